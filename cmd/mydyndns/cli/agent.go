@@ -1,16 +1,40 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	"github.com/TylerHendrickson/mydyndns/internal"
+	"github.com/TylerHendrickson/mydyndns/internal/pidfile"
+	"github.com/TylerHendrickson/mydyndns/internal/remoteconfig"
+	"github.com/TylerHendrickson/mydyndns/internal/sdnotify"
+	"github.com/TylerHendrickson/mydyndns/internal/update"
 	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+	"github.com/TylerHendrickson/mydyndns/pkg/agent/dryrun"
+	"github.com/TylerHendrickson/mydyndns/pkg/health"
+	"github.com/TylerHendrickson/mydyndns/pkg/ipsource"
+	"github.com/TylerHendrickson/mydyndns/pkg/journal"
+	"github.com/TylerHendrickson/mydyndns/pkg/metrics"
+	"github.com/TylerHendrickson/mydyndns/pkg/notify/email"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+	"github.com/TylerHendrickson/mydyndns/pkg/webhook"
 )
 
 func newAgentCmd() *cobra.Command {
@@ -22,7 +46,7 @@ func newAgentCmd() *cobra.Command {
 }
 
 func newAgentStartCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Starts the agent (as a long-running process)",
 		Long: strings.TrimSpace(`
@@ -30,18 +54,621 @@ starts a long-running agent process that periodically polls for the external-fac
 by querying a configured remote instance of the mydyndns API service. When a change in the external-facing IP address
 is detected, the remote service is notified so that associated DNS records are updated to point to the new IP.`),
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			return firstValidationError(cmd, validateAPIKey, validateBaseURL, validatePollInterval)
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, validatePollInterval,
+				validateExtraUpdateURLs, validateChangeThreshold, validateHistorySize, validateUpdateCooldown,
+				validatePollErrorMaxBackoff, validateMaxConsecutiveErrors, validateLogBackend, validateTTL,
+				validateRecordType, validateStartupDelay, validateRemoteConfigWatch, validateAlertEmail,
+				validateIPSourceURL, validateLogFields, resolveAPIKeySecret)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			logger := internal.ConfigureLogger(
-				viper.GetBool("log-json"),
-				viper.GetInt("log-verbosity"),
-				cmd.ErrOrStderr())
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
 
-			ctx, stop := signal.NotifyContext(cmd.Context(),
-				syscall.SIGHUP, syscall.SIGINT, os.Interrupt)
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 			defer stop()
-			return agent.Run(ctx, logger, apiClient, viper.GetDuration("interval"))
+
+			if pidFile := viper.GetString("pid-file"); pidFile != "" {
+				if err := pidfile.Write(pidFile); err != nil {
+					return fmt.Errorf("unable to write PID file: %w", err)
+				}
+				defer func() {
+					if err := pidfile.Remove(pidFile); err != nil {
+						level.Error(logger).Log("msg", "Error removing PID file", "error", err)
+					}
+				}()
+			}
+
+			options := agent.RunOptions{
+				PollInterval: viper.GetDuration("interval"),
+				RetryPolicy: agent.RetryPolicy{
+					MaxAttempts: viper.GetInt("retry-max-attempts"),
+					BaseDelay:   viper.GetDuration("retry-base-delay"),
+					Multiplier:  defaultRetryMultiplier,
+					MaxDelay:    viper.GetDuration("retry-max-delay"),
+					Jitter:      defaultRetryJitter,
+				},
+				Once:                 viper.GetBool("once"),
+				ChangeThreshold:      viper.GetInt("change-threshold"),
+				HistorySize:          viper.GetInt("history-size"),
+				UpdateCooldown:       viper.GetDuration("update-cooldown"),
+				BackoffOnPollError:   viper.GetBool("backoff-on-poll-error"),
+				PollErrorMaxBackoff:  viper.GetDuration("poll-error-max-backoff"),
+				MaxConsecutiveErrors: viper.GetInt("max-consecutive-errors"),
+				PollIntervalUpdates:  reloadPollIntervalOnHangup(ctx, cmd, logger),
+				StartupDelay:         viper.GetDuration("startup-delay"),
+				AgentVersion:         Version,
+			}
+			if viper.GetBool("config-remote-watch") {
+				stopWatching := watchRemoteConfig(ctx, logger, remoteconfig.NewRemoteProvider(
+					viper.GetString(remoteProviderSettingKey), viper.GetString(remoteEndpointSettingKey),
+					viper.GetString(remotePathSettingKey)))
+				defer stopWatching()
+			}
+			if addr := viper.GetString("metrics-addr"); addr != "" {
+				m := metrics.New()
+				stopMetrics, err := serveInBackground(ctx, logger, "metrics", addr, m.Serve)
+				if err != nil {
+					return err
+				}
+				defer stopMetrics()
+				options.Metrics = m
+			}
+			if addr := viper.GetString("health-addr"); addr != "" {
+				options.StateTracker = &agent.StateTracker{}
+				checker := health.New(options.StateTracker.StateSnapshot, options.PollInterval)
+				stopHealth, err := serveInBackground(ctx, logger, "health checks", addr, checker.Serve)
+				if err != nil {
+					return err
+				}
+				defer stopHealth()
+			}
+			if historyFile := viper.GetString("history-file"); historyFile != "" {
+				options.Notifiers = append(options.Notifiers, journal.New(historyFile))
+			}
+			if webhookURL := viper.GetString("on-change-webhook"); webhookURL != "" {
+				options.Notifiers = append(options.Notifiers,
+					webhook.NewNotifier(webhookURL, viper.GetDuration("on-change-webhook-timeout")))
+			}
+			if sourceURL := viper.GetString("ip-source-url"); sourceURL != "" {
+				source, err := newIPSource(sourceURL)
+				if err != nil {
+					return err
+				}
+				options.IPSource = source
+			}
+			if viper.GetBool("sse") {
+				if subscriber, ok := apiClient.(agent.IPSubscriber); ok {
+					options.IPSubscriber = subscriber
+				} else {
+					level.Warn(logger).Log("msg", "API client does not support IP change subscriptions; polling instead",
+						"client", fmt.Sprintf("%T", apiClient))
+				}
+			}
+			var alerts *email.Notifier
+			if alertEmail := viper.GetString("alert-email"); alertEmail != "" {
+				from := viper.GetString("smtp-from")
+				if from == "" {
+					from = alertEmail
+				}
+				alerts = email.NewNotifier(viper.GetString("smtp-host"), viper.GetInt("smtp-port"), from,
+					viper.GetString("smtp-password"), alertEmail, defaultEmailTimeout)
+				options.ChangeHandlers = append(options.ChangeHandlers, alerts)
+			}
+
+			var client agent.Client = apiClient
+			for _, extra := range extraAPIClients {
+				options.ExtraClients = append(options.ExtraClients, extra)
+			}
+			if opts := updateAliasOptions(); opts != (sdk.UpdateAliasOptions{}) {
+				client = optionsClient{APIClient: apiClient, opts: opts}
+				for i, extra := range extraAPIClients {
+					options.ExtraClients[i] = optionsClient{APIClient: extra, opts: opts}
+				}
+			}
+			if viper.GetBool("dry-run") {
+				level.Warn(logger).Log("msg", "Dry run requested; no API requests will be made")
+				client = dryrun.NewClient(logger, nil)
+				// The dry-run client reports a fixed IP address, which any IP source (or subscription) would contradict
+				options.IPSource = nil
+				options.IPSubscriber = nil
+				for i := range options.ExtraClients {
+					options.ExtraClients[i] = dryrun.NewClient(log.With(logger, "extra_target", fmt.Sprint(i+1)), nil)
+				}
+			}
+
+			notifySystemd := viper.GetBool("notify-systemd")
+			if notifySystemd && !sdnotify.Enabled() {
+				level.Warn(logger).Log("msg", "Systemd notification requested, but no notification socket is available",
+					"env", sdnotify.SocketEnvVar)
+				notifySystemd = false
+			}
+			if notifySystemd {
+				var ready sync.Once
+				options.StateHandlers = append(options.StateHandlers, func(s agent.State) {
+					if s.UpdateCount > 0 {
+						ready.Do(func() { sendSystemdNotification(logger, sdnotify.Ready) })
+					}
+				})
+			}
+
+			// Startup tasks run once the initial DNS update succeeds, separately from the agent, since state
+			// handlers are called while the agent's state is locked
+			var (
+				started     sync.Once
+				initialized bool
+				startup     sync.WaitGroup
+			)
+			checkUpdates := viper.GetBool("check-updates")
+			if alerts != nil || checkUpdates {
+				options.StateHandlers = append(options.StateHandlers, func(s agent.State) {
+					if s.UpdateCount == 0 {
+						return
+					}
+					started.Do(func() {
+						initialized = true
+						startup.Add(1)
+						go func() {
+							defer startup.Done()
+							if alerts != nil {
+								sendAlertEmail(logger, "started", func(ctx context.Context) error {
+									return alerts.NotifyStarted(ctx, s.CurrentIP, time.Now())
+								})
+							}
+							if checkUpdates {
+								checkForUpdates(ctx, logger)
+							}
+						}()
+					})
+				})
+			}
+
+			err = agent.RunWithOptions(ctx, logger, client, options)
+			startup.Wait()
+			if alerts != nil && initialized {
+				sendAlertEmail(logger, "stopped", func(ctx context.Context) error {
+					return alerts.NotifyStopped(ctx, time.Now())
+				})
+			}
+			if notifySystemd && err == nil {
+				sendSystemdNotification(logger, sdnotify.Stopping)
+			}
+			return err
 		},
 	}
+
+	cmd.Flags().Bool("once", false,
+		"Exit after a single DNS update instead of running continuously (e.g. for use with cron)")
+	cmd.Flags().String("pid-file", "",
+		"File to which the PID of the agent process is written (and removed from on shutdown)")
+	cmd.Flags().Bool("dry-run", false,
+		"Log the API operations the agent would perform (reporting a fixed IP address) instead of making API requests")
+	cmd.Flags().StringSlice("extra-update-url", nil,
+		"Base URL of an additional mydyndns API whose DNS alias is also updated on each DNS update (repeatable)")
+	cmd.Flags().Int("change-threshold", defaultChangeThreshold,
+		"Number of consecutive polls that must return the same new IP address before DNS records are updated")
+	cmd.Flags().Duration("update-cooldown", 0,
+		"Minimum amount of time between DNS updates, to limit rapid-fire updates (disabled when 0)")
+	cmd.Flags().Bool("notify-systemd", false,
+		"Notify systemd (as a Type=notify service) when the initial DNS update succeeds and when the agent stops")
+	cmd.Flags().Int("history-size", defaultHistorySize,
+		"Number of recently polled IP addresses reported by the health probes (see --health-addr)")
+	cmd.Flags().String("metrics-addr", "",
+		"Address (e.g. \":9090\") on which to serve Prometheus metrics at /metrics (disabled when empty)")
+	cmd.Flags().String("health-addr", "",
+		"Address (e.g. \":8080\") on which to serve liveness (/healthz) and readiness (/readyz) probes (disabled when empty)")
+	cmd.Flags().String("history-file", "",
+		"Journal file to which each DNS update caused by an IP address change is appended (disabled when empty)")
+	cmd.Flags().String("on-change-webhook", "",
+		"URL to which a JSON notification is POSTed after each DNS update caused by an IP address change")
+	cmd.Flags().Duration("on-change-webhook-timeout", defaultWebhookTimeout,
+		"Maximum amount of time to wait for each webhook notification to be delivered")
+	cmd.Flags().String("alert-email", "",
+		"Email address to notify when the agent starts, stops, or updates DNS records after an IP address change")
+	cmd.Flags().String("smtp-host", "",
+		"Host name of the SMTP server through which alert emails are sent (required by --alert-email)")
+	cmd.Flags().Int("smtp-port", defaultSMTPPort,
+		"Port of the SMTP server through which alert emails are sent")
+	cmd.Flags().String("smtp-from", "",
+		"Sender address of alert emails, which authenticates with the SMTP server (defaults to --alert-email)")
+	cmd.Flags().String("smtp-password", "",
+		"Password with which the sender of alert emails authenticates with the SMTP server (no authentication when empty)")
+	cmd.Flags().String("ip-source-url", "",
+		"URL of a plain-text service (e.g. https://api.ipify.org) polled for the external-facing IP instead of the API "+
+			"(DNS records are still updated by the API)")
+	cmd.Flags().Bool("sse", false,
+		"Receive IP address changes pushed by the API as server-sent events instead of polling "+
+			"(polling resumes if the API does not support them)")
+	cmd.Flags().String("ip-version", "any",
+		"Required IP version (4, 6, or any) of addresses managed by the agent")
+	cmd.Flags().Bool("backoff-on-poll-error", false,
+		"Double the delay between polls after each consecutive failed poll (until a poll succeeds)")
+	cmd.Flags().Duration("poll-error-max-backoff", defaultPollMaxBackoff,
+		"Maximum delay between polls when backing off after poll errors (see --backoff-on-poll-error)")
+	cmd.Flags().Int("max-consecutive-errors", 0,
+		"Stop the agent (with an error) after this many polls or DNS updates in a row have failed (disabled when 0)")
+	cmd.Flags().Int("retry-max-attempts", defaultRetryMaxAttempts,
+		"Maximum number of attempts for each DNS update before waiting for the next poll")
+	cmd.Flags().Duration("retry-base-delay", defaultRetryBaseDelay,
+		"How long to wait before the first DNS update retry (grows exponentially with each retry)")
+	cmd.Flags().Duration("retry-max-delay", defaultRetryMaxDelay,
+		"Maximum amount of time to wait between DNS update retries")
+	cmd.Flags().Bool("config-remote-watch", false,
+		"Reload the configuration whenever the config file set by --config-remote-path changes")
+	cmd.Flags().Duration("startup-delay", 0,
+		"How long to wait (e.g. for network interfaces to come up) until the initial DNS update")
+	cmd.Flags().Int("ttl", 0,
+		"TTL (in seconds) requested for DNS records updated by the agent (the API's default is used when 0)")
+	cmd.Flags().String("record-type", "",
+		"Type of DNS record updated by the agent (A, AAAA, or auto to match the IP version of the external-facing IP)")
+	cmd.Flags().StringArray("log-field", nil,
+		"Custom field (as KEY=VALUE, e.g. env=prod) added to every log line (repeatable)")
+	cmd.Flags().String("log-backend", logBackendGoKit,
+		"Logging implementation used by the agent (go-kit or slog)")
+	cmd.Flags().Bool("check-updates", false,
+		"Check GitHub for a newer mydyndns release once the agent has started, and log a warning if one is available")
+
+	return cmd
+}
+
+// newIPSource returns an IP source that polls sourceURL for the external-facing IP address. Requests are made with
+// the same timeout, proxy, and TLS settings as API requests.
+func newIPSource(sourceURL string) (*ipsource.HTTPIPSource, error) {
+	source := ipsource.NewHTTPIPSource(sourceURL, viper.GetDuration("api-timeout"))
+	t, err := apiClientTransport()
+	if err != nil || t == nil {
+		return source, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(t.ProxyURL)
+	}
+	if t.TLSConfig != nil {
+		transport.TLSClientConfig = t.TLSConfig.Clone()
+	}
+	source.HTTPClient.Transport = transport
+	return source, nil
+}
+
+// sendAlertEmail sends the alert email about the given event with send, logging any failure to deliver it.
+// Alert emails are sent independently of the agent's Context, so that they are delivered during shutdown.
+func sendAlertEmail(logger log.Logger, event string, send func(context.Context) error) {
+	if err := send(context.Background()); err != nil {
+		level.Error(logger).Log("msg", "Error sending alert email", "event", event, "error", err)
+		return
+	}
+	level.Debug(logger).Log("msg", "Sent alert email", "event", event)
+}
+
+// checkLatestVersion reports the latest mydyndns release, and whether it is newer than currentVersion.
+var checkLatestVersion = update.CheckLatestVersion
+
+// checkForUpdates logs a warning (with upgrade instructions) when a newer mydyndns release than Version is available.
+// Failed checks are logged, but do not otherwise affect the agent.
+func checkForUpdates(ctx context.Context, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	latest, newer, err := checkLatestVersion(ctx, Version)
+	switch {
+	case err != nil:
+		level.Warn(logger).Log("msg", "Unable to check for a newer mydyndns release", "error", err)
+	case newer:
+		level.Warn(logger).Log("msg", "A newer mydyndns release is available", "version", Version,
+			"latest_version", latest, "upgrade", fmt.Sprintf(
+				"download it from %s/tag/%s or run: go install github.com/TylerHendrickson/mydyndns/cmd/mydyndns@latest",
+				releasesURL, latest))
+	default:
+		level.Debug(logger).Log("msg", "No newer mydyndns release is available", "version", Version,
+			"latest_version", latest)
+	}
+}
+
+// sendSystemdNotification sends state to systemd, logging (rather than returning) any error.
+func sendSystemdNotification(logger log.Logger, state string) {
+	if err := sdnotify.Notify(state); err != nil {
+		level.Error(logger).Log("msg", "Error notifying systemd", "state", state, "error", err)
+		return
+	}
+	level.Debug(logger).Log("msg", "Notified systemd", "state", state)
+}
+
+// reloadPollIntervalOnHangup re-reads the effective configuration whenever the process receives SIGHUP,
+// and sends the reloaded poll interval to the returned channel. Reloaded configurations that fail validation
+// are logged and otherwise ignored. Signals are no longer handled once ctx is done.
+func reloadPollIntervalOnHangup(ctx context.Context, cmd *cobra.Command, logger log.Logger) <-chan time.Duration {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	intervals := make(chan time.Duration)
+
+	go func() {
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-hangups:
+				level.Info(logger).Log("msg", "Reloading configuration", "signal", "SIGHUP")
+				if err := bootstrapConfig(cmd); err != nil {
+					keyvals := []interface{}{"msg", "Error reloading configuration", "error", err}
+					var loadErr ConfigLoadError
+					if errors.As(err, &loadErr) {
+						keyvals = append(keyvals, "path", loadErr.Path, "phase", loadErr.Phase)
+					}
+					level.Error(logger).Log(keyvals...)
+					continue
+				}
+				if err := validatePollInterval(cmd); err != nil {
+					level.Error(logger).Log("msg", "Error reloading configuration", "error", err)
+					continue
+				}
+				select {
+				case intervals <- viper.GetDuration("interval"):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return intervals
+}
+
+// watchRemoteConfig watches the remote config file of rp in the background, and signals each change to the process
+// as a SIGHUP, which causes the configuration to be reloaded (see reloadPollIntervalOnHangup). Failures to check for
+// changes are logged and retried after the poll interval of the remote config backend. Watching stops once ctx is
+// done, or when the returned function is called (which waits for watching to stop).
+func watchRemoteConfig(ctx context.Context, logger log.Logger, rp viper.RemoteProvider) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proc, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			level.Error(logger).Log("msg", "Unable to watch remote config", "error", err)
+			return
+		}
+		responses, quit := remoteConfig.WatchChannel(rp)
+		for {
+			select {
+			case <-ctx.Done():
+				quit <- true
+				return
+			case resp := <-responses:
+				if resp.Error != nil {
+					level.Error(logger).Log("msg", "Error watching remote config", "error", resp.Error)
+					continue
+				}
+				level.Info(logger).Log("msg", "Remote config changed", "path", rp.Path())
+				if err := proc.Signal(syscall.SIGHUP); err != nil {
+					level.Error(logger).Log("msg", "Error signaling remote config change", "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func newAgentStopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stops a running agent",
+		Long: strings.TrimSpace(`
+stops a running agent process by sending it a SIGTERM signal, then waits for the process to exit. The agent process
+is identified by the PID recorded in the PID file configured by the pid-file directive, which must match the
+PID file used when starting the agent.`),
+		Example: strings.TrimSpace(`
+mydyndns agent start --pid-file=/var/run/mydyndns.pid &
+mydyndns agent stop --pid-file=/var/run/mydyndns.pid`),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetString("pid-file") == "" {
+				return fmt.Errorf("missing PID file directive")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pidFile := viper.GetString("pid-file")
+			pid, err := pidfile.Read(pidFile)
+			if err != nil {
+				return fmt.Errorf("unable to read PID file: %w", err)
+			}
+
+			proc, err := os.FindProcess(pid)
+			if err != nil {
+				return err
+			}
+			if err := proc.Signal(syscall.SIGTERM); errors.Is(err, os.ErrProcessDone) {
+				cmd.Printf("Agent (PID %d) is not running\n", pid)
+				return pidfile.Remove(pidFile)
+			} else if err != nil {
+				return fmt.Errorf("unable to signal agent (PID %d): %w", pid, err)
+			}
+
+			timeout := viper.GetDuration("stop-timeout")
+			if err := waitForExit(cmd.Context(), proc, timeout); err != nil {
+				return fmt.Errorf("agent (PID %d) did not stop within %s: %w", pid, timeout, err)
+			}
+			cmd.Printf("Agent (PID %d) stopped\n", pid)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("pid-file", "",
+		"File containing the PID of the running agent process")
+	cmd.Flags().Duration("stop-timeout", defaultStopTimeout,
+		"Maximum amount of time to wait for the agent process to exit")
+
+	return cmd
+}
+
+// agentStatus describes the status of an agent process identified by a PID file.
+type agentStatus struct {
+	Status  string `json:"status"`
+	PIDFile string `json:"pid_file"`
+	PID     int    `json:"pid,omitempty"`
+	// Started, Uptime, and Dir are only known for running agents that recorded them in the PID file
+	Started *time.Time `json:"started,omitempty"`
+	Uptime  string     `json:"uptime,omitempty"`
+	Dir     string     `json:"cwd,omitempty"`
+}
+
+func newAgentStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Reports whether an agent is running",
+		Long: strings.TrimSpace(`
+reports whether the agent process identified by the PID recorded in the PID file configured by the pid-file
+directive is running. The exit status is 0 when the agent is running, 1 when it is not running, and 2 when the
+PID file does not exist.`),
+		Example: strings.TrimSpace(`
+mydyndns agent status --pid-file=/var/run/mydyndns.pid
+mydyndns agent status --pid-file=/var/run/mydyndns.pid --output=json`),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetString("pid-file") == "" {
+				return fmt.Errorf("missing PID file directive")
+			}
+			return validateOutputFormat(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status := agentStatus{PIDFile: viper.GetString("pid-file")}
+			code := agentStatusRunning
+
+			info, err := pidfile.ReadInfo(status.PIDFile)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				status.Status, code = "unknown", agentStatusNoPIDFile
+			case err != nil:
+				return fmt.Errorf("unable to read PID file: %w", err)
+			case !processIsRunning(info.PID):
+				status.Status, status.PID, code = "stopped", info.PID, agentStatusStopped
+			default:
+				status.Status, status.PID, status.Dir = "running", info.PID, info.Dir
+				if !info.Started.IsZero() {
+					status.Started = &info.Started
+					status.Uptime = time.Since(info.Started).Round(time.Second).String()
+				}
+			}
+
+			if err := printAgentStatus(cmd, status); err != nil {
+				return err
+			}
+			if code != agentStatusRunning {
+				// The outcome has already been reported, so only the exit status is relevant
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return ExitError{code: code}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("pid-file", "",
+		"File containing the PID of the agent process")
+
+	return cmd
+}
+
+// printAgentStatus prints s in the output format configured by the output directive.
+func printAgentStatus(cmd *cobra.Command, s agentStatus) error {
+	switch viper.GetString("output") {
+	case outputFormatJSON:
+		out, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+	case outputFormatTable:
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STATUS\tPID\tUPTIME\tCWD")
+		pid := "-"
+		if s.PID > 0 {
+			pid = strconv.Itoa(s.PID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Status, pid, valueOrDash(s.Uptime), valueOrDash(s.Dir))
+		return w.Flush()
+	default:
+		switch s.Status {
+		case "unknown":
+			cmd.Printf("Agent is not running (PID file %s does not exist)\n", s.PIDFile)
+		case "stopped":
+			cmd.Printf("Agent (PID %d) is not running\n", s.PID)
+		default:
+			cmd.Printf("Agent (PID %d) is running", s.PID)
+			if s.Uptime != "" {
+				cmd.Printf(" (uptime %s)", s.Uptime)
+			}
+			if s.Dir != "" {
+				cmd.Printf(" in %s", s.Dir)
+			}
+			cmd.Println()
+		}
+	}
+	return nil
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// processIsRunning reports whether the process identified by pid is running.
+func processIsRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signaling a process owned by another user is not permitted, but indicates that the process exists
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// waitForExit polls proc until it has exited, returning an error if it is still running after timeout
+// or when ctx is done.
+func waitForExit(ctx context.Context, proc *os.Process, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(stopPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := proc.Signal(syscall.Signal(0)); errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveInBackground listens on the TCP network address addr and calls serve (which describes what is served)
+// in the background until ctx is done. The returned function stops the server and waits for it to shut down.
+func serveInBackground(ctx context.Context, logger log.Logger, what, addr string,
+	serve func(context.Context, net.Listener) error) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		level.Info(logger).Log("msg", "Serving "+what, "addr", ln.Addr().String())
+		if err := serve(ctx, ln); err != nil {
+			level.Error(logger).Log("msg", "Error serving "+what, "error", err)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}, nil
 }
@@ -1,17 +1,38 @@
 package cli
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/internal/pidfile"
+	"github.com/TylerHendrickson/mydyndns/pkg/agent/dryrun"
+	"github.com/TylerHendrickson/mydyndns/pkg/journal"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
 )
 
 func logLine2JSON(t *testing.T, lines []string, lineNo int) map[string]string {
@@ -28,7 +49,7 @@ func TestAgentStart(t *testing.T) {
 		name                   string
 		prepareContext         func() (context.Context, context.CancelFunc)
 		expectedShutdownReason error
-		prepareClient          func() *mockClient
+		prepareClient          func() *sdktest.MockClient
 		expectedCmdError       error
 	}{
 		{
@@ -37,9 +58,9 @@ func TestAgentStart(t *testing.T) {
 				return context.WithTimeout(context.Background(), time.Millisecond)
 			},
 			context.DeadlineExceeded,
-			func() *mockClient {
-				client := new(mockClient)
-				client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil)
+			func() *sdktest.MockClient {
+				client := new(sdktest.MockClient)
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4"))
 				return client
 			},
 			nil,
@@ -52,8 +73,8 @@ func TestAgentStart(t *testing.T) {
 				return ctx, cancel
 			},
 			context.Canceled,
-			func() *mockClient {
-				client := new(mockClient)
+			func() *sdktest.MockClient {
+				client := new(sdktest.MockClient)
 				client.On("UpdateAliasWithContext").Return(nil, context.Canceled)
 				return client
 			},
@@ -67,8 +88,8 @@ func TestAgentStart(t *testing.T) {
 				return ctx, cancel
 			},
 			context.Canceled,
-			func() *mockClient {
-				client := new(mockClient)
+			func() *sdktest.MockClient {
+				client := new(sdktest.MockClient)
 				client.On("UpdateAliasWithContext").Return(net.ParseIP("2.3.4.5"), nil)
 				return client
 			},
@@ -76,6 +97,7 @@ func TestAgentStart(t *testing.T) {
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
 			cmd := newCLI()
 			client := tt.prepareClient()
 			patchBootstrappedAPIClient(client, cmd)
@@ -116,6 +138,15 @@ func TestAgentStart(t *testing.T) {
 					record := logLine2JSON(t, lines, 1)
 					assert.Equal(t, "Initializing agent...", record["msg"])
 				})
+				if tt.expectedCmdError == nil {
+					t.Run("line_2", func(t *testing.T) {
+						record := logLine2JSON(t, lines, 2)
+						assert.Equal(t, "Initialized with IP address after DNS update", record["msg"])
+						assert.Equal(t, Version, record["version"])
+						assert.NotEmpty(t, record["ip"])
+						assert.Equal(t, "4", record["ip_version"])
+					})
+				}
 			})
 
 			t.Run("log_shutdown", func(t *testing.T) {
@@ -140,3 +171,1286 @@ func TestAgentStart(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentStartOnce(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		rvIP        net.IP
+		rvErr       error
+		expectedErr error
+	}{
+		{"success", net.ParseIP("1.2.3.4"), nil, nil},
+		{"failure", nil, fmt.Errorf("alias update error"), fmt.Errorf("failed to start agent: alias update error")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("UpdateAliasWithContext").Return(tt.rvIP, tt.rvErr).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, out, err := ExecuteC(cmd, "agent", "start",
+				"--api-key=asdfjkl", "--api-url=https://example.com", "--once", "-v")
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != nil {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+				assert.NotContains(t, out, "Initialized with IP address after DNS update")
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, out,
+					`msg="Initialized with IP address after DNS update" ip=1.2.3.4 ip_version=4 version=`+Version)
+			}
+			client.AssertExpectations(t)
+			client.AssertNotCalled(t, "MyIPWithContext")
+		})
+	}
+}
+
+// newSubjectRecordingSMTPServer starts a bare SMTP server that accepts any number of sessions, and sends the
+// subject of each email it receives to the returned channel. It returns the address on which the server listens.
+func newSubjectRecordingSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	subjects := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			conn.Write([]byte("220 localhost ESMTP test\r\n"))
+			for inData := false; ; {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				switch {
+				case inData && line == ".\r\n":
+					inData = false
+					conn.Write([]byte("250 OK\r\n"))
+				case inData && strings.HasPrefix(line, "Subject: "):
+					subjects <- strings.TrimSpace(strings.TrimPrefix(line, "Subject: "))
+				case inData:
+				case strings.HasPrefix(line, "DATA"):
+					inData = true
+					conn.Write([]byte("354 Go ahead\r\n"))
+				case strings.HasPrefix(line, "QUIT"):
+					conn.Write([]byte("221 Bye\r\n"))
+				default:
+					conn.Write([]byte("250 OK\r\n"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), subjects
+}
+
+func TestAgentStartAlertEmail(t *testing.T) {
+	t.Run("started and stopped", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		addr, subjects := newSubjectRecordingSMTPServer(t)
+		host, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+			"--once", "-v", "--alert-email=admin@example.com", "--smtp-host="+host, "--smtp-port="+port)
+		require.NoError(t, err)
+		assert.NotContains(t, out, "Error sending alert email")
+		for _, expected := range []string{"mydyndns: agent started", "mydyndns: agent stopped"} {
+			select {
+			case subject := <-subjects:
+				assert.Equal(t, expected, subject)
+			case <-time.After(time.Second):
+				t.Fatalf("no email received with subject %q", expected)
+			}
+		}
+	})
+
+	t.Run("delivery failure is logged", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+			"--once", "--alert-email=admin@example.com", "--smtp-host=127.0.0.1", "--smtp-port="+port)
+		require.NoError(t, err, "failed alert emails should not stop the agent")
+		assert.Contains(t, out, `msg="Error sending alert email" event=started`)
+		assert.Contains(t, out, `msg="Error sending alert email" event=stopped`)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{"missing SMTP host", []string{"--alert-email=admin@example.com"},
+			"missing SMTP host directive (required by alert-email)"},
+		{"invalid alert email", []string{"--alert-email=admin", "--smtp-host=localhost"},
+			`invalid alert-email address "admin": mail: missing '@' or angle-addr`},
+		{"invalid sender", []string{"--alert-email=admin@example.com", "--smtp-host=localhost", "--smtp-from=@"},
+			`invalid smtp-from address "@": mail: missing word in phrase: mail: invalid string`},
+		{"invalid SMTP port", []string{"--alert-email=admin@example.com", "--smtp-host=localhost", "--smtp-port=0"},
+			"invalid SMTP port 0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			patchBootstrappedAPIClient(client, cmd)
+			args := append([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"},
+				tt.args...)
+			_, _, err := ExecuteC(cmd, args...)
+			assert.EqualError(t, err, tt.expectedErr)
+			client.AssertNotCalled(t, "UpdateAliasWithContext")
+		})
+	}
+}
+
+func TestAgentStartChangeThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		threshold   string
+		expectedErr string
+	}{
+		{"default", "", ""},
+		{"custom", "--change-threshold=3", ""},
+		{"zero", "--change-threshold=0", "change threshold must be at least 1 (received 0)"},
+		{"negative", "--change-threshold=-2", "change threshold must be at least 1 (received -2)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := []string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"}
+			if tt.threshold != "" {
+				args = append(args, tt.threshold)
+			}
+			cmd, _, err := ExecuteC(cmd, args...)
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAgentStartLogBackend(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		backend     string
+		expectedErr string
+	}{
+		{"default", "", ""},
+		{"go-kit", "--log-backend=go-kit", ""},
+		{"slog", "--log-backend=slog", ""},
+		{"unsupported", "--log-backend=zap", `unsupported log backend "zap" (must be one of: go-kit, slog)`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := []string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+				"--log-json", "-vv"}
+			if tt.backend != "" {
+				args = append(args, tt.backend)
+			}
+			cmd, output, err := ExecuteC(cmd, args...)
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			client.AssertExpectations(t)
+
+			lines := strings.Split(strings.TrimSpace(output), "\n")
+			require.NotEmpty(t, lines)
+			var levels []string
+			for _, line := range lines {
+				logData := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(line), &logData), "invalid log line: %q", line)
+				assert.Contains(t, logData, "ts")
+				assert.Contains(t, logData, "caller")
+				levels = append(levels, fmt.Sprint(logData["level"]))
+			}
+			assert.Contains(t, levels, "debug")
+			assert.Contains(t, levels, "info")
+		})
+	}
+}
+
+func TestAgentStartTTL(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.On("UpdateAliasWithOptionsAndContext", sdk.UpdateAliasOptions{TTL: 60}).
+		Return(net.ParseIP("1.2.3.4"), nil).Once()
+	patchBootstrappedAPIClient(client, cmd)
+
+	_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+		"--ttl=60")
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "UpdateAliasWithContext")
+}
+
+func TestAgentStartRecordType(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.On("UpdateAliasWithOptionsAndContext", sdk.UpdateAliasOptions{TTL: 60, RecordType: sdk.RecordTypeAAAA}).
+		Return(net.ParseIP("2001:db8::1"), nil).Once()
+	patchBootstrappedAPIClient(client, cmd)
+
+	_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+		"--ttl=60", "--record-type=AAAA")
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "UpdateAliasWithContext")
+}
+
+func TestAgentStartCheckUpdates(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		args            []string
+		latest          string
+		newer           bool
+		err             error
+		expectedCheck   bool
+		expectedMessage string
+	}{
+		{"disabled by default", nil, "v9.9.9", true, nil, false, ""},
+		{"newer release", []string{"--check-updates"}, "v9.9.9", true, nil, true,
+			"A newer mydyndns release is available"},
+		{"up to date", []string{"--check-updates"}, "v0.0.1", false, nil, true, ""},
+		{"failed check", []string{"--check-updates"}, "", false, fmt.Errorf("connection refused"), true,
+			"Unable to check for a newer mydyndns release"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			checked := false
+			original := checkLatestVersion
+			t.Cleanup(func() { checkLatestVersion = original })
+			checkLatestVersion = func(ctx context.Context, currentVersion string) (string, bool, error) {
+				checked = true
+				assert.Equal(t, Version, currentVersion)
+				_, hasDeadline := ctx.Deadline()
+				assert.True(t, hasDeadline, "update checks should time out")
+				return tt.latest, tt.newer, tt.err
+			}
+
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := append([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"},
+				tt.args...)
+			_, out, err := ExecuteC(cmd, args...)
+			require.NoError(t, err, "update checks should not affect the agent")
+			assert.Equal(t, tt.expectedCheck, checked)
+			if tt.expectedMessage != "" {
+				assert.Contains(t, out, tt.expectedMessage)
+			} else {
+				assert.NotContains(t, out, "mydyndns release")
+			}
+			if tt.newer && tt.expectedCheck {
+				assert.Contains(t, out, "latest_version="+tt.latest)
+				assert.Contains(t, out, releasesURL+"/tag/"+tt.latest)
+			}
+		})
+	}
+}
+
+func TestAgentStartStartupDelay(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		delay       string
+		expectedErr string
+	}{
+		{"default", "", ""},
+		{"custom", "--startup-delay=10ms", ""},
+		{"negative", "--startup-delay=-1s", "startup delay cannot be negative (received -1s)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := []string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"}
+			if tt.delay != "" {
+				args = append(args, tt.delay)
+			}
+			_, _, err := ExecuteC(cmd, args...)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			client.AssertExpectations(t)
+		})
+	}
+
+	t.Run("shutdown during delay", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+			"--startup-delay=1h"})
+		_, err := cmd.ExecuteContextC(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), `msg="Shutdown requested during startup delay"`)
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+	})
+}
+
+func TestAgentStartHistoryFile(t *testing.T) {
+	cmd, _, err := newCLI().Find([]string{"agent", "start"})
+	require.NoError(t, err)
+	assert.Empty(t, cmd.Flags().Lookup("history-file").DefValue, "the agent should not journal changes by default")
+
+	cmd, _, err = newCLI().Find([]string{"api", "history"})
+	require.NoError(t, err)
+	assert.Equal(t, journal.DefaultPath, cmd.Flags().Lookup("history-file").DefValue)
+}
+
+func TestAgentStartHistorySize(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		size        string
+		expectedErr string
+	}{
+		{"default", "", ""},
+		{"custom", "--history-size=3", ""},
+		{"disabled", "--history-size=0", ""},
+		{"negative", "--history-size=-2", "history size cannot be negative (received -2)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := []string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"}
+			if tt.size != "" {
+				args = append(args, tt.size)
+			}
+			cmd, _, err := ExecuteC(cmd, args...)
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAgentStartUpdateCooldown(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		cooldown    string
+		expectedErr string
+	}{
+		{"default", "", ""},
+		{"custom", "--update-cooldown=5m", ""},
+		{"negative", "--update-cooldown=-1m", "update cooldown cannot be negative (received -1m0s)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := []string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"}
+			if tt.cooldown != "" {
+				args = append(args, tt.cooldown)
+			}
+			cmd, _, err := ExecuteC(cmd, args...)
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAgentStartPollErrorBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{"default", nil, ""},
+		{"enabled", []string{"--backoff-on-poll-error", "--poll-error-max-backoff=30m"}, ""},
+		{"negative max backoff", []string{"--backoff-on-poll-error", "--poll-error-max-backoff=-1m"},
+			"poll error max backoff cannot be negative (received -1m0s)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			if tt.expectedErr == "" {
+				client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			}
+			patchBootstrappedAPIClient(client, cmd)
+
+			args := append([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once"},
+				tt.args...)
+			cmd, _, err := ExecuteC(cmd, args...)
+			require.Equal(t, "start", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAgentStartMaxConsecutiveErrors(t *testing.T) {
+	t.Run("stops after too many errors", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		// Allow a poll interval short enough for the test
+		originalMinimum := minimumPollInterval
+		minimumPollInterval = time.Millisecond
+		t.Cleanup(func() { minimumPollInterval = originalMinimum })
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+		client.On("MyIPWithContext").Return(nil, fmt.Errorf("poll error"))
+		patchBootstrappedAPIClient(client, cmd)
+
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+				"--interval=10ms", "--max-consecutive-errors=2")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.EqualError(t, err, "too many consecutive errors (2 failed polls in a row): poll error")
+		case <-time.After(5 * time.Second):
+			t.Fatal("agent did not stop after too many consecutive errors")
+		}
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+		_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+			"--once", "--max-consecutive-errors=-1")
+		assert.EqualError(t, err, "max consecutive errors cannot be negative (received -1)")
+	})
+}
+
+func TestAgentStartExtraUpdateURL(t *testing.T) {
+	var requests [2]atomic.Int32
+	var extraURLs []string
+	for i := range requests {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests[i].Add(1)
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/dns-value", r.URL.Path)
+			assert.Equal(t, "asdfjkl", r.Header.Get("x-api-key"), "extra targets should use the same API key")
+			w.Write([]byte("1.2.3.4"))
+		}))
+		t.Cleanup(server.Close)
+		extraURLs = append(extraURLs, server.URL)
+	}
+
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+	patchBootstrappedAPIClient(client, cmd)
+
+	cmd, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+		"--api-tls-skip-verify", "--once",
+		"--extra-update-url", extraURLs[0], "--extra-update-url", extraURLs[1])
+	require.Equal(t, "start", cmd.Name())
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Equal(t, []int32{1, 1}, []int32{requests[0].Load(), requests[1].Load()},
+		"each extra target should be updated")
+
+	t.Run("non-SSL URL", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+			"--extra-update-url=https://ok.example.com", "--extra-update-url=http://insecure.example.com")
+		assert.EqualError(t, err, `SSL is required for extra update URL (received "http://insecure.example.com")`)
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+	})
+
+	t.Run("clients do not share a transport", func(t *testing.T) {
+		var primaryRequests atomic.Int32
+		primary := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			primaryRequests.Add(1)
+			w.Write([]byte("1.2.3.4"))
+		}))
+		t.Cleanup(primary.Close)
+		requests[0].Store(0)
+		requests[1].Store(0)
+
+		// The primary client is not mocked, so that (when run with -race) concurrent updates exercise every transport
+		t.Cleanup(viper.Reset)
+		_, _, err := ExecuteC(newCLI(), "agent", "start", "--api-key=asdfjkl", "--api-url", primary.URL,
+			"--api-tls-skip-verify", "--once",
+			"--extra-update-url", extraURLs[0], "--extra-update-url", extraURLs[1])
+		require.NoError(t, err)
+		assert.Equal(t, []int32{1, 1, 1},
+			[]int32{primaryRequests.Load(), requests[0].Load(), requests[1].Load()})
+
+		require.Len(t, extraAPIClients, 2)
+		transports := []http.RoundTripper{apiClient.(*sdk.Client).HTTPClient.Transport}
+		for _, extra := range extraAPIClients {
+			transports = append(transports, extra.(*sdk.Client).HTTPClient.Transport)
+		}
+		for i := range transports {
+			for j := range transports[:i] {
+				assert.NotSame(t, transports[j], transports[i], "clients %d and %d share a transport", j, i)
+				assert.NotSame(t, transports[j].(*http.Transport).TLSClientConfig,
+					transports[i].(*http.Transport).TLSClientConfig, "clients %d and %d share a TLS config", j, i)
+			}
+		}
+	})
+}
+
+func TestAgentStartIPSourceURL(t *testing.T) {
+	var sourceRequests atomic.Int32
+	source := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourceRequests.Add(1)
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Empty(t, r.Header.Get("x-api-key"), "the API key should not be sent to the IP source")
+		w.Write([]byte("9.8.7.6\n"))
+	}))
+	t.Cleanup(source.Close)
+
+	t.Cleanup(viper.Reset)
+	// Allow a poll interval short enough for the test
+	originalMinimum := minimumPollInterval
+	minimumPollInterval = time.Millisecond
+	t.Cleanup(func() { minimumPollInterval = originalMinimum })
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+	updated := make(chan struct{})
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("9.8.7.6")).Once().Run(
+		func(mock.Arguments) { close(updated) })
+	patchBootstrappedAPIClient(client, cmd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-updated:
+		case <-time.After(5 * time.Second):
+			t.Error("DNS records were not updated after the IP source reported a new IP address")
+		}
+		cancel()
+	}()
+	cmd, _, err := ExecuteContextC(ctx, cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+		"--api-tls-skip-verify", "--interval=10ms", "--ip-source-url="+source.URL)
+	require.Equal(t, "start", cmd.Name())
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "MyIPWithContext")
+	assert.Positive(t, sourceRequests.Load())
+
+	t.Run("non-SSL URL", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+			"--ip-source-url=http://api.ipify.org")
+		assert.EqualError(t, err, `SSL is required for IP source URL (received "http://api.ipify.org")`)
+		assert.Equal(t, validationCodeInsecureIPSourceURL, validationErrorCode(err))
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+	})
+}
+
+func TestAgentStartLogField(t *testing.T) {
+	for _, backend := range []string{logBackendGoKit, logBackendSlog} {
+		t.Run(backend, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, output, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+				"--once", "--log-json", "-vv", "--log-backend="+backend, "--log-field=service=mydyndns",
+				"--log-field", "region=us-west-2,us-east-1", "--log-field=empty=")
+			require.Equal(t, "start", cmd.Name())
+			require.NoError(t, err)
+			client.AssertExpectations(t)
+
+			levels := map[string]bool{}
+			for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+				logData := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(line), &logData), "invalid log line: %q", line)
+				assert.Equal(t, "mydyndns", logData["service"], "missing custom field in %q", line)
+				assert.Equal(t, "us-west-2,us-east-1", logData["region"], "missing custom field in %q", line)
+				assert.Equal(t, "", logData["empty"], "missing custom field in %q", line)
+				levels[fmt.Sprint(logData["level"])] = true
+			}
+			assert.True(t, levels["debug"] && levels["info"] && levels["warn"],
+				"expected custom fields to be checked at every level (checked %v)", levels)
+		})
+	}
+
+	for _, tt := range []struct {
+		name        string
+		field       string
+		expectedErr string
+	}{
+		{"missing value", "--log-field=service", `invalid log field "service" (must be KEY=VALUE)`},
+		{"empty key", "--log-field==mydyndns", "log field keys cannot be empty"},
+		{"reserved key", "--log-field=msg=hello", `log field key "msg" is reserved`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			patchBootstrappedAPIClient(client, cmd)
+
+			_, _, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+				"--once", tt.field)
+			assert.EqualError(t, err, tt.expectedErr)
+			assert.Equal(t, validationCodeInvalidLogField, validationErrorCode(err))
+			client.AssertNotCalled(t, "UpdateAliasWithContext")
+		})
+	}
+}
+
+func TestAgentStartSSE(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+	updated := make(chan struct{})
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("9.8.7.6")).Once().Run(
+		func(mock.Arguments) { close(updated) })
+	client.PushIPs(net.ParseIP("9.8.7.6")).Once()
+	var bootstrapped APIClient
+	originalPersistentPreRunE := cmd.PersistentPreRunE
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		defer func() { bootstrapped, apiClient = apiClient, client }()
+		return originalPersistentPreRunE(cmd, args)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-updated:
+		case <-time.After(5 * time.Second):
+			t.Error("DNS records were not updated after the API pushed a new IP address")
+		}
+		cancel()
+	}()
+	cmd, _, err := ExecuteContextC(ctx, cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+		"--sse")
+	require.Equal(t, "start", cmd.Name())
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "MyIPWithContext")
+	sdkClient, ok := bootstrapped.(*sdk.Client)
+	require.True(t, ok, "expected bootstrapped API client to be an *sdk.Client")
+	assert.True(t, sdkClient.SSEEnabled, "SSE should be enabled for the bootstrapped API client")
+}
+
+func TestAgentStartSSEUnsupported(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+	// Only the APIClient methods of the mock are promoted, so it cannot be used as an agent.IPSubscriber
+	patchBootstrappedAPIClient(struct{ APIClient }{client}, cmd)
+
+	_, out, err := ExecuteC(cmd, "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+		"--once", "--sse")
+	require.NoError(t, err)
+	assert.Contains(t, out, `level=warn msg="API client does not support IP change subscriptions; polling instead"`)
+	client.AssertExpectations(t)
+}
+
+func TestAgentStartHealthAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+	patchBootstrappedAPIClient(client, cmd)
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+		fmt.Sprintf("--health-addr=%s", addr)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := cmd.ExecuteContextC(ctx)
+		done <- err
+	}()
+
+	get := func(path string) (int, map[string]string) {
+		resp, err := http.Get(fmt.Sprintf("http://%s%s", addr, path))
+		if err != nil {
+			return 0, nil
+		}
+		defer resp.Body.Close()
+		body := map[string]string{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+	require.Eventually(t, func() bool {
+		code, _ := get("/readyz")
+		return code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond, "agent should become ready after its initial DNS update")
+
+	code, body := get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, "1.2.3.4", body["current_ip"])
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "agent did not stop after context cancellation")
+	}
+	_, err = http.Get(fmt.Sprintf("http://%s/healthz", addr))
+	assert.Error(t, err, "health server should be shut down with the agent")
+	client.AssertExpectations(t)
+}
+
+func TestAgentStartDryRun(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	t.Cleanup(viper.Reset)
+	cmd := newCLI()
+	cmd.SetOut(new(bytes.Buffer))
+	stdErr := new(bytes.Buffer)
+	cmd.SetErr(stdErr)
+	cmd.SetArgs([]string{"agent", "start", "--dry-run", "--api-key=asdfjkl", fmt.Sprintf("--api-url=%s", server.URL),
+		"--log-json", "-v"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd, err := cmd.ExecuteContextC(ctx)
+	require.Equal(t, "start", cmd.Name())
+	require.NoError(t, err, "agent should exit cleanly when its context is cancelled")
+	assert.Zero(t, requests.Load(), "no API requests should be made during a dry run")
+
+	lines := strings.Split(strings.TrimSpace(stdErr.String()), "\n")
+	var dryRunOps []string
+	for i := range lines {
+		if record := logLine2JSON(t, lines, i); record["dry_run"] == "true" {
+			dryRunOps = append(dryRunOps, record["op"])
+			assert.Equal(t, "info", record["level"])
+			assert.Equal(t, dryrun.DefaultIP.String(), record["ip"])
+		}
+	}
+	assert.Equal(t, []string{"update-alias"}, dryRunOps)
+	assert.Equal(t, "Dry run requested; no API requests will be made", logLine2JSON(t, lines, 0)["msg"])
+	assert.Equal(t, "Agent stopped", logLine2JSON(t, lines, len(lines)-1)["msg"])
+}
+
+func TestAgentStartNotifySystemd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on windows")
+	}
+	receive := func(t *testing.T, conn net.PacketConn) (string, error) {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		buf := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buf)
+		return string(buf[:n]), err
+	}
+
+	for _, tt := range []struct {
+		name             string
+		rvIP             net.IP
+		rvErr            error
+		expectedMessages []string
+	}{
+		{"initial update succeeds", net.ParseIP("1.2.3.4"), nil, []string{"READY=1", "STOPPING=1"}},
+		{"initial update fails", nil, fmt.Errorf("alias update error"), nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Socket paths are limited to ~100 characters, which t.TempDir() may exceed
+			dir, err := os.MkdirTemp("", "sdnotify")
+			require.NoError(t, err)
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			socket := filepath.Join(dir, "notify.sock")
+			conn, err := net.ListenPacket("unixgram", socket)
+			require.NoError(t, err)
+			defer conn.Close()
+			t.Setenv("NOTIFY_SOCKET", socket)
+
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("UpdateAliasWithContext").Return(tt.rvIP, tt.rvErr).Once()
+			patchBootstrappedAPIClient(client, cmd)
+			cmd, _, err = ExecuteC(cmd, "agent", "start",
+				"--api-key=asdfjkl", "--api-url=https://example.com", "--once", "--notify-systemd")
+			require.Equal(t, "start", cmd.Name())
+			assert.Equal(t, tt.rvErr == nil, err == nil)
+
+			var messages []string
+			for {
+				msg, err := receive(t, conn)
+				if err != nil {
+					break
+				}
+				messages = append(messages, msg)
+			}
+			assert.Equal(t, tt.expectedMessages, messages)
+		})
+	}
+
+	t.Run("no notification socket", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		t.Cleanup(viper.Reset)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+		cmd.SetOut(new(bytes.Buffer))
+		stdErr := new(bytes.Buffer)
+		cmd.SetErr(stdErr)
+		cmd.SetArgs([]string{"agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com", "--once",
+			"--notify-systemd", "--log-json"})
+
+		cmd, err := cmd.ExecuteC()
+		require.Equal(t, "start", cmd.Name())
+		require.NoError(t, err, "agent should run without a notification socket")
+		lines := strings.Split(strings.TrimSpace(stdErr.String()), "\n")
+		record := logLine2JSON(t, lines, 0)
+		assert.Equal(t, "warn", record["level"])
+		assert.Equal(t, "Systemd notification requested, but no notification socket is available", record["msg"])
+		assert.Equal(t, "NOTIFY_SOCKET", record["env"])
+	})
+}
+
+func TestAgentStartReloadsPollIntervalOnSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP cannot be sent on windows")
+	}
+	for _, tt := range []struct {
+		name             string
+		reloadedInterval string
+		expectedLog      map[string]string
+	}{
+		{
+			"interval changed",
+			"30s",
+			map[string]string{"msg": "Poll interval updated", "previous": "1h0m0s", "interval": "30s"},
+		},
+		{
+			"interval unchanged",
+			"1h",
+			map[string]string{"msg": "Poll interval unchanged", "interval": "1h0m0s"},
+		},
+		{
+			"invalid interval",
+			"1s",
+			map[string]string{"msg": "Error reloading configuration",
+				"error": fmt.Sprintf("poll interval cannot be less than %s", minimumPollInterval)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			configFile := writeConfig(t, "mydyndns.toml", map[string]interface{}{
+				"api-key": "asdfjkl", "api-url": "https://example.com", "interval": "1h",
+			})
+			proc, err := os.FindProcess(os.Getpid())
+			require.NoError(t, err)
+
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once().Run(
+				func(mock.Arguments) {
+					v := viper.New()
+					v.Set("api-key", "asdfjkl")
+					v.Set("api-url", "https://example.com")
+					v.Set("interval", tt.reloadedInterval)
+					require.NoError(t, v.WriteConfigAs(configFile))
+					require.NoError(t, proc.Signal(syscall.SIGHUP))
+				})
+			patchBootstrappedAPIClient(client, cmd)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+			defer cancel()
+			cmd, out, err := ExecuteContextC(ctx, cmd, "agent", "start",
+				fmt.Sprintf("--config-file=%s", configFile), "--log-json", "-vv")
+			require.Equal(t, "start", cmd.Name())
+			require.NoError(t, err)
+			client.AssertExpectations(t)
+
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			var reloaded, matched bool
+			for i := range lines {
+				record := logLine2JSON(t, lines, i)
+				if record["msg"] == "Reloading configuration" {
+					reloaded = true
+				}
+				if record["msg"] == tt.expectedLog["msg"] {
+					matched = true
+					for k, v := range tt.expectedLog {
+						assert.Equal(t, v, record[k], "unexpected %q in log record: %s", k, record)
+					}
+				}
+			}
+			assert.True(t, reloaded, "configuration should be reloaded:\n%s", out)
+			assert.True(t, matched, "expected log record was not found:\n%s", out)
+		})
+	}
+}
+
+func TestAgentStartWatchesRemoteConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP cannot be sent on windows")
+	}
+	t.Cleanup(viper.Reset)
+	pollInterval := remoteConfig.PollInterval
+	t.Cleanup(func() { remoteConfig.PollInterval = pollInterval })
+	remoteConfig.PollInterval = time.Millisecond * 10
+
+	server := newEtcdServer(t, map[string]string{
+		"/config/mydyndns.toml": "api-key = \"asdfjkl\"\napi-url = \"https://example.com\"\ninterval = \"1h\"\n",
+	})
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Once().Run(func(mock.Arguments) {
+		server.put("/config/mydyndns.toml",
+			"api-key = \"asdfjkl\"\napi-url = \"https://example.com\"\ninterval = \"30s\"\n")
+	})
+	patchBootstrappedAPIClient(client, cmd)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	_, out, err := ExecuteContextC(ctx, cmd, "agent", "start", "--config-remote-provider=etcd",
+		"--config-remote-endpoint="+server.URL, "--config-remote-path=/config/mydyndns.toml",
+		"--config-remote-watch", "--log-json", "-vv")
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var changed, updated bool
+	for i := range lines {
+		switch record := logLine2JSON(t, lines, i); record["msg"] {
+		case "Remote config changed":
+			changed = true
+		case "Poll interval updated":
+			updated = true
+			assert.Equal(t, "30s", record["interval"])
+		}
+	}
+	assert.True(t, changed, "remote config change should be detected:\n%s", out)
+	assert.True(t, updated, "poll interval should be reloaded from the remote config:\n%s", out)
+
+	t.Run("requires a remote provider", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "agent", "start", "--api-key=asdfjkl", "--api-url=https://example.com",
+			"--config-remote-watch")
+		assert.EqualError(t, err, "config-remote-watch requires the config-remote-provider directive")
+	})
+}
+
+func TestAgentStartPIDFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	pidFile := filepath.Join(t.TempDir(), "mydyndns.pid")
+
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAliasWithContext", net.ParseIP("1.2.3.4")).Run(func(mock.Arguments) {
+		pid, err := pidfile.Read(pidFile)
+		require.NoError(t, err, "PID file should exist while the agent is running")
+		assert.Equal(t, os.Getpid(), pid)
+	})
+	patchBootstrappedAPIClient(client, cmd)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	cmd, _, err := ExecuteContextC(ctx, cmd, "agent", "start",
+		"--api-key=asdfjkl", "--api-url=https://example.com", fmt.Sprintf("--pid-file=%s", pidFile))
+	require.Equal(t, "start", cmd.Name())
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.NoFileExists(t, pidFile, "PID file should be removed after the agent stops")
+}
+
+func TestAgentStop(t *testing.T) {
+	// startProcess starts a long-running child process that is reaped in the background once it exits.
+	startProcess := func(t *testing.T, script string) *os.Process {
+		t.Helper()
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("sh is required to run this test")
+		}
+		c := exec.Command(sh, "-c", script)
+		require.NoError(t, c.Start())
+		go c.Wait()
+		t.Cleanup(func() { c.Process.Kill() })
+		return c.Process
+	}
+	writePIDFile := func(t *testing.T, pid int) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "mydyndns.pid")
+		require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%d\n", pid)), 0o644))
+		return path
+	}
+
+	t.Run("stops running agent", func(t *testing.T) {
+		proc := startProcess(t, "sleep 10")
+		pidFile := writePIDFile(t, proc.Pid)
+
+		cmd, out, err := ExecuteC(newCLI(), "agent", "stop", fmt.Sprintf("--pid-file=%s", pidFile))
+		require.Equal(t, "stop", cmd.Name())
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Agent (PID %d) stopped\n", proc.Pid), out)
+	})
+
+	t.Run("times out when agent does not stop", func(t *testing.T) {
+		proc := startProcess(t, `trap "" TERM; sleep 10 & wait`)
+		pidFile := writePIDFile(t, proc.Pid)
+		// Give the shell a chance to ignore SIGTERM before it is sent
+		time.Sleep(time.Millisecond * 100)
+
+		cmd, _, err := ExecuteC(newCLI(), "agent", "stop",
+			fmt.Sprintf("--pid-file=%s", pidFile), "--stop-timeout=200ms")
+		require.Equal(t, "stop", cmd.Name())
+		assert.EqualError(t, err, fmt.Sprintf(
+			"agent (PID %d) did not stop within 200ms: %s", proc.Pid, context.DeadlineExceeded))
+	})
+
+	t.Run("already stopped agent", func(t *testing.T) {
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("sh is required to run this test")
+		}
+		c := exec.Command(sh, "-c", "exit 0")
+		require.NoError(t, c.Run())
+		pidFile := writePIDFile(t, c.Process.Pid)
+
+		cmd, out, err := ExecuteC(newCLI(), "agent", "stop", fmt.Sprintf("--pid-file=%s", pidFile))
+		require.Equal(t, "stop", cmd.Name())
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Agent (PID %d) is not running\n", c.Process.Pid), out)
+		assert.NoFileExists(t, pidFile, "stale PID file should be removed")
+	})
+
+	t.Run("missing PID file", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "missing.pid")
+		cmd, _, err := ExecuteC(newCLI(), "agent", "stop", fmt.Sprintf("--pid-file=%s", pidFile))
+		require.Equal(t, "stop", cmd.Name())
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		assert.ErrorContains(t, err, "unable to read PID file")
+	})
+
+	t.Run("missing PID file directive", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "agent", "stop")
+		require.Equal(t, "stop", cmd.Name())
+		assert.EqualError(t, err, "missing PID file directive")
+	})
+
+	t.Run("unreadable PID file", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("file permissions are not enforced for root")
+		}
+		pidFile := writePIDFile(t, os.Getpid())
+		require.NoError(t, os.Chmod(pidFile, 0o000))
+
+		cmd, _, err := ExecuteC(newCLI(), "agent", "stop", fmt.Sprintf("--pid-file=%s", pidFile))
+		require.Equal(t, "stop", cmd.Name())
+		assert.ErrorIs(t, err, fs.ErrPermission)
+	})
+
+	t.Run("agent owned by another user", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("signal permissions are not enforced for root")
+		}
+		// PID 1 is owned by root, so it cannot be signaled by an unprivileged user
+		pidFile := writePIDFile(t, 1)
+
+		cmd, _, err := ExecuteC(newCLI(), "agent", "stop", fmt.Sprintf("--pid-file=%s", pidFile))
+		require.Equal(t, "stop", cmd.Name())
+		assert.ErrorIs(t, err, fs.ErrPermission)
+		assert.ErrorContains(t, err, "unable to signal agent (PID 1)")
+	})
+}
+
+func TestAgentStatus(t *testing.T) {
+	pidFileDir := t.TempDir()
+	runningPIDFile := filepath.Join(pidFileDir, "running.pid")
+	require.NoError(t, pidfile.Write(runningPIDFile))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	stoppedPIDFile := filepath.Join(pidFileDir, "stopped.pid")
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to run this test")
+	}
+	c := exec.Command(sh, "-c", "exit 0")
+	require.NoError(t, c.Run())
+	require.NoError(t, os.WriteFile(stoppedPIDFile, []byte(fmt.Sprintf("%d\n", c.Process.Pid)), 0o644))
+
+	missingPIDFile := filepath.Join(pidFileDir, "missing.pid")
+
+	t.Run("text", func(t *testing.T) {
+		for _, tt := range []struct {
+			name, pidFile, expectedOutput string
+			expectedExitCode              int
+		}{
+			{
+				"running",
+				runningPIDFile,
+				fmt.Sprintf(`^Agent \(PID %d\) is running \(uptime \d+s\) in %s\n$`, os.Getpid(), regexp.QuoteMeta(wd)),
+				0,
+			},
+			{
+				"stopped",
+				stoppedPIDFile,
+				fmt.Sprintf(`^Agent \(PID %d\) is not running\n$`, c.Process.Pid),
+				1,
+			},
+			{
+				"missing PID file",
+				missingPIDFile,
+				fmt.Sprintf(`^Agent is not running \(PID file %s does not exist\)\n$`, regexp.QuoteMeta(missingPIDFile)),
+				2,
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				cmd, out, err := ExecuteC(newCLI(), "agent", "status", fmt.Sprintf("--pid-file=%s", tt.pidFile))
+				require.Equal(t, "status", cmd.Name())
+				assert.Equal(t, tt.expectedExitCode, ExitCode(err))
+				assert.Regexp(t, tt.expectedOutput, out, "output should not include errors or usage")
+			})
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		for _, tt := range []struct {
+			name, pidFile    string
+			expectedStatus   string
+			expectedPID      int
+			expectedExitCode int
+		}{
+			{"running", runningPIDFile, "running", os.Getpid(), 0},
+			{"stopped", stoppedPIDFile, "stopped", c.Process.Pid, 1},
+			{"missing PID file", missingPIDFile, "unknown", 0, 2},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				_, out, err := ExecuteC(newCLI(), "agent", "status",
+					fmt.Sprintf("--pid-file=%s", tt.pidFile), "--output=json")
+				assert.Equal(t, tt.expectedExitCode, ExitCode(err))
+
+				var status map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(out), &status))
+				assert.Equal(t, tt.expectedStatus, status["status"])
+				assert.Equal(t, tt.pidFile, status["pid_file"])
+				if tt.expectedPID > 0 {
+					assert.EqualValues(t, tt.expectedPID, status["pid"])
+				} else {
+					assert.NotContains(t, status, "pid")
+				}
+				if tt.expectedStatus == "running" {
+					assert.Equal(t, wd, status["cwd"])
+					assert.Contains(t, status, "uptime")
+					assert.Contains(t, status, "started")
+				} else {
+					assert.NotContains(t, status, "cwd")
+					assert.NotContains(t, status, "uptime")
+				}
+			})
+		}
+	})
+
+	t.Run("invalid PID file", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "invalid.pid")
+		require.NoError(t, os.WriteFile(pidFile, []byte("abc"), 0o644))
+		_, out, err := ExecuteC(newCLI(), "agent", "status", fmt.Sprintf("--pid-file=%s", pidFile))
+		assert.EqualError(t, err, fmt.Sprintf("unable to read PID file: PID file %s does not contain a valid PID", pidFile))
+		assert.Equal(t, ExitAgentError, ExitCode(err))
+		assert.Contains(t, out, "Error: unable to read PID file")
+	})
+
+	t.Run("missing PID file directive", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "agent", "status")
+		require.Equal(t, "status", cmd.Name())
+		assert.EqualError(t, err, "missing PID file directive")
+	})
+}
@@ -1,48 +1,694 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/journal"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
 )
 
 func newAPICmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "api",
 		Short: "mydyndns API client operations",
 	}
+
+	cmd.PersistentFlags().String("ip-version", "any",
+		"Required IP version (4, 6, or any) of addresses reported by the API")
+
+	return cmd
+}
+
+// ipResult describes the outcome of an API operation that reports an IP address.
+type ipResult struct {
+	IP         net.IP    `json:"ip"`
+	PreviousIP net.IP    `json:"previous_ip,omitempty"`
+	Timestamp  time.Time `json:"ts"`
+	// Changed indicates whether the operation changed the DNS alias, when known
+	Changed *bool `json:"changed,omitempty"`
+	// includePrevious indicates whether PreviousIP is relevant to the operation (i.e. shown in table output)
+	includePrevious bool
+	// includeTimestamp indicates whether Timestamp is shown in text output
+	includeTimestamp bool
+}
+
+// ipTemplateData is the data to which the output template of an API operation that reports an IP address is applied.
+type ipTemplateData struct {
+	IP        string
+	Timestamp time.Time
+	// Command is the name of the subcommand that performed the operation, e.g. "my-ip"
+	Command string
+}
+
+// addOutputTemplateFlag adds the --output-template flag to cmd.
+func addOutputTemplateFlag(cmd *cobra.Command) {
+	cmd.Flags().String("output-template", "",
+		"Go template used to format the result (takes precedence over --output), e.g. '{{.Command}}: {{.IP}}'")
+}
+
+// outputTemplate returns the output template configured for cmd by the output-template directive,
+// or nil when none is configured (or cmd does not support output templates).
+func outputTemplate(cmd *cobra.Command) (*template.Template, error) {
+	text := viper.GetString("output-template")
+	if cmd.Flags().Lookup("output-template") == nil || text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("output-template").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// printIPResult prints r in the output format configured by the output directive, unless an output template
+// is configured by the output-template directive, in which case the template is used instead.
+func printIPResult(cmd *cobra.Command, r ipResult) error {
+	tmpl, err := outputTemplate(cmd)
+	if err != nil {
+		return err
+	}
+	if tmpl != nil {
+		// Execute into a buffer so that nothing is printed when execution fails partway through
+		var out strings.Builder
+		data := ipTemplateData{IP: r.IP.String(), Timestamp: r.Timestamp, Command: cmd.Name()}
+		if err := tmpl.Execute(&out, data); err != nil {
+			return fmt.Errorf("unable to execute output template: %w", err)
+		}
+		cmd.Println(out.String())
+		return nil
+	}
+
+	switch viper.GetString("output") {
+	case outputFormatJSON:
+		out, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+	case outputFormatTable:
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		if r.includePrevious {
+			previousIP := "(unknown)"
+			if r.PreviousIP != nil {
+				previousIP = r.PreviousIP.String()
+			}
+			fmt.Fprintln(w, "IP\tPREVIOUS IP\tTIMESTAMP")
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.IP, previousIP, r.Timestamp.Format(time.RFC3339))
+		} else {
+			fmt.Fprintln(w, "IP\tTIMESTAMP")
+			fmt.Fprintf(w, "%s\t%s\n", r.IP, r.Timestamp.Format(time.RFC3339))
+		}
+		return w.Flush()
+	default:
+		if r.Changed != nil && !*r.Changed {
+			cmd.Println("no change")
+		} else if r.includeTimestamp {
+			cmd.Printf("%s %s\n", r.Timestamp.Format(time.RFC3339), r.IP)
+		} else {
+			cmd.Println(r.IP)
+		}
+	}
+	return nil
+}
+
+// logAPIOperation logs the outcome of the API operation op, which started at start.
+// The ip field is omitted when ip is nil, and the error field is omitted when err is nil.
+func logAPIOperation(logger log.Logger, op string, start time.Time, ip net.IP, err error) {
+	msg := "API operation succeeded"
+	if err != nil {
+		msg = "API operation failed"
+	}
+	keyvals := []interface{}{"msg", msg, "op", op,
+		"duration_ms", strconv.FormatInt(time.Since(start).Milliseconds(), 10)}
+	if ip != nil {
+		keyvals = append(keyvals, "ip", ip.String())
+	}
+	if err != nil {
+		keyvals = append(keyvals, "error", err)
+	}
+	level.Info(logger).Log(keyvals...)
 }
 
 func newAPIMyIPCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "my-ip",
 		Short: "Show the external-facing IP address",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			return firstValidationError(cmd, validateAPIKey, validateBaseURL)
+			if viper.GetInt("count") > 1 {
+				if viper.GetBool("watch") {
+					return fmt.Errorf("count cannot be used with watch (which polls until interrupted)")
+				}
+				if viper.GetString("output-template") != "" {
+					return fmt.Errorf("count cannot be used with output-template (which formats a single result)")
+				}
+			}
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, validateOutputFormat,
+				validateOutputTemplate, validateSampling, resolveAPIKeySecret)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			if viper.GetBool("watch") {
+				return watchMyIP(cmd, logger)
+			}
+			if viper.GetInt("count") > 1 {
+				return sampleMyIP(cmd, logger, viper.GetInt("count"), viper.GetDuration("sample-interval"))
+			}
+
+			start := time.Now()
 			myIP, err := apiClient.MyIP()
+			logAPIOperation(logger, "my-ip", start, myIP, err)
 			if err != nil {
 				return err
 			}
-			cmd.Println(myIP)
-			return nil
+			return printIPResult(cmd, ipResult{IP: myIP, Timestamp: time.Now()})
 		},
 	}
+	addOutputTemplateFlag(cmd)
+	cmd.Flags().Bool("watch", false,
+		"Keep polling for the external-facing IP address, printing a timestamped result whenever it changes")
+	// NB: This flag shadows the global interval (poll interval) flag, which is not used by this command
+	cmd.Flags().Duration("interval", time.Second*5,
+		"How often to poll for the external-facing IP address when --watch is set")
+	cmd.Flags().Int("count", 1,
+		"Number of times to sample the external-facing IP address, printing statistics about the samples when > 1")
+	cmd.Flags().Duration("sample-interval", time.Second,
+		"How long to wait between samples when --count is greater than 1")
+
+	return cmd
+}
+
+// ipObservation is a single sample of the external-facing IP address.
+type ipObservation struct {
+	IP        net.IP    `json:"ip"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// ipSampleStats summarizes several samples of the external-facing IP address, which reveals IP addresses that
+// change between samples (i.e. flapping).
+type ipSampleStats struct {
+	UniqueIPs    []net.IP `json:"unique_ips"`
+	MostCommonIP net.IP   `json:"most_common_ip"`
+	// MostCommonCount is the number of Observations of MostCommonIP
+	MostCommonCount int `json:"most_common_count"`
+	// FirstObserved and LastObserved are the timestamps of the earliest and latest Observations
+	FirstObserved time.Time       `json:"first_observed"`
+	LastObserved  time.Time       `json:"last_observed"`
+	Observations  []ipObservation `json:"observations"`
+}
+
+// newIPSampleStats returns the statistics of observations, which are in chronological order.
+// When several IP addresses are observed equally often, the first of them to be observed is the most common.
+func newIPSampleStats(observations []ipObservation) ipSampleStats {
+	stats := ipSampleStats{Observations: observations}
+	counts := make(map[string]int)
+	for _, o := range observations {
+		key := o.IP.String()
+		if counts[key] == 0 {
+			stats.UniqueIPs = append(stats.UniqueIPs, o.IP)
+		}
+		counts[key]++
+	}
+	for _, ip := range stats.UniqueIPs {
+		if n := counts[ip.String()]; n > stats.MostCommonCount {
+			stats.MostCommonIP, stats.MostCommonCount = ip, n
+		}
+	}
+	if len(observations) > 0 {
+		stats.FirstObserved = observations[0].Timestamp
+		stats.LastObserved = observations[len(observations)-1].Timestamp
+	}
+	return stats
+}
+
+// sampleMyIP retrieves the external-facing IP address count times, waiting interval between each request,
+// and then prints statistics about the observed IP addresses. Any failed request stops the sampling.
+func sampleMyIP(cmd *cobra.Command, logger log.Logger, count int, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	observations := make([]ipObservation, 0, count)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+		start := time.Now()
+		myIP, err := apiClient.MyIPWithContext(ctx)
+		logAPIOperation(logger, "my-ip", start, myIP, err)
+		if err != nil {
+			return err
+		}
+		observations = append(observations, ipObservation{IP: myIP, Timestamp: time.Now()})
+	}
+	return printIPSampleStats(cmd, newIPSampleStats(observations))
+}
+
+// printIPSampleStats prints stats in the output format configured by the output directive.
+func printIPSampleStats(cmd *cobra.Command, stats ipSampleStats) error {
+	uniqueIPs := make([]string, len(stats.UniqueIPs))
+	for i, ip := range stats.UniqueIPs {
+		uniqueIPs[i] = ip.String()
+	}
+
+	switch viper.GetString("output") {
+	case outputFormatJSON:
+		out, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		cmd.Println(string(out))
+	case outputFormatTable:
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SAMPLES\tUNIQUE IPS\tMOST COMMON IP\tFIRST OBSERVED\tLAST OBSERVED")
+		fmt.Fprintf(w, "%d\t%s\t%s (%d)\t%s\t%s\n", len(stats.Observations), strings.Join(uniqueIPs, ","),
+			stats.MostCommonIP, stats.MostCommonCount, stats.FirstObserved.Format(time.RFC3339),
+			stats.LastObserved.Format(time.RFC3339))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TIMESTAMP\tIP")
+		for _, o := range stats.Observations {
+			fmt.Fprintf(w, "%s\t%s\n", o.Timestamp.Format(time.RFC3339), o.IP)
+		}
+		return w.Flush()
+	default:
+		cmd.Printf("samples: %d\n", len(stats.Observations))
+		cmd.Printf("unique IPs: %s\n", strings.Join(uniqueIPs, ", "))
+		cmd.Printf("most common IP: %s (%d/%d)\n", stats.MostCommonIP, stats.MostCommonCount, len(stats.Observations))
+		cmd.Printf("first observed: %s\n", stats.FirstObserved.Format(time.RFC3339))
+		cmd.Printf("last observed: %s\n", stats.LastObserved.Format(time.RFC3339))
+		for _, o := range stats.Observations {
+			cmd.Printf("%s %s\n", o.Timestamp.Format(time.RFC3339), o.IP)
+		}
+	}
+	return nil
+}
+
+// watchMyIP polls for the external-facing IP address at the interval set by cmd's local interval flag,
+// and prints the result of the first poll and of each poll that returns a different IP address than the
+// previous successful poll. Failed polls are printed to stderr, and polling continues until interrupted.
+func watchMyIP(cmd *cobra.Command, logger log.Logger) error {
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be positive (received %s)", interval)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous net.IP
+	for {
+		start := time.Now()
+		myIP, err := apiClient.MyIPWithContext(ctx)
+		logAPIOperation(logger, "my-ip", start, myIP, err)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			cmd.PrintErrf("%s ERROR: %s\n", time.Now().Format(time.RFC3339), err)
+		case !myIP.Equal(previous):
+			if err := printIPResult(cmd, ipResult{IP: myIP, Timestamp: time.Now(), includeTimestamp: true}); err != nil {
+				return err
+			}
+			previous = myIP
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
 
 func newAPIUpdateAliasCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "update-alias",
 		Short: "Request a DNS update that points to the external-facing IP address",
+		Long: `The update-alias subcommand requests a single DNS update. Unlike the agent, which only requests a DNS update
+after detecting that the external-facing IP address changed, update-alias always requests the update (without
+comparing IP addresses first), which makes it suitable for forcing DNS records to be refreshed.
+With --if-changed, the DNS update is only requested when the external-facing IP address differs from the current
+DNS alias. With --force, the DNS update is always requested, even if a later version of mydyndns skips unchanged
+updates by default.
+With --wait-for-propagation, the command then waits until --hostname resolves to the updated IP address (as reported
+by --propagation-server), and fails if it does not within --propagation-timeout.`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			return firstValidationError(cmd, validateAPIKey, validateBaseURL)
+			if viper.GetBool("force") && viper.GetBool("if-changed") {
+				return fmt.Errorf("force cannot be used with if-changed (which skips unchanged DNS updates)")
+			}
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, validateOutputFormat,
+				validateOutputTemplate, validateTTL, validateRecordType, validatePropagation, resolveAPIKeySecret)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			myIP, err := apiClient.UpdateAlias()
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			if viper.GetBool("if-changed") {
+				return updateAliasIfChanged(cmd, logger)
+			}
+
+			start := time.Now()
+			myIP, err := updateAlias(cmd)
+			logAPIOperation(logger, "update-alias", start, myIP, err)
 			if err != nil {
 				return err
 			}
-			cmd.Println(myIP)
+			if err := waitForPropagation(cmd, myIP); err != nil {
+				return err
+			}
+			// The previous IP address is not tracked, so it is omitted from the result
+			return printIPResult(cmd, ipResult{IP: myIP, Timestamp: time.Now(), includePrevious: true})
+		},
+	}
+	addOutputTemplateFlag(cmd)
+	cmd.Flags().Bool("if-changed", false,
+		"Only request a DNS update when the external-facing IP address differs from the current DNS alias")
+	cmd.Flags().Bool("force", false,
+		"Always request a DNS update, without comparing the external-facing IP address to the current DNS alias")
+	cmd.Flags().Int("ttl", 0,
+		"TTL (in seconds) requested for the updated DNS record (the API's default is used when 0)")
+	cmd.Flags().String("record-type", "",
+		"Type of DNS record to update (A, AAAA, or auto to match the IP version of the external-facing IP)")
+	cmd.Flags().Bool("wait-for-propagation", false,
+		"After the DNS update, wait until --hostname resolves to the updated IP address")
+	cmd.Flags().String("hostname", "",
+		"Host name of the DNS record managed by the API, which is resolved by --wait-for-propagation")
+	cmd.Flags().Duration("propagation-timeout", defaultPropagationTimeout,
+		"Maximum amount of time to wait for the DNS update to propagate")
+	cmd.Flags().String("propagation-server", defaultPropagationServer,
+		"Address (host:port) of the DNS server queried to check propagation of the DNS update")
+
+	return cmd
+}
+
+// An ipResolver looks up the IP addresses of a host. It is satisfied by *net.Resolver.
+type ipResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// newPropagationResolver returns an ipResolver that sends all DNS queries to server (as host:port).
+// It can be replaced (e.g. by tests) to check propagation without querying a DNS server.
+var newPropagationResolver = func(server string) ipResolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// waitForPropagation waits until the host name configured by the hostname directive resolves to ip, when requested
+// by the wait-for-propagation directive. The host name is resolved (by the DNS server configured by the
+// propagation-server directive) every propagationCheckInterval, and the outcome of each check is printed to cmd's
+// error output. An error is returned when ip is not resolved within the propagation-timeout directive.
+func waitForPropagation(cmd *cobra.Command, ip net.IP) error {
+	if !viper.GetBool("wait-for-propagation") {
+		return nil
+	}
+	var (
+		host     = viper.GetString("hostname")
+		timeout  = viper.GetDuration("propagation-timeout")
+		resolver = newPropagationResolver(viper.GetString("propagation-server"))
+		network  = "ip6"
+	)
+	if ip.To4() != nil {
+		network = "ip4"
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(propagationCheckInterval)
+	defer ticker.Stop()
+	for attempt := 1; ; attempt++ {
+		resolved, err := resolver.LookupIP(ctx, network, host)
+		switch {
+		case err != nil:
+			cmd.PrintErrf("Propagation check %d: unable to resolve %s: %s\n", attempt, host, err)
+		case slices.ContainsFunc(resolved, ip.Equal):
+			cmd.PrintErrf("Propagation check %d: %s resolves to %s\n", attempt, host, ip)
+			return nil
+		default:
+			cmd.PrintErrf("Propagation check %d: %s resolves to %s (waiting for %s)\n", attempt, host,
+				joinIPs(resolved), ip)
+		}
+
+		select {
+		case <-ctx.Done():
+			if cmd.Context().Err() == nil {
+				return fmt.Errorf("DNS update for %s did not propagate (as %s) within %s", host, ip, timeout)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// joinIPs returns a comma-separated list of the given IP addresses.
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// updateAlias requests a DNS update with the TTL and record type configured by the ttl and record-type directives,
+// if any.
+func updateAlias(cmd *cobra.Command) (net.IP, error) {
+	if opts := updateAliasOptions(); opts != (sdk.UpdateAliasOptions{}) {
+		return apiClient.UpdateAliasWithOptionsAndContext(cmd.Context(), opts)
+	}
+	return apiClient.UpdateAlias()
+}
+
+// updateAliasIfChanged compares the current DNS alias to the external-facing IP address, and requests a DNS update
+// only when they differ. The printed result indicates whether the DNS alias was changed.
+func updateAliasIfChanged(cmd *cobra.Command, logger log.Logger) error {
+	start := time.Now()
+	aliasIP, err := apiClient.GetCurrentAlias()
+	logAPIOperation(logger, "current-alias", start, aliasIP, err)
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	myIP, err := apiClient.MyIP()
+	logAPIOperation(logger, "my-ip", start, myIP, err)
+	if err != nil {
+		return err
+	}
+
+	changed := !myIP.Equal(aliasIP)
+	if changed {
+		start = time.Now()
+		myIP, err = updateAlias(cmd)
+		logAPIOperation(logger, "update-alias", start, myIP, err)
+		if err != nil {
+			return err
+		}
+		if err := waitForPropagation(cmd, myIP); err != nil {
+			return err
+		}
+	}
+	return printIPResult(cmd, ipResult{IP: myIP, PreviousIP: aliasIP, Timestamp: time.Now(), Changed: &changed,
+		includePrevious: true})
+}
+
+func newAPICurrentAliasCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "current-alias",
+		Short: "Show the IP address to which the DNS alias currently points (without updating it)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, validateOutputFormat, resolveAPIKeySecret)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			start := time.Now()
+			aliasIP, err := apiClient.GetCurrentAlias()
+			logAPIOperation(logger, "current-alias", start, aliasIP, err)
+			if err != nil {
+				return err
+			}
+			return printIPResult(cmd, ipResult{IP: aliasIP, Timestamp: time.Now()})
+		},
+	}
+}
+
+func newAPIPingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ping",
+		Short: "Check connectivity to the API",
+		Long: `The ping subcommand requests the health check endpoint of the configured API and reports the round-trip
+latency when the API responds successfully. It exits with a non-zero status when the API is unreachable or responds
+with an unexpected HTTP status code.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, resolveAPIKeySecret)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			start := time.Now()
+			latency, err := apiClient.PingWithContext(cmd.Context())
+			logAPIOperation(logger, "ping", start, nil, err)
+			if err != nil {
+				return err
+			}
+			cmd.Printf("API at %s responded in %s\n", viper.GetString("api-url"), latency.Round(time.Millisecond))
+			return nil
+		},
+	}
+
+	cmd.Flags().String("ping-path", sdk.DefaultPingPath,
+		"Path (relative to the API base URL) of the API health check endpoint")
+
+	return cmd
+}
+
+func newAPICheckAuthCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check-auth",
+		Short: "Check whether the API accepts the configured API key",
+		Long: `The check-auth subcommand requests the apparent IP address from the configured API in order to determine whether
+the API accepts the configured API key, without modifying the DNS alias. Rejected credentials are reported separately
+from other failures (e.g. when the API is unreachable).`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return firstValidationError(cmd, validateAPIKey, validateBaseURL, resolveAPIKeySecret)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, closeLog, err := commandLogger(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			start := time.Now()
+			err = apiClient.CheckAuthWithContext(cmd.Context())
+			logAPIOperation(logger, "check-auth", start, nil, err)
+			if errors.Is(err, sdk.ErrUnauthorized) {
+				return fmt.Errorf("authentication failed (the API rejected the configured API key): %w", err)
+			} else if err != nil {
+				return fmt.Errorf("unable to check authentication: %w", err)
+			}
+			cmd.Println("Authentication OK")
 			return nil
 		},
 	}
 }
+
+func newAPIHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the history of IP address changes recorded by the agent",
+		Long: `The history subcommand reads the journal file to which "agent start" records each DNS update made in response
+to an IP address change, and prints the recorded changes (oldest first).
+This subcommand does not make any API requests.`,
+		Example: `  mydyndns api history --limit=10
+  mydyndns api history --since=2022-01-02T15:04:05Z --output=table`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return firstValidationError(cmd, validateOutputFormat, validateHistoryFilter)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := historyFilter()
+			if err != nil {
+				return err
+			}
+			entries, err := journal.Read(viper.GetString("history-file"), filter)
+			if err != nil {
+				return fmt.Errorf("unable to read history file: %w", err)
+			}
+			return printHistory(cmd, entries)
+		},
+	}
+
+	cmd.Flags().String("history-file", journal.DefaultPath,
+		"Journal file from which the history of IP address changes is read")
+	cmd.Flags().Int("limit", 0,
+		"Maximum number of (most recent) changes to show (unlimited when 0)")
+	cmd.Flags().String("since", "",
+		"Only show changes recorded at or after this RFC3339 timestamp")
+
+	return cmd
+}
+
+// historyFilter returns the journal.Filter configured by the limit and since directives.
+func historyFilter() (journal.Filter, error) {
+	filter := journal.Filter{Limit: viper.GetInt("limit")}
+	if since := viper.GetString("since"); since != "" {
+		ts, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since directive %q (must be an RFC3339 timestamp)", since)
+		}
+		filter.Since = ts
+	}
+	return filter, nil
+}
+
+// printHistory prints entries in the output format configured by the output directive.
+func printHistory(cmd *cobra.Command, entries []journal.Entry) error {
+	switch viper.GetString("output") {
+	case outputFormatJSON:
+		for _, e := range entries {
+			out, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			cmd.Println(string(out))
+		}
+	case outputFormatTable:
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIMESTAMP\tFROM IP\tTO IP")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Timestamp.Format(time.RFC3339), e.FromIP, e.ToIP)
+		}
+		return w.Flush()
+	default:
+		for _, e := range entries {
+			cmd.Printf("%s %s -> %s\n", e.Timestamp.Format(time.RFC3339), e.FromIP, e.ToIP)
+		}
+	}
+	return nil
+}
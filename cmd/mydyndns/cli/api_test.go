@@ -1,20 +1,38 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/journal"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
 )
 
 func TestApiSubcommands(t *testing.T) {
-	// NB: The my-ip and update-alias subcommands behave the same,
+	// NB: The my-ip, update-alias, and current-alias subcommands behave the same,
 	// but they call different underlying client methods
-	for _, subcommand := range []string{"my-ip", "update-alias"} {
+	for _, subcommand := range []string{"my-ip", "update-alias", "current-alias"} {
 		t.Run(subcommand, func(t *testing.T) {
 			for _, tt := range []struct {
 				name          string
@@ -49,15 +67,22 @@ func TestApiSubcommands(t *testing.T) {
 					flags:         []string{"--api-url=https://example.com"},
 					validationErr: fmt.Errorf("missing API key directive"),
 				},
+				{
+					name:          "error on invalid IP version",
+					flags:         []string{"--api-url=https://example.com", "--api-key=asdfjkl", "--ip-version=5"},
+					validationErr: fmt.Errorf(`invalid IP version "5" (must be one of: 4, 6, any)`),
+				},
 			} {
 				cmd := newCLI()
-				client := new(mockClient)
+				client := new(sdktest.MockClient)
 				patchBootstrappedAPIClient(client, cmd)
 				switch subcommand {
 				case "my-ip":
 					client.On("MyIP").Return(tt.ip, tt.clientErr).Once()
 				case "update-alias":
 					client.On("UpdateAlias").Return(tt.ip, tt.clientErr).Once()
+				case "current-alias":
+					client.On("GetCurrentAlias").Return(tt.ip, tt.clientErr).Once()
 				default:
 					require.FailNow(t, "unknown subcommand")
 				}
@@ -83,3 +108,1018 @@ func TestApiSubcommands(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIMyIPWatch(t *testing.T) {
+	newWatchClient := func(cancel context.CancelFunc) *sdktest.MockClient {
+		// The IP alternates between polls (with some repetition)
+		client := new(sdktest.MockClient)
+		for _, ip := range []string{"1.2.3.4", "1.2.3.4", "9.8.7.6", "9.8.7.6", "9.8.7.6", "1.2.3.4"} {
+			client.On("MyIPWithContext").Return(net.ParseIP(ip), nil).Once()
+		}
+		// Simulates an interrupt during the final poll, whose result is discarded
+		client.On("MyIPWithContext").Return(net.ParseIP("5.5.5.5"), nil).Once().Run(func(mock.Arguments) {
+			cancel()
+		})
+		return client
+	}
+
+	for _, tt := range []struct {
+		output    string
+		parseLine func(t *testing.T, line string) string
+	}{
+		{"text", func(t *testing.T, line string) string {
+			ts, ip, found := strings.Cut(line, " ")
+			require.True(t, found, "line is not formatted as %q: %s", "timestamp ip", line)
+			_, err := time.Parse(time.RFC3339, ts)
+			assert.NoError(t, err)
+			return ip
+		}},
+		{"json", func(t *testing.T, line string) string {
+			var result map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &result))
+			assert.Contains(t, result, "ts")
+			return result["ip"].(string)
+		}},
+	} {
+		t.Run(tt.output, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cmd := newCLI()
+			client := newWatchClient(cancel)
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, out, err := ExecuteContextC(ctx, cmd, "api", "my-ip", "--api-url=https://example.com",
+				"--api-key=asdfjkl", "--watch", "--interval=1ms", "--output="+tt.output)
+			require.Equal(t, "my-ip", cmd.Name())
+			require.NoError(t, err)
+			client.AssertExpectations(t)
+			client.AssertNotCalled(t, "UpdateAlias")
+			client.AssertNotCalled(t, "UpdateAliasWithContext")
+
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			require.Len(t, lines, 3, "a line should only be printed when the IP changes: %s", out)
+			ips := make([]string, len(lines))
+			for i, line := range lines {
+				ips[i] = tt.parseLine(t, line)
+			}
+			assert.Equal(t, []string{"1.2.3.4", "9.8.7.6", "1.2.3.4"}, ips)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(nil, fmt.Errorf("connection refused")).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once().Run(func(mock.Arguments) {
+			cancel()
+		})
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteContextC(ctx, cmd, "api", "my-ip", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--watch", "--interval=1ms")
+		require.NoError(t, err, "failed polls should not stop the watch")
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 2, out)
+		assert.True(t, strings.HasSuffix(lines[0], " 1.2.3.4"))
+		assert.True(t, strings.HasSuffix(lines[1], " ERROR: connection refused"))
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+		_, _, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--watch", "--interval=0s")
+		assert.EqualError(t, err, "watch interval must be positive (received 0s)")
+		client.AssertNotCalled(t, "MyIPWithContext")
+	})
+}
+
+func TestAPIMyIPCount(t *testing.T) {
+	newSampleClient := func() *sdktest.MockClient {
+		// The IP alternates between samples
+		client := new(sdktest.MockClient)
+		for _, ip := range []string{"1.2.3.4", "9.8.7.6", "1.2.3.4", "9.8.7.6", "1.2.3.4"} {
+			client.On("MyIPWithContext").Return(net.ParseIP(ip), nil).Once()
+		}
+		return client
+	}
+	expectedIPs := []string{"1.2.3.4", "9.8.7.6", "1.2.3.4", "9.8.7.6", "1.2.3.4"}
+
+	t.Run("json", func(t *testing.T) {
+		cmd := newCLI()
+		client := newSampleClient()
+		patchBootstrappedAPIClient(client, cmd)
+
+		cmd, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--count=5", "--sample-interval=1ms", "--output=json")
+		require.Equal(t, "my-ip", cmd.Name())
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+
+		var stats struct {
+			UniqueIPs       []string  `json:"unique_ips"`
+			MostCommonIP    string    `json:"most_common_ip"`
+			MostCommonCount int       `json:"most_common_count"`
+			FirstObserved   time.Time `json:"first_observed"`
+			LastObserved    time.Time `json:"last_observed"`
+			Observations    []struct {
+				IP        string    `json:"ip"`
+				Timestamp time.Time `json:"ts"`
+			} `json:"observations"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(out), &stats), out)
+		assert.Equal(t, []string{"1.2.3.4", "9.8.7.6"}, stats.UniqueIPs)
+		assert.Equal(t, "1.2.3.4", stats.MostCommonIP)
+		assert.Equal(t, 3, stats.MostCommonCount)
+		require.Len(t, stats.Observations, len(expectedIPs))
+		for i, o := range stats.Observations {
+			assert.Equal(t, expectedIPs[i], o.IP)
+		}
+		assert.Equal(t, stats.Observations[0].Timestamp, stats.FirstObserved)
+		assert.Equal(t, stats.Observations[len(expectedIPs)-1].Timestamp, stats.LastObserved)
+		assert.False(t, stats.LastObserved.Before(stats.FirstObserved))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		cmd := newCLI()
+		client := newSampleClient()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--count=5", "--sample-interval=1ms")
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 5+len(expectedIPs), out)
+		assert.Equal(t, "samples: 5", lines[0])
+		assert.Equal(t, "unique IPs: 1.2.3.4, 9.8.7.6", lines[1])
+		assert.Equal(t, "most common IP: 1.2.3.4 (3/5)", lines[2])
+		assert.True(t, strings.HasPrefix(lines[3], "first observed: "), lines[3])
+		assert.True(t, strings.HasPrefix(lines[4], "last observed: "), lines[4])
+		for i, ip := range expectedIPs {
+			assert.True(t, strings.HasSuffix(lines[5+i], " "+ip), lines[5+i])
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		cmd := newCLI()
+		client := newSampleClient()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--count=5", "--sample-interval=1ms", "--output=table")
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 4+len(expectedIPs), out)
+		assert.Regexp(t, `^SAMPLES\s+UNIQUE IPS\s+MOST COMMON IP\s+FIRST OBSERVED\s+LAST OBSERVED$`, lines[0])
+		assert.Regexp(t, `^5\s+1\.2\.3\.4,9\.8\.7\.6\s+1\.2\.3\.4 \(3\)\s+`, lines[1])
+		assert.Regexp(t, `^TIMESTAMP\s+IP$`, lines[3])
+	})
+
+	t.Run("failed sample", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(nil, fmt.Errorf("connection refused")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--count=5", "--sample-interval=1ms")
+		assert.EqualError(t, err, "connection refused")
+		assert.NotContains(t, out, "samples:", "no statistics should be printed")
+		client.AssertExpectations(t)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{"zero count", []string{"--count=0"}, "sample count must be at least 1 (received 0)"},
+		{"negative interval", []string{"--count=2", "--sample-interval=-1s"},
+			"sample interval cannot be negative (received -1s)"},
+		{"with watch", []string{"--count=2", "--watch"},
+			"count cannot be used with watch (which polls until interrupted)"},
+		{"with output template", []string{"--count=2", "--output-template={{.IP}}"},
+			"count cannot be used with output-template (which formats a single result)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			patchBootstrappedAPIClient(client, cmd)
+			args := append([]string{"api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl"},
+				tt.args...)
+			_, _, err := ExecuteC(cmd, args...)
+			assert.EqualError(t, err, tt.expectedErr)
+			client.AssertNotCalled(t, "MyIPWithContext")
+		})
+	}
+}
+
+func TestAPIUpdateAliasIfChanged(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		aliasIP, myIP  string
+		aliasErr       error
+		myIPErr        error
+		updateErr      error
+		expectUpdate   bool
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:    "no change",
+			aliasIP: "1.2.3.4", myIP: "1.2.3.4",
+			expectedOutput: "no change",
+		},
+		{
+			name:    "changed",
+			aliasIP: "1.2.3.4", myIP: "9.8.7.6",
+			expectUpdate:   true,
+			expectedOutput: "9.8.7.6",
+		},
+		{
+			name:        "current alias error",
+			aliasErr:    fmt.Errorf("current alias error"),
+			myIP:        "9.8.7.6",
+			expectedErr: "current alias error",
+		},
+		{
+			name:        "my IP error",
+			aliasIP:     "1.2.3.4",
+			myIPErr:     fmt.Errorf("my IP error"),
+			expectedErr: "my IP error",
+		},
+		{
+			name:    "update error",
+			aliasIP: "1.2.3.4", myIP: "9.8.7.6",
+			updateErr:    fmt.Errorf("alias update error"),
+			expectUpdate: true,
+			expectedErr:  "alias update error",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("GetCurrentAlias").Return(net.ParseIP(tt.aliasIP), tt.aliasErr).Once()
+			client.On("MyIP").Return(net.ParseIP(tt.myIP), tt.myIPErr).Maybe()
+			client.On("UpdateAlias").Return(net.ParseIP(tt.myIP), tt.updateErr).Maybe()
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+				"--api-key=asdfjkl", "--if-changed")
+			require.Equal(t, "update-alias", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedOutput, strings.TrimSpace(out))
+			}
+			if tt.aliasErr != nil {
+				client.AssertNotCalled(t, "MyIP")
+			}
+			if tt.expectUpdate {
+				client.AssertCalled(t, "UpdateAlias")
+			} else {
+				client.AssertNotCalled(t, "UpdateAlias")
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		for _, tt := range []struct {
+			name, myIP      string
+			expectedChanged bool
+		}{
+			{"no change", "1.2.3.4", false},
+			{"changed", "9.8.7.6", true},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				cmd := newCLI()
+				client := new(sdktest.MockClient)
+				client.On("GetCurrentAlias").Return(net.ParseIP("1.2.3.4"), nil).Once()
+				client.On("MyIP").Return(net.ParseIP(tt.myIP), nil).Once()
+				client.On("UpdateAlias").Return(net.ParseIP(tt.myIP), nil).Maybe()
+				patchBootstrappedAPIClient(client, cmd)
+
+				_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+					"--api-key=asdfjkl", "--if-changed", "--output=json")
+				require.NoError(t, err)
+				var result map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(out), &result))
+				assert.Equal(t, tt.myIP, result["ip"])
+				assert.Equal(t, "1.2.3.4", result["previous_ip"], "the current alias is the previous IP")
+				assert.Equal(t, tt.expectedChanged, result["changed"])
+			})
+		}
+	})
+
+	t.Run("without if-changed", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("UpdateAlias").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--output=json")
+		require.NoError(t, err)
+		assert.NotContains(t, out, "changed", "changes are not known without --if-changed")
+		client.AssertNotCalled(t, "GetCurrentAlias")
+		client.AssertNotCalled(t, "MyIP")
+	})
+
+	t.Run("with ttl", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("UpdateAliasWithOptionsAndContext", sdk.UpdateAliasOptions{TTL: 300}).
+			Return(net.ParseIP("1.2.3.4"), nil).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--ttl=300")
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4\n", out)
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "UpdateAlias")
+	})
+
+	t.Run("with negative ttl", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, _, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--ttl=-1")
+		assert.EqualError(t, err, "TTL cannot be negative (received -1)")
+		client.AssertNotCalled(t, "UpdateAliasWithOptionsAndContext", mock.Anything)
+	})
+}
+
+func TestAPIUpdateAliasForce(t *testing.T) {
+	cmd := newCLI()
+	client := new(sdktest.MockClient)
+	client.ReturnIP("UpdateAlias", net.ParseIP("1.2.3.4")).Once()
+	patchBootstrappedAPIClient(client, cmd)
+
+	_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+		"--force")
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4\n", out)
+	client.AssertNumberOfCalls(t, "UpdateAlias", 1)
+	client.AssertNotCalled(t, "GetCurrentAlias")
+	client.AssertNotCalled(t, "MyIP")
+
+	t.Run("with if-changed", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, _, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--force", "--if-changed")
+		assert.EqualError(t, err, "force cannot be used with if-changed (which skips unchanged DNS updates)")
+		assert.Equal(t, ExitValidationError, ExitCode(err))
+		assert.Empty(t, client.Calls)
+	})
+}
+
+type mockResolver struct{ mock.Mock }
+
+func (m *mockResolver) LookupIP(_ context.Context, network, host string) ([]net.IP, error) {
+	args := m.Called(network, host)
+	ips, _ := args.Get(0).([]net.IP)
+	return ips, args.Error(1)
+}
+
+// patchPropagationResolver replaces the resolver used to check DNS propagation with resolver for the duration of
+// the test, and records the DNS server it is created for. Propagation is checked every millisecond.
+func patchPropagationResolver(t *testing.T, resolver ipResolver) *string {
+	t.Helper()
+	var server string
+	originalResolver, originalInterval := newPropagationResolver, propagationCheckInterval
+	newPropagationResolver = func(s string) ipResolver {
+		server = s
+		return resolver
+	}
+	propagationCheckInterval = time.Millisecond
+	t.Cleanup(func() { newPropagationResolver, propagationCheckInterval = originalResolver, originalInterval })
+	return &server
+}
+
+func TestAPIUpdateAliasWaitForPropagation(t *testing.T) {
+	t.Run("converges", func(t *testing.T) {
+		resolver := new(mockResolver)
+		resolver.On("LookupIP", "ip4", "home.example.com").Return(nil, errors.New("no such host")).Once()
+		resolver.On("LookupIP", "ip4", "home.example.com").Return([]net.IP{net.ParseIP("1.2.3.4")}, nil).Once()
+		resolver.On("LookupIP", "ip4", "home.example.com").
+			Return([]net.IP{net.ParseIP("5.6.7.8"), net.ParseIP("9.8.7.6")}, nil).Once()
+		server := patchPropagationResolver(t, resolver)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("UpdateAlias", net.ParseIP("9.8.7.6")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--wait-for-propagation", "--hostname=home.example.com", "--propagation-server=1.1.1.1:53")
+		require.NoError(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"Propagation check 1: unable to resolve home.example.com: no such host",
+			"Propagation check 2: home.example.com resolves to 1.2.3.4 (waiting for 9.8.7.6)",
+			"Propagation check 3: home.example.com resolves to 9.8.7.6",
+			"9.8.7.6",
+		}, "\n")+"\n", out)
+		assert.Equal(t, "1.1.1.1:53", *server)
+		resolver.AssertExpectations(t)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("converges after changed update", func(t *testing.T) {
+		resolver := new(mockResolver)
+		resolver.On("LookupIP", "ip6", "home.example.com").Return([]net.IP{net.ParseIP("2001:db8::1")}, nil).Once()
+		server := patchPropagationResolver(t, resolver)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("GetCurrentAlias", net.ParseIP("1.2.3.4")).Once()
+		client.ReturnIP("MyIP", net.ParseIP("2001:db8::1")).Once()
+		client.ReturnIP("UpdateAlias", net.ParseIP("2001:db8::1")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--if-changed", "--wait-for-propagation", "--hostname=home.example.com", "-o=json")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out,
+			"Propagation check 1: home.example.com resolves to 2001:db8::1\n{"), "unexpected output: %q", out)
+		assert.Equal(t, defaultPropagationServer, *server)
+		resolver.AssertExpectations(t)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		resolver := new(mockResolver)
+		resolver.On("LookupIP", "ip4", "home.example.com").Return([]net.IP{net.ParseIP("1.2.3.4")}, nil)
+		patchPropagationResolver(t, resolver)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("UpdateAlias", net.ParseIP("9.8.7.6")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--wait-for-propagation", "--hostname=home.example.com", "--propagation-timeout=50ms")
+		assert.EqualError(t, err, "DNS update for home.example.com did not propagate (as 9.8.7.6) within 50ms")
+		assert.Contains(t, out, "Propagation check 1: home.example.com resolves to 1.2.3.4 (waiting for 9.8.7.6)\n")
+		assert.Greater(t, len(resolver.Calls), 1, "propagation should be checked repeatedly until the timeout")
+		assert.NotContains(t, out, "9.8.7.6\n", "the update result should not be printed")
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		resolver := new(mockResolver)
+		patchPropagationResolver(t, resolver)
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.ReturnIP("UpdateAlias", net.ParseIP("9.8.7.6")).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com", "--api-key=asdfjkl",
+			"--hostname=home.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "9.8.7.6\n", out)
+		resolver.AssertNotCalled(t, "LookupIP", mock.Anything, mock.Anything)
+	})
+
+	for _, tt := range []struct {
+		name         string
+		args         []string
+		expectedErr  string
+		expectedCode string
+	}{
+		{"missing hostname", nil, "missing hostname directive (required by wait-for-propagation)",
+			validationCodeMissingHostname},
+		{"invalid timeout", []string{"--hostname=home.example.com", "--propagation-timeout=0s"},
+			"propagation timeout must be positive (received 0s)", validationCodeInvalidPropagationTimeout},
+		{"invalid server", []string{"--hostname=home.example.com", "--propagation-server=8.8.8.8"},
+			`propagation server must be an address of the form host:port (received "8.8.8.8")`,
+			validationCodeInvalidPropagationServer},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			patchBootstrappedAPIClient(client, cmd)
+
+			_, _, err := ExecuteC(cmd, append([]string{"api", "update-alias", "--api-url=https://example.com",
+				"--api-key=asdfjkl", "--wait-for-propagation"}, tt.args...)...)
+			assert.EqualError(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedCode, validationErrorCode(err))
+			assert.Empty(t, client.Calls)
+		})
+	}
+}
+
+func TestAPIUpdateAliasRecordType(t *testing.T) {
+	for _, recordType := range []sdk.RecordType{sdk.RecordTypeA, sdk.RecordTypeAAAA, sdk.RecordTypeAuto} {
+		t.Run(fmt.Sprintf("with record type %s", recordType), func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("UpdateAliasWithOptionsAndContext", sdk.UpdateAliasOptions{RecordType: recordType}).
+				Return(net.ParseIP("1.2.3.4"), nil).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			_, out, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+				"--api-key=asdfjkl", fmt.Sprintf("--record-type=%s", recordType))
+			require.NoError(t, err)
+			assert.Equal(t, "1.2.3.4\n", out)
+			client.AssertExpectations(t)
+			client.AssertNotCalled(t, "UpdateAlias")
+		})
+	}
+
+	t.Run("with invalid record type", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, _, err := ExecuteC(cmd, "api", "update-alias", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--record-type=CNAME")
+		assert.EqualError(t, err, `invalid record type "CNAME" (must be one of: A, AAAA, auto)`)
+		client.AssertNotCalled(t, "UpdateAliasWithOptionsAndContext", mock.Anything)
+	})
+
+	t.Run("with auto record type detected by API", func(t *testing.T) {
+		var recordTypes []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /my-ip", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("2001:db8::1"))
+		})
+		mux.HandleFunc("POST /dns-value", func(w http.ResponseWriter, r *http.Request) {
+			recordTypes = append(recordTypes, r.URL.Query().Get("record_type"))
+			w.Write([]byte("2001:db8::1"))
+		})
+		server := httptest.NewTLSServer(mux)
+		defer server.Close()
+
+		_, out, err := ExecuteC(newCLI(), "api", "update-alias", fmt.Sprintf("--api-url=%s", server.URL),
+			"--api-key=asdfjkl", "--api-tls-skip-verify", "--record-type=auto")
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(out, "\n2001:db8::1\n"), "unexpected output: %q", out)
+		assert.Equal(t, []string{"AAAA"}, recordTypes)
+	})
+}
+
+func TestApiSubcommandsOutputFormats(t *testing.T) {
+	clientMethods := map[string]string{
+		"my-ip":         "MyIP",
+		"update-alias":  "UpdateAlias",
+		"current-alias": "GetCurrentAlias",
+	}
+	for subcommand, clientMethod := range clientMethods {
+		t.Run(subcommand, func(t *testing.T) {
+			newMockedCLI := func() (*cobra.Command, *sdktest.MockClient) {
+				cmd := newCLI()
+				client := new(sdktest.MockClient)
+				client.On(clientMethod).Return(net.ParseIP("1.2.3.4"), nil).Once()
+				patchBootstrappedAPIClient(client, cmd)
+				return cmd, client
+			}
+			execute := func(t *testing.T, extraArgs ...string) string {
+				t.Helper()
+				cmd, client := newMockedCLI()
+				args := append([]string{"api", subcommand, "--api-url=https://example.com", "--api-key=asdfjkl"},
+					extraArgs...)
+				cmd, out, err := ExecuteC(cmd, args...)
+				require.Equal(t, subcommand, cmd.Name())
+				require.NoError(t, err)
+				client.AssertExpectations(t)
+				return out
+			}
+
+			t.Run("text", func(t *testing.T) {
+				assert.Equal(t, "1.2.3.4\n", execute(t))
+				assert.Equal(t, "1.2.3.4\n", execute(t, "--output=text"))
+			})
+
+			t.Run("json", func(t *testing.T) {
+				before := time.Now().Truncate(time.Second)
+				out := execute(t, "-o", "json")
+
+				var result map[string]string
+				require.NoError(t, json.Unmarshal([]byte(out), &result))
+				assert.Equal(t, "1.2.3.4", result["ip"])
+				assert.NotContains(t, result, "previous_ip", "previous IP is not known")
+				ts, err := time.Parse(time.RFC3339Nano, result["ts"])
+				require.NoError(t, err)
+				assert.False(t, ts.Before(before), "timestamp should be the time of the operation")
+			})
+
+			t.Run("table", func(t *testing.T) {
+				lines := strings.Split(strings.TrimSpace(execute(t, "--output=table")), "\n")
+				require.Len(t, lines, 2)
+				header, row := strings.Fields(lines[0]), strings.Fields(lines[1])
+				if subcommand != "update-alias" {
+					assert.Equal(t, []string{"IP", "TIMESTAMP"}, header)
+					require.Len(t, row, 2)
+				} else {
+					assert.Equal(t, []string{"IP", "PREVIOUS", "IP", "TIMESTAMP"}, header)
+					require.Len(t, row, 3)
+					assert.Equal(t, "(unknown)", row[1])
+				}
+				assert.Equal(t, "1.2.3.4", row[0])
+				assert.Equal(t, strings.Index(lines[0], "TIMESTAMP"), strings.Index(lines[1], row[len(row)-1]),
+					"table columns should be aligned")
+			})
+
+			t.Run("unsupported", func(t *testing.T) {
+				cmd, client := newMockedCLI()
+				cmd, _, err := ExecuteC(cmd, "api", subcommand,
+					"--api-url=https://example.com", "--api-key=asdfjkl", "--output=xml")
+				require.Equal(t, subcommand, cmd.Name())
+				assert.EqualError(t, err, `unsupported output format "xml" (must be one of: text, json, table)`)
+				client.AssertNotCalled(t, clientMethod)
+			})
+		})
+	}
+}
+
+func TestApiSubcommandsOutputTemplate(t *testing.T) {
+	clientMethods := map[string]string{
+		"my-ip":        "MyIP",
+		"update-alias": "UpdateAlias",
+	}
+	for subcommand, clientMethod := range clientMethods {
+		t.Run(subcommand, func(t *testing.T) {
+			newMockedCLI := func() (*cobra.Command, *sdktest.MockClient) {
+				cmd := newCLI()
+				client := new(sdktest.MockClient)
+				client.On(clientMethod).Return(net.ParseIP("1.2.3.4"), nil).Maybe()
+				patchBootstrappedAPIClient(client, cmd)
+				return cmd, client
+			}
+			execute := func(t *testing.T, extraArgs ...string) (*sdktest.MockClient, string, error) {
+				t.Helper()
+				cmd, client := newMockedCLI()
+				args := append([]string{"api", subcommand, "--api-url=https://example.com", "--api-key=asdfjkl"},
+					extraArgs...)
+				cmd, out, err := ExecuteC(cmd, args...)
+				require.Equal(t, subcommand, cmd.Name())
+				return client, out, err
+			}
+
+			t.Run("all fields", func(t *testing.T) {
+				before := time.Now().Truncate(time.Second)
+				client, out, err := execute(t, "--output=json",
+					`--output-template={{.Command}} {{.IP}} {{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}`)
+				require.NoError(t, err)
+				client.AssertExpectations(t)
+
+				fields := strings.Fields(out)
+				require.Len(t, fields, 3, "template should take precedence over --output")
+				assert.Equal(t, subcommand, fields[0])
+				assert.Equal(t, "1.2.3.4", fields[1])
+				ts, err := time.Parse(time.RFC3339, fields[2])
+				require.NoError(t, err)
+				assert.False(t, ts.Before(before), "timestamp should be the time of the operation")
+			})
+
+			t.Run("invalid template", func(t *testing.T) {
+				client, out, err := execute(t, "--output-template={{.IP")
+				require.Error(t, err)
+				assert.ErrorContains(t, err, "invalid output template: template: output-template:1: unclosed action")
+				assert.Contains(t, out, "Error: invalid output template")
+				client.AssertNotCalled(t, clientMethod)
+			})
+
+			t.Run("execution error", func(t *testing.T) {
+				client, out, err := execute(t, "--output-template=before {{.Nonexistent}} after")
+				require.Error(t, err)
+				assert.ErrorContains(t, err, "unable to execute output template:")
+				assert.ErrorContains(t, err, "can't evaluate field Nonexistent")
+				assert.NotContains(t, out, "before", "partial template output should not be printed")
+				client.AssertCalled(t, clientMethod)
+			})
+		})
+	}
+
+	t.Run("not supported by current-alias", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "api", "current-alias", "--api-url=https://example.com",
+			"--api-key=asdfjkl", "--output-template={{.IP}}")
+		assert.EqualError(t, err, "unknown flag: --output-template")
+	})
+}
+
+func TestApiSubcommandsLogging(t *testing.T) {
+	for _, tt := range []struct {
+		subcommand, clientMethod string
+		ip                       net.IP
+		clientErr                error
+		expectedLog              map[string]string
+	}{
+		{
+			"my-ip", "MyIP", net.ParseIP("1.2.3.4"), nil,
+			map[string]string{"msg": "API operation succeeded", "op": "my-ip", "ip": "1.2.3.4"},
+		},
+		{
+			"update-alias", "UpdateAlias", net.ParseIP("1.2.3.4"), nil,
+			map[string]string{"msg": "API operation succeeded", "op": "update-alias", "ip": "1.2.3.4"},
+		},
+		{
+			"current-alias", "GetCurrentAlias", net.ParseIP("1.2.3.4"), nil,
+			map[string]string{"msg": "API operation succeeded", "op": "current-alias", "ip": "1.2.3.4"},
+		},
+		{
+			"my-ip", "MyIP", nil, fmt.Errorf("ip fetch error"),
+			map[string]string{"msg": "API operation failed", "op": "my-ip", "error": "ip fetch error"},
+		},
+	} {
+		t.Run(fmt.Sprintf("%s %s", tt.subcommand, tt.expectedLog["msg"]), func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On(tt.clientMethod).Return(tt.ip, tt.clientErr).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			stdOut, stdErr := new(bytes.Buffer), new(bytes.Buffer)
+			cmd.SetOut(stdOut)
+			cmd.SetErr(stdErr)
+			cmd.SetArgs([]string{"api", tt.subcommand,
+				"--api-url=https://example.com", "--api-key=asdfjkl", "--log-json", "-v"})
+			_, err := cmd.ExecuteC()
+			if tt.clientErr != nil {
+				require.EqualError(t, err, tt.clientErr.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.ip.String()+"\n", stdOut.String(), "logs should not be written to stdout")
+			}
+			client.AssertExpectations(t)
+
+			lines := strings.Split(strings.TrimSpace(stdErr.String()), "\n")
+			record := logLine2JSON(t, lines, 0)
+			for k, v := range tt.expectedLog {
+				assert.Equal(t, v, record[k], "unexpected %q in log record: %s", k, record)
+			}
+			assert.Equal(t, "info", record["level"])
+			_, err = strconv.Atoi(record["duration_ms"])
+			assert.NoError(t, err, "duration_ms should be an integer")
+			if tt.ip == nil {
+				assert.NotContains(t, record, "ip")
+			}
+		})
+	}
+
+	t.Run("log file", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "mydyndns.log")
+		require.NoError(t, os.WriteFile(logFile, []byte("existing\n"), 0o644))
+		for _, ip := range []string{"1.2.3.4", "9.8.7.6"} {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("MyIP").Return(net.ParseIP(ip), nil).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			_, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+				"--log-json", "-v", fmt.Sprintf("--log-file=%s", logFile))
+			require.NoError(t, err)
+			assert.Equal(t, ip+"\n", out, "logs should not be written to stderr")
+		}
+
+		b, err := os.ReadFile(logFile)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		require.Len(t, lines, 3, "logs should be appended to the log file")
+		assert.Equal(t, "existing", lines[0])
+		assert.Equal(t, "1.2.3.4", logLine2JSON(t, lines, 1)["ip"])
+		assert.Equal(t, "9.8.7.6", logLine2JSON(t, lines, 2)["ip"])
+	})
+
+	t.Run("unwritable log file", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+
+		logFile := filepath.Join(t.TempDir(), "missing", "mydyndns.log")
+		_, _, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl",
+			fmt.Sprintf("--log-file=%s", logFile))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		assert.ErrorContains(t, err, "unable to open log file")
+		client.AssertNotCalled(t, "MyIP")
+	})
+
+	t.Run("quiet by default", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("MyIP").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		patchBootstrappedAPIClient(client, cmd)
+
+		_, out, err := ExecuteC(cmd, "api", "my-ip", "--api-url=https://example.com", "--api-key=asdfjkl")
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4\n", out)
+	})
+}
+
+func TestAPIPingCmd(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		flags          []string
+		latency        time.Duration
+		clientErr      error
+		validationErr  error
+		expectedOutput string
+	}{
+		{
+			name:           "healthy API",
+			flags:          []string{"--api-url=https://example.com", "--api-key=asdfjkl"},
+			latency:        time.Millisecond * 42,
+			expectedOutput: "API at https://example.com responded in 42ms",
+		},
+		{
+			name:      "unhealthy API",
+			flags:     []string{"--api-url=https://example.com", "--api-key=asdfjkl"},
+			clientErr: fmt.Errorf("unexpected status code"),
+		},
+		{
+			name:          "error on missing API key",
+			flags:         []string{"--api-url=https://example.com"},
+			validationErr: fmt.Errorf("missing API key directive"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("PingWithContext").Return(tt.latency, tt.clientErr).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, out, err := ExecuteC(cmd, append([]string{"api", "ping"}, tt.flags...)...)
+			require.Equal(t, "ping", cmd.Name())
+			switch {
+			case tt.validationErr != nil:
+				assert.EqualError(t, err, tt.validationErr.Error())
+				client.AssertNotCalled(t, "PingWithContext")
+			case tt.clientErr != nil:
+				assert.EqualError(t, err, tt.clientErr.Error())
+				client.AssertExpectations(t)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedOutput, strings.TrimSpace(out))
+				client.AssertExpectations(t)
+			}
+		})
+	}
+
+	t.Run("custom ping path", func(t *testing.T) {
+		requestedPaths := make(chan string, 1)
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedPaths <- r.URL.Path
+			// Stall until the client gives up, so that the request is limited by the API timeout
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+
+		cmd, _, err := ExecuteC(newCLI(), "api", "ping", "--api-url", server.URL, "--api-tls-skip-verify",
+			"--api-key=asdfjkl", "--ping-path=status", "--api-timeout=50ms")
+		require.Equal(t, "ping", cmd.Name())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, "/status", <-requestedPaths)
+		client, ok := apiClient.(*sdk.Client)
+		require.True(t, ok, "expected bootstrapped API client to be an *sdk.Client")
+		assert.Equal(t, "status", client.PingPath)
+	})
+}
+
+func TestAPIHistoryCmd(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+	j := journal.New(historyFile)
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i, ip := range []string{"1.2.3.4", "2.3.4.5", "3.4.5.6"} {
+		require.NoError(t, j.Append(journal.Entry{
+			Timestamp: ts.Add(time.Duration(i) * time.Hour),
+			FromIP:    net.ParseIP(fmt.Sprintf("10.0.0.%d", i)),
+			ToIP:      net.ParseIP(ip),
+		}))
+	}
+
+	for _, tt := range []struct {
+		name           string
+		flags          []string
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:  "text",
+			flags: []string{},
+			expectedOutput: "2022-01-02T15:04:05Z 10.0.0.0 -> 1.2.3.4\n" +
+				"2022-01-02T16:04:05Z 10.0.0.1 -> 2.3.4.5\n" +
+				"2022-01-02T17:04:05Z 10.0.0.2 -> 3.4.5.6",
+		},
+		{
+			name:           "limit",
+			flags:          []string{"--limit=1"},
+			expectedOutput: "2022-01-02T17:04:05Z 10.0.0.2 -> 3.4.5.6",
+		},
+		{
+			name:  "since",
+			flags: []string{"--since=2022-01-02T16:00:00Z", "--output=json"},
+			expectedOutput: `{"ts":"2022-01-02T16:04:05Z","from_ip":"10.0.0.1","to_ip":"2.3.4.5"}` + "\n" +
+				`{"ts":"2022-01-02T17:04:05Z","from_ip":"10.0.0.2","to_ip":"3.4.5.6"}`,
+		},
+		{
+			name:  "table",
+			flags: []string{"--limit=2", "--output=table"},
+			expectedOutput: "TIMESTAMP             FROM IP   TO IP\n" +
+				"2022-01-02T16:04:05Z  10.0.0.1  2.3.4.5\n" +
+				"2022-01-02T17:04:05Z  10.0.0.2  3.4.5.6",
+		},
+		{
+			name:        "negative limit",
+			flags:       []string{"--limit=-1"},
+			expectedErr: "history limit cannot be negative (received -1)",
+		},
+		{
+			name:        "invalid since",
+			flags:       []string{"--since=yesterday"},
+			expectedErr: `invalid since directive "yesterday" (must be an RFC3339 timestamp)`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"api", "history", "--history-file", historyFile}, tt.flags...)
+			cmd, out, err := ExecuteC(newCLI(), args...)
+			require.Equal(t, "history", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, strings.TrimSpace(out))
+		})
+	}
+
+	t.Run("missing history file", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "api", "history",
+			"--history-file", filepath.Join(t.TempDir(), "missing.jsonl"))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		assert.ErrorContains(t, err, "unable to read history file")
+	})
+}
+
+func TestAPICheckAuthCmd(t *testing.T) {
+	unexpectedStatus := func(status int) error {
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/my-ip", http.NoBody)
+		return sdk.NewUnexpectedStatusCode(req, &http.Response{StatusCode: status})
+	}
+
+	for _, tt := range []struct {
+		name           string
+		clientErr      error
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:           "200",
+			expectedOutput: "Authentication OK",
+		},
+		{
+			name:      "401",
+			clientErr: unexpectedStatus(http.StatusUnauthorized),
+			expectedErr: "authentication failed (the API rejected the configured API key): request to " +
+				"https://example.com/my-ip responded with unexpected status code 401 (Unauthorized)",
+		},
+		{
+			name:      "403",
+			clientErr: unexpectedStatus(http.StatusForbidden),
+			expectedErr: "authentication failed (the API rejected the configured API key): request to " +
+				"https://example.com/my-ip responded with unexpected status code 403 (Forbidden)",
+		},
+		{
+			name:      "500",
+			clientErr: unexpectedStatus(http.StatusInternalServerError),
+			expectedErr: "unable to check authentication: request to " +
+				"https://example.com/my-ip responded with unexpected status code 500 (Internal Server Error)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			client := new(sdktest.MockClient)
+			client.On("CheckAuthWithContext").Return(tt.clientErr).Once()
+			patchBootstrappedAPIClient(client, cmd)
+
+			cmd, out, err := ExecuteC(cmd, "api", "check-auth", "--api-url=https://example.com", "--api-key=asdfjkl")
+			require.Equal(t, "check-auth", cmd.Name())
+			client.AssertExpectations(t)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				if tt.clientErr != nil {
+					assert.ErrorIs(t, err, tt.clientErr)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, strings.TrimSpace(out))
+		})
+	}
+
+	t.Run("missing API key", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		patchBootstrappedAPIClient(client, cmd)
+		_, _, err := ExecuteC(cmd, "api", "check-auth", "--api-url=https://example.com")
+		assert.EqualError(t, err, "missing API key directive")
+		client.AssertNotCalled(t, "CheckAuthWithContext")
+	})
+}
@@ -3,6 +3,8 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"runtime/debug"
 	"time"
 
@@ -10,17 +12,61 @@ import (
 )
 
 const (
-	defaultConfigPath     = "."
-	defaultConfigFilename = "mydyndns"
-	envPrefix             = "MYDYNDNS"
-	configPathSettingKey  = "config-path"
-	configFileSettingKey  = "config-file"
+	defaultConfigPath           = "."
+	defaultConfigFilename       = "mydyndns"
+	envPrefix                   = "MYDYNDNS"
+	configPathSettingKey        = "config-path"
+	configFileSettingKey        = "config-file"
+	urlHistoryFilename          = "url-history"
+	noConfigDiscoverySettingKey = "no-config-discovery"
+	decryptKeySettingKey        = "decrypt-key"
+	preprocessConfigSettingKey  = "preprocess-config"
+	remoteProviderSettingKey    = "config-remote-provider"
+	remoteEndpointSettingKey    = "config-remote-endpoint"
+	remotePathSettingKey        = "config-remote-path"
+	outputFormatText            = "text"
+	outputFormatJSON            = "json"
+	outputFormatTable           = "table"
+	outputFormatEnv             = "env"
+	defaultOutputFormat         = outputFormatText
+	secretBackendEnv            = "env"
+	secretBackendAWS            = "aws-secretsmanager"
+	secretBackendVault          = "vault"
+	logBackendGoKit             = "go-kit"
+	logBackendSlog              = "slog"
+	releasesURL                 = "https://github.com/TylerHendrickson/mydyndns/releases"
 )
 
 var (
-	Version             = "dev"
-	defaultPollInterval = time.Hour
-	minimumPollInterval = time.Second * 10
+	Version                   = "dev"
+	defaultPollInterval       = time.Hour
+	minimumPollInterval       = time.Second * 10
+	defaultAPITimeout         = time.Second * 30
+	defaultChangeThreshold    = 1
+	defaultHistorySize        = 10
+	defaultPollMaxBackoff     = time.Hour * 6
+	defaultRetryMaxAttempts   = 3
+	defaultRetryBaseDelay     = time.Second * 5
+	defaultRetryMaxDelay      = time.Minute
+	defaultRetryMultiplier    = 2.0
+	defaultRetryJitter        = 0.2
+	defaultWebhookTimeout     = time.Second * 10
+	defaultEmailTimeout       = time.Second * 30
+	defaultSMTPPort           = 587
+	defaultStopTimeout        = time.Second * 10
+	defaultLogMaxSizeMB       = 100
+	stopPollInterval          = time.Millisecond * 100
+	defaultPropagationTimeout = time.Minute
+	defaultPropagationServer  = "8.8.8.8:53"
+	propagationCheckInterval  = time.Second * 2
+	updateCheckTimeout        = time.Second * 10
+)
+
+// Exit codes of the "agent status" command
+const (
+	agentStatusRunning   = 0
+	agentStatusStopped   = 1
+	agentStatusNoPIDFile = 2
 )
 
 func init() {
@@ -39,21 +85,111 @@ func ExecuteContext(ctx context.Context) error {
 	return newCLI().ExecuteContext(ctx)
 }
 
+// Exit codes with which the CLI application exits after a command fails, by category of failure.
+// Failures that do not fall into any category (e.g. unknown flags) result in an exit code of 1.
+const (
+	// ExitValidationError indicates that a command was given invalid directives.
+	ExitValidationError = 2
+	// ExitConfigError indicates a failure to read the configuration (e.g. a missing or invalid config file),
+	// or a failure of a "config" command.
+	ExitConfigError = 3
+	// ExitAPIError indicates a failure of an "api" command (e.g. an unreachable API).
+	ExitAPIError = 4
+	// ExitAgentError indicates a failure of an "agent" command.
+	ExitAgentError = 5
+)
+
+// An ExitError indicates that the CLI application should exit with a specific (non-zero) status code.
+// Failed commands return an ExitError that wraps the cause of the failure, and commands may also return
+// an ExitError without a cause to report an outcome that is not otherwise an error (e.g. "agent status").
+type ExitError struct {
+	code int
+	err  error
+}
+
+// Code returns the status code with which the CLI application should exit.
+func (e ExitError) Code() int {
+	return e.code
+}
+
+func (e ExitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e ExitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err wrapped in an ExitError with the given code, unless err is nil or already wraps
+// an ExitError (whose code takes precedence).
+func withExitCode(code int, err error) error {
+	if err == nil || errors.As(err, new(ExitError)) {
+		return err
+	}
+	return ExitError{code: code, err: err}
+}
+
+// setExitCodes configures cmd and its (nested) subcommands to return ExitErrors: errors returned by PreRunE
+// functions (which validate directives) are given the ExitValidationError code, and errors returned by
+// RunE functions are given the provided code.
+func setExitCodes(cmd *cobra.Command, code int) {
+	if preRunE := cmd.PreRunE; preRunE != nil {
+		cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+			return withExitCode(ExitValidationError, preRunE(cmd, args))
+		}
+	}
+	if runE := cmd.RunE; runE != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return withExitCode(code, runE(cmd, args))
+		}
+	}
+	for _, child := range cmd.Commands() {
+		setExitCodes(child, code)
+	}
+}
+
+// ExitCode returns the status code with which the CLI application should exit after returning err
+// from Execute or ExecuteContext.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e ExitError
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return 1
+}
+
 // newCLI creates and returns a new *cobra.Command "root" command, assembling child/sub commands
 // with the following nested hierarchy (note this does not include Cobra-provided subcommands
 // such as "completion" or "help"):
 //   mydyndns
 //   ├── agent
-//   │   └── start
+//   │   ├── start
+//   │   ├── status
+//   │   └── stop
 //   ├── api
+//   │   ├── check-auth
+//   │   ├── current-alias
+//   │   ├── history
 //   │   ├── my-ip
+//   │   ├── ping
 //   │   └── update-alias
 //   └── config
+//       ├── diff
+//       ├── env
+//       ├── merge
 //       ├── show
 //       ├── types
 //       │   ├── check
 //       │   └── list
+//       ├── upgrade
 //       ├── validate
+//       ├── watch
 //       └── write
 func newCLI() *cobra.Command {
 	// mydyndns ...
@@ -61,17 +197,19 @@ func newCLI() *cobra.Command {
 
 	// mydyndns api ...
 	apiCmd := newAPICmd()
-	apiCmd.AddCommand(newAPIMyIPCmd(), newAPIUpdateAliasCmd())
+	apiCmd.AddCommand(newAPIMyIPCmd(), newAPIUpdateAliasCmd(), newAPIPingCmd(), newAPICurrentAliasCmd(),
+		newAPIHistoryCmd(), newAPICheckAuthCmd())
 	rootCmd.AddCommand(apiCmd)
 
 	// mydyndns agent ...
 	agentCmd := newAgentCmd()
-	agentCmd.AddCommand(newAgentStartCmd())
+	agentCmd.AddCommand(newAgentStartCmd(), newAgentStopCmd(), newAgentStatusCmd())
 	rootCmd.AddCommand(agentCmd)
 
 	// mydyndns config ...
 	configCmd := newConfigCmd()
-	configCmd.AddCommand(newConfigWriteCmd(), newConfigShowCmd(), newConfigValidateCmd())
+	configCmd.AddCommand(newConfigWriteCmd(), newConfigShowCmd(), newConfigValidateCmd(), newConfigDiffCmd(),
+		newConfigMergeCmd(), newConfigEnvCmd(), newConfigWatchCmd(), newConfigUpgradeCmd())
 	rootCmd.AddCommand(configCmd)
 
 	// mydyndns config types ...
@@ -82,5 +220,10 @@ func newCLI() *cobra.Command {
 	// (HIDDEN) mydyndns command-tree ...
 	rootCmd.AddCommand(newCommandTreeCmd())
 
+	// Failed commands exit with a status code identifying the category of failure
+	setExitCodes(apiCmd, ExitAPIError)
+	setExitCodes(agentCmd, ExitAgentError)
+	setExitCodes(configCmd, ExitConfigError)
+
 	return rootCmd
 }
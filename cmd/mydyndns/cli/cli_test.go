@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
+)
+
+func TestExitCodes(t *testing.T) {
+	missingFile := filepath.Join(t.TempDir(), "missing.toml")
+	apiArgs := []string{"--api-url=https://example.com", "--api-key=asdfjkl"}
+
+	for _, tt := range []struct {
+		name         string
+		args         []string
+		client       func() *sdktest.MockClient
+		expectedCode int
+	}{
+		{
+			"validation error",
+			[]string{"api", "my-ip", "--api-url=https://example.com"},
+			nil,
+			ExitValidationError,
+		},
+		{
+			"agent validation error",
+			append([]string{"agent", "start", "--change-threshold=-1"}, apiArgs...),
+			nil,
+			ExitValidationError,
+		},
+		{
+			"config file error",
+			append([]string{"api", "my-ip", fmt.Sprintf("--config-file=%s", missingFile)}, apiArgs...),
+			nil,
+			ExitConfigError,
+		},
+		{
+			"config command error",
+			[]string{"config", "diff", missingFile, missingFile},
+			nil,
+			ExitConfigError,
+		},
+		{
+			"API error",
+			append([]string{"api", "my-ip"}, apiArgs...),
+			func() *sdktest.MockClient {
+				client := new(sdktest.MockClient)
+				client.ReturnError("MyIP", fmt.Errorf("connection refused"))
+				return client
+			},
+			ExitAPIError,
+		},
+		{
+			"agent error",
+			append([]string{"agent", "start"}, apiArgs...),
+			func() *sdktest.MockClient {
+				client := new(sdktest.MockClient)
+				client.ReturnError("UpdateAliasWithContext", fmt.Errorf("connection refused"))
+				return client
+			},
+			ExitAgentError,
+		},
+		{
+			"uncategorized error",
+			[]string{"api", "my-ip", "--no-such-flag"},
+			nil,
+			1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newCLI()
+			if tt.client != nil {
+				patchBootstrappedAPIClient(tt.client(), cmd)
+			}
+			_, _, err := ExecuteC(cmd, tt.args...)
+			require.Error(t, err)
+			assert.Equal(t, tt.expectedCode, ExitCode(err))
+
+			var exitErr ExitError
+			if tt.expectedCode == 1 {
+				assert.False(t, errors.As(err, &exitErr))
+			} else {
+				require.ErrorAs(t, err, &exitErr)
+				assert.Equal(t, tt.expectedCode, exitErr.Code())
+				assert.NotNil(t, errors.Unwrap(exitErr), "the cause of the failure should be wrapped")
+			}
+		})
+	}
+
+	t.Run("success", func(t *testing.T) {
+		cmd := newCLI()
+		client := new(sdktest.MockClient)
+		client.On("MyIP").Return(net.ParseIP("1.2.3.4"), nil)
+		patchBootstrappedAPIClient(client, cmd)
+		_, _, err := ExecuteC(cmd, append([]string{"api", "my-ip"}, apiArgs...)...)
+		require.NoError(t, err)
+		assert.Equal(t, 0, ExitCode(err))
+	})
+}
+
+func TestExitError(t *testing.T) {
+	cause := fmt.Errorf("something failed")
+
+	err := withExitCode(ExitAPIError, cause)
+	assert.Equal(t, ExitAPIError, ExitCode(err))
+	assert.EqualError(t, err, "something failed")
+	assert.ErrorIs(t, err, cause)
+
+	assert.Equal(t, ExitAPIError, ExitCode(withExitCode(ExitAgentError, fmt.Errorf("wrapped: %w", err))),
+		"the code of an existing ExitError should take precedence")
+	assert.NoError(t, withExitCode(ExitAPIError, nil))
+
+	assert.EqualError(t, ExitError{code: agentStatusStopped}, "exit status 1")
+	assert.Equal(t, agentStatusStopped, ExitCode(ExitError{code: agentStatusStopped}))
+}
@@ -1,15 +1,32 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/TylerHendrickson/mydyndns/cmd/mydyndns/cli/migrations"
 	"github.com/TylerHendrickson/mydyndns/internal"
+	"github.com/TylerHendrickson/mydyndns/internal/crypto"
 )
 
 func newConfigCmd() *cobra.Command {
@@ -21,7 +38,8 @@ mydyndns reads configuration directives in from the following sources (in order
 and a configuration file. Configuration files may be specified explicitly by setting the global --config-file flag to the
 name of a file with a supported extension. When this flag is not set, mydyndns attempts to find a suitable configuration
 file by looking in the current working directory for a file named "mydyndns.ext", where "ext" is one of any supported
-config file extensions.`),
+config file extensions. Unless the --config-path or --no-config-discovery flag is set, the following directories are
+then searched (in order) for the same file: $XDG_CONFIG_HOME/mydyndns, ~/.config/mydyndns, ~/.mydyndns, /etc/mydyndns.`),
 	}
 }
 
@@ -53,6 +71,14 @@ useful for generating config file templates).`,
     mydyndns config write toml --validate ⮕ ./mydyndns.toml (or ERROR!)
   - Only write the effective configuration if no existing file will be overwritten:
     mydyndns config write toml --safe ⮕ ./mydyndns.toml (or ERROR!)
+  - Review the changes to an existing config file, and confirm them (interactively) to overwrite it:
+    mydyndns config write toml --compare ⮕ ./mydyndns.toml (diff, then "Overwrite? [y/N]")
+  - Generate an encrypted config file (readable with the global --decrypt-key flag):
+    mydyndns config write toml --encrypt-key /path/to/32-byte.key ⮕ ./mydyndns.toml
+  - Generate a config file from directives piped to stdin (merged with any effective configuration):
+    cat fragment.yaml | mydyndns config write toml --stdin-format yaml ⮕ ./mydyndns.toml
+  - Update a single directive in an existing config file, keeping all others:
+    mydyndns config write mydyndns.toml --merge-from mydyndns.toml --api-key=new-key ⮕ ./mydyndns.toml
   - This will fail because the format is not supported:
     mydyndns config write bespokeformat ⮕ (ERROR!)`,
 		Args: func(cmd *cobra.Command, args []string) error {
@@ -88,6 +114,23 @@ useful for generating config file templates).`,
 			return completions, directive
 		},
 		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetBool("defaults") && viper.GetString("stdin-format") != "" {
+				return fmt.Errorf("stdin-format cannot be used with defaults (which ignore the effective configuration)")
+			}
+			if viper.GetBool("defaults") && viper.GetString("merge-from") != "" {
+				return fmt.Errorf("merge-from cannot be used with defaults (which ignore the effective configuration)")
+			}
+			if mergeFrom := viper.GetString("merge-from"); mergeFrom != "" {
+				if err := validateConfigFileNames([]string{mergeFrom}); err != nil {
+					return err
+				}
+			}
+			if viper.GetBool("compare") && viper.GetString("encrypt-key") != "" {
+				return fmt.Errorf("compare cannot be used with encrypt-key (encrypted files cannot be compared)")
+			}
+			if viper.GetBool("compare") && viper.GetBool("safe") {
+				return fmt.Errorf("compare cannot be used with safe (which never overwrites existing files)")
+			}
 			if viper.GetBool("validate") {
 				return firstValidationError(cmd,
 					validateAPIKey, validateBaseURL, validatePollInterval)
@@ -100,6 +143,7 @@ useful for generating config file templates).`,
 				safeWrite       = viper.GetBool("safe")
 				quiet           = viper.GetBool("quiet")
 				defaultsOnly    = viper.GetBool("defaults")
+				compare         = viper.GetBool("compare")
 			)
 
 			// Ensure base path is absolute
@@ -108,26 +152,23 @@ useful for generating config file templates).`,
 				return err
 			}
 
-			// Get all viper settings, which we will use to create an isolated viper
-			// with only the settings that make sense for a config file.
-			configMap := viper.AllSettings()
-			// These don't make sense for a config file:
-			delete(configMap, configFileSettingKey)
-			delete(configMap, configPathSettingKey)
-			delete(configMap, "help")
-			// Ignore directives that are only used for this ("config write") command
-			cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
-				delete(configMap, f.Name)
-			})
-			// Make an isolated Viper with only the remaining settings
+			// Make an isolated Viper with only the settings that make sense for a config file
 			v := viper.New()
-			v.MergeConfigMap(configMap)
+			if mergeFrom := viper.GetString("merge-from"); mergeFrom != "" {
+				if err := mergeConfigFrom(v, mergeFrom, effectiveConfigMap(cmd)); err != nil {
+					return err
+				}
+			} else {
+				v.MergeConfigMap(effectiveConfigMap(cmd))
+			}
+
+			v.Set(migrations.SchemaVersionKey, migrations.CurrentVersion)
 
 			if defaultsOnly {
 				// Replace remaining settings with the default value set on its corresponding flag
 				cmd.Flags().VisitAll(func(f *pflag.Flag) {
 					if v.IsSet(f.Name) {
-						v.Set(f.Name, f.DefValue)
+						v.Set(f.Name, flagDefault(f))
 					}
 				})
 			}
@@ -136,6 +177,22 @@ useful for generating config file templates).`,
 			if safeWrite {
 				writeFunc = v.SafeWriteConfigAs
 			}
+			if keyFile := viper.GetString("encrypt-key"); keyFile != "" {
+				key, err := crypto.ReadKeyFile(keyFile)
+				if err != nil {
+					return err
+				}
+				writeFunc = func(filename string) error {
+					return writeEncryptedConfig(v, filename, key, safeWrite)
+				}
+			}
+
+			// Overwriting a config file with --compare must be confirmed interactively, which is impossible when
+			// stdin is not a terminal (including when it is read for config directives)
+			var confirmations *bufio.Reader
+			if compare && viper.GetString("stdin-format") == "" && isTerminal(cmd.InOrStdin()) {
+				confirmations = bufio.NewReader(cmd.InOrStdin())
+			}
 
 			for _, f := range args {
 				basePath := defaultBasePath
@@ -146,6 +203,13 @@ useful for generating config file templates).`,
 					f = fmt.Sprintf("%s.%s", defaultConfigFilename, f)
 				}
 				configPath := filepath.Join(basePath, f)
+				if compare {
+					if overwrite, err := compareConfig(cmd, v, configPath, confirmations); err != nil {
+						return err
+					} else if !overwrite {
+						continue
+					}
+				}
 				if err := writeFunc(configPath); err != nil {
 					return err
 				}
@@ -168,32 +232,619 @@ useful for generating config file templates).`,
 		"If unset, filenames are printed as they are written.")
 	cmd.Flags().Bool("defaults", false,
 		"Ignore effective configuration and generate file(s) with defaults for directive values.")
+	cmd.Flags().String("stdin-format", "",
+		fmt.Sprintf("Also read config directives piped to stdin in the given format (%s), "+
+			"which override those from any config file.", strings.Join(viper.SupportedExts, "|")))
+	cmd.Flags().String("encrypt-key", "",
+		"Path to a 32-byte key file used to encrypt the written file(s) with AES-256-GCM")
+	cmd.Flags().Bool("compare", false,
+		"Show a diff of changes to existing files, which are only overwritten once confirmed (on a terminal)")
+	cmd.Flags().String("merge-from", "",
+		"Existing config file whose directives are written, overridden by those set explicitly (e.g. by flags)")
+	cmd.MarkFlagFilename("merge-from", viper.SupportedExts...)
+
+	return cmd
+}
+
+// mergeConfigFrom sets the config directives of v to those read from the config file filename, overridden by each
+// directive in settings that is set explicitly (i.e. not to its default value) in the effective configuration.
+func mergeConfigFrom(v *viper.Viper, filename string, settings map[string]interface{}) error {
+	existing := viper.New()
+	existing.SetConfigFile(filename)
+	if err := existing.ReadInConfig(); err != nil {
+		return fmt.Errorf("unable to read config file to merge from: %w", err)
+	}
+	if err := v.MergeConfigMap(existing.AllSettings()); err != nil {
+		return err
+	}
+	for key := range settings {
+		if !viper.IsSet(key) {
+			delete(settings, key)
+		}
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// compareConfig prints a unified diff of the existing config file filename and the config file that v would write
+// in its place, and then asks for confirmation to overwrite the existing file by reading a line from confirmations.
+// It reports whether the file should be written, which is always the case when the file does not exist yet.
+// When confirmations is nil (i.e. the command is not interactive), existing files are never overwritten.
+func compareConfig(cmd *cobra.Command, v *viper.Viper, filename string, confirmations *bufio.Reader) (bool, error) {
+	existing, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	replacement, err := renderConfig(v, filename)
+	if err != nil {
+		return false, err
+	}
+
+	diff := internal.UnifiedDiff(filename, filename, string(existing), string(replacement))
+	if diff == "" {
+		cmd.Printf("%s is unchanged\n", filename)
+		return false, nil
+	}
+	fmt.Fprint(cmd.OutOrStdout(), diff)
+	if confirmations == nil {
+		cmd.Printf("Not overwriting %s (confirmation requires an interactive terminal)\n", filename)
+		return false, nil
+	}
+
+	fmt.Fprint(cmd.OutOrStdout(), "Overwrite? [y/N] ")
+	answer, err := confirmations.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		cmd.Printf("Not overwriting %s\n", filename)
+		return false, nil
+	}
+}
+
+// isTerminal reports whether r is an interactive terminal, i.e. a character device other than the null device.
+var isTerminal = func(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, devNull)
+}
+
+// renderConfig returns the contents of the config file that v would write to filename (whose extension determines
+// the config format).
+func renderConfig(v *viper.Viper, filename string) ([]byte, error) {
+	// Viper can only write to a filesystem, so the config file is written to memory
+	memFs := afero.NewMemMapFs()
+	v.SetFs(memFs)
+	defer v.SetFs(afero.NewOsFs())
+	name := filepath.Join("/", filepath.Base(filename))
+	if err := v.WriteConfigAs(name); err != nil {
+		return nil, err
+	}
+	return afero.ReadFile(memFs, name)
+}
+
+// writeEncryptedConfig writes the config directives set in v to filename (whose extension determines the config
+// format), encrypted with key. When safe is true, an existing file is never overwritten.
+func writeEncryptedConfig(v *viper.Viper, filename string, key []byte, safe bool) error {
+	plaintext, err := renderConfig(v, filename)
+	if err != nil {
+		return err
+	}
+	data, err := crypto.Encrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if safe {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(filename, flags, 0o600)
+	if err != nil {
+		if safe && errors.Is(err, fs.ErrExist) {
+			return viper.ConfigFileAlreadyExistsError(filename)
+		}
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// effectiveConfigMap returns all effective config directives (settings), excluding those that don't make sense
+// outside of a single command execution: directives used to locate (or decrypt) a config file, and directives that are
+// only used by cmd (i.e. its local flags).
+func effectiveConfigMap(cmd *cobra.Command) map[string]interface{} {
+	configMap := viper.AllSettings()
+	delete(configMap, configFileSettingKey)
+	delete(configMap, configPathSettingKey)
+	delete(configMap, noConfigDiscoverySettingKey)
+	delete(configMap, decryptKeySettingKey)
+	delete(configMap, preprocessConfigSettingKey)
+	delete(configMap, remoteProviderSettingKey)
+	delete(configMap, remoteEndpointSettingKey)
+	delete(configMap, remotePathSettingKey)
+	delete(configMap, "help")
+	// An API key read from api-key-file is not part of the configuration (the file is)
+	if viper.GetString("api-key-file") != "" {
+		delete(configMap, "api-key")
+	}
+	// Likewise, an API URL built from api-url-template is not part of the configuration (the template is)
+	if viper.GetString("api-url-template") != "" {
+		delete(configMap, "api-url")
+	}
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		delete(configMap, f.Name)
+	})
+	return configMap
+}
+
+// defaultRedactedDirectives are config directives whose values are secret, and are masked when displayed
+// (unless overridden with --redact-keys).
+var defaultRedactedDirectives = []string{"api-key", "smtp-password"}
+
+// redactedValue replaces the values of redacted config directives when displayed.
+const redactedValue = "****"
+
+// addRedactionFlags adds the flags that control which config directive values are masked in the output of cmd.
+func addRedactionFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("no-redact", false, "Print all directive values, including sensitive ones, without masking them")
+	cmd.Flags().StringArray("redact-keys", defaultRedactedDirectives,
+		"Directive whose value is masked (repeatable; replaces the default, so include api-key to keep masking it)")
+}
+
+// redactDirectives replaces the values of the directives in settings that are selected by --redact-keys with
+// redactedValue, unless --no-redact is set. Directives that are unset or empty are left as-is.
+func redactDirectives(settings map[string]interface{}) {
+	if viper.GetBool("no-redact") {
+		return
+	}
+	for _, k := range viper.GetStringSlice("redact-keys") {
+		if v, ok := settings[k]; ok && fmt.Sprint(v) != "" {
+			settings[k] = redactedValue
+		}
+	}
+}
+
+// shellExportFormats maps supported shells to format strings for statements that export an environment variable.
+// Each format string receives the environment variable name and its (already quoted) value.
+var shellExportFormats = map[string]string{
+	"bash":       "export %s=%s",
+	"fish":       "set -x %s %s",
+	"powershell": "$env:%s = %s",
+}
+
+// shellQuote quotes s as a string literal for the given shell, such that it is not subject to further expansion.
+func shellQuote(shell, s string) string {
+	switch shell {
+	case "fish":
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	case "powershell":
+		return `"` + strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$").Replace(s) + `"`
+	default:
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+}
+
+func newConfigEnvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Prints shell statements that export the effective configuration as environment variables",
+		Long: `The env subcommand prints the effective configuration as statements that export an equivalent environment
+variable for each directive, which is useful when configuring mydyndns via environment variables instead of a config
+file. Sensitive directive values (api-key, or those selected with --redact-keys) are masked unless the --no-redact flag
+is set.`,
+		Example: `  eval "$(mydyndns config env --config-file mydyndns.toml --no-redact)"
+  mydyndns config env --shell fish | source
+  mydyndns config env --shell powershell`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if shell := viper.GetString("shell"); shellExportFormats[shell] == "" {
+				return fmt.Errorf("unsupported shell %q (must be one of: bash, fish, powershell)", shell)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			shell := viper.GetString("shell")
+			configMap := effectiveConfigMap(cmd)
+			if !viper.GetBool("show-secrets") {
+				redactDirectives(configMap)
+			}
+			for _, k := range sortedKeys(configMap) {
+				value := fmt.Sprint(configMap[k])
+				cmd.Printf(shellExportFormats[shell]+"\n", flagNameToEnvVar(k), shellQuote(shell, value))
+			}
+		},
+	}
+
+	cmd.Flags().String("shell", "bash", "Shell syntax of printed statements (bash, fish, or powershell)")
+	cmd.Flags().Bool("show-secrets", false, "Print sensitive directive values instead of masking them")
+	_ = cmd.Flags().MarkDeprecated("show-secrets", "use --no-redact instead")
+	addRedactionFlags(cmd)
+
+	return cmd
+}
+
+// configDifference describes a config directive whose value differs between two config files.
+// A nil value indicates that the directive is not set in the corresponding file.
+type configDifference struct {
+	Directive string      `json:"directive"`
+	First     interface{} `json:"first"`
+	Second    interface{} `json:"second"`
+}
+
+func newConfigDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <file1> <file2>",
+		Short: "Shows the directives that differ between two config files",
+		Long: `The diff subcommand compares the directives set in two config files, which may be in different formats.
+Only directives whose values differ (including directives that are only set in one of the files) are printed.
+When both files are equivalent, nothing is printed.`,
+		Example: `  mydyndns config diff running.toml candidate.toml
+  mydyndns config diff mydyndns.toml mydyndns.json --format json`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+				return err
+			}
+			return validateConfigFileNames(args)
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if format := viper.GetString("format"); format != "table" && format != "json" {
+				return fmt.Errorf("unsupported format %q (must be one of: table, json)", format)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diffs, err := diffConfigFiles(args[0], args[1])
+			if err != nil || len(diffs) == 0 {
+				return err
+			}
+
+			if viper.GetString("format") == "json" {
+				out, err := json.Marshal(diffs)
+				if err != nil {
+					return err
+				}
+				cmd.Println(string(out))
+				return nil
+			}
+
+			formatValue := func(v interface{}) string {
+				if v == nil {
+					return "(unset)"
+				}
+				return fmt.Sprint(v)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "DIRECTIVE\t%s\t%s\n", args[0], args[1])
+			for _, d := range diffs {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", d.Directive, formatValue(d.First), formatValue(d.Second))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().String("format", "table", "Output format (table or json)")
+
+	return cmd
+}
+
+// diffConfigFiles reads each of the given config files with an isolated Viper and returns the directives
+// whose values differ between them, sorted by directive name.
+func diffConfigFiles(first, second string) ([]configDifference, error) {
+	readConfig := func(filename string) (*viper.Viper, error) {
+		v := viper.New()
+		v.SetConfigFile(filename)
+		return v, v.ReadInConfig()
+	}
+	v1, err := readConfig(first)
+	if err != nil {
+		return nil, err
+	}
+	v2, err := readConfig(second)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := internal.NewStringCollection(v1.AllKeys()...)
+	keys.Add(v2.AllKeys()...)
+
+	diffs := make([]configDifference, 0)
+	keys.EachSorted(func(key string) {
+		first, second := v1.Get(key), v2.Get(key)
+		// Compare string representations, since parsed value types vary according to config file format
+		if first == nil || second == nil || fmt.Sprint(first) != fmt.Sprint(second) {
+			diffs = append(diffs, configDifference{Directive: key, First: first, Second: second})
+		}
+	})
+	return diffs, nil
+}
+
+func newConfigMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge <file1> <file2> [...] --output-file <file>",
+		Short: "Merges multiple config files into one",
+		Long: `The merge subcommand combines the directives set in two or more config files, which may be in different formats,
+and writes the result to a single config file. When a directive is set in more than one file, the value from the file
+provided later in the list of arguments takes precedence.`,
+		Example: `  mydyndns config merge credentials.toml timing.yaml --output-file mydyndns.toml
+  mydyndns config merge base.json overrides.json --output-file mydyndns.json --safe`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.MinimumNArgs(2)(cmd, args); err != nil {
+				return err
+			}
+			return validateConfigFileNames(args)
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			output := viper.GetString("output-file")
+			if output == "" {
+				return fmt.Errorf("missing output file directive")
+			} else if ext := filepath.Ext(output); ext == "" {
+				return viper.UnsupportedConfigError(output)
+			}
+			return validateConfigFileNames([]string{output})
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			merged := viper.New()
+			for _, filename := range args {
+				v := viper.New()
+				v.SetConfigFile(filename)
+				if err := v.ReadInConfig(); err != nil {
+					return err
+				}
+				if err := merged.MergeConfigMap(v.AllSettings()); err != nil {
+					return err
+				}
+			}
+
+			writeFunc := merged.WriteConfigAs
+			if viper.GetBool("safe") {
+				writeFunc = merged.SafeWriteConfigAs
+			}
+			output := viper.GetString("output-file")
+			if err := writeFunc(output); err != nil {
+				return err
+			}
+			cmd.Println(output)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("output-file", "",
+		"Config file to which the merged directives are written (required)")
+	cmd.Flags().Bool("safe", false,
+		"Fails when an existing file would be overwritten")
+
+	return cmd
+}
+
+func newConfigUpgradeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade <file>",
+		Short: "Upgrades a config file to a newer config schema version",
+		Long: fmt.Sprintf(`The upgrade subcommand migrates the directives of a config file written for an older config schema version (as
+recorded by its %[1]s directive, or %[2]d when it has none) to a newer schema version, and overwrites the file with
+the result. Unless --to-version is set, the file is upgraded to the current schema version (%[3]d).`,
+			migrations.SchemaVersionKey, migrations.InitialVersion, migrations.CurrentVersion),
+		Example: `  mydyndns config upgrade mydyndns.toml
+  mydyndns config upgrade mydyndns.toml --from-version 1 --to-version 2`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+				return err
+			}
+			return validateConfigFileNames(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.New()
+			v.SetConfigFile(args[0])
+			if err := v.ReadInConfig(); err != nil {
+				return err
+			}
+			settings := v.AllSettings()
+
+			from := viper.GetInt("from-version")
+			if from == 0 {
+				var err error
+				if from, err = migrations.Version(settings); err != nil {
+					return err
+				}
+			}
+			to := viper.GetInt("to-version")
+			if err := migrations.Upgrade(settings, from, to); err != nil {
+				return err
+			}
+
+			upgraded := viper.New()
+			if err := upgraded.MergeConfigMap(settings); err != nil {
+				return err
+			}
+			if err := upgraded.WriteConfigAs(args[0]); err != nil {
+				return err
+			}
+			cmd.Printf("Upgraded %s from schema version %d to %d\n", args[0], from, to)
+			return nil
+		},
+	}
+
+	cmd.Flags().Int("from-version", 0,
+		fmt.Sprintf("Schema version of the config file (read from its %s directive when 0)", migrations.SchemaVersionKey))
+	cmd.Flags().Int("to-version", migrations.CurrentVersion,
+		"Schema version to which the config file is upgraded")
 
 	return cmd
 }
 
 func newConfigShowCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "show",
 		Short: "Displays the effective configuration for the mydyndns agent.",
 		Long: `The show subcommand is useful for checking the effective agent configuration, especially when multiple
 configuration sources (environment variables, config file, and/or CLI flags) are in-use.
 
-Note that the output from this command should not be used to create config files, as its output is meant to be human-
-readable and is not intended to be compatible with any supported configuration file format. To generate usable config
-files in a variety of supported formats, see the "agent config write" subcommand.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			for k, v := range viper.AllSettings() {
-				if k == "help" {
-					continue
+The output format is selected with the --output flag:
+  text  One "directive = value" line per directive, sorted alphabetically by directive (default)
+  json  A JSON object of all directives, which may be piped to "config write --stdin-format json"
+  env   One MYDYNDNS_DIRECTIVE='value' line per directive, suitable for sourcing in a POSIX shell
+
+With --diff-from-defaults, only directives whose effective value differs from their default value are shown.
+
+With --export-shell, one MYDYNDNS_DIRECTIVE='value' assignment per directive is printed (in place of --output) for
+pasting into a POSIX shell session. Assignments of directives that have their default value are commented out with
+"# ", which distinguishes them from explicitly-set directives.
+
+Sensitive directive values (api-key, or those selected with --redact-keys) are masked as "****" unless the --no-redact
+flag is set. Since masked values would be written as-is, --no-redact is required when the output is piped to
+"config write".`,
+		Example: `  mydyndns config show --config-file mydyndns.toml
+  mydyndns config show --diff-from-defaults
+  mydyndns config show --redact-keys api-key --redact-keys api-url
+  mydyndns config show --output json --no-redact | mydyndns config write --stdin-format json json
+  set -a; eval "$(mydyndns config show --output env --no-redact)"; set +a
+  mydyndns config show --export-shell --no-redact`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if viper.GetBool("export-shell") && cmd.Flags().Changed("output") {
+				return fmt.Errorf("export-shell cannot be used with output (which selects another format)")
+			}
+			switch format := viper.GetString("output"); format {
+			case outputFormatText, outputFormatJSON, outputFormatEnv:
+				return nil
+			default:
+				return fmt.Errorf("unsupported output format %q (must be one of: text, json, env)", format)
+			}
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings := viper.AllSettings()
+			delete(settings, "help")
+			settings[configFileSettingKey] = viper.ConfigFileUsed()
+			// An API key read from api-key-file is not part of the configuration (the file is)
+			if viper.GetString("api-key-file") != "" {
+				delete(settings, "api-key")
+			}
+			// The output format given to this command only applies to its own output, so it is not a directive
+			// worth reproducing (e.g. when the output is used to write a config file)
+			if cmd.Flags().Changed("output") {
+				delete(settings, "output")
+			}
+			for _, k := range []string{"diff-from-defaults", "export-shell", "no-redact", "redact-keys"} {
+				delete(settings, k)
+			}
+			if viper.GetBool("diff-from-defaults") {
+				cmd.Flags().VisitAll(func(f *pflag.Flag) {
+					if isDefaultValue(f) {
+						delete(settings, f.Name)
+					}
+				})
+			}
+
+			redactDirectives(settings)
+
+			if viper.GetBool("export-shell") {
+				for _, k := range sortedKeys(settings) {
+					var comment string
+					if f := cmd.Flags().Lookup(k); f != nil && isDefaultValue(f) {
+						comment = "# "
+					}
+					cmd.Printf("%s%s=%s\n", comment, flagNameToEnvVar(k), shellQuote("sh", fmt.Sprint(settings[k])))
+				}
+				return nil
+			}
+
+			switch viper.GetString("output") {
+			case outputFormatJSON:
+				out, err := json.Marshal(settings)
+				if err != nil {
+					return err
 				}
-				if k == configFileSettingKey {
-					v = viper.ConfigFileUsed()
+				cmd.Println(string(out))
+			case outputFormatEnv:
+				for _, k := range sortedKeys(settings) {
+					cmd.Printf("%s=%s\n", flagNameToEnvVar(k), shellQuote("bash", fmt.Sprint(settings[k])))
+				}
+			default:
+				for _, k := range sortedKeys(settings) {
+					cmd.Printf("%s = %v\n", k, settings[k])
 				}
-				cmd.Printf("%s = %v\n", k, v)
 			}
+			return nil
 		},
 	}
+
+	cmd.Flags().Bool("diff-from-defaults", false,
+		"Only show directives whose effective value differs from the default value")
+	cmd.Flags().Bool("export-shell", false,
+		"Print POSIX shell variable assignments (commenting out those of default values) instead of --output")
+	addRedactionFlags(cmd)
+
+	return cmd
+}
+
+// isDefaultValue reports whether the effective value of the directive corresponding to f equals the default value
+// of f. Values are compared according to the type of f, so that e.g. an interval of "60m" equals a default of "1h0m0s".
+func isDefaultValue(f *pflag.Flag) bool {
+	switch f.Value.Type() {
+	case "bool":
+		def, err := strconv.ParseBool(f.DefValue)
+		return err == nil && viper.GetBool(f.Name) == def
+	case "int", "count":
+		def, err := strconv.Atoi(f.DefValue)
+		return err == nil && viper.GetInt(f.Name) == def
+	case "duration":
+		def, err := time.ParseDuration(f.DefValue)
+		return err == nil && viper.GetDuration(f.Name) == def
+	case "stringSlice", "stringArray":
+		// Format the value like the default value of a flag of the same type, which quotes elements as needed
+		values := pflag.NewFlagSet("", pflag.ContinueOnError)
+		if f.Value.Type() == "stringSlice" {
+			values.StringSlice(f.Name, viper.GetStringSlice(f.Name), "")
+		} else {
+			values.StringArray(f.Name, viper.GetStringSlice(f.Name), "")
+		}
+		return values.Lookup(f.Name).DefValue == f.DefValue
+	default:
+		return viper.GetString(f.Name) == f.DefValue
+	}
+}
+
+// flagDefault returns the default value of f as it should be written to a config file: slice flags default to a list
+// of values (rather than the string representation of that list), and all other flags to their default value string.
+func flagDefault(f *pflag.Flag) interface{} {
+	switch f.Value.Type() {
+	case "stringSlice", "stringArray":
+		values := pflag.NewFlagSet("", pflag.ContinueOnError)
+		values.StringSlice(f.Name, nil, "")
+		// The elements of the default value string are comma-separated and quoted as needed
+		if elements := strings.TrimSuffix(strings.TrimPrefix(f.DefValue, "["), "]"); elements != "" {
+			values.Set(f.Name, elements)
+		}
+		defaults, _ := values.GetStringSlice(f.Name)
+		return append([]string{}, defaults...)
+	default:
+		return f.DefValue
+	}
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func newConfigTypesCmd() *cobra.Command {
@@ -208,18 +859,34 @@ func newConfigTypesListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "Print a list of supported configuration file types (as extensions)",
 		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
-			if viper.GetBool("bare") {
-				for _, ext := range viper.SupportedExts {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exts := slices.Clone(viper.SupportedExts)
+			if viper.GetBool("sorted") {
+				slices.Sort(exts)
+			}
+
+			switch {
+			case viper.GetBool("json"):
+				out, err := json.Marshal(exts)
+				if err != nil {
+					return err
+				}
+				cmd.Println(string(out))
+			case viper.GetBool("bare"):
+				for _, ext := range exts {
 					cmd.Println(ext)
 				}
-			} else {
-				cmd.Printf("Supported config file extensions: %s\n", strings.Join(viper.SupportedExts, ", "))
+			default:
+				cmd.Printf("Supported config file extensions: %s\n", strings.Join(exts, ", "))
 			}
+			return nil
 		},
 	}
 
 	cmd.Flags().Bool("bare", false, "Outputs one extension per line")
+	cmd.Flags().Bool("json", false, "Outputs a JSON array of extensions")
+	cmd.Flags().Bool("sorted", false, "Outputs extensions in alphabetical order")
+	cmd.MarkFlagsMutuallyExclusive("bare", "json")
 
 	return cmd
 }
@@ -258,15 +925,158 @@ preceded by a dot (as a file extension) any of the following values: %s`, string
 	}
 }
 
+// configValidationResult is the machine-readable outcome of "config validate".
+type configValidationResult struct {
+	Valid  bool                    `json:"valid"`
+	Errors []configValidationIssue `json:"errors,omitempty"`
+}
+
+// configValidationIssue describes a single validation failure reported by "config validate".
+type configValidationIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func newConfigValidateCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "validate",
 		Short: "Checks the effective agent configuration for issues",
 		Long: `The validate subcommand isolates the configuration checks executed when the mydyndns agent starts. Use this to
-check whether the agent would fail to start due to invalid configuration, without actually running the agent.`,
+check whether the agent would fail to start due to invalid configuration, without actually running the agent.
+With --strict, config directives that do not correspond to any mydyndns flag (e.g. typos) are also reported.
+With --output json, every issue found is reported as a JSON object instead of only the first, e.g.
+{"valid":false,"errors":[{"code":"missing_api_key","message":"missing API key directive"}]}`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			validators := []func(*cobra.Command) error{validateAPIKey, validateBaseURL, validatePollInterval}
+			if viper.GetBool("strict") {
+				validators = append([]func(*cobra.Command) error{validateKnownConfigKeys}, validators...)
+			}
+			errs := allValidationErrors(cmd, validators...)
+			if viper.GetString("output") != "json" {
+				if len(errs) > 0 {
+					return errs[0]
+				}
+				return nil
+			}
+
+			result := configValidationResult{Valid: len(errs) == 0}
+			for _, err := range errs {
+				result.Errors = append(result.Errors, configValidationIssue{
+					Code:    validationErrorCode(err),
+					Message: err.Error(),
+				})
+			}
+			out, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			cmd.Println(string(out))
+			if !result.Valid {
+				// The outcome has already been reported, so only the exit status is relevant
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return ExitError{code: ExitConfigError}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("strict", false, "Treat unrecognized config directives as errors")
+
+	return cmd
+}
+
+// knownConfigKeys returns the names of all flags registered on the command tree to which cmd belongs,
+// each of which is a recognized config directive.
+func knownConfigKeys(cmd *cobra.Command) *internal.StringCollection {
+	known := internal.NewStringCollection(migrations.SchemaVersionKey)
+	var visit func(*cobra.Command)
+	visit = func(c *cobra.Command) {
+		for _, flags := range []*pflag.FlagSet{c.PersistentFlags(), c.LocalFlags()} {
+			flags.VisitAll(func(f *pflag.Flag) {
+				known.Add(f.Name)
+			})
+		}
+		for _, sub := range c.Commands() {
+			visit(sub)
+		}
+	}
+	visit(cmd.Root())
+	return known
+}
+
+func newConfigWatchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Re-validates the config file whenever it changes",
+		Long: strings.TrimSpace(`
+The watch subcommand polls the resolved config file for changes and, whenever its contents change, re-runs the
+configuration checks executed when the mydyndns agent starts. The outcome of each check is printed as a timestamped
+OK or ERROR line. The command runs until interrupted (e.g. with ctrl-c).`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return firstValidationError(cmd,
-				validateAPIKey, validateBaseURL, validatePollInterval)
+			configFile := viper.ConfigFileUsed()
+			if configFile == "" {
+				return fmt.Errorf("no config file found to watch")
+			}
+			interval, err := cmd.Flags().GetDuration("interval")
+			if err != nil {
+				return err
+			}
+			if interval <= 0 {
+				return fmt.Errorf("watch interval must be positive (received %s)", interval)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+			defer stop()
+
+			cmd.Printf("Watching %s for changes (every %s)...\n", configFile, interval)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			var previous []byte
+			for first := true; ; first = false {
+				contents, readErr := os.ReadFile(configFile)
+				if first || readErr != nil || !bytes.Equal(contents, previous) {
+					if readErr == nil {
+						readErr = revalidateConfig(cmd)
+					}
+					printWatchResult(cmd, readErr)
+					previous = contents
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
 		},
 	}
+
+	// NB: This flag shadows the global interval flag, which is restored by revalidateConfig
+	cmd.Flags().Duration("interval", time.Second,
+		"How often to check the config file for changes")
+
+	return cmd
+}
+
+// revalidateConfig re-reads the effective configuration and runs the checks performed by "config validate".
+func revalidateConfig(cmd *cobra.Command) error {
+	if err := bootstrapConfig(cmd); err != nil {
+		return err
+	}
+	// The watch command's local interval flag is bound in place of the global interval (poll interval) flag
+	if err := viper.BindPFlag("interval", cmd.Root().PersistentFlags().Lookup("interval")); err != nil {
+		return err
+	}
+	return firstValidationError(cmd, validateAPIKey, validateBaseURL, validatePollInterval)
+}
+
+// printWatchResult prints a timestamped line describing the outcome of a config file check.
+func printWatchResult(cmd *cobra.Command, err error) {
+	ts := time.Now().Format(time.RFC3339)
+	if err != nil {
+		cmd.Printf("%s ERROR: %s\n", ts, err)
+	} else {
+		cmd.Printf("%s OK\n", ts)
+	}
 }
@@ -1,8 +1,18 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -11,6 +21,9 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/cmd/mydyndns/cli/migrations"
+	"github.com/TylerHendrickson/mydyndns/internal/crypto"
 )
 
 func TestConfigWriteCmd(t *testing.T) {
@@ -35,11 +48,29 @@ func TestConfigWriteCmd(t *testing.T) {
 			false,
 			[]string{"mydyndns.toml"},
 			map[string]interface{}{
-				"api-key":       "",
-				"api-url":       "",
-				"interval":      defaultPollInterval.String(),
-				"log-json":      "false",
-				"log-verbosity": "0",
+				"api-check-url":        "",
+				"api-key":              "",
+				"api-header":           []interface{}{},
+				"api-key-file":         "",
+				"api-proxy":            "",
+				"api-timeout":          defaultAPITimeout.String(),
+				"api-tls-ca-cert":      "",
+				"api-tls-cert":         "",
+				"api-tls-key":          "",
+				"api-tls-skip-verify":  "false",
+				"api-url":              "",
+				"api-url-template":     "",
+				"interval":             defaultPollInterval.String(),
+				"log-file":             "",
+				"log-json":             "false",
+				"log-max-size-mb":      "100",
+				"log-redact-headers":   []interface{}{"x-api-key"},
+				"log-request-response": "false",
+				"log-verbosity":        "0",
+				"output":               "text",
+				"secret-backend":       "env",
+				"secret-id":            "",
+				"vault-path":           "",
 			},
 			returnsNil,
 		},
@@ -50,6 +81,9 @@ func TestConfigWriteCmd(t *testing.T) {
 			[]string{
 				"--api-key=asdfjkl",
 				"--api-url=https://example.com",
+				"--api-check-url=https://check.example.com",
+				"--api-proxy=http://proxy.example.com:3128",
+				"--api-timeout=10s",
 				"--interval=24h",
 				"--log-json",
 				"--log-verbosity=2",
@@ -58,11 +92,29 @@ func TestConfigWriteCmd(t *testing.T) {
 			false,
 			[]string{"mydyndns.toml"},
 			map[string]interface{}{
-				"api-key":       "asdfjkl",
-				"api-url":       "https://example.com",
-				"interval":      (time.Hour * 24).String(),
-				"log-json":      true,
-				"log-verbosity": "2",
+				"api-check-url":        "https://check.example.com",
+				"api-key":              "asdfjkl",
+				"api-header":           []interface{}{},
+				"api-key-file":         "",
+				"api-proxy":            "http://proxy.example.com:3128",
+				"api-timeout":          (time.Second * 10).String(),
+				"api-tls-ca-cert":      "",
+				"api-tls-cert":         "",
+				"api-tls-key":          "",
+				"api-tls-skip-verify":  false,
+				"api-url":              "https://example.com",
+				"api-url-template":     "",
+				"interval":             (time.Hour * 24).String(),
+				"log-file":             "",
+				"log-json":             true,
+				"log-max-size-mb":      int64(100),
+				"log-redact-headers":   []interface{}{"x-api-key"},
+				"log-request-response": false,
+				"log-verbosity":        "2",
+				"output":               "text",
+				"secret-backend":       "env",
+				"secret-id":            "",
+				"vault-path":           "",
 			},
 			returnsNil,
 		},
@@ -74,11 +126,29 @@ func TestConfigWriteCmd(t *testing.T) {
 			false,
 			[]string{"foobar.yaml"},
 			map[string]interface{}{
-				"api-key":       "",
-				"api-url":       "",
-				"interval":      defaultPollInterval.String(),
-				"log-json":      "false",
-				"log-verbosity": "0",
+				"api-check-url":        "",
+				"api-key":              "",
+				"api-header":           []interface{}{},
+				"api-key-file":         "",
+				"api-proxy":            "",
+				"api-timeout":          defaultAPITimeout.String(),
+				"api-tls-ca-cert":      "",
+				"api-tls-cert":         "",
+				"api-tls-key":          "",
+				"api-tls-skip-verify":  "false",
+				"api-url":              "",
+				"api-url-template":     "",
+				"interval":             defaultPollInterval.String(),
+				"log-file":             "",
+				"log-json":             "false",
+				"log-max-size-mb":      "100",
+				"log-redact-headers":   []interface{}{"x-api-key"},
+				"log-request-response": "false",
+				"log-verbosity":        "0",
+				"output":               "text",
+				"secret-backend":       "env",
+				"secret-id":            "",
+				"vault-path":           "",
 			},
 			returnsNil,
 		},
@@ -90,11 +160,29 @@ func TestConfigWriteCmd(t *testing.T) {
 			false,
 			[]string{"mydyndns.toml", "foobar.yaml", "mydyndns.json", "mydyndns.yml"},
 			map[string]interface{}{
-				"api-key":       "",
-				"api-url":       "",
-				"interval":      defaultPollInterval.String(),
-				"log-json":      "false",
-				"log-verbosity": "0",
+				"api-check-url":        "",
+				"api-key":              "",
+				"api-header":           []interface{}{},
+				"api-key-file":         "",
+				"api-proxy":            "",
+				"api-timeout":          defaultAPITimeout.String(),
+				"api-tls-ca-cert":      "",
+				"api-tls-cert":         "",
+				"api-tls-key":          "",
+				"api-tls-skip-verify":  "false",
+				"api-url":              "",
+				"api-url-template":     "",
+				"interval":             defaultPollInterval.String(),
+				"log-file":             "",
+				"log-json":             "false",
+				"log-max-size-mb":      "100",
+				"log-redact-headers":   []interface{}{"x-api-key"},
+				"log-request-response": "false",
+				"log-verbosity":        "0",
+				"output":               "text",
+				"secret-backend":       "env",
+				"secret-id":            "",
+				"vault-path":           "",
 			},
 			returnsNil,
 		},
@@ -106,11 +194,29 @@ func TestConfigWriteCmd(t *testing.T) {
 			false,
 			[]string{"foobar.yaml"},
 			map[string]interface{}{
-				"api-key":       "",
-				"api-url":       "",
-				"interval":      defaultPollInterval.String(),
-				"log-json":      "false",
-				"log-verbosity": "0",
+				"api-check-url":        "",
+				"api-key":              "",
+				"api-header":           []interface{}{},
+				"api-key-file":         "",
+				"api-proxy":            "",
+				"api-timeout":          defaultAPITimeout.String(),
+				"api-tls-ca-cert":      "",
+				"api-tls-cert":         "",
+				"api-tls-key":          "",
+				"api-tls-skip-verify":  "false",
+				"api-url":              "",
+				"api-url-template":     "",
+				"interval":             defaultPollInterval.String(),
+				"log-file":             "",
+				"log-json":             "false",
+				"log-max-size-mb":      "100",
+				"log-redact-headers":   []interface{}{"x-api-key"},
+				"log-request-response": "false",
+				"log-verbosity":        "0",
+				"output":               "text",
+				"secret-backend":       "env",
+				"secret-id":            "",
+				"vault-path":           "",
 			},
 			func(tt TT) error {
 				return viper.ConfigFileAlreadyExistsError(filepath.Join(tt.configDir, "foobar.yaml"))
@@ -187,13 +293,245 @@ func TestConfigWriteCmd(t *testing.T) {
 					v := viper.New()
 					v.SetConfigFile(expectedOutputFilename)
 					require.NoError(t, v.ReadInConfig())
-					assert.Equal(t, tt.expectedConfig, v.AllSettings())
+					settings := v.AllSettings()
+					assert.Equal(t, migrations.CurrentVersion, v.GetInt(migrations.SchemaVersionKey),
+						"written config files should record the current schema version")
+					delete(settings, migrations.SchemaVersionKey)
+					assert.Equal(t, tt.expectedConfig, settings)
 				})
 			}
 		})
 	}
 }
 
+// pipeStdin replaces os.Stdin with a pipe from which data can be read, until the test completes.
+func pipeStdin(t *testing.T, data string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestConfigWriteCmdFromStdin(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "base.toml")
+	require.NoError(t, os.WriteFile(configFile,
+		[]byte("api-key = \"base-key\"\napi-url = \"https://base.example.com\"\n"), 0o644))
+
+	for _, tt := range []struct {
+		format, data string
+	}{
+		{"toml", "api-url = \"https://stdin.example.com\"\ninterval = \"24h\"\n"},
+		{"json", `{"api-url": "https://stdin.example.com", "interval": "24h"}`},
+		{"yaml", "api-url: https://stdin.example.com\ninterval: 24h\n"},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			pipeStdin(t, tt.data)
+			configDir := t.TempDir()
+			cmd, _, err := ExecuteC(newCLI(), "config", "write", "json", "--quiet",
+				fmt.Sprintf("--directory=%s", configDir), fmt.Sprintf("--config-file=%s", configFile),
+				fmt.Sprintf("--stdin-format=%s", tt.format))
+			require.Equal(t, "write", cmd.Name())
+			require.NoError(t, err)
+
+			v := viper.New()
+			v.SetConfigFile(filepath.Join(configDir, "mydyndns.json"))
+			require.NoError(t, v.ReadInConfig())
+			assert.Equal(t, "base-key", v.GetString("api-key"), "directives from the config file should be kept")
+			assert.Equal(t, "https://stdin.example.com", v.GetString("api-url"),
+				"directives from stdin should override those from the config file")
+			assert.Equal(t, 24*time.Hour, v.GetDuration("interval"))
+			assert.False(t, v.IsSet("stdin-format"))
+		})
+	}
+
+	for _, tt := range []struct {
+		name, data    string
+		args          []string
+		expectedError string
+	}{
+		{
+			"unsupported format",
+			"api-url = \"https://stdin.example.com\"",
+			[]string{"--stdin-format=ini2"},
+			fmt.Sprintf(`unsupported stdin format "ini2" (must be one of: %s)`,
+				strings.Join(viper.SupportedExts, ", ")),
+		},
+		{
+			"invalid data",
+			"{not json",
+			[]string{"--stdin-format=json"},
+			"unable to read config from stdin",
+		},
+		{
+			"with defaults",
+			"api-url = \"https://stdin.example.com\"",
+			[]string{"--stdin-format=toml", "--defaults"},
+			"stdin-format cannot be used with defaults (which ignore the effective configuration)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeStdin(t, tt.data)
+			args := append([]string{"config", "write", "toml", fmt.Sprintf("--directory=%s", t.TempDir())},
+				tt.args...)
+			_, _, err := ExecuteC(newCLI(), args...)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestConfigWriteCmdMergeFrom(t *testing.T) {
+	existing := map[string]interface{}{
+		"api-key": "existing-key", "api-url": "https://existing.example.com", "interval": "2h",
+	}
+
+	t.Run("overrides and preserves keys", func(t *testing.T) {
+		mergeFrom := writeConfig(t, "existing.yaml", existing)
+		configDir := t.TempDir()
+		cmd, _, err := ExecuteC(newCLI(), "config", "write", "json", "--quiet",
+			fmt.Sprintf("--directory=%s", configDir), fmt.Sprintf("--merge-from=%s", mergeFrom),
+			"--api-key=new-key")
+		require.Equal(t, "write", cmd.Name())
+		require.NoError(t, err)
+
+		v := viper.New()
+		v.SetConfigFile(filepath.Join(configDir, "mydyndns.json"))
+		require.NoError(t, v.ReadInConfig())
+		assert.Equal(t, "new-key", v.GetString("api-key"), "directives set by flags should be overridden")
+		assert.Equal(t, "https://existing.example.com", v.GetString("api-url"),
+			"directives from the merged file should be preserved")
+		assert.Equal(t, 2*time.Hour, v.GetDuration("interval"),
+			"directives from the merged file should not be replaced by defaults")
+		assert.False(t, v.IsSet("merge-from"))
+	})
+
+	t.Run("in-place update", func(t *testing.T) {
+		configFile := writeConfig(t, "mydyndns.toml", existing)
+		_, out, err := ExecuteC(newCLI(), "config", "write", configFile,
+			fmt.Sprintf("--merge-from=%s", configFile), "--interval=30m")
+		require.NoError(t, err)
+		assert.Equal(t, configFile, strings.TrimSpace(out))
+
+		v := viper.New()
+		v.SetConfigFile(configFile)
+		require.NoError(t, v.ReadInConfig())
+		assert.Equal(t, map[string]interface{}{
+			"api-key": "existing-key", "api-url": "https://existing.example.com", "interval": "30m0s",
+			migrations.SchemaVersionKey: int64(migrations.CurrentVersion),
+		}, v.AllSettings())
+	})
+
+	t.Run("safe in-place update fails", func(t *testing.T) {
+		configFile := writeConfig(t, "mydyndns.toml", existing)
+		before, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		_, _, err = ExecuteC(newCLI(), "config", "write", configFile,
+			fmt.Sprintf("--merge-from=%s", configFile), "--interval=30m", "--safe")
+		assert.ErrorIs(t, err, viper.ConfigFileAlreadyExistsError(configFile))
+		after, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		assert.Equal(t, string(before), string(after), "existing file should not be modified")
+	})
+
+	for _, tt := range []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{"missing file", []string{"--merge-from=" + filepath.Join(t.TempDir(), "missing.toml")},
+			"unable to read config file to merge from"},
+		{"unsupported file type", []string{"--merge-from=existing.bespokeformat"}, "Unsupported Config Type"},
+		{"with defaults", []string{"--merge-from=existing.toml", "--defaults"},
+			"merge-from cannot be used with defaults (which ignore the effective configuration)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"config", "write", "toml", fmt.Sprintf("--directory=%s", t.TempDir())},
+				tt.args...)
+			_, _, err := ExecuteC(newCLI(), args...)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestConfigWriteCmdEncrypted(t *testing.T) {
+	keyDir := t.TempDir()
+	keyFile := filepath.Join(keyDir, "config.key")
+	require.NoError(t, os.WriteFile(keyFile, bytes.Repeat([]byte{0x01}, crypto.KeySize), 0o600))
+	wrongKeyFile := filepath.Join(keyDir, "wrong.key")
+	require.NoError(t, os.WriteFile(wrongKeyFile, bytes.Repeat([]byte{0x02}, crypto.KeySize), 0o600))
+
+	for _, format := range []string{"toml", "json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			configDir := t.TempDir()
+			configFile := filepath.Join(configDir, "mydyndns."+format)
+			_, _, err := ExecuteC(newCLI(), "config", "write", format, "--quiet",
+				fmt.Sprintf("--directory=%s", configDir), fmt.Sprintf("--encrypt-key=%s", keyFile),
+				"--api-url=https://example.com", "--api-key=it's-secret", "--interval=2m")
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(configFile)
+			require.NoError(t, err)
+			assert.True(t, crypto.IsEncrypted(data), "written file should be encrypted")
+			assert.NotContains(t, string(data), "it's-secret")
+			info, err := os.Stat(configFile)
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+			_, out, err := ExecuteC(newCLI(), "config", "show", "--no-redact",
+				fmt.Sprintf("--config-file=%s", configFile), fmt.Sprintf("--decrypt-key=%s", keyFile))
+			require.NoError(t, err)
+			assert.Contains(t, out, "api-key = it's-secret\n")
+			assert.Contains(t, out, "api-url = https://example.com\n")
+			assert.Contains(t, out, "interval = 2m0s\n")
+
+			_, _, err = ExecuteC(newCLI(), "config", "show",
+				fmt.Sprintf("--config-file=%s", configFile), fmt.Sprintf("--decrypt-key=%s", wrongKeyFile))
+			assert.EqualError(t, err, fmt.Sprintf(
+				"unable to read config file %s: decryption failed: wrong key or corrupted data", configFile))
+
+			_, _, err = ExecuteC(newCLI(), "config", "show", fmt.Sprintf("--config-file=%s", configFile))
+			assert.EqualError(t, err, fmt.Sprintf(
+				"unable to read config file %s: file is encrypted (set --decrypt-key to decrypt it)", configFile))
+		})
+	}
+
+	t.Run("safe", func(t *testing.T) {
+		configDir := t.TempDir()
+		configFile := filepath.Join(configDir, "mydyndns.toml")
+		require.NoError(t, os.WriteFile(configFile, []byte("api-key = \"existing\"\n"), 0o644))
+		_, _, err := ExecuteC(newCLI(), "config", "write", "toml", "--safe",
+			fmt.Sprintf("--directory=%s", configDir), fmt.Sprintf("--encrypt-key=%s", keyFile))
+		assert.EqualError(t, err, viper.ConfigFileAlreadyExistsError(configFile).Error())
+		data, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		assert.Equal(t, "api-key = \"existing\"\n", string(data), "existing file should not be modified")
+	})
+
+	t.Run("plaintext config with decrypt key", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "mydyndns.toml")
+		require.NoError(t, os.WriteFile(configFile, []byte("api-key = \"plaintext\"\n"), 0o644))
+		_, out, err := ExecuteC(newCLI(), "config", "show", "--no-redact",
+			fmt.Sprintf("--config-file=%s", configFile), fmt.Sprintf("--decrypt-key=%s", keyFile))
+		require.NoError(t, err)
+		assert.Contains(t, out, "api-key = plaintext\n")
+	})
+
+	t.Run("invalid key file", func(t *testing.T) {
+		shortKeyFile := filepath.Join(t.TempDir(), "short.key")
+		require.NoError(t, os.WriteFile(shortKeyFile, []byte("short"), 0o600))
+		_, _, err := ExecuteC(newCLI(), "config", "write", "toml", fmt.Sprintf("--directory=%s", t.TempDir()),
+			fmt.Sprintf("--encrypt-key=%s", shortKeyFile))
+		assert.EqualError(t, err, fmt.Sprintf("key file %s must contain exactly 32 bytes (found 5)", shortKeyFile))
+	})
+}
+
 func TestConfigWriteCmdArgCompletion(t *testing.T) {
 	for _, tt := range []struct {
 		name                string
@@ -271,6 +609,53 @@ func TestConfigTypesListCmd(t *testing.T) {
 		outList := strings.Split(strings.TrimSpace(out), "\n")
 		assert.ElementsMatch(t, outList, viper.SupportedExts)
 	})
+
+	t.Run("json", func(t *testing.T) {
+		cmd, out, err := ExecuteC(newCLI(), "config", "types", "list", "--json")
+
+		require.Equal(t, "list", cmd.Name())
+		require.Nil(t, err)
+		var outList []string
+		require.NoError(t, json.Unmarshal([]byte(out), &outList), "output should be valid JSON")
+		assert.Equal(t, viper.SupportedExts, outList)
+	})
+
+	t.Run("sorted", func(t *testing.T) {
+		supportedExts := slices.Clone(viper.SupportedExts)
+		sortedExts := slices.Sorted(slices.Values(viper.SupportedExts))
+		for _, tt := range []struct {
+			name  string
+			flags []string
+			parse func(out string) []string
+		}{
+			{"default", nil, func(out string) []string {
+				return strings.Split(strings.TrimSpace(out[strings.Index(out, ":")+1:]), ", ")
+			}},
+			{"bare", []string{"--bare"}, func(out string) []string {
+				return strings.Split(strings.TrimSpace(out), "\n")
+			}},
+			{"json", []string{"--json"}, func(out string) (outList []string) {
+				require.NoError(t, json.Unmarshal([]byte(out), &outList))
+				return
+			}},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				args := append([]string{"config", "types", "list", "--sorted"}, tt.flags...)
+				cmd, out, err := ExecuteC(newCLI(), args...)
+
+				require.Equal(t, "list", cmd.Name())
+				require.Nil(t, err)
+				assert.Equal(t, sortedExts, tt.parse(out))
+			})
+		}
+		assert.Equal(t, supportedExts, viper.SupportedExts, "sorting should not modify viper.SupportedExts")
+	})
+
+	t.Run("bare and json are mutually exclusive", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "config", "types", "list", "--bare", "--json")
+		assert.EqualError(t, err,
+			"if any flags in the group [bare json] are set none of the others can be; [bare json] were all set")
+	})
 }
 
 func TestConfigTypesCheckCmd(t *testing.T) {
@@ -303,15 +688,38 @@ func TestConfigShowCmd(t *testing.T) {
 	// Clean slate – ensure settings don't leak from previous tests
 	viper.Reset()
 
-	makeExpectedConfig := func(apiURL, apiKey, configFile, configPath, interval, logJson, logVerbosity string) map[string]string {
+	makeExpectedConfig := func(
+		apiURL, apiCheckURL, apiKey, apiTimeout, configFile, configPath, interval, logJson, logVerbosity string,
+	) map[string]string {
 		return map[string]string{
 			"api-url":       fmt.Sprintf("%v", apiURL),
+			"api-check-url": fmt.Sprintf("%v", apiCheckURL),
 			"api-key":       fmt.Sprintf("%v", apiKey),
+			"api-timeout":   fmt.Sprintf("%v", apiTimeout),
 			"config-file":   fmt.Sprintf("%v", configFile),
 			"config-path":   fmt.Sprintf("%v", configPath),
 			"interval":      fmt.Sprintf("%v", interval),
 			"log-json":      fmt.Sprintf("%v", logJson),
 			"log-verbosity": fmt.Sprintf("%v", logVerbosity),
+			// Directives that are not customized by any test case
+			"api-header":           "[]",
+			"api-key-file":         "",
+			"api-proxy":            "",
+			"api-tls-ca-cert":      "",
+			"api-tls-cert":         "",
+			"api-tls-key":          "",
+			"api-tls-skip-verify":  "false",
+			"decrypt-key":          "",
+			"log-file":             "",
+			"log-max-size-mb":      "100",
+			"log-redact-headers":   "[x-api-key]",
+			"log-request-response": "false",
+			"no-config-discovery":  "false",
+			"output":               "text",
+			"preprocess-config":    "false",
+			"secret-backend":       "env",
+			"secret-id":            "",
+			"vault-path":           "",
 		}
 	}
 
@@ -328,7 +736,9 @@ func TestConfigShowCmd(t *testing.T) {
 			func(t *testing.T, cmd *cobra.Command, args ...string) (*cobra.Command, string, error) {
 				args = append(args,
 					"--api-url=https://example.com/Test-flags",
+					"--api-check-url=https://check.example.com/Test-flags",
 					"--api-key=my-api-key",
+					"--api-timeout=5s",
 					"--interval=2m",
 					"--log-json=true",
 					"--log-verbosity=1",
@@ -337,7 +747,9 @@ func TestConfigShowCmd(t *testing.T) {
 			},
 			makeExpectedConfig(
 				"https://example.com/Test-flags",
-				"my-api-key",
+				"https://check.example.com/Test-flags",
+				redactedValue,
+				fmt.Sprint(time.Second*5),
 				"",
 				".",
 				fmt.Sprint(time.Minute*2),
@@ -350,14 +762,16 @@ func TestConfigShowCmd(t *testing.T) {
 			func(t *testing.T, cmd *cobra.Command, args ...string) (*cobra.Command, string, error) {
 				return ExecuteC(cmd, args...)
 			},
-			makeExpectedConfig("", "", "", ".", fmt.Sprint(defaultPollInterval), "false", "0"),
+			makeExpectedConfig("", "", "", fmt.Sprint(defaultAPITimeout), "", ".", fmt.Sprint(defaultPollInterval), "false", "0"),
 		},
 		{
 			"file",
 			func(t *testing.T, cmd *cobra.Command, args ...string) (*cobra.Command, string, error) {
 				v := viper.New()
 				v.Set("api-url", "https://example.com/Test-file")
+				v.Set("api-check-url", "https://check.example.com/Test-file")
 				v.Set("api-key", "some-api-key")
+				v.Set("api-timeout", (time.Minute).String())
 				v.Set("interval", (time.Hour * 12).String())
 				v.Set("log-json", true)
 				v.Set("log-verbosity", 2)
@@ -367,7 +781,9 @@ func TestConfigShowCmd(t *testing.T) {
 			},
 			makeExpectedConfig(
 				"https://example.com/Test-file",
-				"some-api-key",
+				"https://check.example.com/Test-file",
+				redactedValue,
+				fmt.Sprint(time.Minute),
 				configFile.Name(),
 				configDir,
 				fmt.Sprint(time.Hour*12),
@@ -397,6 +813,226 @@ func TestConfigShowCmd(t *testing.T) {
 	}
 }
 
+func TestConfigShowCmdOutputFormats(t *testing.T) {
+	flags := []string{"config", "show", "--api-url=https://example.com", "--api-key=it's-secret", "--interval=2m"}
+
+	t.Run("text", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), flags...)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		directives := make([]string, len(lines))
+		for i, line := range lines {
+			directive, _, found := strings.Cut(line, " = ")
+			require.True(t, found, "line %d is not formatted as %q: %s", i, "key = value", line)
+			directives[i] = directive
+		}
+		assert.IsIncreasing(t, directives, "directives should be sorted alphabetically")
+		assert.Contains(t, lines, "api-url = https://example.com")
+		assert.Contains(t, lines, "output = text")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), append(flags, "--output=json")...)
+		require.NoError(t, err)
+		settings := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(out), &settings), "output is not valid JSON: %s", out)
+		assert.Equal(t, "https://example.com", settings["api-url"])
+		assert.Equal(t, redactedValue, settings["api-key"])
+		assert.Equal(t, "2m0s", settings["interval"])
+		assert.Equal(t, float64(defaultLogMaxSizeMB), settings["log-max-size-mb"])
+		assert.NotContains(t, settings, "output", "the output format of this command is not a directive")
+		assert.NotContains(t, settings, "help")
+	})
+
+	t.Run("env", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), append(flags, "--output=env")...)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		assert.IsIncreasing(t, lines, "variables should be sorted alphabetically")
+		assert.Contains(t, lines, "MYDYNDNS_API_URL='https://example.com'")
+		assert.Contains(t, lines, "MYDYNDNS_API_KEY='****'")
+		assert.Contains(t, lines, "MYDYNDNS_INTERVAL='2m0s'")
+		assert.NotContains(t, out, "MYDYNDNS_OUTPUT=")
+	})
+
+	t.Run("json round-trip", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), append(flags, "--output=json", "--no-redact")...)
+		require.NoError(t, err)
+
+		pipeStdin(t, out)
+		configDir := t.TempDir()
+		_, _, err = ExecuteC(newCLI(), "config", "write", "toml", "--quiet", "--stdin-format=json",
+			fmt.Sprintf("--directory=%s", configDir))
+		require.NoError(t, err)
+
+		_, out, err = ExecuteC(newCLI(), "config", "show", "--no-redact",
+			fmt.Sprintf("--config-file=%s", filepath.Join(configDir, "mydyndns.toml")))
+		require.NoError(t, err)
+		assert.Contains(t, out, "api-key = it's-secret\n")
+		assert.Contains(t, out, "api-url = https://example.com\n")
+		assert.Contains(t, out, "interval = 2m0s\n")
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), append(flags, "--output=table")...)
+		assert.EqualError(t, err, `unsupported output format "table" (must be one of: text, json, env)`)
+	})
+}
+
+func TestConfigShowCmdRedaction(t *testing.T) {
+	flags := []string{"config", "show", "--api-url=https://example.com", "--api-key=it's-secret"}
+
+	for _, tt := range []struct {
+		name            string
+		args            []string
+		expectedLines   []string
+		unexpectedLines []string
+	}{
+		{
+			"masked by default",
+			nil,
+			[]string{"api-key = ****", "api-url = https://example.com", "api-check-url = "},
+			[]string{"api-key = it's-secret"},
+		},
+		{
+			"no-redact",
+			[]string{"--no-redact"},
+			[]string{"api-key = it's-secret", "api-url = https://example.com"},
+			[]string{"api-key = ****"},
+		},
+		{
+			"custom keys replace the default",
+			[]string{"--redact-keys=api-url", "--redact-keys=api-check-url"},
+			[]string{"api-key = it's-secret", "api-url = ****", "api-check-url = "},
+			[]string{"api-key = ****"},
+		},
+		{
+			"no-redact overrides custom keys",
+			[]string{"--redact-keys=api-url", "--no-redact"},
+			[]string{"api-key = it's-secret", "api-url = https://example.com"},
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out, err := ExecuteC(newCLI(), append(flags, tt.args...)...)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			for _, line := range tt.expectedLines {
+				assert.Contains(t, lines, line)
+			}
+			for _, line := range tt.unexpectedLines {
+				assert.NotContains(t, lines, line)
+			}
+			assert.NotRegexp(t, `(?m)^(no-redact|redact-keys) =`, out, "redaction flags are not directives")
+		})
+	}
+}
+
+func TestConfigShowCmdDiffFromDefaults(t *testing.T) {
+	// Ensure that no config file is discovered
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+
+	for _, tt := range []struct {
+		name          string
+		args          []string
+		expectedLines []string
+	}{
+		{
+			"three flags set",
+			[]string{"--api-url=https://example.com", "--interval=2m", "--log-verbosity=2"},
+			[]string{"api-url = https://example.com", "interval = 2m0s", "log-verbosity = 2"},
+		},
+		{"no flags set", nil, nil},
+		{
+			"flags set to default values",
+			[]string{"--interval=60m", "--api-timeout=30s", "--log-json=false", "--output=text", "--api-url="},
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out, err := ExecuteC(newCLI(), append([]string{"config", "show", "--diff-from-defaults"}, tt.args...)...)
+			require.NoError(t, err)
+			if tt.expectedLines == nil {
+				assert.Empty(t, out)
+			} else {
+				assert.Equal(t, tt.expectedLines, strings.Split(strings.TrimSpace(out), "\n"))
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), "config", "show", "--diff-from-defaults", "--output=json",
+			"--api-key=secret", "--api-header=X-Tenant=example")
+		require.NoError(t, err)
+		settings := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(out), &settings), "output is not valid JSON: %s", out)
+		assert.Equal(t, map[string]interface{}{
+			"api-key":    redactedValue,
+			"api-header": []interface{}{"X-Tenant=example"},
+		}, settings)
+	})
+
+	t.Run("config file", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "mydyndns.toml")
+		require.NoError(t, os.WriteFile(configFile, []byte("api-key = \"secret\"\ninterval = \"1h\"\n"), 0o644))
+		_, out, err := ExecuteC(newCLI(), "config", "show", "--diff-from-defaults",
+			fmt.Sprintf("--config-file=%s", configFile))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api-key = ****", "config-file = " + configFile},
+			strings.Split(strings.TrimSpace(out), "\n"), "interval from the config file is the default value")
+	})
+}
+
+func TestConfigShowCmdExportShell(t *testing.T) {
+	// Ensure that no config file is discovered
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	const apiKey = `it's a "$ecret" with \backslashes, $(subshells), and ` + "`backticks`"
+	flags := []string{"config", "show", "--export-shell", "--no-redact",
+		"--api-url=https://example.com", "--api-key=" + apiKey, "--interval=2m"}
+
+	_, out, err := ExecuteC(newCLI(), flags...)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Contains(t, lines, `MYDYNDNS_API_KEY='it'\''s a "$ecret" with \backslashes, $(subshells), and `+"`backticks`'",
+		"values should be single-quoted, with embedded single quotes escaped")
+	assert.Contains(t, lines, "MYDYNDNS_API_URL='https://example.com'")
+	assert.Contains(t, lines, "MYDYNDNS_INTERVAL='2m0s'")
+	assert.Contains(t, lines, "# MYDYNDNS_API_TIMEOUT='30s'", "default values should be commented out")
+	assert.Contains(t, lines, "# MYDYNDNS_LOG_JSON='false'", "default values should be commented out")
+	assert.Contains(t, lines, "# MYDYNDNS_OUTPUT='text'", "default values should be commented out")
+	assert.NotContains(t, out, "MYDYNDNS_EXPORT_SHELL=")
+	for _, line := range lines {
+		assert.Regexp(t, `^(# )?MYDYNDNS_[A-Z0-9_]+='`, line)
+	}
+
+	t.Run("redacted", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), "config", "show", "--export-shell", "--api-key=secret")
+		require.NoError(t, err)
+		assert.Contains(t, strings.Split(out, "\n"), "MYDYNDNS_API_KEY='****'")
+	})
+
+	t.Run("eval round-trip", func(t *testing.T) {
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("sh is not available")
+		}
+		script := out + `printf '%s\n%s\n%s' "$MYDYNDNS_API_KEY" "$MYDYNDNS_INTERVAL" "${MYDYNDNS_API_TIMEOUT-unset}"`
+		evaluated, err := exec.Command(sh, "-c", script).Output()
+		require.NoError(t, err)
+		assert.Equal(t, apiKey+"\n2m0s\nunset", string(evaluated),
+			"explicit values should be assigned verbatim, and default values not at all")
+	})
+
+	t.Run("with output", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), append(flags, "--output=json")...)
+		assert.EqualError(t, err, "export-shell cannot be used with output (which selects another format)")
+	})
+}
+
 func TestConfigValidateCmd(t *testing.T) {
 	for _, tt := range []struct {
 		name string
@@ -428,6 +1064,25 @@ func TestConfigValidateCmd(t *testing.T) {
 			},
 			fmt.Errorf("SSL is required for API Base URL (received %q)", "http://example.com"),
 		},
+		{
+			"Unparseable API base URL",
+			[]string{
+				"--api-key=asdfjkl",
+				"--api-url=https://exa mple.com",
+				"--interval=1h",
+			},
+			fmt.Errorf(`invalid base URL %q: URL cannot be parsed`, "https://exa mple.com"),
+		},
+		{
+			"Non-SSL API check URL",
+			[]string{
+				"--api-key=asdfjkl",
+				"--api-url=https://example.com",
+				"--api-check-url=http://check.example.com",
+				"--interval=1h",
+			},
+			fmt.Errorf("SSL is required for API check URL (received %q)", "http://check.example.com"),
+		},
 		{
 			"Poll interval below min threshold",
 			[]string{
@@ -435,7 +1090,8 @@ func TestConfigValidateCmd(t *testing.T) {
 				"--api-url=https://example.com",
 				"--interval=1ms",
 			},
-			fmt.Errorf("poll interval cannot be less than %s", minimumPollInterval),
+			fmt.Errorf(`invalid argument "1ms" for "-i, --interval" flag: poll interval cannot be less than %s`,
+				minimumPollInterval),
 		},
 		{
 			"Valid configuration",
@@ -460,3 +1116,650 @@ func TestConfigValidateCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigValidateCmdStrict(t *testing.T) {
+	validSettings := map[string]interface{}{
+		"api-key":          "asdfjkl",
+		"api-url":          "https://example.com",
+		"interval":         "1h",
+		"change-threshold": 2,
+	}
+	for _, tt := range []struct {
+		name        string
+		extra       map[string]interface{}
+		strict      bool
+		expectedErr string
+	}{
+		{"no unknown directives", nil, true, ""},
+		{"unknown directive without strict", map[string]interface{}{"api_url": "https://example.com"}, false, ""},
+		{
+			"one unknown directive",
+			map[string]interface{}{"api_url": "https://example.com"},
+			true,
+			`unrecognized config directive "api_url"`,
+		},
+		{
+			"multiple unknown directives",
+			map[string]interface{}{"intervall": "1h", "api_url": "https://example.com", "log-verbosityy": 2},
+			true,
+			`unrecognized config directives: "api_url", "intervall", "log-verbosityy"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := maps.Clone(validSettings)
+			maps.Copy(settings, tt.extra)
+			args := []string{"config", "validate", "--config-file", writeConfig(t, "mydyndns.toml", settings)}
+			if tt.strict {
+				args = append(args, "--strict")
+			}
+			cmd, _, err := ExecuteC(newCLI(), args...)
+			require.Equal(t, "validate", cmd.Name())
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateCmdJSON(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		settings map[string]interface{}
+		args     []string
+		expected string
+	}{
+		{
+			"valid configuration",
+			map[string]interface{}{"api-key": "asdfjkl", "api-url": "https://example.com", "interval": "1h"},
+			nil,
+			`{"valid":true}`,
+		},
+		{
+			"single error",
+			map[string]interface{}{"api-url": "https://example.com", "interval": "1h"},
+			nil,
+			`{"valid":false,"errors":[{"code":"missing_api_key","message":"missing API key directive"}]}`,
+		},
+		{
+			"multiple errors",
+			map[string]interface{}{"api-url": "http://example.com", "interval": "1ms", "api_key": "asdfjkl"},
+			[]string{"--strict"},
+			`{"valid":false,"errors":[` +
+				`{"code":"unrecognized_directive","message":"unrecognized config directive \"api_key\""},` +
+				`{"code":"missing_api_key","message":"missing API key directive"},` +
+				`{"code":"insecure_api_url","message":"SSL is required for API Base URL (received \"http://example.com\")"},` +
+				fmt.Sprintf(`{"code":"invalid_poll_interval","message":"poll interval cannot be less than %s"}`,
+					minimumPollInterval) +
+				`]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{
+				"config", "validate", "--output=json", "--config-file", writeConfig(t, "mydyndns.toml", tt.settings),
+			}, tt.args...)
+			cmd, output, err := ExecuteC(newCLI(), args...)
+			require.Equal(t, "validate", cmd.Name())
+			assert.JSONEq(t, tt.expected, output)
+			if strings.Contains(tt.expected, `"valid":true`) {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Equal(t, ExitConfigError, ExitCode(err))
+			}
+		})
+	}
+
+	t.Run("text output reports the first error", func(t *testing.T) {
+		settings := map[string]interface{}{"api-url": "http://example.com", "interval": "1h"}
+		_, _, err := ExecuteC(newCLI(), "config", "validate", "--config-file", writeConfig(t, "mydyndns.toml", settings))
+		assert.EqualError(t, err, "missing API key directive")
+	})
+}
+
+// writeConfig writes a config file named filename with the given settings to a temporary directory,
+// returning the path of the written file.
+func writeConfig(t *testing.T, filename string, settings map[string]interface{}) string {
+	t.Helper()
+	v := viper.New()
+	for k, val := range settings {
+		v.Set(k, val)
+	}
+	path := filepath.Join(t.TempDir(), filename)
+	require.NoError(t, v.WriteConfigAs(path))
+	return path
+}
+
+func TestConfigDiffCmd(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		first, second map[string]interface{}
+		expected      []configDifference
+	}{
+		{
+			"identical files",
+			map[string]interface{}{"api-url": "https://example.com", "interval": "1h", "log-verbosity": 1},
+			map[string]interface{}{"api-url": "https://example.com", "interval": "1h", "log-verbosity": 1},
+			[]configDifference{},
+		},
+		{
+			"partially overlapping keys",
+			map[string]interface{}{"api-url": "https://example.com", "interval": "1h", "log-verbosity": 1},
+			map[string]interface{}{"api-url": "https://example.com", "interval": "2h", "log-json": true},
+			[]configDifference{
+				{"interval", "1h", "2h"},
+				{"log-json", nil, true},
+				{"log-verbosity", float64(1), nil},
+			},
+		},
+		{
+			"completely disjoint keys",
+			map[string]interface{}{"api-url": "https://example.com"},
+			map[string]interface{}{"api-key": "asdfjkl"},
+			[]configDifference{
+				{"api-key", nil, "asdfjkl"},
+				{"api-url", "https://example.com", nil},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Use different formats to ensure the comparison does not depend on parsed value types
+			first := writeConfig(t, "first.toml", tt.first)
+			second := writeConfig(t, "second.json", tt.second)
+
+			t.Run("json", func(t *testing.T) {
+				cmd, out, err := ExecuteC(newCLI(), "config", "diff", first, second, "--format=json")
+				require.Equal(t, "diff", cmd.Name())
+				require.NoError(t, err)
+				if len(tt.expected) == 0 {
+					assert.Empty(t, out)
+					return
+				}
+				var diffs []configDifference
+				require.NoError(t, json.Unmarshal([]byte(out), &diffs))
+				assert.Equal(t, tt.expected, diffs)
+			})
+
+			t.Run("table", func(t *testing.T) {
+				cmd, out, err := ExecuteC(newCLI(), "config", "diff", first, second)
+				require.Equal(t, "diff", cmd.Name())
+				require.NoError(t, err)
+				if len(tt.expected) == 0 {
+					assert.Empty(t, out)
+					return
+				}
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				require.Len(t, lines, len(tt.expected)+1)
+				assert.Equal(t, []string{"DIRECTIVE", first, second}, strings.Fields(lines[0]))
+				for i, d := range tt.expected {
+					fields := strings.Fields(lines[i+1])
+					require.Len(t, fields, 3)
+					assert.Equal(t, d.Directive, fields[0])
+				}
+			})
+		})
+	}
+
+	t.Run("unsupported file type", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "config", "diff", "first.toml", "second.bespokeformat")
+		require.Equal(t, "diff", cmd.Name())
+		assert.ErrorIs(t, err, viper.UnsupportedConfigError("bespokeformat"))
+	})
+
+	t.Run("unsupported output format", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		cmd, _, err := ExecuteC(newCLI(), "config", "diff", first, first, "--format=xml")
+		require.Equal(t, "diff", cmd.Name())
+		assert.EqualError(t, err, `unsupported format "xml" (must be one of: table, json)`)
+	})
+}
+
+func TestConfigMergeCmd(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		inputs   []string
+		settings []map[string]interface{}
+		output   string
+		expected map[string]interface{}
+	}{
+		{
+			"overlapping TOML files",
+			[]string{"first.toml", "second.toml"},
+			[]map[string]interface{}{
+				{"api-url": "https://example.com", "interval": "1h"},
+				{"api-key": "asdfjkl", "interval": "2h"},
+			},
+			"merged.toml",
+			map[string]interface{}{"api-url": "https://example.com", "api-key": "asdfjkl", "interval": "2h"},
+		},
+		{
+			"JSON and YAML files",
+			[]string{"credentials.json", "timing.yaml"},
+			[]map[string]interface{}{
+				{"api-url": "https://example.com", "api-key": "asdfjkl"},
+				{"interval": "30m", "log-verbosity": 2},
+			},
+			"merged.json",
+			map[string]interface{}{
+				"api-url":       "https://example.com",
+				"api-key":       "asdfjkl",
+				"interval":      "30m",
+				"log-verbosity": float64(2),
+			},
+		},
+		{
+			"later files take precedence",
+			[]string{"first.toml", "second.json", "third.yaml"},
+			[]map[string]interface{}{
+				{"api-key": "first", "interval": "1h", "log-json": false},
+				{"api-key": "second", "interval": "2h"},
+				{"api-key": "third"},
+			},
+			"merged.yaml",
+			map[string]interface{}{"api-key": "third", "interval": "2h", "log-json": false},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"config", "merge"}
+			for i, filename := range tt.inputs {
+				args = append(args, writeConfig(t, filename, tt.settings[i]))
+			}
+			output := filepath.Join(t.TempDir(), tt.output)
+			args = append(args, fmt.Sprintf("--output-file=%s", output))
+
+			cmd, out, err := ExecuteC(newCLI(), args...)
+			require.Equal(t, "merge", cmd.Name())
+			require.NoError(t, err)
+			assert.Equal(t, output, strings.TrimSpace(out))
+
+			v := viper.New()
+			v.SetConfigFile(output)
+			require.NoError(t, v.ReadInConfig())
+			assert.Equal(t, tt.expected, v.AllSettings())
+		})
+	}
+
+	t.Run("with global output format", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		output := filepath.Join(t.TempDir(), "merged.toml")
+		cmd, out, err := ExecuteC(newCLI(), "config", "merge", first, first, "-o", "json",
+			fmt.Sprintf("--output-file=%s", output))
+		require.Equal(t, "merge", cmd.Name())
+		require.NoError(t, err)
+		assert.Equal(t, output, strings.TrimSpace(out))
+		assert.FileExists(t, output)
+	})
+
+	t.Run("missing input file", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		missing := filepath.Join(t.TempDir(), "missing.toml")
+		output := filepath.Join(t.TempDir(), "merged.toml")
+
+		cmd, _, err := ExecuteC(newCLI(), "config", "merge", first, missing, fmt.Sprintf("--output-file=%s", output))
+		require.Equal(t, "merge", cmd.Name())
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		assert.NoFileExists(t, output)
+	})
+
+	t.Run("unsupported input file type", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "config", "merge", "first.toml", "second.bespokeformat",
+			"--output-file=merged.toml")
+		require.Equal(t, "merge", cmd.Name())
+		assert.ErrorIs(t, err, viper.UnsupportedConfigError("bespokeformat"))
+	})
+
+	t.Run("unsupported output file type", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		for _, output := range []string{"merged.bespokeformat", "merged"} {
+			cmd, _, err := ExecuteC(newCLI(), "config", "merge", first, first, fmt.Sprintf("--output-file=%s", output))
+			require.Equal(t, "merge", cmd.Name())
+			assert.ErrorAs(t, err, new(viper.UnsupportedConfigError))
+			assert.Equal(t, ExitValidationError, ExitCode(err))
+		}
+	})
+
+	t.Run("safe write fails", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		cmd, _, err := ExecuteC(newCLI(), "config", "merge", first, first, fmt.Sprintf("--output-file=%s", first), "--safe")
+		require.Equal(t, "merge", cmd.Name())
+		assert.ErrorIs(t, err, viper.ConfigFileAlreadyExistsError(first))
+	})
+
+	t.Run("requires output", func(t *testing.T) {
+		first := writeConfig(t, "first.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		cmd, _, err := ExecuteC(newCLI(), "config", "merge", first, first)
+		require.Equal(t, "merge", cmd.Name())
+		assert.EqualError(t, err, "missing output file directive")
+	})
+
+	t.Run("requires at least 2 arguments", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "config", "merge", "first.toml", "--output-file=merged.toml")
+		require.Equal(t, "merge", cmd.Name())
+		assert.EqualError(t, err, cobra.MinimumNArgs(2)(nil, []string{"first.toml"}).Error())
+	})
+}
+
+func TestConfigUpgradeCmd(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	t.Run("current version is unchanged", func(t *testing.T) {
+		filename := writeConfig(t, "mydyndns.toml", map[string]interface{}{"api-key": "asdfjkl"})
+
+		cmd, out, err := ExecuteC(newCLI(), "config", "upgrade", filename)
+		require.Equal(t, "upgrade", cmd.Name())
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Upgraded %s from schema version 1 to 1", filename), strings.TrimSpace(out))
+
+		v := viper.New()
+		v.SetConfigFile(filename)
+		require.NoError(t, v.ReadInConfig())
+		assert.Equal(t, map[string]interface{}{
+			"api-key": "asdfjkl", migrations.SchemaVersionKey: int64(1),
+		}, v.AllSettings())
+	})
+
+	t.Run("applies registered migrations", func(t *testing.T) {
+		original := migrations.Migrations
+		t.Cleanup(func() { migrations.Migrations = original })
+		migrations.Migrations = map[int]migrations.MigrationFunc{
+			1: func(settings map[string]interface{}) error {
+				settings["interval"] = settings["update-interval"]
+				delete(settings, "update-interval")
+				return nil
+			},
+		}
+		filename := writeConfig(t, "mydyndns.yaml", map[string]interface{}{
+			"api-key": "asdfjkl", "update-interval": "1h", migrations.SchemaVersionKey: 1,
+		})
+
+		cmd, _, err := ExecuteC(newCLI(), "config", "upgrade", filename, "--to-version=2")
+		require.Equal(t, "upgrade", cmd.Name())
+		require.NoError(t, err)
+
+		v := viper.New()
+		v.SetConfigFile(filename)
+		require.NoError(t, v.ReadInConfig())
+		assert.Equal(t, map[string]interface{}{
+			"api-key": "asdfjkl", "interval": "1h", migrations.SchemaVersionKey: 2,
+		}, v.AllSettings())
+	})
+
+	t.Run("missing migration", func(t *testing.T) {
+		filename := writeConfig(t, "mydyndns.json", map[string]interface{}{"api-key": "asdfjkl"})
+		before, err := os.ReadFile(filename)
+		require.NoError(t, err)
+
+		cmd, _, err := ExecuteC(newCLI(), "config", "upgrade", filename, "--to-version=2")
+		require.Equal(t, "upgrade", cmd.Name())
+		assert.EqualError(t, err, "no migration from schema version 1 to 2")
+		after, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, before, after, "config file should not be modified when the upgrade fails")
+	})
+
+	t.Run("downgrade", func(t *testing.T) {
+		filename := writeConfig(t, "mydyndns.toml", map[string]interface{}{"api-key": "asdfjkl"})
+		cmd, _, err := ExecuteC(newCLI(), "config", "upgrade", filename,
+			"--from-version=2", "--to-version=1")
+		require.Equal(t, "upgrade", cmd.Name())
+		assert.EqualError(t, err, "cannot downgrade from schema version 2 to 1")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "config", "upgrade", filepath.Join(t.TempDir(), "missing.toml"))
+		require.Equal(t, "upgrade", cmd.Name())
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
+
+func TestConfigEnvCmd(t *testing.T) {
+	baseArgs := []string{
+		"config", "env",
+		"--api-url=https://example.com",
+		"--api-key=it's-a-secret",
+		"--interval=2h",
+		"--log-verbosity=1",
+	}
+
+	for _, tt := range []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			"bash (default)",
+			nil,
+			[]string{
+				"export MYDYNDNS_API_KEY='****'",
+				"export MYDYNDNS_API_URL='https://example.com'",
+				"export MYDYNDNS_INTERVAL='2h0m0s'",
+				"export MYDYNDNS_LOG_VERBOSITY='1'",
+			},
+		},
+		{
+			"bash with secrets",
+			[]string{"--shell=bash", "--no-redact"},
+			[]string{
+				`export MYDYNDNS_API_KEY='it'\''s-a-secret'`,
+				"export MYDYNDNS_API_URL='https://example.com'",
+			},
+		},
+		{
+			"fish",
+			[]string{"--shell=fish"},
+			[]string{
+				"set -x MYDYNDNS_API_KEY '****'",
+				"set -x MYDYNDNS_API_URL 'https://example.com'",
+				"set -x MYDYNDNS_INTERVAL '2h0m0s'",
+			},
+		},
+		{
+			"fish with secrets",
+			[]string{"--shell=fish", "--no-redact"},
+			[]string{`set -x MYDYNDNS_API_KEY 'it\'s-a-secret'`},
+		},
+		{
+			"powershell",
+			[]string{"--shell=powershell"},
+			[]string{
+				`$env:MYDYNDNS_API_KEY = "****"`,
+				`$env:MYDYNDNS_API_URL = "https://example.com"`,
+				`$env:MYDYNDNS_INTERVAL = "2h0m0s"`,
+			},
+		},
+		{
+			"powershell with secrets",
+			[]string{"--shell=powershell", "--no-redact"},
+			[]string{`$env:MYDYNDNS_API_KEY = "it's-a-secret"`},
+		},
+		{
+			"custom redacted keys",
+			[]string{"--redact-keys=api-url", "--redact-keys=interval"},
+			[]string{
+				`export MYDYNDNS_API_KEY='it'\''s-a-secret'`,
+				"export MYDYNDNS_API_URL='****'",
+				"export MYDYNDNS_INTERVAL='****'",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, out, err := ExecuteC(newCLI(), append(baseArgs, tt.args...)...)
+			require.Equal(t, "env", cmd.Name())
+			require.NoError(t, err)
+
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			for _, expected := range tt.expected {
+				assert.Contains(t, lines, expected)
+			}
+			for _, line := range lines {
+				assert.NotContains(t, line, "MYDYNDNS_CONFIG_", "config file location should not be exported")
+				assert.NotContains(t, line, "MYDYNDNS_SHELL", "local flags should not be exported")
+				assert.NotContains(t, line, "MYDYNDNS_SHOW_SECRETS", "local flags should not be exported")
+				assert.NotContains(t, line, "MYDYNDNS_NO_REDACT", "local flags should not be exported")
+				assert.NotContains(t, line, "MYDYNDNS_REDACT_KEYS", "local flags should not be exported")
+			}
+			assert.True(t, sort.StringsAreSorted(lines), "exported variables should be sorted")
+		})
+	}
+
+	t.Run("deprecated show-secrets", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), append(baseArgs, "--show-secrets")...)
+		require.NoError(t, err)
+		assert.Contains(t, out, `export MYDYNDNS_API_KEY='it'\''s-a-secret'`)
+		assert.Contains(t, out, "Flag --show-secrets has been deprecated, use --no-redact instead")
+	})
+
+	t.Run("unsupported shell", func(t *testing.T) {
+		cmd, _, err := ExecuteC(newCLI(), "config", "env", "--shell=tcsh")
+		require.Equal(t, "env", cmd.Name())
+		assert.EqualError(t, err, `unsupported shell "tcsh" (must be one of: bash, fish, powershell)`)
+	})
+}
+
+func TestConfigWatchCmd(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	configFile := writeConfig(t, "mydyndns.toml", map[string]interface{}{
+		"api-key": "asdfjkl", "api-url": "https://example.com",
+	})
+	// Changes are written to a temporary file that replaces the config file, so that partial writes are not observed.
+	// The payloads are written without Viper, whose global state is used (and reset) by the command under test.
+	tmpFile := filepath.Join(filepath.Dir(configFile), "tmp.toml")
+	rewriteConfig := func(payload string) {
+		assert.NoError(t, os.WriteFile(tmpFile, []byte(payload), 0o644))
+		assert.NoError(t, os.Rename(tmpFile, configFile))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(time.Millisecond * 100)
+		rewriteConfig("api-url = 'https://example.com'\n")
+		time.Sleep(time.Millisecond * 100)
+		rewriteConfig("api-key = 'asdfjkl'\napi-url = 'https://example.com'\ninterval = '1s'\n")
+		time.Sleep(time.Millisecond * 100)
+		rewriteConfig("not valid toml =")
+		time.Sleep(time.Millisecond * 100)
+		cancel()
+	}()
+
+	cmd, out, err := ExecuteContextC(ctx, newCLI(), "config", "watch",
+		fmt.Sprintf("--config-file=%s", configFile), "--interval=10ms")
+	<-done
+	require.Equal(t, "watch", cmd.Name())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 5, "each change should be reported exactly once:\n%s", out)
+	assert.Equal(t, fmt.Sprintf("Watching %s for changes (every 10ms)...", configFile), lines[0])
+	for i, expected := range []string{
+		"OK",
+		"ERROR: missing API key directive",
+		fmt.Sprintf("ERROR: poll interval cannot be less than %s", minimumPollInterval),
+		fmt.Sprintf("ERROR: unable to parse config file %s: While parsing config", configFile),
+	} {
+		ts, result, found := strings.Cut(lines[i+1], " ")
+		require.True(t, found, "line %d", i+1)
+		_, err := time.Parse(time.RFC3339, ts)
+		assert.NoError(t, err, "line %d should be timestamped", i+1)
+		assert.True(t, strings.HasPrefix(result, expected), "line %d: expected %q, got %q", i+1, expected, result)
+	}
+}
+
+func TestConfigWatchCmdWithoutConfigFile(t *testing.T) {
+	cmd, _, err := ExecuteC(newCLI(), "config", "watch", fmt.Sprintf("--config-path=%s", t.TempDir()))
+	require.Equal(t, "watch", cmd.Name())
+	assert.EqualError(t, err, "no config file found to watch")
+}
+
+func TestConfigWriteCmdCompare(t *testing.T) {
+	// writeExisting writes a config file with --api-key=existing-key and returns its path and content.
+	writeExisting := func(t *testing.T) (string, string) {
+		configDir := t.TempDir()
+		_, _, err := ExecuteC(newCLI(), "config", "write", "toml", "--quiet",
+			fmt.Sprintf("--directory=%s", configDir), "--api-key=existing-key")
+		require.NoError(t, err)
+		configFile := filepath.Join(configDir, "mydyndns.toml")
+		data, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		return configFile, string(data)
+	}
+
+	for _, tt := range []struct {
+		name            string
+		interactive     bool
+		input           string
+		expectOverwrite bool
+		expectedOutput  string
+	}{
+		{"non-interactive", false, "y\n", false, "Not overwriting %[1]s (confirmation requires an interactive terminal)\n"},
+		{"confirmed", true, "y\n", true, "Overwrite? [y/N] %[1]s\n"},
+		{"confirmed verbosely", true, "Yes\n", true, "Overwrite? [y/N] %[1]s\n"},
+		{"declined", true, "n\n", false, "Overwrite? [y/N] Not overwriting %[1]s\n"},
+		{"declined by default", true, "\n", false, "Overwrite? [y/N] Not overwriting %[1]s\n"},
+		{"no answer", true, "", false, "Overwrite? [y/N] Not overwriting %[1]s\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			isTerminalOrig := isTerminal
+			isTerminal = func(io.Reader) bool { return tt.interactive }
+			t.Cleanup(func() { isTerminal = isTerminalOrig })
+			configFile, existing := writeExisting(t)
+
+			cli := newCLI()
+			cli.SetIn(strings.NewReader(tt.input))
+			_, out, err := ExecuteC(cli, "config", "write", configFile, "--compare", "--api-key=new-key")
+			require.NoError(t, err)
+
+			assert.Equal(t, fmt.Sprintf(`--- %[1]s
++++ %[1]s
+@@ -1,6 +1,6 @@
+ api-check-url = ''
+ api-header = []
+-api-key = 'existing-key'
++api-key = 'new-key'
+ api-key-file = ''
+ api-proxy = ''
+ api-timeout = '30s'
+`+tt.expectedOutput, configFile), out)
+			data, err := os.ReadFile(configFile)
+			require.NoError(t, err)
+			if tt.expectOverwrite {
+				assert.Equal(t, strings.Replace(existing, "existing-key", "new-key", 1), string(data))
+			} else {
+				assert.Equal(t, existing, string(data), "existing file should not be modified")
+			}
+		})
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		configFile, existing := writeExisting(t)
+		_, out, err := ExecuteC(newCLI(), "config", "write", configFile, "--compare", "--api-key=existing-key")
+		require.NoError(t, err)
+		assert.Equal(t, configFile+" is unchanged\n", out)
+		data, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		assert.Equal(t, existing, string(data))
+	})
+
+	t.Run("new file", func(t *testing.T) {
+		configDir := t.TempDir()
+		_, out, err := ExecuteC(newCLI(), "config", "write", "toml", "--compare",
+			fmt.Sprintf("--directory=%s", configDir), "--api-key=new-key")
+		require.NoError(t, err)
+		configFile := filepath.Join(configDir, "mydyndns.toml")
+		assert.Equal(t, configFile+"\n", out)
+		data, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "api-key = 'new-key'\n")
+	})
+
+	for _, flag := range []string{"--safe", "--encrypt-key=config.key"} {
+		t.Run("with "+flag, func(t *testing.T) {
+			_, _, err := ExecuteC(newCLI(), "config", "write", "toml", "--compare", flag,
+				fmt.Sprintf("--directory=%s", t.TempDir()))
+			assert.ErrorContains(t, err, "compare cannot be used with")
+		})
+	}
+}
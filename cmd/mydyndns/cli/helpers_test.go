@@ -4,13 +4,12 @@ import (
 	"bytes"
 	"context"
 	"io/ioutil"
-	"net"
 	"os"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
-	"github.com/stretchr/testify/mock"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,6 +35,8 @@ func ExecuteC(cmd *cobra.Command, args ...string) (*cobra.Command, string, error
 }
 
 func executorC(cmd *cobra.Command, args []string, fn func() (*cobra.Command, error)) (*cobra.Command, string, error) {
+	// Each execution should behave like a fresh process, so settings bound by previous executions must not leak
+	viper.Reset()
 	buf := new(bytes.Buffer)
 	cmd.SetOut(buf)
 	cmd.SetErr(buf)
@@ -44,32 +45,6 @@ func executorC(cmd *cobra.Command, args []string, fn func() (*cobra.Command, err
 	return c, buf.String(), err
 }
 
-type mockClient struct{ mock.Mock }
-
-func (m *mockClient) MyIP() (ip net.IP, err error) { return m.coerceRV(m.Called()) }
-
-func (m *mockClient) MyIPWithContext(context.Context) (ip net.IP, err error) {
-	return m.coerceRV(m.Called())
-}
-
-func (m *mockClient) UpdateAlias() (ip net.IP, err error) {
-	return m.coerceRV(m.Called())
-}
-
-func (m *mockClient) UpdateAliasWithContext(context.Context) (ip net.IP, err error) {
-	return m.coerceRV(m.Called())
-}
-
-func (m *mockClient) coerceRV(args mock.Arguments) (ip net.IP, err error) {
-	if rvIP := args.Get(0); rvIP != nil {
-		ip = rvIP.(net.IP)
-	}
-	if rvErr := args.Get(1); rvErr != nil {
-		err = rvErr.(error)
-	}
-	return
-}
-
 func patchBootstrappedAPIClient(mocked APIClient, rootCmd *cobra.Command) {
 	originalPersistentPreRunE := rootCmd.PersistentPreRunE
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
@@ -0,0 +1,62 @@
+// Package migrations upgrades the config directives of mydyndns config files written by older versions of mydyndns
+// to newer config schema versions.
+package migrations
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SchemaVersionKey is the config directive that records the schema version of a config file.
+	SchemaVersionKey = "schema-version"
+	// CurrentVersion is the schema version of config files written by this version of mydyndns.
+	CurrentVersion = 1
+	// InitialVersion is the schema version of config files without a SchemaVersionKey directive.
+	InitialVersion = 1
+)
+
+// A MigrationFunc upgrades the config directives in settings from one schema version to the next, in-place.
+type MigrationFunc func(settings map[string]interface{}) error
+
+// Migrations are indexed by the schema version that they upgrade from, i.e. Migrations[n] upgrades settings from
+// version n to version n+1. There is no migration from CurrentVersion.
+var Migrations = map[int]MigrationFunc{}
+
+// Version returns the schema version recorded in settings by the SchemaVersionKey directive,
+// or InitialVersion when settings has no such directive.
+func Version(settings map[string]interface{}) (int, error) {
+	v, ok := settings[SchemaVersionKey]
+	if !ok {
+		return InitialVersion, nil
+	}
+	version, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil || version < InitialVersion {
+		return 0, fmt.Errorf("invalid %s %q", SchemaVersionKey, fmt.Sprint(v))
+	}
+	return version, nil
+}
+
+// Upgrade applies each of the Migrations from schema version from to schema version to (in order) to settings,
+// and then records to as the schema version of settings. Upgrading to the same version only records the version.
+// An error is returned when to is earlier than from, or when any required migration is not defined or fails;
+// settings may be partially upgraded in that case.
+func Upgrade(settings map[string]interface{}, from, to int) error {
+	if from < InitialVersion {
+		return fmt.Errorf("invalid schema version %d (must be at least %d)", from, InitialVersion)
+	}
+	if to < from {
+		return fmt.Errorf("cannot downgrade from schema version %d to %d", from, to)
+	}
+	for v := from; v < to; v++ {
+		migrate, ok := Migrations[v]
+		if !ok {
+			return fmt.Errorf("no migration from schema version %d to %d", v, v+1)
+		}
+		if err := migrate(settings); err != nil {
+			return fmt.Errorf("unable to migrate from schema version %d to %d: %w", v, v+1, err)
+		}
+	}
+	settings[SchemaVersionKey] = to
+	return nil
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withMigrations replaces Migrations with m for the duration of the test.
+func withMigrations(t *testing.T, m map[int]MigrationFunc) {
+	original := Migrations
+	Migrations = m
+	t.Cleanup(func() { Migrations = original })
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run("no-op", func(t *testing.T) {
+		settings := map[string]interface{}{"api-key": "asdfjkl"}
+		require.NoError(t, Upgrade(settings, CurrentVersion, CurrentVersion))
+		assert.Equal(t, map[string]interface{}{"api-key": "asdfjkl", SchemaVersionKey: CurrentVersion}, settings)
+	})
+
+	t.Run("v1 to v2 adds a key", func(t *testing.T) {
+		withMigrations(t, map[int]MigrationFunc{
+			1: func(settings map[string]interface{}) error {
+				settings["added-key"] = "added"
+				return nil
+			},
+		})
+		settings := map[string]interface{}{"api-key": "asdfjkl"}
+		require.NoError(t, Upgrade(settings, 1, 2))
+		assert.Equal(t, map[string]interface{}{"api-key": "asdfjkl", "added-key": "added", SchemaVersionKey: 2},
+			settings)
+	})
+
+	t.Run("migrations are applied in order", func(t *testing.T) {
+		var applied []int
+		withMigrations(t, map[int]MigrationFunc{
+			1: func(map[string]interface{}) error { applied = append(applied, 1); return nil },
+			2: func(map[string]interface{}) error { applied = append(applied, 2); return nil },
+			3: func(map[string]interface{}) error { applied = append(applied, 3); return nil },
+		})
+		require.NoError(t, Upgrade(map[string]interface{}{}, 2, 4))
+		assert.Equal(t, []int{2, 3}, applied)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		from, to    int
+		expectedErr string
+	}{
+		{"downgrade", 2, 1, "cannot downgrade from schema version 2 to 1"},
+		{"invalid version", 0, 1, "invalid schema version 0 (must be at least 1)"},
+		{"missing migration", 1, 3, "no migration from schema version 2 to 3"},
+		{"failed migration", 3, 4, "unable to migrate from schema version 3 to 4: boom"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMigrations(t, map[int]MigrationFunc{
+				1: func(map[string]interface{}) error { return nil },
+				3: func(map[string]interface{}) error { return fmt.Errorf("boom") },
+			})
+			assert.EqualError(t, Upgrade(map[string]interface{}{}, tt.from, tt.to), tt.expectedErr)
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		settings    map[string]interface{}
+		expected    int
+		expectedErr string
+	}{
+		{"missing", map[string]interface{}{}, InitialVersion, ""},
+		{"int", map[string]interface{}{SchemaVersionKey: 2}, 2, ""},
+		{"int64", map[string]interface{}{SchemaVersionKey: int64(3)}, 3, ""},
+		{"string", map[string]interface{}{SchemaVersionKey: "2"}, 2, ""},
+		{"invalid", map[string]interface{}{SchemaVersionKey: "two"}, 0, `invalid schema-version "two"`},
+		{"too low", map[string]interface{}{SchemaVersionKey: 0}, 0, `invalid schema-version "0"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := Version(tt.settings)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, version)
+		})
+	}
+}
@@ -1,15 +1,37 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
 
+	"github.com/TylerHendrickson/mydyndns/internal"
+	"github.com/TylerHendrickson/mydyndns/internal/crypto"
+	"github.com/TylerHendrickson/mydyndns/internal/logrotate"
+	"github.com/TylerHendrickson/mydyndns/internal/remoteconfig"
 	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+	"github.com/TylerHendrickson/mydyndns/pkg/secrets"
 )
 
 func newRootCmd() *cobra.Command {
@@ -21,9 +43,9 @@ func newRootCmd() *cobra.Command {
 refresh from and send updates to a remote DNS management service.`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			if err := bootstrapConfig(cmd); err != nil {
-				return err
+				return withExitCode(ExitConfigError, err)
 			}
-			return bootstrapAPIClient(cmd)
+			return withExitCode(ExitConfigError, bootstrapAPIClient(cmd))
 		},
 	}
 
@@ -34,34 +56,148 @@ refresh from and send updates to a remote DNS management service.`,
 	// Global flags
 	cmd.PersistentFlags().String(configFileSettingKey, "",
 		"Explicitly set a config file (disables config file discovery)")
+	cmd.RegisterFlagCompletionFunc(configFileSettingKey, ConfigFileCompletion)
 	cmd.PersistentFlags().String(configPathSettingKey, defaultConfigPath,
 		"Search path for config file discovery when --config-file is not set to an absolute path.")
+	cmd.PersistentFlags().Bool(noConfigDiscoverySettingKey, false,
+		"Only search --config-path (rather than also searching well-known directories) for a config file.")
+	cmd.PersistentFlags().Bool(preprocessConfigSettingKey, false,
+		"Resolve YAML anchors and merge keys when reading a YAML config file (no effect on other formats)")
+	cmd.PersistentFlags().String(decryptKeySettingKey, "",
+		"Path to a 32-byte key file used to decrypt an encrypted config file (see \"config write --encrypt-key\")")
+	cmd.PersistentFlags().String(remoteProviderSettingKey, "",
+		"Read the config file from a key-value store (etcd or consul) instead of the filesystem")
+	cmd.PersistentFlags().String(remoteEndpointSettingKey, "",
+		"Endpoint of the key-value store set by --config-remote-provider, e.g. http://127.0.0.1:2379")
+	cmd.PersistentFlags().String(remotePathSettingKey, "",
+		"Key of the config file in the key-value store, whose extension sets its format (e.g. /config/mydyndns.toml)")
 
 	cmd.PersistentFlags().StringP("api-url", "u", "",
 		"Base URL for the mydyndns control API")
-	cmd.PersistentFlags().DurationP("interval", "i", defaultPollInterval,
-		"How often to poll for a new IP")
+	cmd.RegisterFlagCompletionFunc("api-url", URLCompletion)
+	cmd.PersistentFlags().String("api-url-template", "",
+		"Go template from which the API base URL is built (instead of --api-url), e.g. 'https://{{.Hostname}}.example.com'")
+	cmd.PersistentFlags().String("api-check-url", "",
+		"Base URL for detecting the apparent IP address, when different from --api-url")
+	cmd.PersistentFlags().VarP(internal.NewDurationMin(defaultPollInterval, minimumPollInterval, "poll interval"),
+		"interval", "i", fmt.Sprintf("How often to poll for a new IP (minimum %s)", minimumPollInterval))
 	cmd.PersistentFlags().StringP("api-key", "k", "",
 		"Client API secret")
+	cmd.PersistentFlags().String("api-key-file", "",
+		"File from which the client API secret is read (instead of --api-key, which is visible to other processes)")
+	cmd.PersistentFlags().String("secret-backend", secretBackendEnv,
+		"Where to retrieve the API key from (env, aws-secretsmanager, or vault)")
+	cmd.PersistentFlags().String("secret-id", "",
+		"Name or ARN of the AWS Secrets Manager secret containing the API key")
+	cmd.PersistentFlags().String("vault-path", "",
+		"API path of the Vault secret containing the API key, e.g. secret/data/mydyndns")
+	cmd.PersistentFlags().Duration("api-timeout", defaultAPITimeout,
+		"Maximum amount of time allowed for each API request (0 disables the limit)")
+	cmd.PersistentFlags().String("api-proxy", "",
+		"URL of a proxy for API requests (defaults to the proxy configured by the environment)")
+	cmd.PersistentFlags().String("api-tls-ca-cert", "",
+		"PEM-encoded CA certificate file to trust (in addition to system CAs) for API requests")
+	cmd.PersistentFlags().String("api-tls-cert", "",
+		"PEM-encoded client certificate file to present to the API (mutual TLS); requires --api-tls-key")
+	cmd.PersistentFlags().String("api-tls-key", "",
+		"PEM-encoded private key file for the client certificate set by --api-tls-cert")
+	cmd.PersistentFlags().Bool("api-tls-skip-verify", false,
+		"Disable verification of the API server's TLS certificate (INSECURE)")
+	cmd.PersistentFlags().StringArray("api-header", nil,
+		"Additional header (as KEY=VALUE) to send with each API request, e.g. for an API gateway (repeatable)")
+	cmd.PersistentFlags().StringP("output", "o", defaultOutputFormat,
+		"Output format for command results (text, json, or table)")
 	cmd.PersistentFlags().CountP("log-verbosity", "v",
 		"Increase logging verbosity level (default ERROR)")
 	cmd.PersistentFlags().Bool("log-json", false,
 		"Whether to output JSON logs")
+	cmd.PersistentFlags().String("log-file", "",
+		"File to which logs are appended instead of stderr")
+	cmd.PersistentFlags().Int("log-max-size-mb", defaultLogMaxSizeMB,
+		"Size (in megabytes) at which the log file is rotated (0 disables rotation)")
+	cmd.PersistentFlags().Bool("log-request-response", false,
+		"Log dumps of HTTP requests to the API and their responses (requires a log verbosity of at least 2, i.e. -vv)")
+	cmd.PersistentFlags().StringArray("log-redact-headers", sdk.DefaultRedactedHeaders,
+		"Header whose values are redacted from logged HTTP dumps (repeatable; replaces the default, so include "+
+			"x-api-key to keep redacting the API key)")
 
 	return cmd
 }
 
 func bootstrapConfig(cmd *cobra.Command) error {
-	// Matching environment variables must have prefix MYDYNDNS_
+	// Matching environment variables must have prefix MYDYNDNS_ and use underscores instead of dashes
 	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
 
-	// Bind all CLI flags to Viper
-	_ = viper.BindPFlags(cmd.Flags())
+	bindFlags(cmd)
+
+	if viper.GetString(remoteProviderSettingKey) != "" {
+		if err := readRemoteConfig(); err != nil {
+			return err
+		}
+	} else if err := readConfigFile(cmd); err != nil {
+		return err
+	}
+
+	// Merge config directives piped to stdin by commands that support it
+	if cmd.Flags().Lookup("stdin-format") != nil {
+		if format := viper.GetString("stdin-format"); format != "" {
+			return mergeStdinConfig(cmd.InOrStdin(), format)
+		}
+	}
+
+	return nil
+}
 
-	// Explicitly bind config-path and config-file env vars
-	viper.BindEnv(configPathSettingKey, fmt.Sprintf("%s_CONFIG_PATH", envPrefix))
-	viper.BindEnv(configFileSettingKey, fmt.Sprintf("%s_CONFIG_FILE", envPrefix))
+// Phases of loading a config file, as reported by ConfigLoadError.
+const (
+	ConfigLoadPhaseDiscover = "discover"
+	ConfigLoadPhaseRead     = "read"
+	ConfigLoadPhaseParse    = "parse"
+)
+
+// ConfigLoadError is returned when the config file cannot be loaded. It identifies the config file (when known)
+// and the phase of loading (one of the ConfigLoadPhase* constants) in which the underlying error occurred.
+type ConfigLoadError struct {
+	Path  string
+	Cause error
+	Phase string
+}
+
+func (e ConfigLoadError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("unable to %s config file: %s", e.Phase, e.Cause)
+	}
+	return fmt.Sprintf("unable to %s config file %s: %s", e.Phase, e.Path, e.Cause)
+}
+
+func (e ConfigLoadError) Unwrap() error {
+	return e.Cause
+}
+
+// newConfigLoadError wraps an error returned by Viper when reading the config file at path in a ConfigLoadError,
+// determining the phase of loading in which it occurred from its type.
+func newConfigLoadError(path string, err error) ConfigLoadError {
+	phase := ConfigLoadPhaseRead
+	if errors.As(err, new(viper.ConfigFileNotFoundError)) {
+		phase = ConfigLoadPhaseDiscover
+	} else if errors.As(err, new(viper.ConfigParseError)) || errors.As(err, new(viper.UnsupportedConfigError)) {
+		phase = ConfigLoadPhaseParse
+	}
+	return ConfigLoadError{Path: path, Cause: err, Phase: phase}
+}
+
+// readConfigFile locates the config file (as configured by the config-file, config-path, and no-config-discovery
+// directives) and reads it. A missing config file is only an error when the config-file directive is set.
+// Errors are returned as a ConfigLoadError.
+func readConfigFile(cmd *cobra.Command) (err error) {
+	// Viper's config parsers may panic (rather than return an error) when given malformed input
+	defer func() {
+		if r := recover(); r != nil {
+			err = ConfigLoadError{Path: viper.ConfigFileUsed(), Cause: fmt.Errorf("%v", r), Phase: ConfigLoadPhaseParse}
+		}
+	}()
 
 	if viper.IsSet(configFileSettingKey) {
 		configFilename := viper.GetString(configFileSettingKey)
@@ -72,27 +208,607 @@ func bootstrapConfig(cmd *cobra.Command) error {
 	} else {
 		viper.SetConfigName(defaultConfigFilename)
 		viper.AddConfigPath(viper.GetString(configPathSettingKey))
+		if !viper.IsSet(configPathSettingKey) && !viper.GetBool(noConfigDiscoverySettingKey) {
+			for _, path := range configDiscoveryPaths() {
+				viper.AddConfigPath(path)
+			}
+		}
 	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || viper.IsSet(configFileSettingKey) {
-			return err
+	if err := readInConfig(cmd); err != nil {
+		var loadErr ConfigLoadError
+		if !errors.As(err, &loadErr) {
+			loadErr = newConfigLoadError(viper.ConfigFileUsed(), err)
+		}
+		if loadErr.Phase != ConfigLoadPhaseDiscover || viper.IsSet(configFileSettingKey) {
+			return loadErr
 		}
 	}
+	return nil
+}
+
+// remoteConfig is the backend used by Viper to read config files from key-value stores.
+var remoteConfig = remoteconfig.New()
+
+func init() {
+	viper.RemoteConfig = remoteConfig
+}
 
+// readRemoteConfig reads the config file stored in the key-value store configured by the config-remote-provider,
+// config-remote-endpoint, and config-remote-path directives. The format of the config file is determined by
+// the extension of its path.
+func readRemoteConfig() error {
+	provider := viper.GetString(remoteProviderSettingKey)
+	endpoint := viper.GetString(remoteEndpointSettingKey)
+	path := viper.GetString(remotePathSettingKey)
+	switch {
+	case provider != remoteconfig.ProviderEtcd && provider != remoteconfig.ProviderConsul:
+		return fmt.Errorf("unsupported remote config provider %q (must be one of: %s, %s)",
+			provider, remoteconfig.ProviderEtcd, remoteconfig.ProviderConsul)
+	case endpoint == "":
+		return fmt.Errorf("missing %s directive (required by %s)", remoteEndpointSettingKey, remoteProviderSettingKey)
+	case path == "":
+		return fmt.Errorf("missing %s directive (required by %s)", remotePathSettingKey, remoteProviderSettingKey)
+	case viper.GetString(configFileSettingKey) != "":
+		return fmt.Errorf("%s and %s directives cannot both be set", configFileSettingKey, remoteProviderSettingKey)
+	}
+	configType := strings.TrimPrefix(filepath.Ext(path), ".")
+	if !slices.Contains(viper.SupportedExts, configType) {
+		return fmt.Errorf("unable to determine the format of remote config file %s "+
+			"(its extension must be one of: %s)", path, strings.Join(viper.SupportedExts, ", "))
+	}
+
+	viper.SetConfigType(configType)
+	if err := viper.AddRemoteProvider(provider, endpoint, path); err != nil {
+		return err
+	}
+	if err := viper.ReadRemoteConfig(); err != nil {
+		if cause := remoteConfig.Err(); cause != nil {
+			err = cause
+		}
+		return fmt.Errorf("unable to read remote config file %s from %s: %w", path, provider, err)
+	}
 	return nil
 }
 
+// readInConfig reads the config file located by Viper. Since Viper cannot parse encrypted config files
+// (see "config write --encrypt-key"), they are decrypted with the key read from the decrypt-key file and then read.
+// When the preprocess-config directive is set, YAML anchors, aliases, and merge keys in a YAML config file are
+// resolved (see resolveYAMLAnchors) before the config file is read. The sections of an INI config file are always
+// flattened (see flattenINISections), since Viper would otherwise nest the directives within them.
+func readInConfig(cmd *cobra.Command) error {
+	err := viper.ReadInConfig()
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		return err
+	}
+	data, readErr := os.ReadFile(configFile)
+	if readErr != nil {
+		return err
+	}
+	configType := strings.TrimPrefix(filepath.Ext(configFile), ".")
+	encrypted := crypto.IsEncrypted(data)
+	preprocess := viper.GetBool(preprocessConfigSettingKey) && (configType == "yaml" || configType == "yml")
+	if !encrypted && !preprocess && configType != "ini" {
+		return err
+	}
+
+	if encrypted {
+		keyFile := viper.GetString(decryptKeySettingKey)
+		if keyFile == "" {
+			return ConfigLoadError{Path: configFile, Phase: ConfigLoadPhaseRead,
+				Cause: fmt.Errorf("file is encrypted (set --%s to decrypt it)", decryptKeySettingKey)}
+		}
+		key, err := crypto.ReadKeyFile(keyFile)
+		if err != nil {
+			return ConfigLoadError{Path: configFile, Cause: err, Phase: ConfigLoadPhaseRead}
+		}
+		if data, err = crypto.Decrypt(key, data); err != nil {
+			return ConfigLoadError{Path: configFile, Phase: ConfigLoadPhaseRead,
+				Cause: fmt.Errorf("decryption failed: %w", err)}
+		}
+	}
+	if preprocess {
+		if data, err = resolveYAMLAnchors(data); err != nil {
+			return ConfigLoadError{Path: configFile, Phase: ConfigLoadPhaseParse,
+				Cause: fmt.Errorf("preprocessing failed: %w", err)}
+		}
+	}
+	viper.SetConfigType(configType)
+	if configType == "ini" {
+		settings, err := flattenINISections(data, knownConfigKeys(cmd))
+		if err != nil {
+			return ConfigLoadError{Path: configFile, Cause: err, Phase: ConfigLoadPhaseParse}
+		}
+		// Replace any (nested) directives read by Viper with the flattened directives
+		if err := viper.ReadConfig(bytes.NewReader(nil)); err != nil {
+			return err
+		}
+		return viper.MergeConfigMap(settings)
+	}
+	return viper.ReadConfig(bytes.NewReader(data))
+}
+
+// resolveYAMLAnchors returns a copy of the YAML document in data in which anchors, aliases, and merge keys
+// (e.g. "<<: *base") have been replaced by the values to which they refer.
+func resolveYAMLAnchors(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// flattenINISections parses the INI document in data, and returns its key-value pairs named after the (flat) config
+// directives they set. Keys in the default section are used as-is, while each key in a named section is prefixed with
+// the section name (e.g. "key" in an [api] section sets "api-key") when the prefixed name is in known. Otherwise,
+// sections only group keys, so that e.g. "interval" in an [agent] section sets "interval".
+func flattenINISections(data []byte, known *internal.StringCollection) (map[string]interface{}, error) {
+	cfg, err := ini.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]interface{})
+	for _, section := range cfg.Sections() {
+		for _, key := range section.Keys() {
+			name := strings.ToLower(key.Name())
+			if section.Name() != ini.DefaultSection {
+				if prefixed := strings.ToLower(section.Name()) + "-" + name; known.Contains(prefixed) {
+					name = prefixed
+				}
+			}
+			settings[name] = key.String()
+		}
+	}
+	return settings, nil
+}
+
+// configDiscoveryPaths returns the well-known directories that are searched (in order of priority, after the
+// default config path) for a config file when neither a config file nor a config path is provided.
+// Following the XDG base directory specification, $XDG_CONFIG_HOME is only considered when it is an absolute path.
+func configDiscoveryPaths() []string {
+	var paths []string
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdgConfigHome) {
+		paths = append(paths, filepath.Join(xdgConfigHome, "mydyndns"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "mydyndns"), filepath.Join(home, ".mydyndns"))
+	}
+	return append(paths, "/etc/mydyndns")
+}
+
+// ConfigFileCompletion completes the --config-file flag with the names of the files in the --config-path directory
+// that start with toComplete, and which are either named mydyndns (with any extension) or have a supported config file
+// extension (see viper.SupportedExts). The shell's default completion remains available, e.g. for paths to files
+// in other directories.
+func ConfigFileCompletion(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := []string{}
+	if strings.ContainsRune(toComplete, filepath.Separator) || strings.ContainsRune(toComplete, '/') {
+		return names, cobra.ShellCompDirectiveDefault
+	}
+	dir := defaultConfigPath
+	if f := cmd.Flag(configPathSettingKey); f != nil {
+		dir = f.Value.String()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return names, cobra.ShellCompDirectiveDefault
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, toComplete) {
+			continue
+		}
+		if strings.HasPrefix(name, "mydyndns.") ||
+			slices.Contains(viper.SupportedExts, strings.TrimPrefix(filepath.Ext(name), ".")) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveDefault
+}
+
+// URLCompletion completes the --api-url flag with the recently-used URLs that start with toComplete, as listed
+// (one per line, in order of preference) in the ~/.config/mydyndns/url-history file. Duplicate and blank lines
+// are ignored, and no URLs are suggested when the file does not exist.
+func URLCompletion(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	urls := []string{}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return urls, cobra.ShellCompDirectiveNoFileComp
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".config", "mydyndns", urlHistoryFilename))
+	if err != nil {
+		return urls, cobra.ShellCompDirectiveNoFileComp
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		url := strings.TrimSpace(line)
+		if url != "" && strings.HasPrefix(url, toComplete) && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls, cobra.ShellCompDirectiveNoFileComp
+}
+
+// mergeStdinConfig parses config directives from r according to format (a supported config file extension),
+// and merges them into the effective configuration, overriding directives read from any discovered config file.
+func mergeStdinConfig(r io.Reader, format string) error {
+	if !slices.Contains(viper.SupportedExts, format) {
+		return fmt.Errorf("unsupported stdin format %q (must be one of: %s)",
+			format, strings.Join(viper.SupportedExts, ", "))
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(r); err != nil {
+		return fmt.Errorf("unable to read config from stdin: %w", err)
+	}
+	return viper.MergeConfigMap(v.AllSettings())
+}
+
+// bindFlags binds each of cmd's (local and inherited) flags to the Viper directive of the same name, and explicitly
+// binds each directive to its environment variable (see flagNameToEnvVar), so that env var overrides do not rely on
+// the implicit naming of AutomaticEnv.
+func bindFlags(cmd *cobra.Command) {
+	_ = viper.BindPFlags(cmd.Flags())
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		_ = viper.BindEnv(f.Name, flagNameToEnvVar(f.Name))
+	})
+}
+
+// flagNameToEnvVar returns the name of the environment variable that corresponds to the config directive
+// (flag) with the given name, e.g. "api-key" corresponds to "MYDYNDNS_API_KEY".
+func flagNameToEnvVar(name string) string {
+	return fmt.Sprintf("%s_%s", envPrefix, strings.ToUpper(strings.ReplaceAll(name, "-", "_")))
+}
+
+// commandLogger returns a logger configured by the log-json, log-verbosity, log-backend, and log-field directives,
+// along with a function that releases its resources. Logs are written to cmd's error output unless the log-file
+// directive is set, in which case they are appended to that file (which is rotated according to the log-max-size-mb
+// directive).
+func commandLogger(cmd *cobra.Command) (log.Logger, func(), error) {
+	fields, err := logFields()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		w        io.Writer = cmd.ErrOrStderr()
+		closeLog           = func() {}
+	)
+	if logFile := viper.GetString("log-file"); logFile != "" {
+		rw, err := logrotate.Open(logFile, viper.GetInt64("log-max-size-mb")*1024*1024)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to open log file: %w", err)
+		}
+		w, closeLog = rw, func() { rw.Close() }
+	}
+	var logger log.Logger
+	if viper.GetString("log-backend") == logBackendSlog {
+		slogger := internal.ConfigureLoggerSlog(viper.GetBool("log-json"), viper.GetInt("log-verbosity"), w, fields...)
+		logger = internal.NewSlogAdapter(slogger)
+	} else {
+		logger = internal.ConfigureLoggerWithFields(viper.GetBool("log-json"), viper.GetInt("log-verbosity"), w,
+			fields...)
+	}
+	apiTrafficLogger.setLogger(level.Debug(logger))
+	return logger, closeLog, nil
+}
+
+// apiTrafficLogger receives the HTTP traffic logged by API clients when the log-request-response directive is set.
+// API clients are configured before the logger of the running command, so apiTrafficLogger forwards the traffic
+// to that logger once commandLogger has configured it (and discards it until then).
+var apiTrafficLogger = &forwardingLogger{}
+
+// forwardingLogger is a log.Logger that forwards each log event to another log.Logger, which can be replaced
+// at any time.
+type forwardingLogger struct {
+	mu     sync.Mutex
+	logger log.Logger
+}
+
+func (l *forwardingLogger) Log(keyvals ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.logger == nil {
+		return nil
+	}
+	return l.logger.Log(keyvals...)
+}
+
+func (l *forwardingLogger) setLogger(logger log.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger = logger
+}
+
 type APIClient interface {
 	MyIP() (net.IP, error)
 	MyIPWithContext(context.Context) (net.IP, error)
 	UpdateAlias() (net.IP, error)
 	UpdateAliasWithContext(context.Context) (net.IP, error)
+	UpdateAliasWithOptionsAndContext(context.Context, sdk.UpdateAliasOptions) (net.IP, error)
+	GetCurrentAlias() (net.IP, error)
+	GetCurrentAliasWithContext(context.Context) (net.IP, error)
+	PingWithContext(context.Context) (time.Duration, error)
+	CheckAuthWithContext(context.Context) error
 }
 
 var apiClient APIClient
 
+// updateAliasOptions returns the sdk.UpdateAliasOptions configured by the ttl and record-type directives.
+func updateAliasOptions() sdk.UpdateAliasOptions {
+	return sdk.UpdateAliasOptions{
+		TTL:        viper.GetInt("ttl"),
+		RecordType: sdk.RecordType(viper.GetString("record-type")),
+	}
+}
+
+// optionsClient is an APIClient whose UpdateAliasWithContext requests are configured by its options.
+type optionsClient struct {
+	APIClient
+	opts sdk.UpdateAliasOptions
+}
+
+func (c optionsClient) UpdateAliasWithContext(ctx context.Context) (net.IP, error) {
+	return c.UpdateAliasWithOptionsAndContext(ctx, c.opts)
+}
+
+// extraAPIClients are configured like apiClient, but make requests to each of the extra-update-url directives
+// of commands that support them.
+var extraAPIClients []APIClient
+
+// hostname reports the host name that is substituted into the api-url-template directive.
+var hostname = os.Hostname
+
+// apiURLTemplateData is the data with which the api-url-template directive is executed.
+type apiURLTemplateData struct {
+	Hostname string
+}
+
+// executeAPIURLTemplate returns the API base URL built by executing the Go template text.
+func executeAPIURLTemplate(text string) (string, error) {
+	tmpl, err := template.New("api-url-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid API URL template: %w", err)
+	}
+	name, err := hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine hostname for API URL template: %w", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, apiURLTemplateData{Hostname: name}); err != nil {
+		return "", fmt.Errorf("unable to execute API URL template: %w", err)
+	}
+	return out.String(), nil
+}
+
 func bootstrapAPIClient(cmd *cobra.Command) error {
-	apiClient = sdk.NewClient(viper.GetString("api-url"), viper.GetString("api-key"))
+	if viper.GetBool("api-tls-skip-verify") {
+		cmd.PrintErrln("WARNING: TLS certificate verification is disabled for API requests (--api-tls-skip-verify). " +
+			"Connections to the API are vulnerable to interception!")
+	}
+
+	if err := validateAPIURLSource(cmd); err != nil {
+		return err
+	}
+	if text := viper.GetString("api-url-template"); text != "" {
+		baseURL, err := executeAPIURLTemplate(text)
+		if err != nil {
+			return validationError{code: validationCodeInvalidAPIURLTemplate, err: err}
+		}
+		viper.Set("api-url", baseURL)
+		if err := validateBaseURL(cmd); err != nil {
+			return err
+		}
+	}
+
+	if err := validateAPIKeySource(cmd); err != nil {
+		return err
+	}
+	if keyFile := viper.GetString("api-key-file"); keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read API key file: %w", err)
+		}
+		viper.Set("api-key", strings.TrimRight(string(b), "\r\n"))
+	}
+
+	// API keys from external secret backends are resolved by resolveAPIKeySecret, since only commands that make API
+	// requests need them
+	return newAPIClients(cmd, viper.GetString("api-key"))
+}
+
+// newAPIClients sets apiClient and extraAPIClients to new API clients that are authenticated with apiKey.
+// No API clients are created when the API base URL directives are missing or invalid, since commands that make API
+// requests report them (see validateBaseURL and validateExtraUpdateURLs), and other commands (e.g. config validate)
+// have no use for API clients.
+func newAPIClients(cmd *cobra.Command, apiKey string) error {
+	apiClient, extraAPIClients = nil, nil
+	if validateBaseURL(cmd) != nil {
+		return nil
+	}
+	ipFamily, err := sdk.ParseIPFamily(viper.GetString("ip-version"))
+	if err != nil {
+		return err
+	}
+	opts, err := apiClientOptions()
+	if err != nil {
+		return err
+	}
+	client, err := sdk.NewClientE(viper.GetString("api-url"), apiKey, opts...)
+	if err != nil {
+		return err
+	}
+	client.CheckBaseURL = viper.GetString("api-check-url")
+	client.PingPath = viper.GetString("ping-path")
+	client.IPFamily = ipFamily
+	apiClient = client
+
+	if cmd.Flags().Lookup("extra-update-url") != nil && validateExtraUpdateURLs(cmd) == nil {
+		for _, extraURL := range viper.GetStringSlice("extra-update-url") {
+			// Extra clients update DNS concurrently with the primary client, so each has its own options (and
+			// therefore its own transport and TLS config)
+			opts, err := apiClientOptions()
+			if err != nil {
+				return err
+			}
+			extra, err := sdk.NewClientE(extraURL, apiKey, opts...)
+			if err != nil {
+				return err
+			}
+			extra.IPFamily = ipFamily
+			extraAPIClients = append(extraAPIClients, extra)
+		}
+	}
 	return nil
 }
+
+// apiClientOptions returns a new set of sdk.ClientOption values for an API client, as configured by the api-* and
+// log-request-response directives. Each call builds a new transport, so that it is not shared by API clients.
+func apiClientOptions() ([]sdk.ClientOption, error) {
+	opts := []sdk.ClientOption{sdk.WithRequestTimeout(viper.GetDuration("api-timeout"))}
+	if transport, err := apiClientTransport(); err != nil {
+		return nil, err
+	} else if transport != nil {
+		opts = append(opts, sdk.WithTransport(*transport))
+	}
+	if cert, key := viper.GetString("api-tls-cert"), viper.GetString("api-tls-key"); cert != "" || key != "" {
+		switch {
+		case key == "":
+			return nil, fmt.Errorf("missing API TLS key directive (required by api-tls-cert)")
+		case cert == "":
+			return nil, fmt.Errorf("missing API TLS certificate directive (required by api-tls-key)")
+		}
+		opts = append(opts, sdk.WithClientCert(cert, key))
+	}
+	if headers, err := apiHeaders(); err != nil {
+		return nil, err
+	} else if len(headers) > 0 {
+		opts = append(opts, sdk.WithCustomHeaders(headers))
+	}
+	if viper.GetBool("log-request-response") && viper.GetInt("log-verbosity") >= 2 {
+		opts = append(opts, sdk.WithDebugLogging(apiTrafficLogger, viper.GetStringSlice("log-redact-headers")...))
+	}
+	if viper.GetBool("sse") {
+		opts = append(opts, sdk.WithSSEEnabled(true))
+	}
+	return opts, nil
+}
+
+// resolveAPIKeySecret replaces the bootstrapped API clients with clients that are authenticated with the API key
+// resolved from the secret store configured by the secret-backend directive (see resolveAPIKey). Resolving a secret
+// may require requests to the secret store, so this is deferred to the PreRunE of each command that makes API
+// requests, rather than done for every command when the API client is bootstrapped.
+func resolveAPIKeySecret(cmd *cobra.Command) error {
+	if backend := viper.GetString("secret-backend"); backend == "" || backend == secretBackendEnv {
+		return nil
+	}
+	apiKey, err := resolveAPIKey(cmd.Context())
+	if err != nil {
+		return withExitCode(ExitConfigError, err)
+	}
+	return withExitCode(ExitConfigError, newAPIClients(cmd, apiKey))
+}
+
+// resolveAPIKey returns the API key from the secret store configured by the secret-backend directive.
+// When the backend is "env", the api-key directive is used as-is. Resolved secrets are not stored in
+// Viper, so that they are never written to config files.
+func resolveAPIKey(ctx context.Context) (string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var (
+		backend secrets.Backend
+		id      string
+		err     error
+	)
+	switch name := viper.GetString("secret-backend"); name {
+	case "", secretBackendEnv:
+		return viper.GetString("api-key"), nil
+	case secretBackendAWS:
+		if id = viper.GetString("secret-id"); id == "" {
+			return "", fmt.Errorf("missing secret ID directive (required by the %s secret backend)", name)
+		}
+		backend, err = secrets.NewAWSSecretsManagerBackendFromEnv()
+	case secretBackendVault:
+		if id = viper.GetString("vault-path"); id == "" {
+			return "", fmt.Errorf("missing Vault path directive (required by the %s secret backend)", name)
+		}
+		backend, err = secrets.NewVaultBackendFromEnv()
+	default:
+		return "", fmt.Errorf("unsupported secret backend %q (must be one of: env, aws-secretsmanager, vault)", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return secrets.Resolve(ctx, backend, id)
+}
+
+// apiHeaders returns the custom headers for API requests configured by the api-header directive,
+// each of which must be a KEY=VALUE pair.
+func apiHeaders() (map[string]string, error) {
+	headers := map[string]string{}
+	for _, header := range viper.GetStringSlice("api-header") {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid API header %q (must be KEY=VALUE)", header)
+		}
+		headers[strings.TrimSpace(name)] = value
+	}
+	return headers, nil
+}
+
+// logFields returns the custom fields configured by the log-field directive as key-value pairs.
+func logFields() ([]interface{}, error) {
+	var fields []interface{}
+	for _, field := range viper.GetStringSlice("log-field") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid log field %q (must be KEY=VALUE)", field)
+		}
+		fields = append(fields, strings.TrimSpace(key), value)
+	}
+	if err := internal.ValidateLogFields(fields...); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// apiClientTransport returns the HTTP transport settings for API requests configured by the api-proxy,
+// api-tls-ca-cert, and api-tls-skip-verify directives. When none are set, the returned value is nil.
+func apiClientTransport() (*sdk.ClientTransport, error) {
+	var (
+		proxy      = viper.GetString("api-proxy")
+		caCert     = viper.GetString("api-tls-ca-cert")
+		skipVerify = viper.GetBool("api-tls-skip-verify")
+	)
+	if proxy == "" && caCert == "" && !skipVerify {
+		return nil, nil
+	}
+
+	transport := &sdk.ClientTransport{}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API proxy URL: %w", err)
+		}
+		transport.ProxyURL = proxyURL
+	}
+	if caCert != "" || skipVerify {
+		transport.TLSConfig = &tls.Config{InsecureSkipVerify: skipVerify}
+	}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read API CA certificate: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid PEM-encoded certificates found in %s", caCert)
+		}
+		transport.TLSConfig.RootCAs = roots
+	}
+	return transport, nil
+}
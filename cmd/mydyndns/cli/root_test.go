@@ -1,12 +1,34 @@
 package cli
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
 )
 
 func TestBootstrapConfigConfigFileResolution(t *testing.T) {
@@ -48,3 +70,1012 @@ func TestBootstrapConfigConfigFileResolution(t *testing.T) {
 		})
 	}
 }
+
+func TestBootstrapConfigDiscovery(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	xdgConfigHome := filepath.Join(home, "xdg")
+
+	// Discovery starts in the working directory, which must not contain a config file unless a test case adds one
+	workDir := t.TempDir()
+	origWorkDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(workDir))
+	t.Cleanup(func() { os.Chdir(origWorkDir) })
+
+	var (
+		xdgDir      = filepath.Join(xdgConfigHome, "mydyndns")
+		dotConfDir  = filepath.Join(home, ".config", "mydyndns")
+		dotHomeDir  = filepath.Join(home, ".mydyndns")
+		explicitDir = filepath.Join(home, "explicit")
+	)
+	for _, tt := range []struct {
+		name           string
+		xdgConfigHome  string
+		configDirs     []string
+		args           []string
+		expectedConfig string
+	}{
+		{"no config files", xdgConfigHome, nil, nil, ""},
+		{"home directory", "", []string{dotHomeDir}, nil, dotHomeDir},
+		{"default XDG config home", "", []string{dotConfDir, dotHomeDir}, nil, dotConfDir},
+		{"custom XDG config home", xdgConfigHome, []string{xdgDir, dotConfDir, dotHomeDir}, nil, xdgDir},
+		{"relative XDG config home is ignored", "xdg", []string{xdgDir, dotHomeDir}, nil, dotHomeDir},
+		{"working directory", xdgConfigHome, []string{workDir, xdgDir, dotConfDir}, nil, workDir},
+		{"opt out", xdgConfigHome, []string{xdgDir, dotConfDir}, []string{"--no-config-discovery"}, ""},
+		{"explicit config path", xdgConfigHome, []string{explicitDir, xdgDir},
+			[]string{fmt.Sprintf("--config-path=%s", explicitDir)}, explicitDir},
+		{"explicit config path without config file", xdgConfigHome, []string{xdgDir},
+			[]string{fmt.Sprintf("--config-path=%s", explicitDir)}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdgConfigHome)
+			for _, dir := range tt.configDirs {
+				require.NoError(t, os.MkdirAll(dir, 0o755))
+				configFile := filepath.Join(dir, "mydyndns.toml")
+				require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf("api-url = %q\n", dir)), 0o644))
+				t.Cleanup(func() { os.Remove(configFile) })
+			}
+
+			_, _, err := ExecuteC(newCLI(), append([]string{"config", "show"}, tt.args...)...)
+			require.NoError(t, err)
+			if tt.expectedConfig == "" {
+				assert.Empty(t, viper.ConfigFileUsed())
+			} else {
+				assert.Equal(t, filepath.Join(tt.expectedConfig, "mydyndns.toml"), viper.ConfigFileUsed())
+				assert.Equal(t, tt.expectedConfig, viper.GetString("api-url"))
+			}
+		})
+	}
+}
+
+func TestBootstrapConfigPreprocess(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "mydyndns.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+base: &base
+  api-url: &url https://example.com
+  interval: 2m
+  log-verbosity: 1
+<<: *base
+api-check-url: *url
+api-key: secret
+interval: 5m
+`), 0o644))
+	tomlFile := filepath.Join(dir, "mydyndns.toml")
+	require.NoError(t, os.WriteFile(tomlFile, []byte("api-url = \"https://example.com\"\ninterval = \"5m\"\n"), 0o644))
+
+	t.Run("yaml", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--preprocess-config",
+			fmt.Sprintf("--config-file=%s", yamlFile))
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", viper.GetString("api-url"), "merge key should be resolved")
+		assert.Equal(t, 1, viper.GetInt("log-verbosity"), "merge key should be resolved")
+		assert.Equal(t, "https://example.com", viper.GetString("api-check-url"), "alias should be resolved")
+		assert.Equal(t, "secret", viper.GetString("api-key"))
+		assert.Equal(t, 5*time.Minute, viper.GetDuration("interval"), "explicit keys should override merged keys")
+	})
+
+	t.Run("toml is unaffected", func(t *testing.T) {
+		_, withoutOut, err := ExecuteC(newCLI(), "config", "show", fmt.Sprintf("--config-file=%s", tomlFile))
+		require.NoError(t, err)
+		_, withOut, err := ExecuteC(newCLI(), "config", "show", "--preprocess-config",
+			fmt.Sprintf("--config-file=%s", tomlFile))
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", viper.GetString("api-url"))
+		assert.Equal(t, 5*time.Minute, viper.GetDuration("interval"))
+		assert.Equal(t, strings.Replace(withoutOut, "preprocess-config = false", "preprocess-config = true", 1),
+			withOut)
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		invalidFile := filepath.Join(dir, "invalid.yaml")
+		require.NoError(t, os.WriteFile(invalidFile, []byte("api-url: *undefined\n"), 0o644))
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--preprocess-config",
+			fmt.Sprintf("--config-file=%s", invalidFile))
+		assert.ErrorContains(t, err, fmt.Sprintf("unable to parse config file %s: preprocessing failed: ", invalidFile))
+	})
+
+	t.Run("not written to config files", func(t *testing.T) {
+		outDir := t.TempDir()
+		_, _, err := ExecuteC(newCLI(), "config", "write", "json", "--quiet", "--preprocess-config",
+			fmt.Sprintf("--directory=%s", outDir), fmt.Sprintf("--config-file=%s", yamlFile))
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(outDir, "mydyndns.json"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "preprocess-config")
+		assert.Contains(t, string(data), `"api-check-url": "https://example.com"`)
+	})
+}
+
+func TestBootstrapConfigINISections(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "mydyndns.ini")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+api-url = https://example.com
+
+[api]
+key = secret
+check-url = https://check.example.com
+
+[agent]
+interval = 2m
+change-threshold = 3
+`), 0o644))
+
+	_, _, err := ExecuteC(newCLI(), "config", "validate", "--strict", fmt.Sprintf("--config-file=%s", configFile))
+	require.NoError(t, err, "flattened directives should all be recognized")
+	assert.Equal(t, "secret", viper.GetString("api-key"), "section name should prefix the key")
+	assert.Equal(t, "https://check.example.com", viper.GetString("api-check-url"))
+	assert.Equal(t, 2*time.Minute, viper.GetDuration("interval"), "section should only group unprefixed keys")
+	assert.Equal(t, 3, viper.GetInt("change-threshold"))
+	assert.Equal(t, "https://example.com", viper.GetString("api-url"), "default section keys should be used as-is")
+	for _, nested := range []string{"api", "agent", "default"} {
+		assert.NotContains(t, viper.AllSettings(), nested, "sections should not be nested directives")
+	}
+
+	t.Run("invalid ini", func(t *testing.T) {
+		invalidFile := filepath.Join(t.TempDir(), "mydyndns.ini")
+		require.NoError(t, os.WriteFile(invalidFile, []byte("[api\nkey = secret\n"), 0o644))
+		_, _, err := ExecuteC(newCLI(), "config", "show", fmt.Sprintf("--config-file=%s", invalidFile))
+		assert.ErrorContains(t, err, fmt.Sprintf("unable to parse config file %s: ", invalidFile))
+	})
+}
+
+// etcdServer simulates the KV range API of etcd v3 for the config files in values.
+type etcdServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	values   map[string]string
+	revision int
+}
+
+func newEtcdServer(t *testing.T, values map[string]string) *etcdServer {
+	t.Helper()
+	s := &etcdServer{values: values, revision: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Key []byte }
+		if r.URL.Path != "/v3/kv/range" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		resp := map[string]interface{}{}
+		if value, ok := s.values[string(req.Key)]; ok {
+			resp["kvs"] = []map[string]interface{}{
+				{"key": req.Key, "value": []byte(value), "mod_revision": fmt.Sprint(s.revision)}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *etcdServer) put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.revision++
+}
+
+func TestBootstrapConfigLoadError(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	corruptFile := filepath.Join(dir, "corrupt.toml")
+	require.NoError(t, os.WriteFile(corruptFile, []byte("api-key = \"unterminated\napi-url = [\n"), 0o644))
+	missingFile := filepath.Join(dir, "missing.toml")
+
+	for _, tt := range []struct {
+		name          string
+		configFile    string
+		expectedPhase string
+		causeTarget   interface{}
+	}{
+		{"corrupt toml", corruptFile, ConfigLoadPhaseParse, new(viper.ConfigParseError)},
+		{"missing file", missingFile, ConfigLoadPhaseRead, new(*fs.PathError)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, err := ExecuteC(newCLI(), "config", "show", fmt.Sprintf("--config-file=%s", tt.configFile))
+			require.Equal(t, "show", cmd.Name())
+			var loadErr ConfigLoadError
+			require.ErrorAs(t, err, &loadErr)
+			assert.Equal(t, tt.configFile, loadErr.Path)
+			assert.Equal(t, tt.expectedPhase, loadErr.Phase)
+			assert.ErrorAs(t, loadErr.Cause, tt.causeTarget)
+			assert.ErrorContains(t, err,
+				fmt.Sprintf("unable to %s config file %s: ", tt.expectedPhase, tt.configFile))
+			assert.Equal(t, ExitConfigError, ExitCode(err))
+		})
+	}
+}
+
+func TestBootstrapConfigRemote(t *testing.T) {
+	server := newEtcdServer(t, map[string]string{
+		"/config/mydyndns.toml": "api-url = \"https://example.com\"\ninterval = \"5m\"\n",
+		"/config/mydyndns":      "interval = \"5m\"\n",
+	})
+
+	t.Run("etcd", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--config-remote-provider=etcd",
+			"--config-remote-endpoint="+server.URL, "--config-remote-path=/config/mydyndns.toml")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", viper.GetString("api-url"))
+		assert.Equal(t, 5*time.Minute, viper.GetDuration("interval"))
+	})
+
+	t.Run("flags take precedence", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--config-remote-provider=etcd",
+			"--config-remote-endpoint="+server.URL, "--config-remote-path=/config/mydyndns.toml", "--interval=1m")
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, viper.GetDuration("interval"))
+	})
+
+	for _, tt := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{
+			"unsupported provider",
+			[]string{"--config-remote-provider=zookeeper"},
+			`unsupported remote config provider "zookeeper" (must be one of: etcd, consul)`,
+		},
+		{
+			"missing endpoint",
+			[]string{"--config-remote-provider=etcd", "--config-remote-path=/config/mydyndns.toml"},
+			"missing config-remote-endpoint directive (required by config-remote-provider)",
+		},
+		{
+			"missing path",
+			[]string{"--config-remote-provider=etcd", "--config-remote-endpoint=" + server.URL},
+			"missing config-remote-path directive (required by config-remote-provider)",
+		},
+		{
+			"with config file",
+			[]string{"--config-remote-provider=etcd", "--config-remote-endpoint=" + server.URL,
+				"--config-remote-path=/config/mydyndns.toml", "--config-file=mydyndns.toml"},
+			"config-file and config-remote-provider directives cannot both be set",
+		},
+		{
+			"unknown format",
+			[]string{"--config-remote-provider=etcd", "--config-remote-endpoint=" + server.URL,
+				"--config-remote-path=/config/mydyndns"},
+			"unable to determine the format of remote config file /config/mydyndns (its extension must be one of: ",
+		},
+		{
+			"missing key",
+			[]string{"--config-remote-provider=etcd", "--config-remote-endpoint=" + server.URL,
+				"--config-remote-path=/config/missing.toml"},
+			"unable to read remote config file /config/missing.toml from etcd: " +
+				"key /config/missing.toml not found in etcd",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ExecuteC(newCLI(), append([]string{"config", "show"}, tt.args...)...)
+			require.Error(t, err)
+			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.Equal(t, ExitConfigError, ExitCode(err))
+		})
+	}
+}
+
+func TestBootstrapAPIClientTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caCertFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644))
+	invalidCACertFile := filepath.Join(t.TempDir(), "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidCACertFile, []byte("not a certificate"), 0o644))
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientCertTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mydyndns-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientCertDER, err := x509.CreateCertificate(
+		rand.Reader, clientCertTemplate, clientCertTemplate, &clientKey.PublicKey, clientKey)
+	require.NoError(t, err)
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+	clientCertFile := filepath.Join(t.TempDir(), "client.crt")
+	require.NoError(t, os.WriteFile(clientCertFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCertDER}), 0o644))
+	clientKeyFile := filepath.Join(t.TempDir(), "client.key")
+	require.NoError(t, os.WriteFile(clientKeyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDER}), 0o600))
+
+	bootstrappedTransport := func(t *testing.T, args ...string) (*http.Transport, string, error) {
+		t.Helper()
+		_, out, err := ExecuteC(newCLI(), append([]string{"config", "show", "--api-url=https://example.com"}, args...)...)
+		if err != nil {
+			return nil, out, err
+		}
+		client, ok := apiClient.(*sdk.Client)
+		require.True(t, ok, "expected bootstrapped API client to be an *sdk.Client")
+		if client.HTTPClient.Transport == nil {
+			return nil, out, nil
+		}
+		transport, ok := client.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok, "expected bootstrapped API client to use an *http.Transport")
+		return transport, out, nil
+	}
+
+	t.Run("default transport", func(t *testing.T) {
+		transport, _, err := bootstrappedTransport(t)
+		require.NoError(t, err)
+		assert.Nil(t, transport)
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		transport, _, err := bootstrappedTransport(t, "--api-proxy=http://proxy.example.com:3128")
+		require.NoError(t, err)
+		require.NotNil(t, transport)
+		proxyURL, err := transport.Proxy(httptest.NewRequest(http.MethodGet, "https://example.com", http.NoBody))
+		require.NoError(t, err)
+		assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+	})
+
+	t.Run("CA certificate", func(t *testing.T) {
+		transport, _, err := bootstrappedTransport(t, fmt.Sprintf("--api-tls-ca-cert=%s", caCertFile))
+		require.NoError(t, err)
+		require.NotNil(t, transport)
+		require.NotNil(t, transport.TLSClientConfig)
+		assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		require.NoError(t, err, "server certificate should be trusted")
+		resp.Body.Close()
+	})
+
+	t.Run("missing CA certificate", func(t *testing.T) {
+		_, _, err := bootstrappedTransport(t, "--api-tls-ca-cert=/does/not/exist.pem")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid CA certificate", func(t *testing.T) {
+		_, _, err := bootstrappedTransport(t, fmt.Sprintf("--api-tls-ca-cert=%s", invalidCACertFile))
+		assert.EqualError(t, err, fmt.Sprintf("no valid PEM-encoded certificates found in %s", invalidCACertFile))
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		transport, _, err := bootstrappedTransport(t,
+			fmt.Sprintf("--api-tls-cert=%s", clientCertFile), fmt.Sprintf("--api-tls-key=%s", clientKeyFile))
+		require.NoError(t, err)
+		require.NotNil(t, transport)
+		require.NotNil(t, transport.TLSClientConfig)
+		require.Len(t, transport.TLSClientConfig.Certificates, 1)
+		assert.Equal(t, clientCertDER, transport.TLSClientConfig.Certificates[0].Certificate[0])
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		_, _, err := bootstrappedTransport(t, fmt.Sprintf("--api-tls-cert=%s", clientCertFile))
+		assert.EqualError(t, err, "missing API TLS key directive (required by api-tls-cert)")
+	})
+
+	t.Run("client key without certificate", func(t *testing.T) {
+		_, _, err := bootstrappedTransport(t, fmt.Sprintf("--api-tls-key=%s", clientKeyFile))
+		assert.EqualError(t, err, "missing API TLS certificate directive (required by api-tls-key)")
+	})
+
+	t.Run("invalid client certificate", func(t *testing.T) {
+		_, _, err := bootstrappedTransport(t,
+			fmt.Sprintf("--api-tls-cert=%s", invalidCACertFile), fmt.Sprintf("--api-tls-key=%s", clientKeyFile))
+		assert.ErrorContains(t, err, "unable to load client certificate")
+	})
+
+	t.Run("skip verify", func(t *testing.T) {
+		transport, out, err := bootstrappedTransport(t, "--api-tls-skip-verify")
+		require.NoError(t, err)
+		require.NotNil(t, transport)
+		require.NotNil(t, transport.TLSClientConfig)
+		assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+		assert.Contains(t, out, "WARNING: TLS certificate verification is disabled")
+	})
+}
+
+func TestBootstrapAPIClientCustomHeaders(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedHeaders = req.Header.Clone()
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name          string
+		args          []string
+		expectedErr   string
+		expectHeaders map[string]string
+	}{
+		{
+			"no custom headers",
+			nil,
+			"",
+			map[string]string{"X-Api-Key": "asdfjkl"},
+		},
+		{
+			"multiple custom headers",
+			[]string{"--api-header", "X-Request-Id=abc123", "--api-header", "X-Tenant-Filter=region=us,tier=1"},
+			"",
+			map[string]string{"X-Request-Id": "abc123", "X-Tenant-Filter": "region=us,tier=1", "X-Api-Key": "asdfjkl"},
+		},
+		{
+			"empty value",
+			[]string{"--api-header=X-Empty="},
+			"",
+			map[string]string{"X-Empty": ""},
+		},
+		{
+			"missing value",
+			[]string{"--api-header=X-Request-Id"},
+			`invalid API header "X-Request-Id" (must be KEY=VALUE)`,
+			nil,
+		},
+		{
+			"missing name",
+			[]string{"--api-header==abc123"},
+			`invalid API header "=abc123" (must be KEY=VALUE)`,
+			nil,
+		},
+		{
+			"reserved header",
+			[]string{"--api-header=X-API-Key=override"},
+			`custom header "X-API-Key" is reserved and cannot be overridden`,
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			receivedHeaders = nil
+			args := append([]string{"api", "my-ip", "--api-url=" + server.URL, "--api-key=asdfjkl",
+				"--api-tls-skip-verify"}, tt.args...)
+			_, _, err := ExecuteC(newCLI(), args...)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				assert.Nil(t, receivedHeaders, "no request should be made")
+				return
+			}
+			require.NoError(t, err)
+			for name, value := range tt.expectHeaders {
+				assert.Contains(t, receivedHeaders, name)
+				assert.Equal(t, value, receivedHeaders.Get(name))
+			}
+		})
+	}
+}
+
+func TestBootstrapAPIClientLogRequestResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "asdfjkl", req.Header.Get("X-Api-Key"), "the API key should be sent unredacted")
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name            string
+		args            []string
+		expectDumps     bool
+		expectRedacted  []string
+		expectUnchanged []string
+	}{
+		{
+			"not requested",
+			[]string{"-vv"},
+			false, nil, nil,
+		},
+		{
+			"insufficient verbosity",
+			[]string{"--log-request-response", "-v"},
+			false, nil, nil,
+		},
+		{
+			"default redaction",
+			[]string{"--log-request-response", "-vv", "--api-header=X-Tenant=example"},
+			true,
+			[]string{"X-Api-Key"},
+			[]string{"X-Tenant: example"},
+		},
+		{
+			"custom redaction",
+			[]string{"--log-request-response", "-vv", "--api-header=X-Tenant=example",
+				"--log-redact-headers=x-api-key", "--log-redact-headers=X-TENANT"},
+			true,
+			[]string{"X-Api-Key", "X-Tenant"},
+			nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"api", "my-ip", "--api-url=" + server.URL, "--api-key=asdfjkl",
+				"--api-tls-skip-verify", "--log-json"}, tt.args...)
+			_, out, err := ExecuteC(newCLI(), args...)
+			require.NoError(t, err)
+
+			var dumps []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				var record map[string]interface{}
+				if json.Unmarshal([]byte(line), &record) == nil && record["request"] != nil {
+					dumps = append(dumps, record)
+				}
+			}
+			if !tt.expectDumps {
+				assert.Empty(t, dumps)
+				assert.NotContains(t, out, "Received API response")
+				return
+			}
+
+			require.Len(t, dumps, 1)
+			assert.Equal(t, "debug", dumps[0]["level"])
+			assert.Equal(t, "Sending API request", dumps[0]["msg"])
+			request := dumps[0]["request"].(string)
+			for _, name := range tt.expectRedacted {
+				assert.Contains(t, request, "\r\n"+name+": [REDACTED]\r\n")
+			}
+			for _, header := range tt.expectUnchanged {
+				assert.Contains(t, request, "\r\n"+header+"\r\n")
+			}
+			assert.NotContains(t, out, "asdfjkl")
+			assert.Contains(t, out, `"msg":"Received API response"`)
+		})
+	}
+}
+
+func TestBootstrapAPIClientSecretBackend(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Header.Get("X-Vault-Token") != "vault-token":
+			resp.WriteHeader(http.StatusForbidden)
+		case req.URL.Path == "/v1/secret/data/mydyndns":
+			resp.Write([]byte(`{"data":{"data":{"api-key":"vault-api-key"}}}`))
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	var apiKeys []string
+	api := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		apiKeys = append(apiKeys, req.Header.Get("x-api-key"))
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer api.Close()
+
+	for _, tt := range []struct {
+		name, vaultToken, expectedAPIKey, expectedErr string
+		args                                          []string
+	}{
+		{
+			"env backend uses api-key directive",
+			"vault-token",
+			"asdfjkl",
+			"",
+			[]string{"--api-key=asdfjkl"},
+		},
+		{
+			"vault backend resolves api key",
+			"vault-token",
+			"vault-api-key",
+			"",
+			[]string{"--api-key=asdfjkl", "--secret-backend=vault", "--vault-path=secret/data/mydyndns"},
+		},
+		{
+			"vault backend with missing secret",
+			"vault-token",
+			"",
+			`unable to resolve secret "secret/data/other": vault path secret/data/other: secret not found`,
+			[]string{"--secret-backend=vault", "--vault-path=secret/data/other"},
+		},
+		{
+			"vault backend with wrong permissions",
+			"wrong-token",
+			"",
+			`unable to resolve secret "secret/data/mydyndns": vault path secret/data/mydyndns: permission denied`,
+			[]string{"--secret-backend=vault", "--vault-path=secret/data/mydyndns"},
+		},
+		{
+			"vault backend requires vault-path",
+			"vault-token",
+			"",
+			"missing Vault path directive (required by the vault secret backend)",
+			[]string{"--secret-backend=vault"},
+		},
+		{
+			"aws backend requires secret-id",
+			"vault-token",
+			"",
+			"missing secret ID directive (required by the aws-secretsmanager secret backend)",
+			[]string{"--secret-backend=aws-secretsmanager"},
+		},
+		{
+			"unsupported backend",
+			"vault-token",
+			"",
+			`unsupported secret backend "keychain" (must be one of: env, aws-secretsmanager, vault)`,
+			[]string{"--secret-backend=keychain"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VAULT_ADDR", vault.URL)
+			t.Setenv("VAULT_TOKEN", tt.vaultToken)
+			t.Cleanup(viper.Reset)
+			apiKeys = nil
+
+			_, _, err := ExecuteC(newCLI(), append([]string{"api", "my-ip", "--api-url", api.URL, "--api-tls-skip-verify"},
+				tt.args...)...)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				assert.Empty(t, apiKeys, "no API request should be made without an API key")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{tt.expectedAPIKey}, apiKeys)
+		})
+	}
+
+	t.Run("not resolved by commands that do not make API requests", func(t *testing.T) {
+		vaultRequests := 0
+		vault := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			vaultRequests++
+			resp.WriteHeader(http.StatusForbidden)
+		}))
+		defer vault.Close()
+		t.Setenv("VAULT_ADDR", vault.URL)
+		t.Setenv("VAULT_TOKEN", "vault-token")
+		t.Cleanup(viper.Reset)
+
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--secret-backend=vault", "--vault-path=secret/data/mydyndns")
+		require.NoError(t, err)
+		assert.Zero(t, vaultRequests)
+	})
+}
+
+func TestBootstrapAPIClientAPIKeyFile(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte(req.Header.Get("x-api-key")))
+	}))
+	defer api.Close()
+
+	dir := t.TempDir()
+	writeKeyFile := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+		return path
+	}
+	keyFile := writeKeyFile("api-key", "file-api-key")
+	keyFileWithNewline := writeKeyFile("api-key-newline", "file-api-key\n")
+	missingKeyFile := filepath.Join(dir, "nonexistent")
+
+	for _, tt := range []struct {
+		name, expectedAPIKey, expectedErr string
+		args                              []string
+	}{
+		{
+			"file exists",
+			"file-api-key",
+			"",
+			[]string{"--api-key-file=" + keyFile},
+		},
+		{
+			"file with trailing newline",
+			"file-api-key",
+			"",
+			[]string{"--api-key-file=" + keyFileWithNewline},
+		},
+		{
+			"file missing",
+			"",
+			fmt.Sprintf("unable to read API key file: open %s: no such file or directory", missingKeyFile),
+			[]string{"--api-key-file=" + missingKeyFile},
+		},
+		{
+			"both api-key and api-key-file",
+			"",
+			"api-key and api-key-file directives cannot both be set",
+			[]string{"--api-key=asdfjkl", "--api-key-file=" + keyFile},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ExecuteC(newCLI(),
+				append([]string{"config", "show", "--api-url=https://example.com"}, tt.args...)...)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			client, ok := apiClient.(*sdk.Client)
+			require.True(t, ok, "expected bootstrapped API client to be an *sdk.Client")
+			client.BaseURL = api.URL
+			// The API echoes the x-api-key header back as a response body that is not a valid IP
+			_, err = client.MyIP()
+			var parseErr sdk.IPParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.expectedAPIKey, string(parseErr.Body()))
+		})
+	}
+
+	t.Run("key is not part of the effective configuration", func(t *testing.T) {
+		_, out, err := ExecuteC(newCLI(), "config", "show", "--api-key-file="+keyFile, "--output=json")
+		require.NoError(t, err)
+		var settings map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(out), &settings))
+		assert.NotContains(t, settings, "api-key")
+		assert.Equal(t, keyFile, settings["api-key-file"])
+	})
+}
+
+func TestBootstrapAPIClientInvalidBaseURL(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"--api-url=http://example.com"},
+		{"--api-url=https://example.com", "--api-check-url=http://check.example.com"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			apiClient = new(sdktest.MockClient)
+			_, _, err := ExecuteC(newCLI(), append([]string{"config", "show"}, args...)...)
+			require.NoError(t, err, "commands that make no API requests should not require a valid API URL")
+			assert.Nil(t, apiClient, "no API client should be bootstrapped")
+		})
+	}
+
+	t.Run("client errors are reported", func(t *testing.T) {
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--api-url=https://example.com",
+			"--api-tls-cert="+filepath.Join(t.TempDir(), "missing.crt"), "--api-tls-key=missing.key")
+		assert.ErrorContains(t, err, "unable to load client certificate")
+		assert.Equal(t, ExitConfigError, ExitCode(err))
+	})
+}
+
+func TestBootstrapAPIClientAPIURLTemplate(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	originalHostname := hostname
+	t.Cleanup(func() { hostname = originalHostname })
+	hostname = func() (string, error) { return "tenant1", nil }
+
+	for _, tt := range []struct {
+		name, expectedURL, expectedErr, expectedCode string
+		args                                         []string
+	}{
+		{
+			"hostname substitution",
+			"https://tenant1.mydyndns.io",
+			"",
+			"",
+			[]string{"--api-url-template=https://{{.Hostname}}.mydyndns.io"},
+		},
+		{
+			"invalid template syntax",
+			"",
+			"invalid API URL template: template: api-url-template:1: unclosed action",
+			validationCodeInvalidAPIURLTemplate,
+			[]string{"--api-url-template=https://{{.Hostname.mydyndns.io"},
+		},
+		{
+			"unknown template field",
+			"",
+			"unable to execute API URL template: template: api-url-template:1:10: executing \"api-url-template\" " +
+				"at <.Tenant>: can't evaluate field Tenant in type cli.apiURLTemplateData",
+			validationCodeInvalidAPIURLTemplate,
+			[]string{"--api-url-template=https://{{.Tenant}}.mydyndns.io"},
+		},
+		{
+			"insecure result",
+			"",
+			`SSL is required for API Base URL (received "http://tenant1.mydyndns.io")`,
+			validationCodeInsecureAPIURL,
+			[]string{"--api-url-template=http://{{.Hostname}}.mydyndns.io"},
+		},
+		{
+			"both api-url and api-url-template",
+			"",
+			"api-url and api-url-template directives cannot both be set",
+			validationCodeConflictingAPIURLSources,
+			[]string{"--api-url=https://example.com", "--api-url-template=https://{{.Hostname}}.mydyndns.io"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ExecuteC(newCLI(), append([]string{"config", "show"}, tt.args...)...)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				assert.Equal(t, tt.expectedCode, validationErrorCode(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, viper.GetString("api-url"))
+			client, ok := apiClient.(*sdk.Client)
+			require.True(t, ok, "expected bootstrapped API client to be an *sdk.Client")
+			assert.Equal(t, tt.expectedURL, client.BaseURL)
+		})
+	}
+
+	t.Run("hostname error", func(t *testing.T) {
+		hostname = func() (string, error) { return "", errors.New("no hostname") }
+		_, _, err := ExecuteC(newCLI(), "config", "show", "--api-url-template=https://{{.Hostname}}.mydyndns.io")
+		assert.EqualError(t, err, "unable to determine hostname for API URL template: no hostname")
+	})
+
+	t.Run("URL is not written to config files", func(t *testing.T) {
+		hostname = func() (string, error) { return "tenant1", nil }
+		outDir := t.TempDir()
+		_, _, err := ExecuteC(newCLI(), "config", "write", "json", "--quiet", fmt.Sprintf("--directory=%s", outDir),
+			"--api-url-template=https://{{.Hostname}}.mydyndns.io")
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(outDir, "mydyndns.json"))
+		require.NoError(t, err)
+		var settings map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &settings))
+		assert.NotContains(t, settings, "api-url")
+		assert.Equal(t, "https://{{.Hostname}}.mydyndns.io", settings["api-url-template"])
+	})
+}
+
+func TestURLCompletion(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	completionFunc, ok := newCLI().GetFlagCompletionFunc("api-url")
+	require.True(t, ok, "--api-url should have a completion function")
+
+	t.Run("no history file", func(t *testing.T) {
+		urls, directive := completionFunc(newCLI(), nil, "")
+		assert.Empty(t, urls)
+		assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+	})
+
+	historyDir := filepath.Join(home, ".config", "mydyndns")
+	require.NoError(t, os.MkdirAll(historyDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(historyDir, "url-history"), []byte(strings.Join([]string{
+		"https://dyndns.example.com",
+		"https://staging.example.com",
+		"",
+		"http://localhost:8080",
+		"https://dyndns.example.com",
+		"  https://staging.example.com  ",
+		"https://dyndns.example.org",
+	}, "\n")+"\n"), 0o644))
+
+	for _, tt := range []struct {
+		toComplete string
+		expected   []string
+	}{
+		{"", []string{
+			"https://dyndns.example.com",
+			"https://staging.example.com",
+			"http://localhost:8080",
+			"https://dyndns.example.org",
+		}},
+		{"https://", []string{
+			"https://dyndns.example.com",
+			"https://staging.example.com",
+			"https://dyndns.example.org",
+		}},
+		{"https://dyndns.", []string{"https://dyndns.example.com", "https://dyndns.example.org"}},
+		{"http://l", []string{"http://localhost:8080"}},
+		{"ftp://", []string{}},
+	} {
+		t.Run(fmt.Sprintf("completing %q", tt.toComplete), func(t *testing.T) {
+			urls, directive := completionFunc(newCLI(), nil, tt.toComplete)
+			assert.Equal(t, tt.expected, urls)
+			assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+		})
+	}
+}
+
+func TestConfigFileCompletion(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"mydyndns.toml", "mydyndns.yaml", "mydyndns.enc", "staging.json", "prod.hcl", "notes.txt", "README",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "backup.yaml"), 0o755))
+
+	// complete requests completions for --config-file as a shell would, and returns the suggestions and directive
+	complete := func(t *testing.T, args ...string) ([]string, string) {
+		t.Helper()
+		t.Cleanup(viper.Reset)
+		_, out, err := ExecuteC(newCLI(), append([]string{cobra.ShellCompRequestCmd, "config", "show"}, args...)...)
+		require.NoError(t, err)
+		var suggestions []string
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, ":") {
+				return suggestions, line
+			}
+			suggestions = append(suggestions, line)
+		}
+		t.Fatalf("no completion directive in output: %q", out)
+		return nil, ""
+	}
+	defaultDirective := fmt.Sprintf(":%d", cobra.ShellCompDirectiveDefault)
+
+	for _, tt := range []struct {
+		toComplete string
+		expected   []string
+	}{
+		{"", []string{"mydyndns.enc", "mydyndns.toml", "mydyndns.yaml", "prod.hcl", "staging.json"}},
+		{"my", []string{"mydyndns.enc", "mydyndns.toml", "mydyndns.yaml"}},
+		{"mydyndns.y", []string{"mydyndns.yaml"}},
+		{"s", []string{"staging.json"}},
+		{"n", nil},
+		{"b", nil},
+	} {
+		t.Run(fmt.Sprintf("completing %q", tt.toComplete), func(t *testing.T) {
+			suggestions, directive := complete(t, "--config-path", dir, "--config-file", tt.toComplete)
+			assert.Equal(t, tt.expected, suggestions)
+			assert.Equal(t, defaultDirective, directive)
+		})
+	}
+
+	t.Run("default config path", func(t *testing.T) {
+		origWorkDir, err := os.Getwd()
+		require.NoError(t, err)
+		require.NoError(t, os.Chdir(dir))
+		t.Cleanup(func() { os.Chdir(origWorkDir) })
+		suggestions, directive := complete(t, "--config-file", "st")
+		assert.Equal(t, []string{"staging.json"}, suggestions)
+		assert.Equal(t, defaultDirective, directive)
+	})
+
+	t.Run("paths are left to the shell", func(t *testing.T) {
+		suggestions, directive := complete(t, "--config-path", dir, "--config-file", dir+"/my")
+		assert.Empty(t, suggestions)
+		assert.Equal(t, defaultDirective, directive)
+	})
+
+	t.Run("missing config path", func(t *testing.T) {
+		suggestions, directive := complete(t, "--config-path", filepath.Join(dir, "missing"), "--config-file", "")
+		assert.Empty(t, suggestions)
+		assert.Equal(t, defaultDirective, directive)
+	})
+}
+
+func TestFlagNameToEnvVar(t *testing.T) {
+	for flagName, expected := range map[string]string{
+		"interval":            "MYDYNDNS_INTERVAL",
+		"api-key":             "MYDYNDNS_API_KEY",
+		"api-tls-skip-verify": "MYDYNDNS_API_TLS_SKIP_VERIFY",
+	} {
+		t.Run(flagName, func(t *testing.T) {
+			assert.Equal(t, expected, flagNameToEnvVar(flagName))
+		})
+	}
+}
+
+func TestBootstrapConfigEnvironmentVariables(t *testing.T) {
+	t.Setenv(flagNameToEnvVar("api-key"), "env-api-key")
+	t.Setenv(flagNameToEnvVar("log-verbosity"), "2")
+
+	cmd, out, err := ExecuteC(newCLI(), "config", "show", "--no-redact")
+	require.Equal(t, "show", cmd.Name())
+	require.NoError(t, err)
+	assert.Contains(t, out, "api-key = env-api-key\n")
+	assert.Contains(t, out, "log-verbosity = 2\n")
+}
+
+func TestAllFlagsHaveEnvBinding(t *testing.T) {
+	var visit func(*cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		// LocalFlags merges the persistent flags of parent commands into cmd.Flags(), as happens on execution
+		cmd.LocalFlags()
+		t.Run(cmd.CommandPath(), func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			bindFlags(cmd)
+			cmd.Flags().VisitAll(func(f *pflag.Flag) {
+				t.Run(f.Name, func(t *testing.T) {
+					// AutomaticEnv is not enabled, so only explicit bindings are effective
+					t.Setenv(flagNameToEnvVar(f.Name), "from-env")
+					assert.Equal(t, "from-env", viper.GetString(f.Name),
+						"flag should be overridable by %s", flagNameToEnvVar(f.Name))
+				})
+			})
+		})
+		for _, sub := range cmd.Commands() {
+			visit(sub)
+		}
+	}
+	visit(newCLI())
+}
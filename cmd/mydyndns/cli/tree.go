@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/spf13/cobra"
 	"github.com/xlab/treeprint"
 
@@ -12,19 +15,51 @@ func newCommandTreeCmd() *cobra.Command {
 		Use:    "command-tree",
 		Hidden: true,
 		Long: `Prints an ASCII tree representation of the nested (sub)command hierarchy. 
-Note that output excludes this command, "help", "completion", and deprecated/hidden commands.`,
-		Run: func(cmd *cobra.Command, args []string) {
+Note that output excludes this command, "help", "completion", and deprecated/hidden commands.
+With --json, the hierarchy is instead printed as JSON (including each command's descriptions).`,
+		RunE: func(cmd *cobra.Command, args []string) error {
 			exclusions := internal.NewStringCollection("completion")
-			tree := cmdToTree(cmd.Root(), func(c *cobra.Command) bool {
+			filter := func(c *cobra.Command) bool {
 				return !exclusions.Contains(c.Name()) && c.IsAvailableCommand()
-			})
-			cmd.Print(tree.String())
+			}
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				out, err := json.Marshal(cmdToNode(cmd.Root(), filter))
+				if err != nil {
+					return err
+				}
+				cmd.Println(string(out))
+				return nil
+			}
+			cmd.Print(cmdToTree(cmd.Root(), filter).String())
+			return nil
 		},
 	}
 
+	cmd.Flags().Bool("json", false, "Print the command hierarchy as JSON instead of an ASCII tree")
+
 	return cmd
 }
 
+// commandNode is the JSON representation of a command in the command hierarchy.
+type commandNode struct {
+	Name      string        `json:"name"`
+	ShortDesc string        `json:"short_desc"`
+	LongDesc  string        `json:"long_desc"`
+	Children  []commandNode `json:"children,omitempty"`
+}
+
+// cmdToNode returns a commandNode representing cmd and (recursively) those of its subcommands for which f
+// returns true.
+func cmdToNode(cmd *cobra.Command, f func(*cobra.Command) bool) commandNode {
+	node := commandNode{Name: cmd.Name(), ShortDesc: cmd.Short, LongDesc: strings.TrimSpace(cmd.Long)}
+	for _, child := range cmd.Commands() {
+		if f(child) {
+			node.Children = append(node.Children, cmdToNode(child, f))
+		}
+	}
+	return node
+}
+
 func cmdToTree(cmd *cobra.Command, f func(*cobra.Command) bool) treeprint.Tree {
 	var buildTree func(treeprint.Tree, *cobra.Command)
 	buildTree = func(t treeprint.Tree, c *cobra.Command) {
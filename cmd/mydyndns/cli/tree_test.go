@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -25,6 +26,60 @@ func TestNewCommandTreeCmd(t *testing.T) {
 		"Tree output should exclude build-in \"help\" command")
 }
 
+func TestNewCommandTreeCmdJSON(t *testing.T) {
+	cmd, out, err := ExecuteC(newCLI(), "command-tree", "--json")
+	require.Equal(t, "command-tree", cmd.Name())
+	require.NoError(t, err)
+
+	var root commandNode
+	require.NoError(t, json.Unmarshal([]byte(out), &root), "output is not valid JSON: %s", out)
+
+	// Flatten the tree to space-separated command paths
+	var paths []string
+	var walk func(prefix string, n commandNode)
+	walk = func(prefix string, n commandNode) {
+		path := strings.TrimSpace(prefix + " " + n.Name)
+		paths = append(paths, path)
+		for _, child := range n.Children {
+			walk(path, child)
+		}
+	}
+	walk("", root)
+	assert.Equal(t, []string{
+		"mydyndns",
+		"mydyndns agent",
+		"mydyndns agent start",
+		"mydyndns agent status",
+		"mydyndns agent stop",
+		"mydyndns api",
+		"mydyndns api check-auth",
+		"mydyndns api current-alias",
+		"mydyndns api history",
+		"mydyndns api my-ip",
+		"mydyndns api ping",
+		"mydyndns api update-alias",
+		"mydyndns config",
+		"mydyndns config diff",
+		"mydyndns config env",
+		"mydyndns config merge",
+		"mydyndns config show",
+		"mydyndns config types",
+		"mydyndns config types check",
+		"mydyndns config types list", "mydyndns config upgrade",
+		"mydyndns config validate",
+		"mydyndns config watch",
+		"mydyndns config write",
+	}, paths, "JSON tree should match the command hierarchy, excluding hidden and built-in commands")
+
+	rootCmd := newCLI()
+	assert.Equal(t, rootCmd.Short, root.ShortDesc)
+	assert.Equal(t, strings.TrimSpace(rootCmd.Long), root.LongDesc)
+	require.NotEmpty(t, root.Children)
+	agent := root.Children[0]
+	assert.Equal(t, "agent", agent.Name)
+	assert.Equal(t, newAgentCmd().Short, agent.ShortDesc)
+}
+
 func TestCmdToTree(t *testing.T) {
 	root := &cobra.Command{Use: "root"}
 	a := &cobra.Command{Use: "a"}
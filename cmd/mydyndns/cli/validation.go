@@ -1,38 +1,334 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
 	"path/filepath"
 	"strings"
 
 	"github.com/TylerHendrickson/mydyndns/internal"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// Codes that identify each kind of validation failure in machine-readable output (see "config validate").
+// Failures without a more specific code are identified by validationCodeInvalidConfig.
+const (
+	validationCodeInvalidConfig               = "invalid_config"
+	validationCodeConflictingAPIKeySources    = "conflicting_api_key_sources"
+	validationCodeConflictingAPIURLSources    = "conflicting_api_url_sources"
+	validationCodeInsecureAPICheckURL         = "insecure_api_check_url"
+	validationCodeInvalidAlertEmail           = "invalid_alert_email"
+	validationCodeInsecureAPIURL              = "insecure_api_url"
+	validationCodeInsecureExtraUpdateURL      = "insecure_extra_update_url"
+	validationCodeInsecureIPSourceURL         = "insecure_ip_source_url"
+	validationCodeInvalidAPIURL               = "invalid_api_url"
+	validationCodeInvalidAPIURLTemplate       = "invalid_api_url_template"
+	validationCodeInvalidChangeThreshold      = "invalid_change_threshold"
+	validationCodeInvalidExtraUpdateURL       = "invalid_extra_update_url"
+	validationCodeInvalidHistoryLimit         = "invalid_history_limit"
+	validationCodeInvalidHistorySince         = "invalid_history_since"
+	validationCodeInvalidHistorySize          = "invalid_history_size"
+	validationCodeInvalidIPSourceURL          = "invalid_ip_source_url"
+	validationCodeInvalidLogField             = "invalid_log_field"
+	validationCodeInvalidMaxConsecutiveErrors = "invalid_max_consecutive_errors"
+	validationCodeInvalidOutputTemplate       = "invalid_output_template"
+	validationCodeInvalidPollErrorMaxBackoff  = "invalid_poll_error_max_backoff"
+	validationCodeInvalidPollInterval         = "invalid_poll_interval"
+	validationCodeInvalidPropagationServer    = "invalid_propagation_server"
+	validationCodeInvalidPropagationTimeout   = "invalid_propagation_timeout"
+	validationCodeInvalidSampleCount          = "invalid_sample_count"
+	validationCodeInvalidSampleInterval       = "invalid_sample_interval"
+	validationCodeInvalidStartupDelay         = "invalid_startup_delay"
+	validationCodeInvalidTTL                  = "invalid_ttl"
+	validationCodeInvalidUpdateCooldown       = "invalid_update_cooldown"
+	validationCodeMissingAPIKey               = "missing_api_key"
+	validationCodeMissingAPIURL               = "missing_api_url"
+	validationCodeMissingHostname             = "missing_hostname"
+	validationCodeMissingRemoteProvider       = "missing_remote_provider"
+	validationCodeMissingSMTPHost             = "missing_smtp_host"
+	validationCodeUnrecognizedDirective       = "unrecognized_directive"
+	validationCodeUnsupportedLogBackend       = "unsupported_log_backend"
+	validationCodeUnsupportedOutputFormat     = "unsupported_output_format"
+	validationCodeUnsupportedRecordType       = "unsupported_record_type"
+)
+
+// validationError is a validation failure, identified by a code for machine-readable output.
+type validationError struct {
+	code string
+	err  error
+}
+
+func newValidationError(code, format string, a ...interface{}) error {
+	return validationError{code: code, err: fmt.Errorf(format, a...)}
+}
+
+func (e validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e validationError) Unwrap() error {
+	return e.err
+}
+
+// validationErrorCode returns the code of the validationError wrapped by err, or validationCodeInvalidConfig
+// if err does not wrap a validationError.
+func validationErrorCode(err error) string {
+	var e validationError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return validationCodeInvalidConfig
+}
+
 func validatePollInterval(cmd *cobra.Command) error {
 	if pollInterval := viper.GetDuration("interval"); pollInterval < minimumPollInterval {
-		return fmt.Errorf("poll interval cannot be less than %s", minimumPollInterval)
+		return newValidationError(validationCodeInvalidPollInterval, "poll interval cannot be less than %s", minimumPollInterval)
+	}
+	return nil
+}
+
+func validateChangeThreshold(cmd *cobra.Command) error {
+	if threshold := viper.GetInt("change-threshold"); threshold < 1 {
+		return newValidationError(validationCodeInvalidChangeThreshold, "change threshold must be at least 1 (received %d)", threshold)
+	}
+	return nil
+}
+
+func validateHistorySize(cmd *cobra.Command) error {
+	if size := viper.GetInt("history-size"); size < 0 {
+		return newValidationError(validationCodeInvalidHistorySize, "history size cannot be negative (received %d)", size)
+	}
+	return nil
+}
+
+func validateUpdateCooldown(cmd *cobra.Command) error {
+	if cooldown := viper.GetDuration("update-cooldown"); cooldown < 0 {
+		return newValidationError(validationCodeInvalidUpdateCooldown, "update cooldown cannot be negative (received %s)", cooldown)
+	}
+	return nil
+}
+
+func validatePollErrorMaxBackoff(cmd *cobra.Command) error {
+	if maxBackoff := viper.GetDuration("poll-error-max-backoff"); maxBackoff < 0 {
+		return newValidationError(validationCodeInvalidPollErrorMaxBackoff, "poll error max backoff cannot be negative (received %s)", maxBackoff)
+	}
+	return nil
+}
+
+func validateMaxConsecutiveErrors(cmd *cobra.Command) error {
+	if maxErrors := viper.GetInt("max-consecutive-errors"); maxErrors < 0 {
+		return newValidationError(validationCodeInvalidMaxConsecutiveErrors, "max consecutive errors cannot be negative (received %d)", maxErrors)
 	}
 	return nil
 }
 
+func validateKnownConfigKeys(cmd *cobra.Command) error {
+	var unknown []string
+	internal.NewStringCollection(viper.AllKeys()...).Difference(knownConfigKeys(cmd)).EachSorted(func(key string) {
+		unknown = append(unknown, fmt.Sprintf("%q", key))
+	})
+	switch len(unknown) {
+	case 0:
+		return nil
+	case 1:
+		return newValidationError(validationCodeUnrecognizedDirective, "unrecognized config directive %s", unknown[0])
+	}
+	return newValidationError(validationCodeUnrecognizedDirective, "unrecognized config directives: %s", strings.Join(unknown, ", "))
+}
+
 func validateBaseURL(cmd *cobra.Command) error {
 	if baseURL := viper.GetString("api-url"); baseURL == "" {
-		return fmt.Errorf("missing API base URL directive")
+		return newValidationError(validationCodeMissingAPIURL, "missing API base URL directive")
 	} else if !strings.HasPrefix(strings.ToLower(baseURL), "https://") {
-		return fmt.Errorf("SSL is required for API Base URL (received %q)", baseURL)
+		return newValidationError(validationCodeInsecureAPIURL, "SSL is required for API Base URL (received %q)", baseURL)
+	} else if err := sdk.ValidateBaseURL(baseURL); err != nil {
+		return validationError{code: validationCodeInvalidAPIURL, err: err}
+	}
+	if checkURL := viper.GetString("api-check-url"); checkURL != "" &&
+		!strings.HasPrefix(strings.ToLower(checkURL), "https://") {
+		return newValidationError(validationCodeInsecureAPICheckURL, "SSL is required for API check URL (received %q)", checkURL)
+	}
+	return nil
+}
+
+func validateExtraUpdateURLs(cmd *cobra.Command) error {
+	for _, extraURL := range viper.GetStringSlice("extra-update-url") {
+		if !strings.HasPrefix(strings.ToLower(extraURL), "https://") {
+			return newValidationError(validationCodeInsecureExtraUpdateURL, "SSL is required for extra update URL (received %q)", extraURL)
+		}
+		if err := sdk.ValidateBaseURL(extraURL); err != nil {
+			return validationError{code: validationCodeInvalidExtraUpdateURL, err: err}
+		}
+	}
+	return nil
+}
+
+func validateIPSourceURL(cmd *cobra.Command) error {
+	sourceURL := viper.GetString("ip-source-url")
+	if sourceURL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(strings.ToLower(sourceURL), "https://") {
+		return newValidationError(validationCodeInsecureIPSourceURL, "SSL is required for IP source URL (received %q)", sourceURL)
+	}
+	if err := sdk.ValidateBaseURL(sourceURL); err != nil {
+		return validationError{code: validationCodeInvalidIPSourceURL, err: err}
+	}
+	return nil
+}
+
+func validateAlertEmail(cmd *cobra.Command) error {
+	alertEmail := viper.GetString("alert-email")
+	if alertEmail == "" {
+		return nil
+	}
+	for _, name := range []string{"alert-email", "smtp-from"} {
+		if addr := viper.GetString(name); addr != "" {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return newValidationError(validationCodeInvalidAlertEmail, "invalid %s address %q: %s", name, addr, err)
+			}
+		}
+	}
+	if viper.GetString("smtp-host") == "" {
+		return newValidationError(validationCodeMissingSMTPHost, "missing SMTP host directive (required by alert-email)")
+	}
+	if port := viper.GetInt("smtp-port"); port < 1 || port > 65535 {
+		return newValidationError(validationCodeInvalidAlertEmail, "invalid SMTP port %d", port)
 	}
 	return nil
 }
 
 func validateAPIKey(cmd *cobra.Command) error {
+	// API keys from external secret backends are validated when they are resolved
+	if backend := viper.GetString("secret-backend"); backend != "" && backend != secretBackendEnv {
+		return nil
+	}
 	if apiKey := viper.GetString("api-key"); apiKey == "" {
-		return fmt.Errorf("missing API key directive")
+		return newValidationError(validationCodeMissingAPIKey, "missing API key directive")
 	}
 	return nil
 }
 
+func validateAPIKeySource(cmd *cobra.Command) error {
+	if viper.GetString("api-key") != "" && viper.GetString("api-key-file") != "" {
+		return newValidationError(validationCodeConflictingAPIKeySources, "api-key and api-key-file directives cannot both be set")
+	}
+	return nil
+}
+
+func validateAPIURLSource(cmd *cobra.Command) error {
+	if viper.GetString("api-url") != "" && viper.GetString("api-url-template") != "" {
+		return newValidationError(validationCodeConflictingAPIURLSources, "api-url and api-url-template directives cannot both be set")
+	}
+	return nil
+}
+
+func validateOutputFormat(cmd *cobra.Command) error {
+	switch format := viper.GetString("output"); format {
+	case outputFormatText, outputFormatJSON, outputFormatTable:
+		return nil
+	default:
+		return newValidationError(validationCodeUnsupportedOutputFormat, "unsupported output format %q (must be one of: text, json, table)", format)
+	}
+}
+
+func validateStartupDelay(cmd *cobra.Command) error {
+	if delay := viper.GetDuration("startup-delay"); delay < 0 {
+		return newValidationError(validationCodeInvalidStartupDelay, "startup delay cannot be negative (received %s)", delay)
+	}
+	return nil
+}
+
+func validateRemoteConfigWatch(cmd *cobra.Command) error {
+	if viper.GetBool("config-remote-watch") && viper.GetString(remoteProviderSettingKey) == "" {
+		return newValidationError(validationCodeMissingRemoteProvider, "config-remote-watch requires the %s directive", remoteProviderSettingKey)
+	}
+	return nil
+}
+
+func validateTTL(cmd *cobra.Command) error {
+	if ttl := viper.GetInt("ttl"); ttl < 0 {
+		return newValidationError(validationCodeInvalidTTL, "TTL cannot be negative (received %d)", ttl)
+	}
+	return nil
+}
+
+func validateRecordType(cmd *cobra.Command) error {
+	if _, err := sdk.ParseRecordType(viper.GetString("record-type")); err != nil {
+		return validationError{code: validationCodeUnsupportedRecordType, err: err}
+	}
+	return nil
+}
+
+func validatePropagation(cmd *cobra.Command) error {
+	if !viper.GetBool("wait-for-propagation") {
+		return nil
+	}
+	if viper.GetString("hostname") == "" {
+		return newValidationError(validationCodeMissingHostname, "missing hostname directive (required by wait-for-propagation)")
+	}
+	if timeout := viper.GetDuration("propagation-timeout"); timeout <= 0 {
+		return newValidationError(validationCodeInvalidPropagationTimeout,
+			"propagation timeout must be positive (received %s)", timeout)
+	}
+	server := viper.GetString("propagation-server")
+	if host, port, err := net.SplitHostPort(server); err != nil || host == "" || port == "" {
+		return newValidationError(validationCodeInvalidPropagationServer,
+			"propagation server must be an address of the form host:port (received %q)", server)
+	}
+	return nil
+}
+
+func validateLogBackend(cmd *cobra.Command) error {
+	switch backend := viper.GetString("log-backend"); backend {
+	case logBackendGoKit, logBackendSlog:
+		return nil
+	default:
+		return newValidationError(validationCodeUnsupportedLogBackend, "unsupported log backend %q (must be one of: %s, %s)", backend, logBackendGoKit, logBackendSlog)
+	}
+}
+
+func validateLogFields(cmd *cobra.Command) error {
+	if _, err := logFields(); err != nil {
+		return validationError{code: validationCodeInvalidLogField, err: err}
+	}
+	return nil
+}
+
+func validateOutputTemplate(cmd *cobra.Command) error {
+	if _, err := outputTemplate(cmd); err != nil {
+		return validationError{code: validationCodeInvalidOutputTemplate, err: err}
+	}
+	return nil
+}
+
+func validateSampling(cmd *cobra.Command) error {
+	if count := viper.GetInt("count"); count < 1 {
+		return newValidationError(validationCodeInvalidSampleCount, "sample count must be at least 1 (received %d)", count)
+	}
+	if interval := viper.GetDuration("sample-interval"); interval < 0 {
+		return newValidationError(validationCodeInvalidSampleInterval,
+			"sample interval cannot be negative (received %s)", interval)
+	}
+	return nil
+}
+
+func validateHistoryFilter(cmd *cobra.Command) error {
+	if limit := viper.GetInt("limit"); limit < 0 {
+		return newValidationError(validationCodeInvalidHistoryLimit, "history limit cannot be negative (received %d)", limit)
+	}
+	if _, err := historyFilter(); err != nil {
+		return validationError{code: validationCodeInvalidHistorySince, err: err}
+	}
+	return nil
+}
+
+// firstValidationError returns the error of the first of validators that fails, or nil if none fail.
+// Validators after the first that fails are not run.
 func firstValidationError(cmd *cobra.Command, validators ...func(*cobra.Command) error) error {
 	for _, fn := range validators {
 		if err := fn(cmd); err != nil {
@@ -42,6 +338,17 @@ func firstValidationError(cmd *cobra.Command, validators ...func(*cobra.Command)
 	return nil
 }
 
+// allValidationErrors runs all validators and returns the errors of those that fail, in order.
+func allValidationErrors(cmd *cobra.Command, validators ...func(*cobra.Command) error) []error {
+	var errs []error
+	for _, fn := range validators {
+		if err := fn(cmd); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 // validateConfigFileNames ensures that all strings represent a valid Viper extension.
 // Each string must be a supported extension ("json") or end in a supported extension ("foo.json").
 // The first value encountered that does not represent a valid Viper extension returns
@@ -0,0 +1,94 @@
+// Package crypto provides authenticated encryption of mydyndns config files.
+//
+// Encrypted data is stored in a simple binary container: a 4-byte magic header (see Magic), followed by
+// the 12-byte AES-GCM nonce, followed by the AES-256-GCM ciphertext (which includes the authentication tag).
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeySize is the required size (in bytes) of an encryption key.
+const KeySize = 32
+
+// Magic is the header that identifies data encrypted by this package.
+const Magic = "MDDE"
+
+const nonceSize = 12
+
+// ErrDecrypt is returned by Decrypt when data cannot be authenticated, which indicates that the wrong key
+// was provided or that the data is corrupted.
+var ErrDecrypt = errors.New("wrong key or corrupted data")
+
+// ErrNotEncrypted is returned by Decrypt when data does not begin with the Magic header.
+var ErrNotEncrypted = errors.New("data is not encrypted (missing header)")
+
+// IsEncrypted reports whether data begins with the Magic header.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// ReadKeyFile reads an encryption key from the named file, which must contain exactly KeySize bytes.
+func ReadKeyFile(name string) ([]byte, error) {
+	key, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key file %s must contain exactly %d bytes (found %d)", name, KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext with key using AES-256-GCM and a random nonce, and returns the result
+// in the container format described in the package documentation.
+func Encrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(Magic)+nonceSize, len(Magic)+nonceSize+len(plaintext)+aead.Overhead())
+	copy(out, Magic)
+	nonce := out[len(Magic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, []byte(Magic)), nil
+}
+
+// Decrypt decrypts data produced by Encrypt using key.
+func Decrypt(key, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, ErrNotEncrypted
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(Magic):]
+	if len(data) < nonceSize+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(Magic))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be exactly %d bytes (received %d)", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, KeySize)
+	plaintext := []byte("api-key = \"secret\"\n")
+
+	encrypted, err := Encrypt(key, plaintext)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.Equal(t, []byte(Magic), encrypted[:len(Magic)])
+	assert.NotContains(t, string(encrypted), "secret")
+
+	again, err := Encrypt(key, plaintext)
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "nonce should be random")
+
+	decrypted, err := Decrypt(key, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := Decrypt(bytes.Repeat([]byte{0x02}, KeySize), encrypted)
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		corrupted := bytes.Clone(encrypted)
+		corrupted[len(corrupted)-1] ^= 0xff
+		_, err := Decrypt(key, corrupted)
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := Decrypt(key, encrypted[:len(Magic)+4])
+		assert.ErrorIs(t, err, ErrDecrypt)
+	})
+	t.Run("not encrypted", func(t *testing.T) {
+		assert.False(t, IsEncrypted(plaintext))
+		_, err := Decrypt(key, plaintext)
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+	})
+	t.Run("invalid key size", func(t *testing.T) {
+		_, err := Encrypt([]byte("short"), plaintext)
+		assert.EqualError(t, err, "key must be exactly 32 bytes (received 5)")
+		_, err = Decrypt([]byte("short"), encrypted)
+		assert.EqualError(t, err, "key must be exactly 32 bytes (received 5)")
+	})
+}
+
+func TestReadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.key")
+	require.NoError(t, os.WriteFile(valid, bytes.Repeat([]byte{0x01}, KeySize), 0o600))
+	key, err := ReadKeyFile(valid)
+	require.NoError(t, err)
+	assert.Len(t, key, KeySize)
+
+	invalid := filepath.Join(dir, "invalid.key")
+	require.NoError(t, os.WriteFile(invalid, []byte("too short"), 0o600))
+	_, err = ReadKeyFile(invalid)
+	assert.EqualError(t, err, "key file "+invalid+" must contain exactly 32 bytes (found 9)")
+
+	_, err = ReadKeyFile(filepath.Join(dir, "missing.key"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
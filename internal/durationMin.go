@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// A DurationMin is a pflag.Value for time.Duration flags whose values must not be less than a minimum.
+// Values below the minimum are rejected when the flag is parsed, rather than being left for later validation.
+type DurationMin struct {
+	value time.Duration
+	min   time.Duration
+	// name describes the flag value in error messages
+	name string
+}
+
+// NewDurationMin returns a pointer to a new DurationMin with the given default value, which rejects values less
+// than min. The value is described by name (e.g. "poll interval") in error messages.
+func NewDurationMin(value, min time.Duration, name string) *DurationMin {
+	return &DurationMin{value: value, min: min, name: name}
+}
+
+// String returns the current value formatted by time.Duration.String.
+func (d *DurationMin) String() string {
+	return d.value.String()
+}
+
+// Set parses s as a time.Duration and sets it as the current value, unless it is invalid or less than the minimum.
+func (d *DurationMin) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if v < d.min {
+		return fmt.Errorf("%s cannot be less than %s", d.name, d.min)
+	}
+	d.value = v
+	return nil
+}
+
+// Type returns "duration", so that a DurationMin flag is treated like any other time.Duration flag
+// (e.g. by viper, which casts the flag value accordingly).
+func (d *DurationMin) Type() string {
+	return "duration"
+}
+
+// Duration returns the current value.
+func (d *DurationMin) Duration() time.Duration {
+	return d.value
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ pflag.Value = (*DurationMin)(nil)
+
+func TestDurationMin(t *testing.T) {
+	for _, tt := range []struct {
+		name, arg     string
+		expected      time.Duration
+		expectedError string
+	}{
+		{"default", "", time.Hour, ""},
+		{"above minimum", "--interval=2m", 2 * time.Minute, ""},
+		{"at minimum", "--interval=10s", 10 * time.Second, ""},
+		{"below minimum", "--interval=9s", time.Hour,
+			`invalid argument "9s" for "--interval" flag: poll interval cannot be less than 10s`},
+		{"negative", "--interval=-1m", time.Hour,
+			`invalid argument "-1m" for "--interval" flag: poll interval cannot be less than 10s`},
+		{"unparseable", "--interval=blah", time.Hour,
+			`invalid argument "blah" for "--interval" flag: time: invalid duration "blah"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDurationMin(time.Hour, 10*time.Second, "poll interval")
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.Var(d, "interval", "")
+			var args []string
+			if tt.arg != "" {
+				args = append(args, tt.arg)
+			}
+
+			err := flags.Parse(args)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, d.Duration())
+			assert.Equal(t, tt.expected.String(), d.String())
+			assert.Equal(t, "duration", flags.Lookup("interval").Value.Type())
+		})
+	}
+}
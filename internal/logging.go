@@ -1,7 +1,16 @@
 package internal
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -13,7 +22,51 @@ import (
 // 0 = WARN | 1 = INFO | 2 = DEBUG. Any value higher than 2 will be DEBUG.
 // In addition to fields defined on a per-log basis, this function configures a "caller" field included
 // on all logged output when lvl >= 2.
-func ConfigureLogger(json bool, lvl int, w io.Writer) (l log.Logger) {
+func ConfigureLogger(json bool, lvl int, w io.Writer) log.Logger {
+	return ConfigureLoggerWithOptions(json, lvl, w, LoggerOptions{})
+}
+
+// LoggerOptions configures optional behavior of loggers created by ConfigureLoggerWithOptions.
+type LoggerOptions struct {
+	// SampleRate, when greater than 1, causes only every Nth DEBUG-level message to be logged.
+	// Messages logged at INFO level and above are never sampled.
+	SampleRate int
+	// Fields are key-value pairs (see ValidateLogFields) added to every log line, e.g. to identify the service or
+	// environment of the logs when they are aggregated.
+	Fields []interface{}
+}
+
+// reservedLogFields are the keys of fields added by ConfigureLogger, which cannot be used as custom fields.
+var reservedLogFields = []string{"ts", "caller", level.Key().(string), "msg"}
+
+// ConfigureLoggerWithFields is like ConfigureLogger, but additionally adds the given key-value pairs to every
+// log line. Callers should check the fields with ValidateLogFields first.
+func ConfigureLoggerWithFields(json bool, lvl int, w io.Writer, fields ...interface{}) log.Logger {
+	return ConfigureLoggerWithOptions(json, lvl, w, LoggerOptions{Fields: fields})
+}
+
+// ValidateLogFields reports whether fields consists of key-value pairs (i.e. has an even number of elements) whose
+// keys are non-empty strings other than the keys of the fields added by ConfigureLogger (ts, caller, level, and msg).
+func ValidateLogFields(fields ...interface{}) error {
+	if len(fields)%2 != 0 {
+		return fmt.Errorf("log fields must be key-value pairs (received %d values)", len(fields))
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		switch {
+		case !ok:
+			return fmt.Errorf("log field keys must be strings (received %T)", fields[i])
+		case key == "":
+			return fmt.Errorf("log field keys cannot be empty")
+		case slices.Contains(reservedLogFields, key):
+			return fmt.Errorf("log field key %q is reserved", key)
+		}
+	}
+	return nil
+}
+
+// ConfigureLoggerWithOptions is like ConfigureLogger, but additionally applies the given LoggerOptions.
+func ConfigureLoggerWithOptions(json bool, lvl int, w io.Writer, opts LoggerOptions) (l log.Logger) {
 	if json {
 		l = log.NewJSONLogger(w)
 	} else {
@@ -33,7 +86,161 @@ func ConfigureLogger(json bool, lvl int, w io.Writer) (l log.Logger) {
 		lvlValue = level.WarnValue()
 	}
 
+	if opts.SampleRate > 1 {
+		l = NewSamplingLogger(l, opts.SampleRate)
+	}
 	l = log.NewSyncLogger(l)
+	if len(opts.Fields) > 0 {
+		l = log.With(l, opts.Fields...)
+	}
 	level.Debug(l).Log("msg", "Configured logger", "effective_level", lvlValue.String())
 	return
 }
+
+// NewSamplingLogger returns a Logger that forwards every DEBUG-level log event to next only once per rate events,
+// starting with the first. Log events at any other level (or without a level) are always forwarded.
+// When rate is less than 2, every log event is forwarded.
+func NewSamplingLogger(next log.Logger, rate int) log.Logger {
+	if rate < 2 {
+		return next
+	}
+	return &samplingLogger{next: next, rate: uint64(rate)}
+}
+
+type samplingLogger struct {
+	next  log.Logger
+	rate  uint64
+	count atomic.Uint64
+}
+
+func (l *samplingLogger) Log(keyvals ...interface{}) error {
+	if isDebug(keyvals) && (l.count.Add(1)-1)%l.rate != 0 {
+		return nil
+	}
+	return l.next.Log(keyvals...)
+}
+
+// isDebug reports whether keyvals contains the DEBUG level (see level.Key).
+func isDebug(keyvals []interface{}) bool {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == level.Key() {
+			if v, ok := keyvals[i+1].(level.Value); ok && v.String() == level.DebugValue().String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ConfigureLoggerSlog is like ConfigureLogger, but creates a *slog.Logger. Its output uses the same keys and values
+// as that of ConfigureLogger: timestamps are RFC3339Nano-formatted values of a "ts" field, levels are lower-cased,
+// and a "caller" field (i.e. "file.go:123") is included on all logged output when lvl >= 2. Like
+// ConfigureLoggerWithFields, the given key-value pairs (if any) are added to all logged output.
+func ConfigureLoggerSlog(json bool, lvl int, w io.Writer, fields ...interface{}) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelWarn, ReplaceAttr: replaceSlogAttr}
+	if lvl >= 2 {
+		opts.Level, opts.AddSource = slog.LevelDebug, true
+	} else if lvl == 1 {
+		opts.Level = slog.LevelInfo
+	}
+
+	var h slog.Handler
+	if json {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	l := slog.New(h).With(fields...)
+	l.Debug("Configured logger", "effective_level", strings.ToLower(opts.Level.Level().String()))
+	return l
+}
+
+// replaceSlogAttr replaces the built-in attributes of slog records with their ConfigureLogger equivalents.
+func replaceSlogAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		return slog.String("ts", a.Value.Time().Format(time.RFC3339Nano))
+	case slog.LevelKey:
+		return slog.String(slog.LevelKey, strings.ToLower(a.Value.String()))
+	case slog.SourceKey:
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			return slog.String("caller", fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+		}
+	}
+	return a
+}
+
+// NewSlogAdapter returns a Logger that writes to l, which allows l to be used by packages that log with a Logger
+// (e.g. the agent package). The level (see level.Key) and "msg" values of each log event become the level and
+// message of the slog record, and all other key-value pairs become its attributes. Events without a level are
+// logged at the INFO level.
+func NewSlogAdapter(l *slog.Logger) log.Logger {
+	return slogAdapter{h: l.Handler()}
+}
+
+type slogAdapter struct {
+	h slog.Handler
+}
+
+func (a slogAdapter) Log(keyvals ...interface{}) error {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, log.ErrMissingValue)
+	}
+	lvl, msg := slog.LevelInfo, ""
+	attrs := make([]slog.Attr, 0, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		k, v := keyvals[i], keyvals[i+1]
+		if k == level.Key() {
+			if lv, ok := v.(level.Value); ok {
+				lvl = slogLevel(lv)
+				continue
+			}
+		} else if k == "msg" {
+			msg = fmt.Sprint(v)
+			continue
+		}
+		attrs = append(attrs, slog.Any(fmt.Sprint(k), v))
+	}
+
+	ctx := context.Background()
+	if !a.h.Enabled(ctx, lvl) {
+		return nil
+	}
+	r := slog.NewRecord(time.Now(), lvl, msg, callerPC())
+	r.AddAttrs(attrs...)
+	return a.h.Handle(ctx, r)
+}
+
+// slogLevel returns the slog.Level corresponding to a go-kit level.Value.
+func slogLevel(v level.Value) slog.Level {
+	switch v.String() {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// callerPC returns the program counter of the function that logged an event to a slogAdapter,
+// i.e. the first caller outside of this file and the go-kit log packages.
+func callerPC() uintptr {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/go-kit/log") {
+			return frame.PC
+		}
+		if !more {
+			return 0
+		}
+	}
+}
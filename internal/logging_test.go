@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,56 +57,189 @@ func TestConfigureLogger(t *testing.T) {
 			false,
 		},
 	} {
-		t.Run(tt.name, func(t *testing.T) {
-			startTime := time.Now()
+		for _, backend := range []struct {
+			name      string
+			configure func(bool, int, io.Writer) log.Logger
+		}{
+			{"go-kit", ConfigureLogger},
+			{"slog", func(json bool, lvl int, w io.Writer) log.Logger {
+				return NewSlogAdapter(ConfigureLoggerSlog(json, lvl, w))
+			}},
+		} {
+			t.Run(fmt.Sprintf("%s/%s", backend.name, tt.name), func(t *testing.T) {
+				startTime := time.Now()
+				buf := bytes.NewBuffer([]byte{})
+				logger := backend.configure(true, tt.lvl, buf)
+				level.Debug(logger).Log("msg", "debug test")
+				level.Info(logger).Log("msg", "info test")
+				level.Warn(logger).Log("msg", "warn test")
+				level.Error(logger).Log("msg", "error test")
+				endTime := time.Now()
+
+				lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+				require.Len(t, lines, len(tt.expectedLogData),
+					"Expected %d lines of log data but found %d", len(tt.expectedLogData), len(lines))
+
+				for lineNo, line := range lines {
+					t.Run(fmt.Sprintf("line:%d", lineNo), func(t *testing.T) {
+						expectedData := tt.expectedLogData[lineNo]
+						logData := map[string]string{}
+						require.NoError(t, json.Unmarshal([]byte(line), &logData),
+							"Error parsing log data as JSON on line %d: %q", lineNo, line)
+
+						for key, expected := range expectedData {
+							actual := logData[key]
+							t.Run(key, func(t *testing.T) {
+								assert.Equal(t, expected, actual,
+									"Unexpected value for key %q in logged data on line %d", key, lineNo)
+							})
+						}
+
+						t.Run("ts", func(t *testing.T) {
+							ts, err := time.Parse(layout, logData["ts"])
+							require.NoError(t, err,
+								"error parsing timestamp %s with layout %s on line %d", logData["ts"], layout, lineNo)
+							assert.False(t, ts.Before(startTime),
+								"logged timestamp %s is earlier than expected (should be after %s)", ts, startTime)
+							assert.False(t, ts.After(endTime),
+								"logged timestamp %s is later than expected (should be before %s)", ts, endTime)
+						})
+						t.Run("caller", func(t *testing.T) {
+							// Expect "caller" to be included only when lvl>=2 (DEBUG)
+							if tt.expectCaller {
+								assert.Contains(t, logData, "caller",
+									"missing \"caller\" in logged data")
+							} else {
+								assert.NotContains(t, logData, "caller",
+									"unexpected \"caller\" present in logged data")
+							}
+						})
+					})
+				}
+			})
+		}
+	}
+}
+
+func TestConfigureLoggerWithOptions(t *testing.T) {
+	t.Run("sampled debug", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		logger := ConfigureLoggerWithOptions(true, 2, buf, LoggerOptions{SampleRate: 10})
+		for i := 0; i < 100; i++ {
+			level.Debug(logger).Log("msg", "debug test", "i", i)
+		}
+		for i := 0; i < 5; i++ {
+			level.Info(logger).Log("msg", "info test", "i", i)
+			level.Warn(logger).Log("msg", "warn test", "i", i)
+		}
+
+		counts := map[string]int{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			logData := map[string]interface{}{}
+			require.NoError(t, json.Unmarshal([]byte(line), &logData), "error parsing log data: %q", line)
+			counts[fmt.Sprint(logData["msg"])]++
+		}
+		assert.InDelta(t, 10, counts["debug test"], 1, "unexpected number of sampled debug messages")
+		assert.Equal(t, 5, counts["info test"], "info messages should never be sampled")
+		assert.Equal(t, 5, counts["warn test"], "warn messages should never be sampled")
+	})
+
+	t.Run("no sampling", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		logger := ConfigureLoggerWithOptions(false, 2, buf, LoggerOptions{SampleRate: 1})
+		for i := 0; i < 100; i++ {
+			level.Debug(logger).Log("msg", "debug test")
+		}
+		assert.Equal(t, 100, strings.Count(buf.String(), `msg="debug test"`))
+	})
+}
+
+func TestConfigureLoggerWithFields(t *testing.T) {
+	for _, lvl := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("level %d", lvl), func(t *testing.T) {
 			buf := bytes.NewBuffer([]byte{})
-			logger := ConfigureLogger(true, tt.lvl, buf)
+			logger := ConfigureLoggerWithFields(true, lvl, buf, "service", "mydyndns", "env", "test")
 			level.Debug(logger).Log("msg", "debug test")
 			level.Info(logger).Log("msg", "info test")
 			level.Warn(logger).Log("msg", "warn test")
-			level.Error(logger).Log("msg", "error test")
-			endTime := time.Now()
+			log.With(level.Error(logger), "region", "us-west-2").Log("msg", "error test")
 
 			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
-			require.Len(t, lines, len(tt.expectedLogData),
-				"Expected %d lines of log data but found %d", len(tt.expectedLogData), len(lines))
-
-			for lineNo, line := range lines {
-				t.Run(fmt.Sprintf("line:%d", lineNo), func(t *testing.T) {
-					expectedData := tt.expectedLogData[lineNo]
-					logData := map[string]string{}
-					require.NoError(t, json.Unmarshal([]byte(line), &logData),
-						"Error parsing log data as JSON on line %d: %q", lineNo, line)
-
-					for key, expected := range expectedData {
-						actual := logData[key]
-						t.Run(key, func(t *testing.T) {
-							assert.Equal(t, expected, actual,
-								"Unexpected value for key %q in logged data on line %d", key, lineNo)
-						})
-					}
-
-					t.Run("ts", func(t *testing.T) {
-						ts, err := time.Parse(layout, logData["ts"])
-						require.NoError(t, err,
-							"error parsing timestamp %s with layout %s on line %d", logData["ts"], layout, lineNo)
-						assert.False(t, ts.Before(startTime),
-							"logged timestamp %s is earlier than expected (should be after %s)", ts, startTime)
-						assert.False(t, ts.After(endTime),
-							"logged timestamp %s is later than expected (should be before %s)", ts, endTime)
-					})
-					t.Run("caller", func(t *testing.T) {
-						// Expect "caller" to be included only when lvl>=2 (DEBUG)
-						if tt.expectCaller {
-							assert.Contains(t, logData, "caller",
-								"missing \"caller\" in logged data")
-						} else {
-							assert.NotContains(t, logData, "caller",
-								"unexpected \"caller\" present in logged data")
-						}
-					})
-				})
+			// Each level logs its own messages and those of each higher level (including "Configured logger" at DEBUG)
+			require.Len(t, lines, []int{2, 3, 5}[lvl])
+			for _, line := range lines {
+				logData := map[string]string{}
+				require.NoError(t, json.Unmarshal([]byte(line), &logData), "error parsing log data: %q", line)
+				assert.Equal(t, "mydyndns", logData["service"], "missing custom field in %q", line)
+				assert.Equal(t, "test", logData["env"], "missing custom field in %q", line)
 			}
+			assert.Contains(t, lines[len(lines)-1], `"region":"us-west-2"`)
 		})
 	}
 }
+
+func TestValidateLogFields(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		fields      []interface{}
+		expectedErr string
+	}{
+		{"no fields", nil, ""},
+		{"key-value pairs", []interface{}{"service", "mydyndns", "replicas", 3}, ""},
+		{"odd count", []interface{}{"service", "mydyndns", "env"}, "log fields must be key-value pairs (received 3 values)"},
+		{"non-string key", []interface{}{1, "mydyndns"}, "log field keys must be strings (received int)"},
+		{"empty key", []interface{}{"", "mydyndns"}, "log field keys cannot be empty"},
+		{"reserved key", []interface{}{"level", "critical"}, `log field key "level" is reserved`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLogFields(tt.fields...)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestConfigureLoggerSlog(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		lvl            int
+		expectedLevels []string
+	}{
+		{"debug level", 2, []string{"debug", "debug", "info", "warn", "error"}},
+		{"info level", 1, []string{"info", "warn", "error"}},
+		{"warn level", 0, []string{"warn", "error"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer([]byte{})
+			logger := ConfigureLoggerSlog(false, tt.lvl, buf)
+			logger.Debug("debug test")
+			logger.Info("info test")
+			logger.Warn("warn test")
+			logger.Error("error test", "err", "boom")
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			require.Len(t, lines, len(tt.expectedLevels))
+			for i, line := range lines {
+				assert.True(t, strings.HasPrefix(line, "ts="), "expected line %d to begin with a timestamp: %q", i, line)
+				assert.Contains(t, line, fmt.Sprintf("level=%s ", tt.expectedLevels[i]))
+				assert.NotContains(t, line, "time=")
+				if tt.lvl >= 2 {
+					assert.Regexp(t, `caller=logging(_test)?\.go:\d+ `, line)
+				} else {
+					assert.NotContains(t, line, "caller=")
+				}
+			}
+			assert.Contains(t, lines[len(lines)-1], `msg="error test" err=boom`)
+		})
+	}
+
+	t.Run("adapter without level", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		logger := NewSlogAdapter(slog.New(slog.NewTextHandler(buf, nil)))
+		require.NoError(t, log.With(logger, "component", "test").Log("msg", "no level", "odd"))
+		assert.Contains(t, buf.String(), `level=INFO msg="no level" component=test odd=(MISSING)`)
+	})
+}
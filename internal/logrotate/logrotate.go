@@ -0,0 +1,93 @@
+// Package logrotate provides a log file writer that rotates the file once it reaches a maximum size.
+package logrotate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatedSuffix is appended to the path of a log file when it is rotated.
+const RotatedSuffix = ".1"
+
+// A Writer appends to a log file, and rotates the file before a write would cause it to exceed MaxSize bytes.
+// Rotating the file renames it by appending RotatedSuffix to its path (replacing any previously-rotated file)
+// and opens a fresh file at the original path. Writer is safe for concurrent use.
+type Writer struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open returns a pointer to a new Writer that appends to the file at path (creating it if necessary).
+// When maxSize is not positive, the file is never rotated.
+func Open(path string, maxSize int64) (*Writer, error) {
+	w := &Writer{path: path, maxSize: maxSize}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends p to the log file, first rotating the file if its size would otherwise exceed the maximum.
+// Since p is never split across files, a single write larger than the maximum size is written to a fresh file.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file. Subsequent writes fail with os.ErrClosed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens the file at w.path for appending and records its current size. The caller must hold w.mu
+// (or otherwise have exclusive access to w).
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+// rotate closes the current file, renames it, and opens a fresh file in its place. The caller must hold w.mu.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+	w.file = nil
+	if err := os.Rename(w.path, w.path+RotatedSuffix); err != nil {
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+	return w.open()
+}
@@ -0,0 +1,126 @@
+package logrotate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestOpenCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.log")
+	w, err := Open(path, 100)
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.FileExists(t, path)
+	_, err = w.Write([]byte("first\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", readFile(t, path))
+}
+
+func TestOpenAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.log")
+	require.NoError(t, os.WriteFile(path, []byte("existing\n"), 0o644))
+
+	w, err := Open(path, 100)
+	require.NoError(t, err)
+	defer w.Close()
+	_, err = w.Write([]byte("appended\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "existing\nappended\n", readFile(t, path))
+}
+
+func TestOpenError(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing", "mydyndns.log"), 100)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.log")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o644))
+	require.NoError(t, os.WriteFile(path+RotatedSuffix, []byte("stale"), 0o644))
+
+	w, err := Open(path, 16)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Existing content counts toward the maximum size
+	_, err = w.Write([]byte("abcde\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcde\n", readFile(t, path))
+	assert.Equal(t, "stale", readFile(t, path+RotatedSuffix))
+
+	// Exceeding the maximum size triggers rotation before the write
+	_, err = w.Write([]byte("fghij\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "fghij\n", readFile(t, path))
+	assert.Equal(t, "0123456789abcde\n", readFile(t, path+RotatedSuffix))
+
+	// Writes larger than the maximum size are not split
+	long := strings.Repeat("x", 20) + "\n"
+	_, err = w.Write([]byte(long))
+	require.NoError(t, err)
+	assert.Equal(t, long, readFile(t, path))
+	assert.Equal(t, "fghij\n", readFile(t, path+RotatedSuffix))
+}
+
+func TestWriterWithoutMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.log")
+	w, err := Open(path, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	for i := 0; i < 100; i++ {
+		_, err = w.Write([]byte("abcdefghij"))
+		require.NoError(t, err)
+	}
+	assert.Len(t, readFile(t, path), 1000)
+	assert.NoFileExists(t, path+RotatedSuffix)
+}
+
+func TestWriterClose(t *testing.T) {
+	w, err := Open(filepath.Join(t.TempDir(), "mydyndns.log"), 100)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.NoError(t, w.Close(), "closing twice should not be an error")
+	_, err = w.Write([]byte("after close"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestWriterConcurrency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.log")
+	w, err := Open(path, 64)
+	require.NoError(t, err)
+	defer w.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := w.Write([]byte("0123456789\n"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range []string{path, path + RotatedSuffix} {
+		contents := readFile(t, p)
+		assert.LessOrEqual(t, len(contents), 64)
+		for _, line := range strings.Split(strings.TrimSpace(contents), "\n") {
+			assert.Equal(t, "0123456789", line, "writes should not be interleaved")
+		}
+	}
+}
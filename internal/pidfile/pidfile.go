@@ -0,0 +1,78 @@
+// Package pidfile provides management of files that record the process ID (PID) of a running process.
+//
+// The first line of a PID file contains the PID. Files written by this package additionally record when the
+// process started and its working directory on the second and third lines, respectively.
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Info describes a process recorded in a PID file.
+type Info struct {
+	// PID is the process ID.
+	PID int
+	// Started is when the PID file was written. It is the zero time when not recorded by the PID file.
+	Started time.Time
+	// Dir is the working directory of the process. It is empty when not recorded by the PID file.
+	Dir string
+}
+
+// Write records the PID, start time, and working directory of the current process in the file at path,
+// replacing any existing contents.
+func Write(path string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	contents := fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339Nano), dir)
+	return os.WriteFile(path, []byte(contents), 0o644)
+}
+
+// Read returns the PID recorded in the file at path.
+// An error is returned when the file cannot be read or does not contain a valid (positive integer) PID.
+func Read(path string) (int, error) {
+	info, err := ReadInfo(path)
+	return info.PID, err
+}
+
+// ReadInfo returns the Info recorded in the file at path.
+// An error is returned when the file cannot be read, does not contain a valid (positive integer) PID,
+// or records an invalid start time.
+func ReadInfo(path string) (Info, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || pid <= 0 {
+		return Info{}, fmt.Errorf("PID file %s does not contain a valid PID", path)
+	}
+
+	info := Info{PID: pid}
+	if len(lines) > 1 {
+		if info.Started, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(lines[1])); err != nil {
+			return Info{}, fmt.Errorf("PID file %s does not contain a valid start time", path)
+		}
+	}
+	if len(lines) > 2 {
+		info.Dir = strings.TrimSpace(lines[2])
+	}
+	return info, nil
+}
+
+// Remove deletes the file at path. It is not an error if the file does not exist.
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
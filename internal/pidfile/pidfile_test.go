@@ -0,0 +1,110 @@
+package pidfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mydyndns.pid")
+	require.NoError(t, os.WriteFile(path, []byte("stale contents"), 0o644))
+
+	before := time.Now()
+	require.NoError(t, Write(path))
+	pid, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+
+	info, err := ReadInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), info.PID)
+	assert.WithinRange(t, info.Started, before, time.Now())
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, wd, info.Dir)
+
+	require.NoError(t, Remove(path))
+	assert.NoFileExists(t, path)
+	assert.NoError(t, Remove(path), "removing a nonexistent PID file should not be an error")
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contents    string
+		expectedPID int
+		expectErr   bool
+	}{
+		{"valid", "1234", 1234, false},
+		{"valid with surrounding whitespace", " 1234\n", 1234, false},
+		{"empty", "", 0, true},
+		{"not a number", "abc", 0, true},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mydyndns.pid")
+			require.NoError(t, os.WriteFile(path, []byte(tt.contents), 0o644))
+
+			pid, err := Read(path)
+			assert.Equal(t, tt.expectedPID, pid)
+			if tt.expectErr {
+				assert.EqualError(t, err, fmt.Sprintf("PID file %s does not contain a valid PID", path))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Read(filepath.Join(t.TempDir(), "missing.pid"))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
+
+func TestReadInfo(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contents    string
+		expected    Info
+		expectedErr string
+	}{
+		{"PID only", "1234\n", Info{PID: 1234}, ""},
+		{
+			"PID and start time",
+			"1234\n2022-01-02T15:04:05Z\n",
+			Info{PID: 1234, Started: time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)},
+			"",
+		},
+		{
+			"all fields",
+			"1234\n2022-01-02T15:04:05.5Z\n/var/lib/mydyndns\n",
+			Info{PID: 1234, Started: time.Date(2022, 1, 2, 15, 4, 5, 5e8, time.UTC), Dir: "/var/lib/mydyndns"},
+			"",
+		},
+		{"invalid PID", "abc\n2022-01-02T15:04:05Z\n", Info{}, "does not contain a valid PID"},
+		{"invalid start time", "1234\nyesterday\n", Info{}, "does not contain a valid start time"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mydyndns.pid")
+			require.NoError(t, os.WriteFile(path, []byte(tt.contents), 0o644))
+
+			info, err := ReadInfo(path)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, fmt.Sprintf("PID file %s %s", path, tt.expectedErr))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.True(t, tt.expected.Started.Equal(info.Started), "unexpected start time %s", info.Started)
+			tt.expected.Started, info.Started = time.Time{}, time.Time{}
+			assert.Equal(t, tt.expected, info)
+		})
+	}
+}
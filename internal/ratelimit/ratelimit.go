@@ -0,0 +1,93 @@
+// Package ratelimit provides rate limiting for callers (e.g. API clients) that share a limited resource.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A TokenBucket limits the rate of events (e.g. API requests) to an average of rate events per second, while
+// allowing bursts of up to burst events. The bucket starts full, and each event consumes one of its tokens, which
+// are replenished continuously at the configured rate.
+// All operations are thread-safe, so a TokenBucket can be shared by concurrent callers.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	// last is when tokens was last replenished
+	last time.Time
+	now  func() time.Time
+}
+
+// NewTokenBucket returns a pointer to a new, full TokenBucket that allows rate events per second, with bursts of
+// up to burst events. A burst less than 1 is treated as 1. When rate is not positive, tokens are never replenished,
+// so no more than burst events are ever allowed.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	b := &TokenBucket{rate: rate, burst: float64(max(burst, 1)), now: time.Now}
+	b.tokens, b.last = b.burst, b.now()
+	return b
+}
+
+// Wait blocks until a token is available (and consumes it), or until ctx is done, in which case the Context error
+// is returned and no token is consumed. Concurrent callers are granted tokens in the order in which they call Wait.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay, ok := b.reserve()
+	if delay == 0 {
+		return nil
+	}
+	if !ok {
+		<-ctx.Done()
+		b.cancel()
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve consumes a token, which may be owed by the bucket (i.e. the balance of tokens becomes negative), and
+// returns how long the caller must wait until the token is available. When the token will never be available
+// (because tokens are not replenished), ok is false.
+func (b *TokenBucket) reserve() (delay time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.replenish()
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	if b.rate <= 0 {
+		return -1, false
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// cancel returns a token that was reserved by a caller that stopped waiting for it.
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.replenish()
+	b.tokens = min(b.tokens+1, b.burst)
+}
+
+// replenish adds the tokens accumulated since they were last replenished, up to the burst size.
+// The caller must hold b.mu.
+func (b *TokenBucket) replenish() {
+	now := b.now()
+	if b.rate > 0 {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	}
+	b.last = now
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeWaits returns how long it takes for n calls to b.Wait to return.
+func timeWaits(t *testing.T, b *TokenBucket, n int) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		require.NoError(t, b.Wait(context.Background()))
+	}
+	return time.Since(start)
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	t.Run("calls within burst are immediate", func(t *testing.T) {
+		for _, burst := range []int{1, 5} {
+			t.Run(fmt.Sprint(burst), func(t *testing.T) {
+				b := NewTokenBucket(0.1, burst)
+				assert.Less(t, timeWaits(t, b, burst), 10*time.Millisecond)
+			})
+		}
+	})
+
+	t.Run("burst less than 1 is treated as 1", func(t *testing.T) {
+		b := NewTokenBucket(0.1, 0)
+		assert.Less(t, timeWaits(t, b, 1), 10*time.Millisecond)
+	})
+
+	t.Run("calls exceeding rate are delayed", func(t *testing.T) {
+		b := NewTokenBucket(20, 2)
+		// The burst is immediate, and each of the 4 subsequent tokens takes 50ms to replenish
+		elapsed := timeWaits(t, b, 6)
+		assert.GreaterOrEqual(t, elapsed, 190*time.Millisecond)
+		assert.Less(t, elapsed, 400*time.Millisecond)
+	})
+
+	t.Run("concurrent calls share the rate", func(t *testing.T) {
+		b := NewTokenBucket(50, 1)
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, b.Wait(context.Background()))
+			}()
+		}
+		wg.Wait()
+		// The first token is immediate, and each of the 4 subsequent tokens takes 20ms to replenish
+		assert.GreaterOrEqual(t, time.Since(start), 75*time.Millisecond)
+	})
+
+	t.Run("context cancellation during wait", func(t *testing.T) {
+		b := NewTokenBucket(0.1, 1)
+		require.NoError(t, b.Wait(context.Background()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		assert.ErrorIs(t, b.Wait(ctx), context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("context cancellation without replenishment", func(t *testing.T) {
+		b := NewTokenBucket(0, 1)
+		require.NoError(t, b.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("cancelled calls do not consume tokens", func(t *testing.T) {
+		b := NewTokenBucket(10, 1)
+		start := time.Now()
+		require.NoError(t, b.Wait(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, b.Wait(ctx), context.DeadlineExceeded)
+		// Had the cancelled call consumed a token, this call would wait for a second one (i.e. until 200ms)
+		require.NoError(t, b.Wait(context.Background()))
+		assert.Less(t, time.Since(start), 180*time.Millisecond)
+	})
+
+	t.Run("context already done", func(t *testing.T) {
+		b := NewTokenBucket(0.1, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, b.Wait(ctx), context.Canceled)
+		assert.Less(t, timeWaits(t, b, 1), 10*time.Millisecond, "the token should not have been consumed")
+	})
+}
+
+func TestTokenBucketReplenish(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(2, 3)
+	b.now, b.last = func() time.Time { return now }, now
+
+	for i := 0; i < 3; i++ {
+		delay, ok := b.reserve()
+		require.True(t, ok)
+		assert.Zero(t, delay)
+	}
+	delay, ok := b.reserve()
+	require.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay, "a token should be owed until replenished")
+	b.cancel()
+
+	// Replenishment is capped at the burst size
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		delay, _ := b.reserve()
+		assert.Zero(t, delay)
+	}
+	delay, _ = b.reserve()
+	assert.Equal(t, 500*time.Millisecond, delay)
+}
@@ -0,0 +1,241 @@
+// Package remoteconfig retrieves config files stored in etcd (v3) or Consul key-value stores.
+//
+// A Backend implements the remote configuration backend of Viper (see viper.RemoteConfig), so that config files can
+// be read with viper.AddRemoteProvider and viper.ReadRemoteConfig (and watched with viper.WatchRemoteConfig)
+// without depending on the etcd and Consul client libraries. Both stores are accessed via their HTTP APIs:
+// the etcd v3 gRPC gateway (i.e. POST /v3/kv/range) and the Consul KV API (i.e. GET /v1/kv/<key>).
+package remoteconfig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Supported remote config providers.
+const (
+	ProviderEtcd   = "etcd"
+	ProviderConsul = "consul"
+)
+
+// DefaultPollInterval is how often a Backend checks for changes to a watched config file when no other interval is
+// configured.
+const DefaultPollInterval = 10 * time.Second
+
+const defaultRequestTimeout = 30 * time.Second
+
+// NotFoundError is returned when the requested key does not exist in the key-value store.
+type NotFoundError struct {
+	Provider, Path string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("key %s not found in %s", e.Path, e.Provider)
+}
+
+// Backend retrieves config files from etcd and Consul key-value stores.
+type Backend struct {
+	// HTTPClient sends requests to the key-value store.
+	HTTPClient *http.Client
+	// PollInterval is how often Watch and WatchChannel check for changes to a config file.
+	PollInterval time.Duration
+
+	mu        sync.Mutex
+	revisions map[string]int64
+	lastErr   error
+}
+
+// New returns a Backend with default settings.
+func New() *Backend {
+	return &Backend{
+		HTTPClient:   &http.Client{Timeout: defaultRequestTimeout},
+		PollInterval: DefaultPollInterval,
+		revisions:    make(map[string]int64),
+	}
+}
+
+// Err returns the error that caused the most recent request to the key-value store to fail, or nil if it succeeded.
+// Viper does not report why a remote config could not be read, so callers can use Err to find out.
+func (b *Backend) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastErr
+}
+
+// Get retrieves the config file stored at the path of rp.
+func (b *Backend) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	value, _, err := b.fetch(rp)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(value), nil
+}
+
+// Watch blocks until the config file stored at the path of rp has changed since it was last retrieved,
+// and then returns the changed config file. Errors that occur while checking for changes are returned immediately.
+func (b *Backend) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	seen := b.revision(rp)
+	for {
+		time.Sleep(b.PollInterval)
+		value, revision, err := b.fetch(rp)
+		if err != nil {
+			return nil, err
+		}
+		if revision != seen {
+			return bytes.NewReader(value), nil
+		}
+	}
+}
+
+// WatchChannel sends each change to the config file stored at the path of rp (or an error that occurred while
+// checking for changes) to the returned response channel, until a value is sent to the returned quit channel.
+func (b *Backend) WatchChannel(rp viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
+	responses := make(chan *viper.RemoteResponse)
+	quit := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(b.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			seen := b.revision(rp)
+			value, revision, err := b.fetch(rp)
+			if err == nil && revision == seen {
+				continue
+			}
+			select {
+			case responses <- &viper.RemoteResponse{Value: value, Error: err}:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return responses, quit
+}
+
+// NewRemoteProvider returns a viper.RemoteProvider for the config file stored at path in the key-value store of
+// provider (i.e. ProviderEtcd or ProviderConsul) at endpoint, such as is required by WatchChannel.
+func NewRemoteProvider(provider, endpoint, path string) viper.RemoteProvider {
+	return remoteProvider{provider: provider, endpoint: endpoint, path: path}
+}
+
+type remoteProvider struct{ provider, endpoint, path string }
+
+func (p remoteProvider) Provider() string      { return p.provider }
+func (p remoteProvider) Endpoint() string      { return p.endpoint }
+func (p remoteProvider) Path() string          { return p.path }
+func (p remoteProvider) SecretKeyring() string { return "" }
+
+// revision returns the revision of the config file stored at the path of rp when it was last retrieved.
+func (b *Backend) revision(rp viper.RemoteProvider) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.revisions[revisionKey(rp)]
+}
+
+// fetch retrieves the config file stored at the path of rp, along with its revision in the key-value store.
+func (b *Backend) fetch(rp viper.RemoteProvider) (value []byte, revision int64, err error) {
+	switch rp.Provider() {
+	case ProviderEtcd:
+		value, revision, err = b.fetchEtcd(rp)
+	case ProviderConsul:
+		value, revision, err = b.fetchConsul(rp)
+	default:
+		err = fmt.Errorf("unsupported remote config provider %q (must be one of: %s, %s)",
+			rp.Provider(), ProviderEtcd, ProviderConsul)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	if err == nil {
+		if b.revisions == nil {
+			b.revisions = make(map[string]int64)
+		}
+		b.revisions[revisionKey(rp)] = revision
+	}
+	return
+}
+
+func revisionKey(rp viper.RemoteProvider) string {
+	return strings.Join([]string{rp.Provider(), rp.Endpoint(), rp.Path()}, "\x00")
+}
+
+// fetchEtcd retrieves a key with the range request of the etcd v3 KV API.
+func (b *Backend) fetchEtcd(rp viper.RemoteProvider) ([]byte, int64, error) {
+	reqBody, err := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(rp.Path()))})
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := b.HTTPClient.Post(endpointURL(rp.Endpoint())+"/v3/kv/range", "application/json",
+		bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected response status from etcd: %s", resp.Status)
+	}
+
+	var result struct {
+		KVs []struct {
+			Value       []byte `json:"value"`
+			ModRevision int64  `json:"mod_revision,string"`
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("unable to parse etcd response: %w", err)
+	}
+	if len(result.KVs) == 0 {
+		return nil, 0, NotFoundError{Provider: ProviderEtcd, Path: rp.Path()}
+	}
+	return result.KVs[0].Value, result.KVs[0].ModRevision, nil
+}
+
+// fetchConsul retrieves a key with the Consul KV API.
+func (b *Backend) fetchConsul(rp viper.RemoteProvider) ([]byte, int64, error) {
+	resp, err := b.HTTPClient.Get(endpointURL(rp.Endpoint()) + "/v1/kv/" + strings.TrimPrefix(rp.Path(), "/"))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, 0, NotFoundError{Provider: ProviderConsul, Path: rp.Path()}
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("unexpected response status from consul: %s", resp.Status)
+	}
+
+	var result []struct {
+		Value       []byte `json:"Value"`
+		ModifyIndex int64  `json:"ModifyIndex"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("unable to parse consul response: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, 0, NotFoundError{Provider: ProviderConsul, Path: rp.Path()}
+	}
+	return result[0].Value, result[0].ModifyIndex, nil
+}
+
+// endpointURL returns endpoint as a URL, using the http scheme when endpoint does not include a scheme
+// (e.g. "127.0.0.1:8500", as is conventional for Consul).
+func endpointURL(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.Contains(endpoint, "://") {
+		return "http://" + endpoint
+	}
+	return endpoint
+}
@@ -0,0 +1,214 @@
+package remoteconfig
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProvider struct{ provider, endpoint, path string }
+
+func (p testProvider) Provider() string      { return p.provider }
+func (p testProvider) Endpoint() string      { return p.endpoint }
+func (p testProvider) Path() string          { return p.path }
+func (p testProvider) SecretKeyring() string { return "" }
+
+// kvStore simulates the key-value APIs of etcd v3 and Consul.
+type kvStore struct {
+	mu       sync.Mutex
+	values   map[string]string
+	revision int64
+}
+
+func newKVStore(t *testing.T) (*kvStore, *httptest.Server) {
+	t.Helper()
+	store := &kvStore{values: make(map[string]string)}
+	server := httptest.NewServer(http.HandlerFunc(store.serveHTTP(t)))
+	t.Cleanup(server.Close)
+	return store, server
+}
+
+func (s *kvStore) put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revision++
+	s.values[key] = value
+}
+
+func (s *kvStore) serveHTTP(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/kv/range":
+			var req struct{ Key []byte }
+			if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&req)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			resp := map[string]interface{}{"header": map[string]string{"revision": fmt.Sprint(s.revision)}}
+			if value, ok := s.values[string(req.Key)]; ok {
+				resp["kvs"] = []map[string]string{{
+					"key":          base64.StdEncoding.EncodeToString(req.Key),
+					"value":        base64.StdEncoding.EncodeToString([]byte(value)),
+					"mod_revision": fmt.Sprint(s.revision),
+				}}
+				resp["count"] = "1"
+			}
+			json.NewEncoder(w).Encode(resp)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+			key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+			value, ok := s.values[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string]interface{}{{
+				"Key": key, "Value": base64.StdEncoding.EncodeToString([]byte(value)), "ModifyIndex": s.revision,
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestBackendGet(t *testing.T) {
+	store, server := newKVStore(t)
+	store.put("/config/mydyndns.toml", "interval = \"5m\"\n")
+	store.put("config/mydyndns.yaml", "interval: 5m\n")
+
+	for _, tt := range []struct {
+		name        string
+		provider    testProvider
+		expected    string
+		expectedErr string
+	}{
+		{
+			"etcd",
+			testProvider{ProviderEtcd, server.URL, "/config/mydyndns.toml"},
+			"interval = \"5m\"\n",
+			"",
+		},
+		{
+			"etcd missing key",
+			testProvider{ProviderEtcd, server.URL, "/config/missing.toml"},
+			"",
+			"key /config/missing.toml not found in etcd",
+		},
+		{
+			"consul",
+			testProvider{ProviderConsul, strings.TrimPrefix(server.URL, "http://"), "/config/mydyndns.yaml"},
+			"interval: 5m\n",
+			"",
+		},
+		{
+			"consul missing key",
+			testProvider{ProviderConsul, server.URL, "config/missing.yaml"},
+			"",
+			"key config/missing.yaml not found in consul",
+		},
+		{
+			"unsupported provider",
+			testProvider{"firestore", server.URL, "config"},
+			"",
+			`unsupported remote config provider "firestore" (must be one of: etcd, consul)`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			r, err := b.Get(tt.provider)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				assert.EqualError(t, b.Err(), tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, b.Err())
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestBackendWatch(t *testing.T) {
+	store, server := newKVStore(t)
+	store.put("/config/mydyndns.toml", "interval = \"5m\"\n")
+	rp := testProvider{ProviderEtcd, server.URL, "/config/mydyndns.toml"}
+
+	b := New()
+	b.PollInterval = time.Millisecond * 10
+	_, err := b.Get(rp)
+	require.NoError(t, err)
+
+	changed := make(chan string, 1)
+	go func() {
+		r, err := b.Watch(rp)
+		if assert.NoError(t, err) {
+			data, _ := io.ReadAll(r)
+			changed <- string(data)
+		}
+	}()
+
+	time.Sleep(b.PollInterval * 3)
+	select {
+	case <-changed:
+		t.Fatal("Watch returned before the config changed")
+	default:
+	}
+
+	store.put("/config/mydyndns.toml", "interval = \"10m\"\n")
+	select {
+	case data := <-changed:
+		assert.Equal(t, "interval = \"10m\"\n", data)
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after the config changed")
+	}
+}
+
+func TestBackendWatchChannel(t *testing.T) {
+	store, server := newKVStore(t)
+	store.put("mydyndns.json", `{"interval": "5m"}`)
+	rp := testProvider{ProviderConsul, server.URL, "mydyndns.json"}
+
+	b := New()
+	b.PollInterval = time.Millisecond * 10
+	_, err := b.Get(rp)
+	require.NoError(t, err)
+
+	responses, quit := b.WatchChannel(rp)
+	defer close(quit)
+	store.put("mydyndns.json", `{"interval": "10m"}`)
+
+	select {
+	case resp := <-responses:
+		require.NoError(t, resp.Error)
+		assert.Equal(t, `{"interval": "10m"}`, string(resp.Value))
+	case <-time.After(time.Second):
+		t.Fatal("no response after the config changed")
+	}
+}
+
+func TestBackendWithViper(t *testing.T) {
+	store, server := newKVStore(t)
+	store.put("/config/mydyndns.toml", "interval = \"5m\"\n")
+
+	v := viper.New()
+	viper.RemoteConfig = New()
+	t.Cleanup(func() { viper.RemoteConfig = nil })
+	require.NoError(t, v.AddRemoteProvider(ProviderEtcd, server.URL, "/config/mydyndns.toml"))
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadRemoteConfig())
+	assert.Equal(t, "5m", v.GetString("interval"))
+}
@@ -0,0 +1,75 @@
+package internal
+
+import "sync"
+
+// A RingBuffer is a fixed-capacity circular buffer, which retains only the most recent values pushed to it.
+// Once the RingBuffer is full, each pushed value replaces the oldest value.
+// All operations are atomic and thread-safe, making RingBuffer appropriate for use in concurrent applications.
+type RingBuffer[T any] struct {
+	values []T
+	// next is the index at which the next pushed value is stored
+	next int
+	// full indicates whether the buffer has wrapped around (i.e. all values are in use)
+	full bool
+	mux  sync.Mutex
+}
+
+// NewRingBuffer returns a pointer to a new, empty RingBuffer that retains up to capacity values.
+// A capacity less than 1 is treated as 1.
+func NewRingBuffer[T any](capacity int) *RingBuffer[T] {
+	return &RingBuffer[T]{values: make([]T, max(capacity, 1))}
+}
+
+// Push adds v as the most recent value of the RingBuffer, replacing the oldest value when the RingBuffer is full.
+func (rb *RingBuffer[T]) Push(v T) {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	rb.values[rb.next] = v
+	rb.next = (rb.next + 1) % len(rb.values)
+	if rb.next == 0 {
+		rb.full = true
+	}
+}
+
+// Peek returns the most recent value of the RingBuffer, or the zero value of T when the RingBuffer is empty.
+func (rb *RingBuffer[T]) Peek() T {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	if rb.len() == 0 {
+		var zero T
+		return zero
+	}
+	return rb.values[(rb.next-1+len(rb.values))%len(rb.values)]
+}
+
+// Slice returns a snapshot of the RingBuffer's values as a new slice, ordered from oldest to most recent.
+func (rb *RingBuffer[T]) Slice() []T {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	if !rb.full {
+		return append([]T(nil), rb.values[:rb.next]...)
+	}
+	s := make([]T, 0, len(rb.values))
+	s = append(s, rb.values[rb.next:]...)
+	return append(s, rb.values[:rb.next]...)
+}
+
+// Len returns the number of values currently held by the RingBuffer.
+func (rb *RingBuffer[T]) Len() int {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	return rb.len()
+}
+
+// len returns the number of values currently held by the RingBuffer. The caller must hold rb.mux.
+func (rb *RingBuffer[T]) len() int {
+	if rb.full {
+		return len(rb.values)
+	}
+	return rb.next
+}
+
+// Cap returns the maximum number of values retained by the RingBuffer.
+func (rb *RingBuffer[T]) Cap() int {
+	return len(rb.values)
+}
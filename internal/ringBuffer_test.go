@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRingBuffer(t *testing.T) {
+	for _, tt := range []struct{ capacity, expectedCap int }{{3, 3}, {1, 1}, {0, 1}, {-1, 1}} {
+		t.Run(fmt.Sprint(tt.capacity), func(t *testing.T) {
+			rb := NewRingBuffer[int](tt.capacity)
+			assert.Equal(t, tt.expectedCap, rb.Cap())
+			assert.Equal(t, 0, rb.Len())
+			assert.Empty(t, rb.Slice())
+			assert.Zero(t, rb.Peek(), "empty buffer should peek the zero value")
+		})
+	}
+}
+
+func TestRingBuffer_Push(t *testing.T) {
+	for _, tt := range []struct {
+		capacity      int
+		push          []string
+		expectedSlice []string
+	}{
+		{3, []string{"a"}, []string{"a"}},
+		{3, []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{3, []string{"a", "b", "c", "d"}, []string{"b", "c", "d"}},
+		{3, []string{"a", "b", "c", "d", "e", "f", "g"}, []string{"e", "f", "g"}},
+		{1, []string{"a", "b"}, []string{"b"}},
+	} {
+		t.Run(fmt.Sprint(tt.capacity, tt.push), func(t *testing.T) {
+			rb := NewRingBuffer[string](tt.capacity)
+			for i, v := range tt.push {
+				rb.Push(v)
+				assert.Equal(t, v, rb.Peek(), "most recent value should be peeked")
+				assert.Equal(t, min(i+1, tt.capacity), rb.Len())
+				assert.Equal(t, tt.capacity, rb.Cap())
+			}
+			assert.Equal(t, tt.expectedSlice, rb.Slice(), "values should be ordered from oldest to most recent")
+		})
+	}
+}
+
+func TestRingBuffer_SliceIsolation(t *testing.T) {
+	rb := NewRingBuffer[int](2)
+	rb.Push(1)
+	rb.Push(2)
+	s := rb.Slice()
+	s[0] = 100
+	rb.Push(3)
+	assert.Equal(t, []int{2, 3}, rb.Slice(), "modifying a slice should not affect the buffer")
+	assert.Equal(t, []int{100, 2}, s, "pushing should not affect a previous slice")
+}
+
+func TestRingBuffer_ConcurrentPush(t *testing.T) {
+	const goroutines, pushes = 10, 100
+	rb := NewRingBuffer[int](goroutines * pushes / 2)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < pushes; i++ {
+				rb.Push(g*pushes + i)
+				rb.Peek()
+				rb.Slice()
+			}
+		}()
+	}
+	wg.Wait()
+
+	values := rb.Slice()
+	require.Len(t, values, rb.Cap())
+	assert.Equal(t, rb.Cap(), rb.Len())
+	sort.Ints(values)
+	for i := 1; i < len(values); i++ {
+		assert.NotEqual(t, values[i-1], values[i], "each pushed value should be retained at most once")
+	}
+	// Values pushed by each goroutine are retained in the order in which they were pushed
+	lastByGoroutine := map[int]int{}
+	for _, v := range rb.Slice() {
+		g := v / pushes
+		if last, ok := lastByGoroutine[g]; ok {
+			assert.Greater(t, v, last)
+		}
+		lastByGoroutine[g] = v
+	}
+}
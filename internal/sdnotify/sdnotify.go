@@ -0,0 +1,49 @@
+// Package sdnotify implements the client side of the systemd service notification protocol (see sd_notify(3)),
+// which allows services of Type=notify to report their readiness (and other status changes) to systemd.
+package sdnotify
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	// SocketEnvVar is the name of the environment variable in which systemd provides the notification socket.
+	SocketEnvVar = "NOTIFY_SOCKET"
+	// Ready tells systemd that service startup is complete.
+	Ready = "READY=1"
+	// Stopping tells systemd that the service is beginning its shutdown.
+	Stopping = "STOPPING=1"
+)
+
+// ErrNoSocket is returned by Notify when no notification socket is provided by the environment,
+// e.g. because the process is not managed by systemd as a Type=notify service.
+var ErrNoSocket = errors.New(SocketEnvVar + " environment variable is not set")
+
+// Enabled reports whether a notification socket is provided by the environment.
+func Enabled() bool {
+	return os.Getenv(SocketEnvVar) != ""
+}
+
+// Notify sends state (e.g. Ready) to the notification socket provided by the environment.
+// It returns ErrNoSocket when the environment does not provide a notification socket.
+func Notify(state string) error {
+	socket := os.Getenv(SocketEnvVar)
+	if socket == "" {
+		return ErrNoSocket
+	}
+	// Sockets in the abstract namespace are indicated by a leading "@"
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,63 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen returns a unixgram connection listening on a new socket, whose path is set as the notification socket.
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on windows")
+	}
+	// Socket paths are limited to ~100 characters, which t.TempDir() may exceed
+	dir, err := os.MkdirTemp("", "sdnotify")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "notify.sock")
+
+	conn, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv(SocketEnvVar, socket)
+	return conn
+}
+
+// receive returns the next message received by conn.
+func receive(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listen(t)
+	assert.True(t, Enabled())
+
+	require.NoError(t, Notify(Ready))
+	require.NoError(t, Notify(Stopping))
+	assert.Equal(t, "READY=1", receive(t, conn))
+	assert.Equal(t, "STOPPING=1", receive(t, conn))
+}
+
+func TestNotifyNoSocket(t *testing.T) {
+	t.Setenv(SocketEnvVar, "")
+	assert.False(t, Enabled())
+	assert.ErrorIs(t, Notify(Ready), ErrNoSocket)
+}
+
+func TestNotifyUnreachableSocket(t *testing.T) {
+	t.Setenv(SocketEnvVar, filepath.Join(t.TempDir(), "nonexistent.sock"))
+	assert.Error(t, Notify(Ready))
+}
@@ -2,8 +2,12 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"unsafe"
 )
 
 // A StringCollection is a container for unique strings.
@@ -67,6 +71,28 @@ func (sc *StringCollection) Slice() []string {
 	return s
 }
 
+// Each calls fn for each member of the StringCollection (in no particular order), without copying the members
+// to a new slice. The StringCollection is locked for the duration of the walk, so concurrent modifications
+// wait until Each returns; as a result, fn must not call any methods of the StringCollection.
+func (sc *StringCollection) Each(fn func(string)) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	for mem := range sc.m {
+		fn(mem)
+	}
+}
+
+// EachSorted calls fn for each member of the StringCollection in ascending order.
+// Since fn is called with members from a sorted snapshot of the StringCollection, the StringCollection is not locked
+// while fn is called and may be modified by fn.
+func (sc *StringCollection) EachSorted(fn func(string)) {
+	s := sc.Slice()
+	sort.Strings(s)
+	for _, mem := range s {
+		fn(mem)
+	}
+}
+
 // String returns a string representing the member values of the StringCollection.
 func (sc *StringCollection) String() string {
 	return fmt.Sprint(sc.Slice())
@@ -78,3 +104,120 @@ func (sc *StringCollection) Len() int {
 	defer sc.mux.Unlock()
 	return len(sc.m)
 }
+
+// Intersect returns a new StringCollection containing the members that are present in both the StringCollection
+// and other.
+func (sc *StringCollection) Intersect(other *StringCollection) *StringCollection {
+	defer sc.lockWith(other)()
+	result := NewStringCollection()
+	for mem := range sc.m {
+		if _, exists := other.m[mem]; exists {
+			result.m[mem] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Union returns a new StringCollection containing the members that are present in either the StringCollection
+// or other (or both).
+func (sc *StringCollection) Union(other *StringCollection) *StringCollection {
+	defer sc.lockWith(other)()
+	result := NewStringCollection()
+	for mem := range sc.m {
+		result.m[mem] = struct{}{}
+	}
+	for mem := range other.m {
+		result.m[mem] = struct{}{}
+	}
+	return result
+}
+
+// Difference returns a new StringCollection containing the members of the StringCollection that are not
+// present in other.
+func (sc *StringCollection) Difference(other *StringCollection) *StringCollection {
+	defer sc.lockWith(other)()
+	result := NewStringCollection()
+	for mem := range sc.m {
+		if _, exists := other.m[mem]; !exists {
+			result.m[mem] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Filter returns a new StringCollection containing the members of the StringCollection for which fn returns true.
+// As with Each, the StringCollection is locked while fn is called, so fn must not call any methods of the
+// StringCollection.
+func (sc *StringCollection) Filter(fn func(string) bool) *StringCollection {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	result := NewStringCollection()
+	for mem := range sc.m {
+		if fn(mem) {
+			result.m[mem] = struct{}{}
+		}
+	}
+	return result
+}
+
+// FilterPrefix returns a new StringCollection containing the members of the StringCollection that begin with prefix.
+func (sc *StringCollection) FilterPrefix(prefix string) *StringCollection {
+	return sc.Filter(func(s string) bool { return strings.HasPrefix(s, prefix) })
+}
+
+// FilterSuffix returns a new StringCollection containing the members of the StringCollection that end with suffix.
+func (sc *StringCollection) FilterSuffix(suffix string) *StringCollection {
+	return sc.Filter(func(s string) bool { return strings.HasSuffix(s, suffix) })
+}
+
+// MarshalJSON implements json.Marshaler by encoding the members of the StringCollection as a JSON array
+// (sorted in ascending order, so that the encoding of equal StringCollections is identical).
+func (sc *StringCollection) MarshalJSON() ([]byte, error) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	s := make([]string, 0, len(sc.m))
+	for mem := range sc.m {
+		s = append(s, mem)
+	}
+	sort.Strings(s)
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON implements json.Unmarshaler by replacing the members of the StringCollection with those
+// of the JSON array in b. As is conventional for json.Unmarshaler implementations, a JSON null is a no-op.
+func (sc *StringCollection) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var members []string
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.m = make(map[string]struct{}, len(members))
+	for _, mem := range members {
+		sc.m[mem] = struct{}{}
+	}
+	return nil
+}
+
+// lockWith locks both the StringCollection and other, and returns a function that unlocks them.
+// Locks are always acquired in order of memory address, so that concurrent operations involving the same
+// pair of StringCollections (in either order) cannot deadlock.
+func (sc *StringCollection) lockWith(other *StringCollection) (unlock func()) {
+	if sc == other {
+		sc.mux.Lock()
+		return sc.mux.Unlock
+	}
+	first, second := sc, other
+	if uintptr(unsafe.Pointer(second)) < uintptr(unsafe.Pointer(first)) {
+		first, second = second, first
+	}
+	first.mux.Lock()
+	second.mux.Lock()
+	return func() {
+		second.mux.Unlock()
+		first.mux.Unlock()
+	}
+}
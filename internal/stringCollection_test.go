@@ -1,11 +1,14 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewStringCollection(t *testing.T) {
@@ -99,6 +102,63 @@ func TestStringCollection_Slice(t *testing.T) {
 	}
 }
 
+func TestStringCollection_Each(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		members []string
+	}{
+		{"Empty", []string{}},
+		{"Single", []string{"a"}},
+		{"Multiple", []string{"up", "down", "a", "b"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			NewStringCollection(tt.members...).Each(func(s string) { visited = append(visited, s) })
+			assert.ElementsMatch(t, tt.members, visited)
+		})
+	}
+}
+
+func TestStringCollection_EachSorted(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		members, expected []string
+	}{
+		{"Empty", []string{}, nil},
+		{"Single", []string{"a"}, []string{"a"}},
+		{"Multiple", []string{"up", "down", "b", "a", "b"}, []string{"a", "b", "down", "up"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			NewStringCollection(tt.members...).EachSorted(func(s string) { visited = append(visited, s) })
+			assert.Equal(t, tt.expected, visited)
+		})
+	}
+
+	t.Run("modified by fn", func(t *testing.T) {
+		sc := NewStringCollection("a", "b")
+		sc.EachSorted(func(s string) { sc.Add(s + s) })
+		assert.ElementsMatch(t, []string{"a", "aa", "b", "bb"}, sc.Slice())
+	})
+}
+
+func TestStringCollection_EachConcurrency(t *testing.T) {
+	sc := NewStringCollection("a", "b", "c")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(3)
+		// Concurrent modifications must wait for (rather than deadlock with, or corrupt) an in-progress walk
+		go func() { defer wg.Done(); sc.Each(func(string) {}) }()
+		go func() { defer wg.Done(); sc.EachSorted(func(string) {}) }()
+		go func(i int) { defer wg.Done(); sc.Add(fmt.Sprint(i)) }(i)
+	}
+	wg.Wait()
+
+	count := 0
+	sc.Each(func(string) { count++ })
+	assert.Equal(t, 103, count)
+}
+
 func TestStringCollection_String(t *testing.T) {
 	for ti, tt := range [][]string{{"a"}, {"a", "b"}, {"a", "b", "c"}, {}} {
 		t.Run(fmt.Sprint(ti), func(t *testing.T) {
@@ -131,3 +191,223 @@ func TestStringCollection_Len(t *testing.T) {
 		})
 	}
 }
+
+func TestStringCollection_SetOperations(t *testing.T) {
+	for _, tt := range []struct {
+		name                                           string
+		a, b                                           []string
+		expectIntersect, expectUnion, expectDifference []string
+	}{
+		{
+			"Both empty",
+			[]string{}, []string{},
+			[]string{}, []string{}, []string{},
+		},
+		{
+			"Receiver empty",
+			[]string{}, []string{"a", "b"},
+			[]string{}, []string{"a", "b"}, []string{},
+		},
+		{
+			"Other empty",
+			[]string{"a", "b"}, []string{},
+			[]string{}, []string{"a", "b"}, []string{"a", "b"},
+		},
+		{
+			"Identical",
+			[]string{"a", "b", "c"}, []string{"c", "b", "a"},
+			[]string{"a", "b", "c"}, []string{"a", "b", "c"}, []string{},
+		},
+		{
+			"Partial overlap",
+			[]string{"a", "b", "c"}, []string{"b", "c", "d"},
+			[]string{"b", "c"}, []string{"a", "b", "c", "d"}, []string{"a"},
+		},
+		{
+			"Disjoint",
+			[]string{"a", "b"}, []string{"c", "d"},
+			[]string{}, []string{"a", "b", "c", "d"}, []string{"a", "b"},
+		},
+		{
+			"Subset",
+			[]string{"a"}, []string{"a", "b"},
+			[]string{"a"}, []string{"a", "b"}, []string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := NewStringCollection(tt.a...), NewStringCollection(tt.b...)
+			assert.ElementsMatch(t, tt.expectIntersect, a.Intersect(b).Slice(), "Intersect")
+			assert.ElementsMatch(t, tt.expectUnion, a.Union(b).Slice(), "Union")
+			assert.ElementsMatch(t, tt.expectDifference, a.Difference(b).Slice(), "Difference")
+
+			assert.ElementsMatch(t, tt.a, a.Slice(), "receiver should not be modified")
+			assert.ElementsMatch(t, tt.b, b.Slice(), "other should not be modified")
+		})
+	}
+}
+
+func TestStringCollection_Filter(t *testing.T) {
+	members := []string{"api-key", "api-url", "log-file", "pid-file", "interval"}
+	for _, tt := range []struct {
+		name     string
+		members  []string
+		filter   func(*StringCollection) *StringCollection
+		expected []string
+	}{
+		{
+			"Empty",
+			[]string{},
+			func(sc *StringCollection) *StringCollection { return sc.Filter(func(string) bool { return true }) },
+			[]string{},
+		},
+		{
+			"All pass",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.Filter(func(string) bool { return true }) },
+			members,
+		},
+		{
+			"All fail",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.Filter(func(string) bool { return false }) },
+			[]string{},
+		},
+		{
+			"Predicate",
+			members,
+			func(sc *StringCollection) *StringCollection {
+				return sc.Filter(func(s string) bool { return strings.Contains(s, "i") && len(s) == 7 })
+			},
+			[]string{"api-key", "api-url"},
+		},
+		{
+			"Prefix",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.FilterPrefix("api-") },
+			[]string{"api-key", "api-url"},
+		},
+		{
+			"Prefix without matches",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.FilterPrefix("secret-") },
+			[]string{},
+		},
+		{
+			"Empty prefix",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.FilterPrefix("") },
+			members,
+		},
+		{
+			"Suffix",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.FilterSuffix("-file") },
+			[]string{"log-file", "pid-file"},
+		},
+		{
+			"Suffix without matches",
+			members,
+			func(sc *StringCollection) *StringCollection { return sc.FilterSuffix("-dir") },
+			[]string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := NewStringCollection(tt.members...)
+			result := tt.filter(sc)
+			assert.ElementsMatch(t, tt.expected, result.Slice())
+			assert.ElementsMatch(t, tt.members, sc.Slice(), "receiver should not be modified")
+
+			// The result is independent of the receiver
+			assert.NotSame(t, sc, result)
+			result.Add("z")
+			assert.False(t, sc.Contains("z"))
+		})
+	}
+}
+
+func TestStringCollection_SetOperationsWithSelf(t *testing.T) {
+	sc := NewStringCollection("a", "b")
+	assert.ElementsMatch(t, []string{"a", "b"}, sc.Intersect(sc).Slice())
+	assert.ElementsMatch(t, []string{"a", "b"}, sc.Union(sc).Slice())
+	assert.Empty(t, sc.Difference(sc).Slice())
+}
+
+func TestStringCollection_SetOperationsConcurrency(t *testing.T) {
+	a, b := NewStringCollection("a", "b"), NewStringCollection("b", "c")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(4)
+		// Operations in both directions must not deadlock
+		go func() { defer wg.Done(); a.Intersect(b) }()
+		go func() { defer wg.Done(); b.Union(a) }()
+		go func() { defer wg.Done(); a.Difference(b) }()
+		go func(i int) { defer wg.Done(); b.Add(fmt.Sprint(i)) }(i)
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, []string{"b"}, a.Intersect(b).Slice())
+}
+
+func TestStringCollection_MarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		members  []string
+		expected string
+	}{
+		{"empty", nil, `[]`},
+		{"non-empty", []string{"c", "a", "b"}, `["a","b","c"]`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(NewStringCollection(tt.members...))
+			require.NoError(t, err)
+			assert.True(t, json.Valid(b), "marshaled StringCollection should be valid JSON: %s", b)
+			assert.JSONEq(t, tt.expected, string(b))
+		})
+	}
+
+	t.Run("embedded in a struct", func(t *testing.T) {
+		b, err := json.Marshal(struct {
+			Keys *StringCollection `json:"keys"`
+		}{NewStringCollection("x")})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"keys":["x"]}`, string(b))
+	})
+}
+
+func TestStringCollection_UnmarshalJSON(t *testing.T) {
+	t.Run("replaces members", func(t *testing.T) {
+		sc := NewStringCollection("old")
+		require.NoError(t, json.Unmarshal([]byte(`["a","b","a"]`), sc))
+		assert.ElementsMatch(t, []string{"a", "b"}, sc.Slice())
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		var sc StringCollection
+		require.NoError(t, json.Unmarshal([]byte(`["a"]`), &sc))
+		assert.True(t, sc.Contains("a"))
+	})
+
+	t.Run("null", func(t *testing.T) {
+		sc := NewStringCollection("old")
+		require.NoError(t, json.Unmarshal([]byte(`null`), sc))
+		assert.ElementsMatch(t, []string{"old"}, sc.Slice(), "null should leave members unchanged")
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		sc := NewStringCollection("old")
+		assert.Error(t, json.Unmarshal([]byte(`{"a":true}`), sc))
+		assert.ElementsMatch(t, []string{"old"}, sc.Slice(), "members should be unchanged after an error")
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, members := range [][]string{{}, {"a"}, {"a", "b", "c"}} {
+			original := NewStringCollection(members...)
+			b, err := json.Marshal(original)
+			require.NoError(t, err)
+			require.True(t, json.Valid(b))
+
+			decoded := NewStringCollection()
+			require.NoError(t, json.Unmarshal(b, decoded))
+			assert.ElementsMatch(t, original.Slice(), decoded.Slice())
+		}
+	})
+}
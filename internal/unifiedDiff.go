@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unifiedDiffContext is the number of unchanged lines shown around each change in a unified diff.
+const unifiedDiffContext = 3
+
+type diffOp struct {
+	kind byte // ' ' (unchanged), '-' (deleted), or '+' (inserted)
+	text string
+}
+
+// UnifiedDiff returns a unified diff (as produced by "diff -u") of the lines in from and to, whose names are
+// shown in the diff header. An empty string is returned when from and to are identical.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	// Record the number of lines of from and to that precede each operation
+	fromPos, toPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		fromPos[i+1], toPos[i+1] = fromPos[i], toPos[i]
+		if op.kind != '+' {
+			fromPos[i+1]++
+		}
+		if op.kind != '-' {
+			toPos[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	for i, hunkEnd := 0, 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		// Extend the hunk over subsequent changes whose context would otherwise overlap
+		start, end := max(i-unifiedDiffContext, hunkEnd), i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*unifiedDiffContext {
+				break
+			}
+			end = next
+		}
+		hunkEnd = min(end+unifiedDiffContext, len(ops))
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(fromPos[start], fromPos[hunkEnd]-fromPos[start]),
+			hunkRange(toPos[start], toPos[hunkEnd]-toPos[start]))
+		for _, op := range ops[start:hunkEnd] {
+			fmt.Fprintf(&b, "%c%s\n", op.kind, op.text)
+		}
+		i = hunkEnd
+	}
+	return b.String()
+}
+
+// hunkRange formats the range of count lines following the first preceding lines of a file in a hunk header.
+func hunkRange(preceding, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", preceding)
+	case 1:
+		return fmt.Sprint(preceding + 1)
+	default:
+		return fmt.Sprintf("%d,%d", preceding+1, count)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the operations that transform from into to, based on their longest common subsequence of lines.
+func diffLines(from, to []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(from)+len(to))
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{' ', from[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		ops = append(ops, diffOp{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		ops = append(ops, diffOp{'+', to[j]})
+	}
+	return ops
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	const alphabet = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+
+	for _, tt := range []struct {
+		name     string
+		from, to string
+		expected string
+	}{
+		{"identical", alphabet, alphabet, ""},
+		{"both empty", "", "", ""},
+		{
+			"separate hunks",
+			alphabet,
+			"a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+			`--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+`,
+		},
+		{
+			"merged hunks",
+			alphabet,
+			"a\nB\nc\nd\ne\nf\ng\nH\ni\nj\nk\nl\n",
+			`--- old
++++ new
+@@ -1,11 +1,11 @@
+ a
+-b
++B
+ c
+ d
+ e
+ f
+ g
+-h
++H
+ i
+ j
+ k
+`,
+		},
+		{"created", "", "x\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n"},
+		{"emptied", "x\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-x\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, UnifiedDiff("old", "new", tt.from, tt.to))
+		})
+	}
+}
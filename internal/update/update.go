@@ -0,0 +1,176 @@
+// Package update checks whether a newer release of mydyndns has been published.
+package update
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LatestReleaseURL is the GitHub API endpoint that describes the latest mydyndns release.
+const LatestReleaseURL = "https://api.github.com/repos/TylerHendrickson/mydyndns/releases/latest"
+
+// Checker checks for newer releases by querying a GitHub releases API endpoint.
+type Checker struct {
+	// URL is the API endpoint that describes the latest release. When empty, LatestReleaseURL is used.
+	URL        string
+	HTTPClient *http.Client
+}
+
+// CheckLatestVersion returns the version of the latest mydyndns release (as published, e.g. "v1.2.3"), and whether
+// it is newer than currentVersion. An error is returned when the latest release cannot be retrieved, or when either
+// version is not a semantic version (which is the case for development builds).
+func CheckLatestVersion(ctx context.Context, currentVersion string) (string, bool, error) {
+	return Checker{}.CheckLatestVersion(ctx, currentVersion)
+}
+
+// CheckLatestVersion returns the version of the latest release (as published, e.g. "v1.2.3"), and whether
+// it is newer than currentVersion. An error is returned when the latest release cannot be retrieved, or when either
+// version is not a semantic version (which is the case for development builds).
+func (c Checker) CheckLatestVersion(ctx context.Context, currentVersion string) (string, bool, error) {
+	current, err := ParseVersion(currentVersion)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to compare current version: %w", err)
+	}
+	tag, err := c.latestTag(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	latest, err := ParseVersion(tag)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to compare latest version: %w", err)
+	}
+	return tag, latest.Compare(current) > 0, nil
+}
+
+// latestTag returns the tag name of the latest release.
+func (c Checker) latestTag(ctx context.Context) (string, error) {
+	url := c.URL
+	if url == "" {
+		url = LatestReleaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("releases API responded with unexpected status code %d (%s)",
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("unable to decode releases API response: %w", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("releases API response does not include a tag name")
+	}
+	return release.TagName, nil
+}
+
+// Version is a parsed semantic version (see https://semver.org). Build metadata is discarded, since it does not
+// affect precedence.
+type Version struct {
+	Major, Minor, Patch int
+	// Prerelease holds the dot-separated identifiers of the pre-release version (if any), e.g. ["rc", "1"].
+	Prerelease []string
+}
+
+// ParseVersion parses a semantic version such as "1.2.3", "v1.2.3-rc.1", or "v1.2.3+build.5".
+// A leading "v" is optional.
+func ParseVersion(s string) (Version, error) {
+	invalid := fmt.Errorf("invalid semantic version %q", s)
+	core, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	core, prerelease, hasPrerelease := strings.Cut(core, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return Version{}, invalid
+	}
+	var numbers [3]int
+	for i, p := range parts {
+		n, ok := parseNumericIdentifier(p)
+		if !ok {
+			return Version{}, invalid
+		}
+		numbers[i] = n
+	}
+
+	v := Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}
+	if hasPrerelease {
+		v.Prerelease = strings.Split(prerelease, ".")
+		for _, id := range v.Prerelease {
+			if id == "" || strings.Trim(id, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-") != "" {
+				return Version{}, invalid
+			}
+		}
+	}
+	return v, nil
+}
+
+// parseNumericIdentifier parses s as a non-negative integer without leading zeros.
+func parseNumericIdentifier(s string) (int, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// Compare returns -1, 0, or 1 when v has lower, equal, or higher precedence than other, respectively.
+// As specified by semantic versioning, a pre-release version has lower precedence than the associated normal version.
+func (v Version) Compare(other Version) int {
+	for _, d := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if c := cmp.Compare(d[0], d[1]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(v.Prerelease) == 0 && len(other.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(other.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.Prerelease), len(other.Prerelease))
+}
+
+// comparePrereleaseIdentifiers compares pre-release identifiers a and b. Numeric identifiers are compared
+// numerically and have lower precedence than alphanumeric identifiers, which are compared lexically.
+func comparePrereleaseIdentifiers(a, b string) int {
+	aNum, aIsNum := parseNumericIdentifier(a)
+	bNum, bIsNum := parseNumericIdentifier(b)
+	switch {
+	case aIsNum && bIsNum:
+		return cmp.Compare(aNum, bNum)
+	case aIsNum:
+		return -1
+	case bIsNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
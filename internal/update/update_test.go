@@ -0,0 +1,136 @@
+package update
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		version  string
+		expected Version
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"v0.10.0", Version{Minor: 10}},
+		{"v1.2.3-rc.1", Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc", "1"}}},
+		{"v1.2.3-alpha-2+build.5", Version{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"alpha-2"}}},
+		{"v1.2.3+20220102", Version{Major: 1, Minor: 2, Patch: 3}},
+	} {
+		t.Run(tt.version, func(t *testing.T) {
+			v, err := ParseVersion(tt.version)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+
+	for _, invalid := range []string{"", "dev", "(devel)", "v1.2", "1.2.3.4", "v01.2.3", "v1.2.x", "v1.2.3-", "v1.2.3-rc..1",
+		"v1.2.3-rc_1", "v-1.2.3"} {
+		t.Run(invalid, func(t *testing.T) {
+			_, err := ParseVersion(invalid)
+			assert.EqualError(t, err, `invalid semantic version "`+invalid+`"`)
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Ordered by increasing precedence, per the example in the semantic versioning specification
+	ordered := []string{
+		"v0.9.9",
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.0.1",
+		"v1.2.0",
+		"v1.10.0",
+		"v2.0.0",
+	}
+	for i, lower := range ordered {
+		for _, higher := range ordered[i+1:] {
+			l, err := ParseVersion(lower)
+			require.NoError(t, err)
+			h, err := ParseVersion(higher)
+			require.NoError(t, err)
+			assert.Equal(t, -1, l.Compare(h), "%s should precede %s", lower, higher)
+			assert.Equal(t, 1, h.Compare(l), "%s should follow %s", higher, lower)
+		}
+	}
+
+	a, _ := ParseVersion("v1.2.3+build.1")
+	b, _ := ParseVersion("1.2.3+build.2")
+	assert.Equal(t, 0, a.Compare(b), "build metadata should not affect precedence")
+}
+
+// newReleasesServer returns the URL of a server that responds to requests for the latest release with the given
+// status code and body.
+func newReleasesServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "application/vnd.github+json", r.Header.Get("Accept"))
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCheckerCheckLatestVersion(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		current        string
+		latest         string
+		expectedNewer  bool
+		expectedLatest string
+	}{
+		{"newer patch", "v1.2.3", "v1.2.4", true, "v1.2.4"},
+		{"newer minor", "1.2.3", "v1.10.0", true, "v1.10.0"},
+		{"same version", "v1.2.3", "v1.2.3", false, "v1.2.3"},
+		{"older release", "v1.3.0", "v1.2.9", false, "v1.2.9"},
+		{"release of current pre-release", "v1.3.0-rc.2", "v1.3.0", true, "v1.3.0"},
+		{"pre-release of current release", "v1.3.0", "v1.3.0-rc.2", false, "v1.3.0-rc.2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newReleasesServer(t, http.StatusOK, `{"tag_name":"`+tt.latest+`","name":"Release"}`)
+			latest, newer, err := Checker{URL: url}.CheckLatestVersion(context.Background(), tt.current)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLatest, latest)
+			assert.Equal(t, tt.expectedNewer, newer)
+		})
+	}
+
+	for _, tt := range []struct {
+		name          string
+		current       string
+		status        int
+		body          string
+		expectedError string
+	}{
+		{"development build", "(devel)", http.StatusOK, `{"tag_name":"v1.0.0"}`,
+			`unable to compare current version: invalid semantic version "(devel)"`},
+		{"unexpected status", "v1.0.0", http.StatusForbidden, `{"message":"API rate limit exceeded"}`,
+			"releases API responded with unexpected status code 403 (Forbidden)"},
+		{"invalid response", "v1.0.0", http.StatusOK, `not json`,
+			"unable to decode releases API response: invalid character 'o' in literal null (expecting 'u')"},
+		{"missing tag name", "v1.0.0", http.StatusOK, `{}`, "releases API response does not include a tag name"},
+		{"invalid tag name", "v1.0.0", http.StatusOK, `{"tag_name":"nightly"}`,
+			`unable to compare latest version: invalid semantic version "nightly"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			url := newReleasesServer(t, tt.status, tt.body)
+			latest, newer, err := Checker{URL: url}.CheckLatestVersion(context.Background(), tt.current)
+			assert.EqualError(t, err, tt.expectedError)
+			assert.Empty(t, latest)
+			assert.False(t, newer)
+		})
+	}
+}
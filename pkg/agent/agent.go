@@ -6,6 +6,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -13,31 +14,453 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
 )
 
 // The Client interface is satisfied by the client struct type from the MyDynDNS SDK.
 type Client interface {
 	UpdateAliasWithContext(ctx context.Context) (net.IP, error)
 	MyIPWithContext(ctx context.Context) (net.IP, error)
+	GetCurrentAliasWithContext(ctx context.Context) (net.IP, error)
 }
 
-// Run executes the agent until the provided context.Context is cancelled.
-// When the agent fails to start, Run returns an error.
-func Run(ctx context.Context, logger log.Logger, client Client, pollInterval time.Duration) error {
-	// Ensure the logger is safe for concurrent use
-	logger = log.NewSyncLogger(logger)
+// An IPSource retrieves the apparent IP address of the host on which the agent runs.
+type IPSource interface {
+	GetIP(ctx context.Context) (net.IP, error)
+}
+
+// SDKIPSource is an IPSource that retrieves the apparent IP address reported by the MyDynDNS API, by way of
+// Client.MyIPWithContext. It is the IPSource used by the agent unless RunOptions.IPSource is set.
+type SDKIPSource struct {
+	Client Client
+}
+
+// GetIP returns the apparent IP address reported by s.Client.
+func (s SDKIPSource) GetIP(ctx context.Context) (net.IP, error) {
+	return s.Client.MyIPWithContext(ctx)
+}
+
+// An IPSubscriber pushes the apparent IP address of the host on which the agent runs whenever it changes, which
+// allows the agent to react to changes without polling. The *Client type of the MyDynDNS SDK is an IPSubscriber
+// (when configured with sdk.WithSSEEnabled).
+type IPSubscriber interface {
+	// SubscribeToIPChangesWithContext sends each new apparent IP address to ch until ctx is done (at which point it
+	// returns nil), or until the subscription fails.
+	SubscribeToIPChangesWithContext(ctx context.Context, ch chan<- net.IP) error
+}
+
+// ErrMaxConsecutiveErrors is matched (see errors.Is) by the error returned by RunWithOptions when the agent stops
+// because RunOptions.MaxConsecutiveErrors was reached.
+var ErrMaxConsecutiveErrors = errors.New("too many consecutive errors")
+
+// A MetricsHandler receives observations about the outcome of agent operations.
+// Implementations must be safe for concurrent use.
+type MetricsHandler interface {
+	// ObservePoll is called after each attempt to retrieve the apparent IP address, which took d to complete.
+	ObservePoll(d time.Duration, ip net.IP, err error)
+	// ObserveUpdate is called after each attempt to update DNS records.
+	ObserveUpdate(ip net.IP, err error)
+}
+
+// nopMetricsHandler is a MetricsHandler that discards all observations.
+type nopMetricsHandler struct{}
+
+func (nopMetricsHandler) ObservePoll(time.Duration, net.IP, error) {}
+func (nopMetricsHandler) ObserveUpdate(net.IP, error)              {}
+
+// A ChangeNotifier is notified whenever the agent updates DNS records in response to an IP address change.
+type ChangeNotifier interface {
+	// Notify is called after DNS records were updated from the previous to the current IP address at ts.
+	Notify(ctx context.Context, previous, current net.IP, ts time.Time) error
+}
+
+// A ChangeHandler handles IP address changes for which the agent updated DNS records.
+// Unlike ChangeNotifiers, which are notified in order, all ChangeHandlers are called concurrently.
+type ChangeHandler interface {
+	// OnChange is called after DNS records were updated from the from IP address to the to IP address at ts.
+	OnChange(ctx context.Context, from, to net.IP, ts time.Time) error
+}
+
+// The ChangeHandlerFunc type is an adapter to allow the use of ordinary functions as ChangeHandlers.
+type ChangeHandlerFunc func(ctx context.Context, from, to net.IP, ts time.Time) error
+
+// OnChange calls f(ctx, from, to, ts).
+func (f ChangeHandlerFunc) OnChange(ctx context.Context, from, to net.IP, ts time.Time) error {
+	return f(ctx, from, to, ts)
+}
+
+const (
+	// DefaultPollInterval is the interval at which the agent polls for its apparent IP address when no other
+	// interval is configured.
+	DefaultPollInterval = time.Hour
+	// DefaultDrainTimeout is how long in-flight DNS updates are allowed to finish after the agent is asked to stop,
+	// when no other timeout is configured.
+	DefaultDrainTimeout = 5 * time.Second
+	// DefaultPollErrorMaxBackoff is the maximum delay between polls after consecutive poll errors (when
+	// RunOptions.BackoffOnPollError is set) when no other maximum is configured.
+	DefaultPollErrorMaxBackoff = 6 * time.Hour
+)
 
-	// Perform an initial blind update and provide the detected IP as the starting point to monitor against
+// RunOptions configures an agent executed by RunWithOptions.
+// The zero value of each field selects a sensible default, so callers need only set the fields they care about.
+type RunOptions struct {
+	// PollInterval is how often the apparent IP address is retrieved. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// RetryPolicy configures how failed DNS alias updates are retried. The zero value disables retries.
+	RetryPolicy RetryPolicy
+	// Metrics receives observations about the outcome of agent operations. Observations are discarded when nil.
+	Metrics MetricsHandler
+	// Notifiers are notified (in order) whenever DNS records are updated in response to an IP address change.
+	// Failed notifications are logged but otherwise ignored.
+	Notifiers []ChangeNotifier
+	// ChangeHandlers are called concurrently (after Notifiers) whenever DNS records are updated in response to an IP
+	// address change, and the agent waits for all of them to return. Errors (and panics) are logged but otherwise
+	// ignored.
+	ChangeHandlers []ChangeHandler
+	// Once causes the agent to exit after its initial DNS update, rather than entering the long-running
+	// poll-and-update cycle.
+	Once bool
+	// ChangeThreshold is the number of times in a row that the same new IP address must be retrieved before
+	// DNS records are updated. Defaults to 1 (i.e. DNS records are updated as soon as a change is detected).
+	ChangeThreshold int
+	// PollIntervalUpdates delivers replacement poll intervals to the running agent. Non-positive values are ignored.
+	PollIntervalUpdates <-chan time.Duration
+	// StateTracker records the State of the running agent. A StateTracker is created automatically when
+	// StateHandlers are configured without one.
+	StateTracker *StateTracker
+	// StateHandlers are called with a snapshot of the agent State whenever it changes.
+	// See WithStateHandler for restrictions on their behavior.
+	StateHandlers []func(State)
+	// DrainTimeout is how long an in-flight DNS update cycle (including retries and change notifications) is
+	// allowed to finish after the Context provided to RunWithOptions is done. Defaults to DefaultDrainTimeout.
+	DrainTimeout time.Duration
+	// HistorySize is the number of recently polled IP addresses recorded as the State.RecentIPs of the
+	// StateTracker (if any). A value of 0 disables the history.
+	HistorySize int
+	// UpdateCooldown is the minimum amount of time between successful DNS updates (including the initial update).
+	// IP address changes detected before the cooldown has elapsed are not acted upon until a poll after it has.
+	// A value of 0 disables the cooldown.
+	UpdateCooldown time.Duration
+	// ExtraClients are additional targets (e.g. for other domains) whose DNS records are updated concurrently
+	// whenever the DNS records of the primary Client are updated. Failed updates of extra targets are retried
+	// according to RetryPolicy and logged, but do not otherwise affect the agent.
+	ExtraClients []Client
+	// BackoffOnPollError causes the delay between polls to double after each consecutive failed poll
+	// (i.e. 1x, 2x, 4x, ... the poll interval), up to PollErrorMaxBackoff. The regular poll interval is
+	// resumed after the next successful poll.
+	BackoffOnPollError bool
+	// PollErrorMaxBackoff caps the delay between polls when BackoffOnPollError is set.
+	// Defaults to DefaultPollErrorMaxBackoff. Delays are never shorter than the poll interval.
+	PollErrorMaxBackoff time.Duration
+	// MaxConsecutiveErrors causes the agent to stop (with an error matching ErrMaxConsecutiveErrors) once this many
+	// polls or DNS update cycles in a row have failed. Polls and DNS updates are counted separately, and each count
+	// is reset whenever an operation of the same kind succeeds. A value of 0 disables the limit.
+	MaxConsecutiveErrors int
+	// StartupDelay is how long the agent waits before its initial DNS update, e.g. to allow network interfaces to be
+	// brought up. When the Context provided to RunWithOptions is done during the delay, the agent stops without
+	// error. A value of 0 disables the delay.
+	StartupDelay time.Duration
+	// CircuitBreaker configures a CircuitBreaker, which skips DNS updates (after the initial update) while the
+	// mydyndns service is known to be down. The zero value disables the circuit breaker.
+	CircuitBreaker CircuitBreakerOptions
+	// AgentVersion is the version of the program running the agent, which is logged with the initial IP address.
+	AgentVersion string
+	// IPSource retrieves the apparent IP address at each poll. Defaults to an SDKIPSource for the Client.
+	// DNS records are always updated by the Client, regardless of the IPSource.
+	IPSource IPSource
+	// IPSubscriber replaces polling: the apparent IP address is instead received from the IPSubscriber whenever it
+	// changes, and PollInterval (along with the other poll settings) only applies when the subscription fails, in
+	// which case the agent falls back to polling the IPSource.
+	IPSubscriber IPSubscriber
+}
+
+// Validate reports whether the RunOptions are usable by RunWithOptions.
+// Unset (zero-value) fields are always valid.
+func (o RunOptions) Validate() error {
+	switch p := o.RetryPolicy; {
+	case o.PollInterval < 0:
+		return fmt.Errorf("poll interval cannot be negative (received %s)", o.PollInterval)
+	case o.ChangeThreshold < 0:
+		return fmt.Errorf("change threshold cannot be negative (received %d)", o.ChangeThreshold)
+	case o.DrainTimeout < 0:
+		return fmt.Errorf("drain timeout cannot be negative (received %s)", o.DrainTimeout)
+	case o.HistorySize < 0:
+		return fmt.Errorf("history size cannot be negative (received %d)", o.HistorySize)
+	case o.UpdateCooldown < 0:
+		return fmt.Errorf("update cooldown cannot be negative (received %s)", o.UpdateCooldown)
+	case o.PollErrorMaxBackoff < 0:
+		return fmt.Errorf("poll error max backoff cannot be negative (received %s)", o.PollErrorMaxBackoff)
+	case o.MaxConsecutiveErrors < 0:
+		return fmt.Errorf("max consecutive errors cannot be negative (received %d)", o.MaxConsecutiveErrors)
+	case o.StartupDelay < 0:
+		return fmt.Errorf("startup delay cannot be negative (received %s)", o.StartupDelay)
+	case o.CircuitBreaker.FailureThreshold < 0:
+		return fmt.Errorf("circuit breaker failure threshold cannot be negative (received %d)",
+			o.CircuitBreaker.FailureThreshold)
+	case o.CircuitBreaker.RecoveryTimeout < 0:
+		return fmt.Errorf("circuit breaker recovery timeout cannot be negative (received %s)",
+			o.CircuitBreaker.RecoveryTimeout)
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("retry max attempts cannot be negative (received %d)", p.MaxAttempts)
+	case p.BaseDelay < 0:
+		return fmt.Errorf("retry base delay cannot be negative (received %s)", p.BaseDelay)
+	case p.MaxDelay < 0:
+		return fmt.Errorf("retry max delay cannot be negative (received %s)", p.MaxDelay)
+	case p.Multiplier < 0:
+		return fmt.Errorf("retry multiplier cannot be negative (received %g)", p.Multiplier)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("retry jitter must be between 0 and 1 (received %g)", p.Jitter)
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the RunOptions in which unset fields are replaced by their default values.
+func (o RunOptions) withDefaults() RunOptions {
+	if o.PollInterval == 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.Metrics == nil {
+		o.Metrics = nopMetricsHandler{}
+	}
+	if o.ChangeThreshold < 1 {
+		o.ChangeThreshold = 1
+	}
+	if o.DrainTimeout == 0 {
+		o.DrainTimeout = DefaultDrainTimeout
+	}
+	if o.PollErrorMaxBackoff == 0 {
+		o.PollErrorMaxBackoff = DefaultPollErrorMaxBackoff
+	}
+	if o.CircuitBreaker.FailureThreshold > 0 && o.CircuitBreaker.RecoveryTimeout == 0 {
+		o.CircuitBreaker.RecoveryTimeout = DefaultCircuitRecoveryTimeout
+	}
+	return o
+}
+
+// A RunOption configures optional agent behavior by modifying RunOptions.
+type RunOption func(*RunOptions)
+
+// WithMetricsHandler configures the agent to report the outcome of its operations to h.
+func WithMetricsHandler(h MetricsHandler) RunOption {
+	return func(o *RunOptions) {
+		o.Metrics = h
+	}
+}
+
+// WithChangeNotifiers configures the agent to notify each of the given ChangeNotifiers (in order) whenever DNS
+// records are updated in response to an IP address change. Failed notifications are logged but otherwise ignored.
+func WithChangeNotifiers(notifiers ...ChangeNotifier) RunOption {
+	return func(o *RunOptions) {
+		o.Notifiers = append(o.Notifiers, notifiers...)
+	}
+}
+
+// WithChangeHandlers configures the agent to call each of the given ChangeHandlers (concurrently) whenever DNS
+// records are updated in response to an IP address change. Errors (and panics) are logged but otherwise ignored.
+func WithChangeHandlers(handlers ...ChangeHandler) RunOption {
+	return func(o *RunOptions) {
+		o.ChangeHandlers = append(o.ChangeHandlers, handlers...)
+	}
+}
+
+// WithOnce configures the agent to exit after its initial DNS update, rather than entering the long-running
+// poll-and-update cycle. This is useful when the agent is executed periodically by an external scheduler (e.g. cron).
+func WithOnce() RunOption {
+	return func(o *RunOptions) {
+		o.Once = true
+	}
+}
+
+// WithChangeThreshold configures the agent to update DNS records only after the same new IP address has been
+// retrieved n times in a row, which avoids unnecessary DNS updates when the apparent IP address is unstable
+// (e.g. on mobile connections). Values of n less than 1 are treated as 1, which is the default.
+func WithChangeThreshold(n int) RunOption {
+	return func(o *RunOptions) {
+		o.ChangeThreshold = max(n, 1)
+	}
+}
+
+// WithPollIntervalUpdates configures the agent to adjust its poll interval whenever a new value is received from
+// updates, which allows callers to reconfigure a running agent (e.g. when a config reload is requested).
+// Non-positive values are ignored.
+func WithPollIntervalUpdates(updates <-chan time.Duration) RunOption {
+	return func(o *RunOptions) {
+		o.PollIntervalUpdates = updates
+	}
+}
+
+// WithStateTracker configures the agent to record its State to t, which allows callers to query the State of the
+// running agent with t.StateSnapshot. Any handlers configured WithStateHandler are called with snapshots of the
+// State recorded to t.
+func WithStateTracker(t *StateTracker) RunOption {
+	return func(o *RunOptions) {
+		o.StateTracker = t
+	}
+}
+
+// WithStateHandler configures the agent to call h with a snapshot of its State whenever the State changes.
+// Calls to h are serialized, so h must not block; nor may it query the StateTracker from which it is called.
+func WithStateHandler(h func(State)) RunOption {
+	return func(o *RunOptions) {
+		o.StateHandlers = append(o.StateHandlers, h)
+	}
+}
+
+// WithIPSource configures the agent to poll s (rather than the Client) for its apparent IP address, e.g. to detect
+// the IP address with a third-party service. DNS records are still updated by the Client.
+func WithIPSource(s IPSource) RunOption {
+	return func(o *RunOptions) {
+		o.IPSource = s
+	}
+}
+
+// WithIPSubscriber configures the agent to receive its apparent IP address from s whenever it changes, rather than
+// polling for it. When the subscription fails, the agent falls back to polling.
+func WithIPSubscriber(s IPSubscriber) RunOption {
+	return func(o *RunOptions) {
+		o.IPSubscriber = s
+	}
+}
+
+// Run executes the agent with the given poll interval, RetryPolicy, and RunOption values.
+//
+// Deprecated: Use RunWithOptions, which accepts all agent settings as a single RunOptions value.
+// Run will be removed in the next major version.
+func Run(ctx context.Context, logger log.Logger, client Client, pollInterval time.Duration, retryPolicy RetryPolicy,
+	opts ...RunOption) error {
+	options := RunOptions{PollInterval: pollInterval, RetryPolicy: retryPolicy}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return RunWithOptions(ctx, logger, client, options)
+}
+
+// RunWithOptions executes the agent until the provided context.Context is cancelled (or, when configured with
+// RunOptions.Once, until the initial DNS update completes). Once the Context is done, no further polls or DNS
+// updates are started, but an in-flight DNS update is given up to RunOptions.DrainTimeout to finish.
+// When the RunOptions are invalid, the agent fails to start, or the agent stops because RunOptions.MaxConsecutiveErrors
+// was reached, RunWithOptions returns an error.
+func RunWithOptions(ctx context.Context, logger log.Logger, client Client, options RunOptions) error {
+	return run(ctx, logger, client, nil, options)
+}
+
+// RunFrom is like RunWithOptions, but rather than performing its own initial DNS update, the agent monitors for
+// changes from startIP, which is typically the IP address returned by WaitForInitialIP. The initial DNS update is
+// reported to RunOptions.Metrics as a successful update to startIP, and RunOptions.StartupDelay is ignored.
+func RunFrom(ctx context.Context, logger log.Logger, client Client, startIP net.IP, options RunOptions) error {
+	if startIP == nil {
+		return fmt.Errorf("invalid agent options: start IP address is required")
+	}
+	return run(ctx, logger, client, startIP, options)
+}
+
+// WaitForInitialIP performs an initial blind DNS update, which points DNS records to the apparent IP address of
+// client, and returns that IP address. Callers that need the IP address before the agent starts (e.g. to start
+// dependent services) can call WaitForInitialIP themselves, and then start the agent with RunFrom.
+func WaitForInitialIP(ctx context.Context, logger log.Logger, client Client) (net.IP, error) {
+	return waitForInitialIP(ctx, ctx, logger, client, nopMetricsHandler{}, "")
+}
+
+// waitForInitialIP implements WaitForInitialIP. The DNS update is performed with updateCtx, which may outlive ctx
+// (see drainContext), and its outcome is reported to metrics. The version of the program running the agent is logged
+// with the initial IP address, unless it is empty.
+func waitForInitialIP(ctx, updateCtx context.Context, logger log.Logger, client Client, metrics MetricsHandler,
+	version string) (net.IP, error) {
 	level.Info(logger).Log("msg", "Initializing agent...")
-	startIP, err := client.UpdateAliasWithContext(ctx)
+	startIP, err := client.UpdateAliasWithContext(updateCtx)
+	metrics.ObserveUpdate(startIP, err)
 	if err != nil {
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			level.Warn(logger).Log("msg", "Shutdown requested before start", "reason", ctxErr)
 		}
 		level.Error(logger).Log("msg", "Error getting initial IP address", "error", err)
-		return fmt.Errorf("failed to start agent: %w", err)
+		return nil, err
+	}
+	level.Info(logger).Log(withVersion(version, "msg", "Initialized with IP address after DNS update",
+		"ip", startIP.String(), "ip_version", sdk.IPFamilyOf(startIP).String())...)
+	return startIP, nil
+}
+
+// withVersion returns keyvals with the version of the program running the agent appended, unless it is empty.
+func withVersion(version string, keyvals ...interface{}) []interface{} {
+	if version != "" {
+		keyvals = append(keyvals, "version", version)
+	}
+	return keyvals
+}
+
+// run implements RunWithOptions and RunFrom. When startIP is nil, the agent performs its own initial DNS update.
+func run(ctx context.Context, logger log.Logger, client Client, startIP net.IP, options RunOptions) error {
+	if err := options.Validate(); err != nil {
+		return fmt.Errorf("invalid agent options: %w", err)
+	}
+	options = options.withDefaults()
+	if options.StateTracker != nil || len(options.StateHandlers) > 0 {
+		tracker := options.StateTracker
+		if tracker == nil {
+			tracker = &StateTracker{}
+		}
+		options.Metrics = multiMetricsHandler{options.Metrics,
+			newStateRecorder(tracker, options.HistorySize, options.StateHandlers)}
+	}
+	if options.MaxConsecutiveErrors > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		options.Metrics = multiMetricsHandler{options.Metrics,
+			&consecutiveErrorLimit{limit: options.MaxConsecutiveErrors, cancel: cancel}}
+	}
+
+	// Ensure the logger is safe for concurrent use
+	logger = log.NewSyncLogger(logger)
+	if len(options.ChangeHandlers) > 0 {
+		// Copy the Notifiers, which may share a backing array with the caller's slice
+		options.Notifiers = append(options.Notifiers[:len(options.Notifiers):len(options.Notifiers)],
+			changeHandlerGroup{handlers: options.ChangeHandlers, logger: logger})
+	}
+
+	if options.StartupDelay > 0 && startIP == nil {
+		level.Info(logger).Log("msg", "Waiting before initializing agent", "startup_delay", options.StartupDelay)
+		timer := time.NewTimer(options.StartupDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			level.Warn(logger).Log("msg", "Shutdown requested during startup delay", "reason", ctx.Err())
+			level.Warn(logger).Log("msg", "Agent stopped")
+			return nil
+		case <-timer.C:
+		}
+	}
+
+	// DNS updates outlive ctx (for up to the drain timeout), so that they are not abandoned partway through
+	drainCtx, stopDrain := drainContext(ctx, logger, options.DrainTimeout)
+	defer stopDrain()
+
+	if startIP == nil {
+		// Perform an initial blind update and provide the detected IP as the starting point to monitor against
+		var err error
+		if startIP, err = waitForInitialIP(ctx, drainCtx, logger, client, options.Metrics,
+			options.AgentVersion); err != nil {
+			return fmt.Errorf("failed to start agent: %w", err)
+		}
+	} else {
+		options.Metrics.ObserveUpdate(startIP, nil)
+		level.Info(logger).Log(withVersion(options.AgentVersion, "msg", "Starting agent from IP address",
+			"ip", startIP.String(), "ip_version", sdk.IPFamilyOf(startIP).String())...)
+	}
+	updateExtraAliases(drainCtx, logger, options.ExtraClients, options.RetryPolicy)
+
+	if options.Once {
+		level.Debug(logger).Log("msg", "Exiting after initial DNS update")
+		level.Warn(logger).Log("msg", "Agent stopped")
+		return nil
+	}
+
+	var breaker *CircuitBreaker
+	if options.CircuitBreaker.FailureThreshold > 0 {
+		breaker = NewCircuitBreaker(options.CircuitBreaker)
 	}
-	level.Info(logger).Log("msg", "Initialized with IP address after DNS update", "ip", startIP.String())
 
 	wg := sync.WaitGroup{}
 	ips := make(chan net.IP, 1)
@@ -46,26 +469,51 @@ func Run(ctx context.Context, logger log.Logger, client Client, pollInterval tim
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		pollIP(ctx, log.With(logger, "agent_operation", "refresh"), client, pollInterval, ips)
+		refreshLogger := log.With(logger, "agent_operation", "refresh")
+		if options.IPSubscriber != nil {
+			err := subscribeIP(ctx, refreshLogger, options.IPSubscriber, options.Metrics, ips)
+			if err == nil {
+				return
+			}
+			level.Error(refreshLogger).Log("msg", "IP change subscription failed; falling back to polling",
+				"error", err)
+		}
+		backoff := pollBackoff{enabled: options.BackoffOnPollError, maxDelay: options.PollErrorMaxBackoff}
+		source := options.IPSource
+		if source == nil {
+			source = SDKIPSource{Client: client}
+		}
+		pollIP(ctx, refreshLogger, source, options.Metrics,
+			options.PollInterval, options.PollIntervalUpdates, backoff, ips)
 	}()
 
 	// Enter the long-running agent update loop
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		updateDNS(ctx, log.With(logger, "agent_operation", "update"), client, startIP, ips)
+		updateDNS(ctx, drainCtx, log.With(logger, "agent_operation", "update"), client, options.Metrics,
+			options.ExtraClients, options.Notifiers, options.RetryPolicy, options.ChangeThreshold,
+			options.UpdateCooldown, breaker, startIP, ips)
 	}()
 
 	// Wait for agent goroutines to finish
 	wg.Wait()
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMaxConsecutiveErrors) {
+		level.Error(logger).Log("msg", "Stopping agent after too many consecutive errors", "error", cause)
+		level.Warn(logger).Log("msg", "Agent stopped")
+		return cause
+	}
 	level.Warn(logger).Log("msg", "Agent stopped")
 	return nil
 }
 
-// pollIP retrieves the apparent Client-reported IP address at regular intervals and sends the retrieved values
-// to the given channel.
+// pollIP retrieves the apparent IP address reported by the given IPSource at regular intervals and sends the
+// retrieved values to the given channel. The outcome of each poll operation is reported to the given MetricsHandler.
+// Whenever a new interval is received from intervalUpdates, the poll schedule is reset to use that interval.
+// When the given pollBackoff is enabled, polls are delayed exponentially after consecutive failures.
 // Poll operations continue indefinitely until the provided Context is done.
-func pollIP(ctx context.Context, logger log.Logger, client Client, interval time.Duration, polledIPs chan<- net.IP) {
+func pollIP(ctx context.Context, logger log.Logger, source IPSource, metrics MetricsHandler, interval time.Duration,
+	intervalUpdates <-chan time.Duration, backoff pollBackoff, polledIPs chan<- net.IP) {
 	level.Debug(logger).Log("msg", "Starting periodic refresh", "interval", interval)
 	ticker := time.NewTicker(interval)
 	for {
@@ -73,12 +521,46 @@ func pollIP(ctx context.Context, logger log.Logger, client Client, interval time
 		case tick := <-ticker.C:
 			tickLogger := log.With(logger, "trigger_ts", tick.Format(time.RFC3339Nano))
 			level.Debug(tickLogger).Log("msg", "Fetching my IP address...")
-			myIP, err := client.MyIPWithContext(ctx)
+			pollStart := time.Now()
+			myIP, err := source.GetIP(ctx)
+			metrics.ObservePoll(time.Since(pollStart), myIP, err)
 			if err != nil {
 				level.Error(tickLogger).Log("msg", "Error fetching my IP address", "error", err)
+				backoff.failures++
+				if backoff.enabled {
+					delay := backoff.delay(interval)
+					ticker.Reset(delay)
+					level.Debug(tickLogger).Log("msg", "Delaying next poll after consecutive errors",
+						"failures", fmt.Sprint(backoff.failures), "delay", delay.String())
+				}
 			} else {
-				level.Info(tickLogger).Log("msg", "Fetched my IP address", "ip", myIP.String())
-				polledIPs <- myIP
+				if backoff.failures > 0 {
+					backoff.failures = 0
+					if backoff.enabled {
+						ticker.Reset(interval)
+						level.Debug(tickLogger).Log("msg", "Resuming regular poll interval", "interval", interval)
+					}
+				}
+				level.Info(tickLogger).Log("msg", "Fetched my IP address",
+					"ip", myIP.String(), "ip_version", sdk.IPFamilyOf(myIP).String())
+				// The receiver stops receiving once ctx is done
+				select {
+				case polledIPs <- myIP:
+				case <-ctx.Done():
+				}
+			}
+
+		case newInterval := <-intervalUpdates:
+			switch {
+			case newInterval <= 0:
+				level.Warn(logger).Log("msg", "Ignoring invalid poll interval", "interval", newInterval)
+			case newInterval == interval:
+				level.Debug(logger).Log("msg", "Poll interval unchanged", "interval", interval)
+			default:
+				ticker.Reset(backoff.delay(newInterval))
+				level.Info(logger).Log("msg", "Poll interval updated",
+					"previous", interval.String(), "interval", newInterval.String())
+				interval = newInterval
 			}
 
 		case <-ctx.Done():
@@ -89,33 +571,271 @@ func pollIP(ctx context.Context, logger log.Logger, client Client, interval time
 	}
 }
 
+// subscribeIP receives the apparent IP address from the given IPSubscriber whenever it changes, and sends the received
+// values to the given channel. Each received value is reported to the given MetricsHandler as a successful poll.
+// It returns nil once the provided Context is done, or otherwise the error that ended the subscription.
+func subscribeIP(ctx context.Context, logger log.Logger, subscriber IPSubscriber, metrics MetricsHandler,
+	polledIPs chan<- net.IP) error {
+	level.Debug(logger).Log("msg", "Subscribing to IP address changes")
+	pushedIPs := make(chan net.IP)
+	done := make(chan error, 1)
+	go func() {
+		done <- subscriber.SubscribeToIPChangesWithContext(ctx, pushedIPs)
+	}()
+	for {
+		select {
+		case myIP := <-pushedIPs:
+			metrics.ObservePoll(0, myIP, nil)
+			level.Info(logger).Log("msg", "Received my IP address",
+				"ip", myIP.String(), "ip_version", sdk.IPFamilyOf(myIP).String())
+			// The receiver stops receiving once ctx is done
+			select {
+			case polledIPs <- myIP:
+			case <-ctx.Done():
+			}
+
+		case err := <-done:
+			if ctx.Err() != nil {
+				level.Debug(logger).Log("msg", "Shutdown requested", "reason", ctx.Err())
+				return nil
+			}
+			if err == nil {
+				err = errors.New("subscription ended unexpectedly")
+			}
+			return err
+		}
+	}
+}
+
 // updateDNS monitors the given channel for new IP address values, and requests the Client to update DNS records
 // whenever the newly-received IP address differs from the previously-received value.
-// The first value is determined by the given startIP.
-// This function will indefinitely wait for new IP addresses until the provided Context is done.
-func updateDNS(ctx context.Context, logger log.Logger, client Client, startIP net.IP, latestIPs <-chan net.IP) {
-	previousIP := startIP
+// A differing IP address is only considered a change once it has been received changeThreshold times in a row;
+// until then, it is tracked as a candidate, which is discarded whenever a different value is received.
+// Failed update requests are retried according to the given RetryPolicy, and the outcome of each update cycle
+// is reported to the given MetricsHandler. After each successful update, the given ChangeNotifiers are notified.
+// Each update cycle also updates the DNS records of extraClients (see updateExtraAliases), whose outcome does not
+// affect the update cycle of client.
+// No update is requested until cooldown has elapsed since the previous successful update; a change detected
+// sooner remains a candidate, so that it is acted upon by a later poll. Likewise, a change is not updated while the
+// given CircuitBreaker (if not nil) is open, and the outcome of each update cycle is reported to it.
+// The first value is determined by the given startIP, which is assumed to have been set by a successful update
+// immediately before updateDNS is called.
+// This function will indefinitely wait for new IP addresses until the provided ctx is done. Update cycles
+// (including retries and notifications) are performed with drainCtx, which allows an in-flight update cycle
+// to finish after ctx is done.
+func updateDNS(ctx, drainCtx context.Context, logger log.Logger, client Client, metrics MetricsHandler,
+	extraClients []Client, notifiers []ChangeNotifier, retryPolicy RetryPolicy, changeThreshold int,
+	cooldown time.Duration, breaker *CircuitBreaker, startIP net.IP, latestIPs <-chan net.IP) {
+	var (
+		previousIP     = startIP
+		candidateIP    net.IP
+		candidateCount int
+		lastUpdate     = time.Now()
+	)
+	if changeThreshold < 1 {
+		changeThreshold = 1
+	}
 
 	level.Debug(logger).Log("msg", "Waiting for refreshed IP address", "starting_ip", startIP)
 	for {
 		select {
 		case latestIP := <-latestIPs:
-			if !latestIP.Equal(previousIP) {
-				level.Debug(logger).Log("msg", "IP address change detected",
-					"previous", previousIP.String(), "new", latestIP.String())
-				if aliasIP, err := client.UpdateAliasWithContext(ctx); err != nil {
-					level.Error(logger).Log("msg", "Error updating DNS alias", "error", err)
-				} else {
-					level.Info(logger).Log("msg", "Updated IP alias", "ip", aliasIP.String())
-					previousIP = aliasIP
-				}
-			} else {
+			if ctx.Err() != nil {
+				// Both cases may be ready at once, but no new update cycles are started after shutdown is requested
+				continue
+			}
+			if latestIP.Equal(previousIP) {
 				level.Debug(logger).Log("msg", "No change in latest IP address", "ip", latestIP)
+				candidateIP, candidateCount = nil, 0
+				continue
+			}
+
+			if latestIP.Equal(candidateIP) {
+				candidateCount++
+			} else {
+				candidateIP, candidateCount = latestIP, 1
+			}
+			if candidateCount < changeThreshold {
+				level.Debug(logger).Log("msg", "IP address change pending confirmation",
+					"previous", previousIP.String(), "new", latestIP.String(),
+					"observed", fmt.Sprint(candidateCount), "threshold", fmt.Sprint(changeThreshold))
+				continue
+			}
+			if sinceUpdate := time.Since(lastUpdate); sinceUpdate < cooldown {
+				level.Debug(logger).Log("msg", "IP address change deferred by update cooldown",
+					"previous", previousIP.String(), "new", latestIP.String(),
+					"since_update", sinceUpdate.String(), "cooldown", cooldown.String())
+				continue
+			}
+
+			if !breaker.Allow() {
+				level.Warn(logger).Log("msg", "IP address change not updated while circuit breaker is open",
+					"previous", previousIP.String(), "new", latestIP.String())
+				continue
 			}
 
+			level.Debug(logger).Log("msg", "IP address change detected",
+				"previous", previousIP.String(), "new", latestIP.String())
+			aliasIP, err := updateAliasWithRetry(drainCtx, logger, client, retryPolicy)
+			metrics.ObserveUpdate(aliasIP, err)
+			reportCircuitOutcome(logger, breaker, err)
+			if err == nil {
+				level.Info(logger).Log("msg", "Updated IP alias",
+					"ip", aliasIP.String(), "ip_version", sdk.IPFamilyOf(aliasIP).String())
+				notifyChange(drainCtx, logger, notifiers, previousIP, aliasIP)
+				previousIP, lastUpdate = aliasIP, time.Now()
+				// The candidate survives failed updates, so that the update is retried on the next poll
+				candidateIP, candidateCount = nil, 0
+			}
+			updateExtraAliases(drainCtx, logger, extraClients, retryPolicy)
+
 		case <-ctx.Done():
 			level.Debug(logger).Log("msg", "Shutdown requested", "reason", ctx.Err())
 			return
 		}
 	}
 }
+
+// reportCircuitOutcome reports the outcome of a DNS update cycle to the given CircuitBreaker (if not nil), and logs
+// any resulting change of its CircuitState.
+func reportCircuitOutcome(logger log.Logger, breaker *CircuitBreaker, err error) {
+	if breaker == nil {
+		return
+	}
+	previous := breaker.State()
+	if err != nil {
+		breaker.Failure()
+	} else {
+		breaker.Success()
+	}
+	switch state := breaker.State(); {
+	case state == CircuitOpen && previous != CircuitOpen:
+		level.Warn(logger).Log("msg", "Circuit breaker opened after failed DNS updates",
+			"recovery_timeout", breaker.options.RecoveryTimeout.String())
+	case state == CircuitClosed && previous != CircuitClosed:
+		level.Info(logger).Log("msg", "Circuit breaker closed after successful DNS update")
+	}
+}
+
+// consecutiveErrorLimit is a MetricsHandler that counts consecutive failed polls and DNS update cycles (separately),
+// and cancels the agent with an error matching ErrMaxConsecutiveErrors once either count reaches limit.
+type consecutiveErrorLimit struct {
+	mu                       sync.Mutex
+	limit                    int
+	pollErrors, updateErrors int
+	cancel                   context.CancelCauseFunc
+}
+
+func (l *consecutiveErrorLimit) ObservePoll(_ time.Duration, _ net.IP, err error) {
+	l.observe(&l.pollErrors, "polls", err)
+}
+
+func (l *consecutiveErrorLimit) ObserveUpdate(_ net.IP, err error) {
+	l.observe(&l.updateErrors, "DNS updates", err)
+}
+
+// observe resets count when err is nil, and otherwise increments it (cancelling the agent when it reaches the limit).
+func (l *consecutiveErrorLimit) observe(count *int, operations string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		*count = 0
+		return
+	}
+	if *count++; *count == l.limit {
+		l.cancel(fmt.Errorf("%w (%d failed %s in a row): %w", ErrMaxConsecutiveErrors, *count, operations, err))
+	}
+}
+
+// updateExtraAliases concurrently requests each of the given Clients to update DNS records (retrying failed requests
+// according to the given RetryPolicy), and waits for all requests to finish. The outcome of each update is logged
+// independently, with an extra_target field identifying the (1-based) position of the Client.
+// It returns the error (or nil) resulting from the update of each Client, in order.
+func updateExtraAliases(ctx context.Context, logger log.Logger, clients []Client, retryPolicy RetryPolicy) []error {
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			targetLogger := log.With(logger, "extra_target", fmt.Sprint(i+1))
+			ip, err := updateAliasWithRetry(ctx, targetLogger, client, retryPolicy)
+			if err != nil {
+				level.Error(targetLogger).Log("msg", "Failed to update extra IP alias", "error", err)
+			} else {
+				level.Info(targetLogger).Log("msg", "Updated extra IP alias",
+					"ip", ip.String(), "ip_version", sdk.IPFamilyOf(ip).String())
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// drainContext returns a copy of ctx that is not done when ctx is done, but only once timeout has elapsed
+// afterwards (or when the returned CancelFunc is called). When the timeout elapses, a warning is logged to indicate
+// that operations still using the returned Context are being abandoned.
+func drainContext(ctx context.Context, logger log.Logger, timeout time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			level.Warn(logger).Log("msg", "Drain timeout exceeded; abandoning in-flight DNS update",
+				"drain_timeout", timeout.String())
+			cancel()
+		case <-drainCtx.Done():
+		}
+	})
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// notifyChange notifies each of the given ChangeNotifiers that the IP address changed from previous to current.
+// Failed notifications are logged as warnings.
+func notifyChange(ctx context.Context, logger log.Logger, notifiers []ChangeNotifier, previous, current net.IP) {
+	ts := time.Now()
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, previous, current, ts); err != nil {
+			level.Warn(logger).Log("msg", "Error delivering IP change notification", "error", err)
+		}
+	}
+}
+
+// changeHandlerGroup is a ChangeNotifier that concurrently calls each of its ChangeHandlers, and waits for all
+// of them to return. Errors and panics are logged (with a change_handler field identifying the 1-based position
+// of the ChangeHandler), so Notify always returns nil.
+type changeHandlerGroup struct {
+	handlers []ChangeHandler
+	logger   log.Logger
+}
+
+func (g changeHandlerGroup) Notify(ctx context.Context, previous, current net.IP, ts time.Time) error {
+	var wg sync.WaitGroup
+	for i, h := range g.handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := callChangeHandler(ctx, h, previous, current, ts); err != nil {
+				level.Warn(g.logger).Log("msg", "Error handling IP change", "change_handler", fmt.Sprint(i+1),
+					"error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// callChangeHandler calls h.OnChange, and recovers from any panic by returning it as an error.
+func callChangeHandler(ctx context.Context, h ChangeHandler, from, to net.IP, ts time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("change handler panicked: %v", r)
+		}
+	}()
+	return h.OnChange(ctx, from, to, ts)
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,56 +18,239 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
-)
-
-type mockClient struct{ mock.Mock }
-
-func (m *mockClient) MyIPWithContext(context.Context) (ip net.IP, err error) {
-	return m.coerceRV(m.Called())
-}
 
-func (m *mockClient) UpdateAliasWithContext(context.Context) (ip net.IP, err error) {
-	return m.coerceRV(m.Called())
-}
-
-func (m *mockClient) coerceRV(args mock.Arguments) (ip net.IP, err error) {
-	if rvIP := args.Get(0); rvIP != nil {
-		ip = rvIP.(net.IP)
-	}
-	if rvErr := args.Get(1); rvErr != nil {
-		err = rvErr.(error)
-	}
-	return
-}
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
+)
 
 func TestAgentRunWithFailedStartup(t *testing.T) {
 	underlyingClientError := fmt.Errorf("alias update error")
-	client := &mockClient{}
+	client := &sdktest.MockClient{}
 	client.On("UpdateAliasWithContext").Return(nil, underlyingClientError).Once()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := Run(ctx, log.NewJSONLogger(io.Discard), client, time.Second)
+	err := Run(ctx, log.NewJSONLogger(io.Discard), client, time.Second, RetryPolicy{})
 	assert.ErrorIs(t, err, underlyingClientError)
 	client.AssertExpectations(t)
 }
 
 func TestAgentRunWithPrematureShutdown(t *testing.T) {
-	client := &mockClient{}
+	client := &sdktest.MockClient{}
 	client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("error: %w", context.Canceled)).Once()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	cancel()
 
-	err := Run(ctx, log.NewJSONLogger(io.Discard), client, time.Second)
+	err := Run(ctx, log.NewJSONLogger(io.Discard), client, time.Second, RetryPolicy{})
 	assert.ErrorIs(t, err, context.Canceled)
 	client.AssertNotCalled(t, "MyIPWithContext")
 	client.AssertExpectations(t)
 }
 
+func TestRunOptionsDefaults(t *testing.T) {
+	options := RunOptions{}.withDefaults()
+	assert.Equal(t, DefaultPollInterval, options.PollInterval)
+	assert.Equal(t, RetryPolicy{}, options.RetryPolicy)
+	assert.Equal(t, 1, options.RetryPolicy.attempts())
+	assert.Equal(t, nopMetricsHandler{}, options.Metrics)
+	assert.Equal(t, 1, options.ChangeThreshold)
+	assert.False(t, options.Once)
+	assert.Empty(t, options.Notifiers)
+	assert.Nil(t, options.PollIntervalUpdates)
+	assert.Nil(t, options.StateTracker)
+	assert.Equal(t, DefaultDrainTimeout, options.DrainTimeout)
+	assert.False(t, options.BackoffOnPollError)
+	assert.Equal(t, DefaultPollErrorMaxBackoff, options.PollErrorMaxBackoff)
+	assert.Equal(t, CircuitBreakerOptions{}, options.CircuitBreaker)
+	assert.Equal(t, DefaultCircuitRecoveryTimeout,
+		RunOptions{CircuitBreaker: CircuitBreakerOptions{FailureThreshold: 3}}.withDefaults().CircuitBreaker.RecoveryTimeout)
+
+	metrics := &mockMetricsHandler{}
+	options = RunOptions{PollInterval: time.Minute, Metrics: metrics, ChangeThreshold: 3}.withDefaults()
+	assert.Equal(t, time.Minute, options.PollInterval)
+	assert.Same(t, metrics, options.Metrics)
+	assert.Equal(t, 3, options.ChangeThreshold)
+}
+
+func TestRunOptionsValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		options       RunOptions
+		expectedError string
+	}{
+		{"zero value", RunOptions{}, ""},
+		{"customized", RunOptions{
+			PollInterval:    time.Minute,
+			RetryPolicy:     RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2, Jitter: 1},
+			ChangeThreshold: 2,
+		}, ""},
+		{"negative poll interval", RunOptions{PollInterval: -time.Second},
+			"poll interval cannot be negative (received -1s)"},
+		{"negative change threshold", RunOptions{ChangeThreshold: -1},
+			"change threshold cannot be negative (received -1)"},
+		{"negative drain timeout", RunOptions{DrainTimeout: -time.Second},
+			"drain timeout cannot be negative (received -1s)"},
+		{"negative history size", RunOptions{HistorySize: -1},
+			"history size cannot be negative (received -1)"},
+		{"negative update cooldown", RunOptions{UpdateCooldown: -time.Second},
+			"update cooldown cannot be negative (received -1s)"},
+		{"negative poll error max backoff", RunOptions{PollErrorMaxBackoff: -time.Second},
+			"poll error max backoff cannot be negative (received -1s)"},
+		{"negative max consecutive errors", RunOptions{MaxConsecutiveErrors: -1},
+			"max consecutive errors cannot be negative (received -1)"},
+		{"negative startup delay", RunOptions{StartupDelay: -time.Second},
+			"startup delay cannot be negative (received -1s)"},
+		{"negative circuit breaker failure threshold",
+			RunOptions{CircuitBreaker: CircuitBreakerOptions{FailureThreshold: -1}},
+			"circuit breaker failure threshold cannot be negative (received -1)"},
+		{"negative circuit breaker recovery timeout",
+			RunOptions{CircuitBreaker: CircuitBreakerOptions{RecoveryTimeout: -time.Second}},
+			"circuit breaker recovery timeout cannot be negative (received -1s)"},
+		{"negative retry attempts", RunOptions{RetryPolicy: RetryPolicy{MaxAttempts: -1}},
+			"retry max attempts cannot be negative (received -1)"},
+		{"negative retry base delay", RunOptions{RetryPolicy: RetryPolicy{BaseDelay: -time.Second}},
+			"retry base delay cannot be negative (received -1s)"},
+		{"negative retry max delay", RunOptions{RetryPolicy: RetryPolicy{MaxDelay: -time.Second}},
+			"retry max delay cannot be negative (received -1s)"},
+		{"negative retry multiplier", RunOptions{RetryPolicy: RetryPolicy{Multiplier: -2}},
+			"retry multiplier cannot be negative (received -2)"},
+		{"excessive retry jitter", RunOptions{RetryPolicy: RetryPolicy{Jitter: 1.5}},
+			"retry jitter must be between 0 and 1 (received 1.5)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestAgentRunWithOptions(t *testing.T) {
+	t.Run("invalid options", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		err := RunWithOptions(context.Background(), log.NewNopLogger(), client, RunOptions{PollInterval: -1})
+		assert.EqualError(t, err, "invalid agent options: poll interval cannot be negative (received -1ns)")
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.NoError(t, RunWithOptions(ctx, log.NewNopLogger(), client, RunOptions{}))
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "MyIPWithContext")
+	})
+
+	t.Run("once", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		tracker := &StateTracker{}
+		err := RunWithOptions(context.Background(), log.NewNopLogger(), client,
+			RunOptions{Once: true, StateTracker: tracker})
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		assert.Equal(t, "1.2.3.4", tracker.StateSnapshot().CurrentIP.String())
+	})
+}
+
+// slowUpdateClient is a Client whose DNS alias updates (after the first) are delayed, unless cut short by the
+// Context provided for the update.
+type slowUpdateClient struct {
+	*sdktest.MockClient
+	delay         time.Duration
+	updates       atomic.Int64
+	updateStarted chan struct{}
+}
+
+func (c *slowUpdateClient) UpdateAliasWithContext(ctx context.Context) (net.IP, error) {
+	if c.updates.Add(1) > 1 {
+		close(c.updateStarted)
+		timer := time.NewTimer(c.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c.MockClient.UpdateAliasWithContext(ctx)
+}
+
+func TestAgentRunWithDrainTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		drainTimeout   time.Duration
+		expectUpdated  bool
+		expectDrainLog bool
+	}{
+		{"generous drain timeout lets in-flight update finish", time.Second, true, false},
+		{"short drain timeout cuts in-flight update short", 10 * time.Millisecond, false, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &slowUpdateClient{MockClient: &sdktest.MockClient{}, delay: 200 * time.Millisecond,
+				updateStarted: make(chan struct{})}
+			client.MockClient.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+			client.MockClient.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Maybe()
+			client.MockClient.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+
+			logs := new(bytes.Buffer)
+			tracker := &StateTracker{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error)
+			go func() {
+				done <- RunWithOptions(ctx, log.NewJSONLogger(logs), client, RunOptions{
+					PollInterval: 10 * time.Millisecond,
+					DrainTimeout: tt.drainTimeout,
+					StateTracker: tracker,
+				})
+			}()
+
+			// Request shutdown while the update caused by the IP address change is in flight
+			<-client.updateStarted
+			cancel()
+			require.NoError(t, <-done)
+
+			state := tracker.StateSnapshot()
+			if tt.expectUpdated {
+				assert.Equal(t, "9.8.7.6", state.CurrentIP.String(), "in-flight update should finish")
+				assert.EqualValues(t, 2, state.UpdateCount)
+			} else {
+				assert.Equal(t, "1.2.3.4", state.CurrentIP.String(), "in-flight update should be abandoned")
+				assert.EqualValues(t, 1, state.UpdateCount)
+			}
+			assert.EqualValues(t, 2, client.updates.Load(), "no updates should be started after shutdown")
+
+			var drainLogs []map[string]string
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var record map[string]string
+				require.NoError(t, json.Unmarshal([]byte(line), &record))
+				if record["drain_timeout"] != "" {
+					drainLogs = append(drainLogs, record)
+				}
+			}
+			if tt.expectDrainLog {
+				require.Len(t, drainLogs, 1)
+				assert.Equal(t, "warn", drainLogs[0]["level"])
+				assert.Equal(t, "Drain timeout exceeded; abandoning in-flight DNS update", drainLogs[0]["msg"])
+				assert.Equal(t, tt.drainTimeout.String(), drainLogs[0]["drain_timeout"])
+			} else {
+				assert.Empty(t, drainLogs)
+			}
+		})
+	}
+}
+
 func TestAgentRun(t *testing.T) {
-	client := &mockClient{}
+	client := &sdktest.MockClient{}
 	var expectedLogs []map[string]string
 	expectedLogs = append(expectedLogs, map[string]string{"msg": "Initializing agent...", "level": "info"})
 
@@ -99,12 +284,15 @@ func TestAgentRun(t *testing.T) {
 	}
 	client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil)
 	client.On("UpdateAliasWithContext").Return(net.ParseIP("2.3.4.5"), nil)
+	// The agent reports its version with the IP address of the initial DNS update
+	expectedLogs[1]["version"] = "v1.2.3"
 
 	logWriter := new(bytes.Buffer)
 	logger := level.NewFilter(log.NewJSONLogger(logWriter), level.AllowInfo())
 	timeoutCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
-	err := Run(timeoutCtx, logger, client, 10*time.Millisecond)
+	err := Run(timeoutCtx, logger, client, 10*time.Millisecond, RetryPolicy{},
+		func(o *RunOptions) { o.AgentVersion = "v1.2.3" })
 	require.NoError(t, err)
 	require.True(t, client.AssertExpectations(t))
 
@@ -123,6 +311,926 @@ func TestAgentRun(t *testing.T) {
 		assert.Equal(t, expectedLogData["error"], logData["error"], "line %d", lineNo)
 		assert.Equal(t, expectedLogData["level"], logData["level"], "line %d", lineNo)
 		assert.Equal(t, expectedLogData["msg"], logData["msg"], "line %d", lineNo)
+		assert.Equal(t, expectedLogData["version"], logData["version"], "line %d", lineNo)
+		if lineNo == 1 {
+			assert.Equal(t, "4", logData["ip_version"], "line %d", lineNo)
+		}
 		//fmt.Printf("%d: %s\n", lineNo, lines[lineNo])
 	}
 }
+
+func TestAgentRunWithOnce(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		logWriter := new(bytes.Buffer)
+		err := Run(context.Background(), log.NewJSONLogger(logWriter), client, time.Millisecond, RetryPolicy{},
+			WithOnce())
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "MyIPWithContext")
+
+		lines := strings.Split(strings.TrimSpace(logWriter.String()), "\n")
+		logData := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &logData))
+		assert.Equal(t, "Agent stopped", logData["msg"])
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		updateErr := fmt.Errorf("alias update error")
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, updateErr).Once()
+
+		err := Run(context.Background(), log.NewJSONLogger(io.Discard), client, time.Millisecond, RetryPolicy{},
+			WithOnce())
+		assert.ErrorIs(t, err, updateErr)
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "MyIPWithContext")
+	})
+}
+
+func TestAgentRunWithStartupDelay(t *testing.T) {
+	t.Run("zero delay", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		logWriter := new(bytes.Buffer)
+		err := RunWithOptions(context.Background(), log.NewJSONLogger(logWriter), client, RunOptions{Once: true})
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		assert.NotContains(t, logWriter.String(), "startup_delay")
+	})
+
+	t.Run("delay completes", func(t *testing.T) {
+		const delay = 50 * time.Millisecond
+		var calledAfter time.Duration
+		start := time.Now()
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once().
+			Run(func(mock.Arguments) { calledAfter = time.Since(start) })
+
+		err := RunWithOptions(context.Background(), log.NewJSONLogger(io.Discard), client,
+			RunOptions{Once: true, StartupDelay: delay})
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		assert.GreaterOrEqual(t, calledAfter, delay, "the initial DNS update should wait for the startup delay")
+	})
+
+	t.Run("cancelled during delay", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		logWriter := new(bytes.Buffer)
+		start := time.Now()
+		err := RunWithOptions(ctx, log.NewJSONLogger(logWriter), client, RunOptions{StartupDelay: time.Hour})
+		assert.NoError(t, err, "shutdown during the startup delay should be clean")
+		assert.Less(t, time.Since(start), time.Minute)
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+		client.AssertNotCalled(t, "MyIPWithContext")
+		assert.Contains(t, logWriter.String(), "Shutdown requested during startup delay")
+	})
+}
+
+type mockMetricsHandler struct{ mock.Mock }
+
+func (m *mockMetricsHandler) ObservePoll(_ time.Duration, ip net.IP, err error) {
+	m.Called(ip.String(), err)
+}
+
+func (m *mockMetricsHandler) ObserveUpdate(ip net.IP, err error) { m.Called(ip.String(), err) }
+
+func TestAgentRunWithMetricsHandler(t *testing.T) {
+	pollErr := fmt.Errorf("ip fetch error")
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(nil, pollErr).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+
+	metrics := &mockMetricsHandler{}
+	metrics.On("ObserveUpdate", "1.2.3.4", nil).Once()
+	metrics.On("ObservePoll", "<nil>", pollErr).Once()
+	metrics.On("ObservePoll", "9.8.7.6", nil)
+	metrics.On("ObserveUpdate", "9.8.7.6", nil).Once()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := Run(ctx, log.NewNopLogger(), client, 10*time.Millisecond, RetryPolicy{}, WithMetricsHandler(metrics))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	metrics.AssertExpectations(t)
+}
+
+func TestWaitForInitialIP(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		logWriter := new(bytes.Buffer)
+		ip, err := WaitForInitialIP(context.Background(), log.NewJSONLogger(logWriter), client)
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "MyIPWithContext")
+		assert.Contains(t, logWriter.String(), "Initialized with IP address after DNS update")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		updateErr := fmt.Errorf("alias update error")
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, updateErr).Once()
+
+		ip, err := WaitForInitialIP(context.Background(), log.NewNopLogger(), client)
+		assert.ErrorIs(t, err, updateErr)
+		assert.Nil(t, ip)
+		client.AssertExpectations(t)
+	})
+}
+
+func TestAgentRunFrom(t *testing.T) {
+	t.Run("monitors from start IP", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+
+		metrics := &mockMetricsHandler{}
+		metrics.On("ObserveUpdate", "1.2.3.4", nil).Once()
+		metrics.On("ObservePoll", mock.Anything, nil)
+		metrics.On("ObserveUpdate", "9.8.7.6", nil).Once()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		err := RunFrom(ctx, log.NewNopLogger(), client, net.ParseIP("1.2.3.4"),
+			RunOptions{PollInterval: 10 * time.Millisecond, Metrics: metrics})
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		client.AssertNumberOfCalls(t, "UpdateAliasWithContext", 1)
+		metrics.AssertExpectations(t)
+	})
+
+	t.Run("with once", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		tracker := &StateTracker{}
+		err := RunFrom(context.Background(), log.NewNopLogger(), client, net.ParseIP("1.2.3.4"),
+			RunOptions{Once: true, StateTracker: tracker})
+		require.NoError(t, err)
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+		client.AssertNotCalled(t, "MyIPWithContext")
+		state := tracker.StateSnapshot()
+		assert.Equal(t, "1.2.3.4", state.CurrentIP.String())
+		assert.EqualValues(t, 1, state.UpdateCount, "the initial DNS update should be recorded")
+	})
+
+	t.Run("without start IP", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		err := RunFrom(context.Background(), log.NewNopLogger(), client, nil, RunOptions{})
+		assert.EqualError(t, err, "invalid agent options: start IP address is required")
+		client.AssertNotCalled(t, "UpdateAliasWithContext")
+	})
+}
+
+func TestAgentRunWithPollIntervalUpdates(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil)
+
+	updates := make(chan time.Duration)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go func() {
+		// Invalid and unchanged intervals are ignored
+		updates <- 0
+		updates <- time.Hour
+		updates <- 10 * time.Millisecond
+	}()
+
+	logWriter := new(bytes.Buffer)
+	logger := level.NewFilter(log.NewJSONLogger(logWriter), level.AllowInfo())
+	err := Run(ctx, logger, client, time.Hour, RetryPolicy{}, WithPollIntervalUpdates(updates))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	var intervalLogs []map[string]string
+	for _, line := range strings.Split(strings.TrimSpace(logWriter.String()), "\n") {
+		logData := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(line), &logData))
+		if strings.Contains(logData["msg"], "interval") {
+			intervalLogs = append(intervalLogs, logData)
+		}
+	}
+	require.Len(t, intervalLogs, 2)
+	assert.Equal(t, "Ignoring invalid poll interval", intervalLogs[0]["msg"])
+	assert.Equal(t, "Poll interval updated", intervalLogs[1]["msg"])
+	assert.Equal(t, "1h0m0s", intervalLogs[1]["previous"])
+	assert.Equal(t, "10ms", intervalLogs[1]["interval"])
+}
+
+func TestPollIPWithBackoff(t *testing.T) {
+	const interval = 5 * time.Millisecond
+	pollErr := fmt.Errorf("poll error")
+
+	// Count the polls made in a fixed window while every poll fails
+	countPolls := func(backoff pollBackoff) int {
+		client := &sdktest.MockClient{}
+		client.On("MyIPWithContext").Return(nil, pollErr)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		pollIP(ctx, log.NewNopLogger(), SDKIPSource{Client: client}, nopMetricsHandler{}, interval, nil, backoff, make(chan net.IP))
+		return len(client.Calls)
+	}
+
+	withoutBackoff := countPolls(pollBackoff{})
+	// Delays of 5, 10, 20, 40, 80, 80ms... allow no more than 6 polls in 200ms
+	withBackoff := countPolls(pollBackoff{enabled: true, maxDelay: 80 * time.Millisecond})
+	assert.LessOrEqual(t, withBackoff, 6)
+	assert.Greater(t, withoutBackoff, 2*withBackoff, "backoff should reduce the number of failed polls")
+
+	t.Run("reset after success", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("MyIPWithContext").Return(nil, pollErr).Times(5)
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ips := make(chan net.IP)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			pollIP(ctx, log.NewNopLogger(), SDKIPSource{Client: client}, nopMetricsHandler{}, interval, nil,
+				pollBackoff{enabled: true, maxDelay: time.Hour}, ips)
+		}()
+
+		// After the first success, polls resume at the regular interval (rather than 16x the interval)
+		<-ips
+		received := time.Now()
+		<-ips
+		assert.Less(t, time.Since(received), 8*interval)
+		cancel()
+		<-done
+	})
+}
+
+func TestAgentRunWithState(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(nil, fmt.Errorf("ip fetch error")).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+
+	tracker := &StateTracker{}
+	var pushed []State
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := Run(ctx, log.NewNopLogger(), client, 10*time.Millisecond, RetryPolicy{},
+		WithStateTracker(tracker), WithStateHandler(func(s State) { pushed = append(pushed, s) }))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	final := tracker.StateSnapshot()
+	assert.Equal(t, "9.8.7.6", final.CurrentIP.String())
+	assert.Equal(t, int64(2), final.UpdateCount)
+	assert.Equal(t, int64(2), final.ErrorCount)
+	assert.False(t, final.LastPollTime.IsZero())
+	assert.False(t, final.LastUpdateTime.IsZero())
+
+	require.NotEmpty(t, pushed)
+	assert.Equal(t, final, pushed[len(pushed)-1], "the last pushed snapshot should match the final State")
+	t.Run("initial state", func(t *testing.T) {
+		assert.Equal(t, "1.2.3.4", pushed[0].CurrentIP.String())
+		assert.Equal(t, int64(1), pushed[0].UpdateCount)
+		assert.Zero(t, pushed[0].ErrorCount)
+		assert.True(t, pushed[0].LastPollTime.IsZero())
+	})
+	t.Run("transitions", func(t *testing.T) {
+		for i := 1; i < len(pushed); i++ {
+			prev, cur := pushed[i-1], pushed[i]
+			assert.GreaterOrEqual(t, cur.UpdateCount, prev.UpdateCount, "snapshot %d", i)
+			assert.GreaterOrEqual(t, cur.ErrorCount, prev.ErrorCount, "snapshot %d", i)
+			assert.False(t, cur.LastPollTime.Before(prev.LastPollTime), "snapshot %d", i)
+			assert.False(t, cur.LastUpdateTime.Before(prev.LastUpdateTime), "snapshot %d", i)
+		}
+	})
+}
+
+func TestAgentRunWithHistorySize(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(nil, fmt.Errorf("ip fetch error")).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+	// Polls may continue until the agent observes the cancellation
+	client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil).Maybe()
+
+	tracker := &StateTracker{}
+	var pushed []State
+	var final State
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := RunWithOptions(ctx, log.NewNopLogger(), client, RunOptions{
+		PollInterval: 10 * time.Millisecond,
+		StateTracker: tracker,
+		HistorySize:  2,
+		StateHandlers: []func(State){func(s State) {
+			pushed = append(pushed, s)
+			if s.CurrentIP.Equal(net.ParseIP("2.3.4.5")) && final.CurrentIP == nil {
+				final = s
+				cancel()
+			}
+		}},
+	})
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Equal(t, []net.IP{net.ParseIP("9.8.7.6"), net.ParseIP("2.3.4.5")}, final.RecentIPs,
+		"only the most recently polled IP addresses should be recorded")
+	assert.Empty(t, pushed[0].RecentIPs, "no IP addresses are polled before the initial update")
+}
+
+func TestAgentRunWithOnceAndStateHandler(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+	var pushed []State
+	err := Run(context.Background(), log.NewNopLogger(), client, time.Millisecond, RetryPolicy{},
+		WithOnce(), WithStateHandler(func(s State) { pushed = append(pushed, s) }))
+	require.NoError(t, err)
+	require.Len(t, pushed, 1)
+	assert.Equal(t, "1.2.3.4", pushed[0].CurrentIP.String())
+	assert.Equal(t, int64(1), pushed[0].UpdateCount)
+}
+
+func TestAgentRunReusingStateTracker(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("5.6.7.8"), nil).Once()
+
+	tracker := &StateTracker{}
+	var first, second []State
+	err := Run(context.Background(), log.NewNopLogger(), client, time.Millisecond, RetryPolicy{},
+		WithOnce(), WithStateTracker(tracker), WithStateHandler(func(s State) { first = append(first, s) }))
+	require.NoError(t, err)
+	err = Run(context.Background(), log.NewNopLogger(), client, time.Millisecond, RetryPolicy{},
+		WithOnce(), WithStateTracker(tracker), WithStateHandler(func(s State) { second = append(second, s) }))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+
+	assert.Len(t, first, 1, "handlers should not be called after their run has returned")
+	require.Len(t, second, 1)
+	assert.Equal(t, "5.6.7.8", second[0].CurrentIP.String())
+	assert.Equal(t, int64(2), second[0].UpdateCount, "the tracked State should carry over between runs")
+}
+
+type mockChangeNotifier struct{ mock.Mock }
+
+func (m *mockChangeNotifier) Notify(_ context.Context, previous, current net.IP, _ time.Time) error {
+	return m.Called(previous.String(), current.String()).Error(0)
+}
+
+func TestAgentRunWithChangeNotifiers(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil)
+
+	failing := &mockChangeNotifier{}
+	failing.On("Notify", "1.2.3.4", "9.8.7.6").Return(fmt.Errorf("notification error")).Once()
+	failing.On("Notify", "9.8.7.6", "2.3.4.5").Return(fmt.Errorf("notification error")).Once()
+	succeeding := &mockChangeNotifier{}
+	succeeding.On("Notify", "1.2.3.4", "9.8.7.6").Return(nil).Once()
+	succeeding.On("Notify", "9.8.7.6", "2.3.4.5").Return(nil).Once()
+
+	logWriter := new(bytes.Buffer)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := Run(ctx, log.NewJSONLogger(logWriter), client, 10*time.Millisecond, RetryPolicy{},
+		WithChangeNotifiers(failing, succeeding))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	failing.AssertExpectations(t)
+	succeeding.AssertExpectations(t)
+
+	var warnings []string
+	for _, line := range strings.Split(strings.TrimSpace(logWriter.String()), "\n") {
+		logData := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(line), &logData))
+		if logData["level"] == "warn" && logData["msg"] == "Error delivering IP change notification" {
+			warnings = append(warnings, logData["error"])
+		}
+	}
+	assert.Equal(t, []string{"notification error", "notification error"}, warnings)
+}
+
+func TestAgentRunWithChangeHandlers(t *testing.T) {
+	newClient := func() *sdktest.MockClient {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("2.3.4.5"), nil).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("2.3.4.5"), nil)
+		return client
+	}
+	run := func(t *testing.T, client *sdktest.MockClient, handlers ...ChangeHandler) []map[string]string {
+		t.Helper()
+		logWriter := new(bytes.Buffer)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		err := RunWithOptions(ctx, log.NewJSONLogger(logWriter), client, RunOptions{
+			PollInterval:   10 * time.Millisecond,
+			ChangeHandlers: handlers,
+		})
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+
+		var warnings []map[string]string
+		for _, line := range strings.Split(strings.TrimSpace(logWriter.String()), "\n") {
+			logData := map[string]string{}
+			require.NoError(t, json.Unmarshal([]byte(line), &logData))
+			if logData["level"] == "warn" && logData["msg"] == "Error handling IP change" {
+				warnings = append(warnings, logData)
+			}
+		}
+		return warnings
+	}
+	expectedChanges := []string{"1.2.3.4 -> 9.8.7.6", "9.8.7.6 -> 2.3.4.5"}
+	recorder := func(changes *[]string) ChangeHandler {
+		var mu sync.Mutex
+		return ChangeHandlerFunc(func(_ context.Context, from, to net.IP, _ time.Time) error {
+			mu.Lock()
+			defer mu.Unlock()
+			*changes = append(*changes, fmt.Sprintf("%s -> %s", from, to))
+			return nil
+		})
+	}
+
+	t.Run("no handlers", func(t *testing.T) {
+		assert.Empty(t, run(t, newClient()))
+	})
+
+	t.Run("one handler", func(t *testing.T) {
+		var changes []string
+		assert.Empty(t, run(t, newClient(), recorder(&changes)))
+		assert.Equal(t, expectedChanges, changes)
+	})
+
+	t.Run("multiple handlers are called concurrently", func(t *testing.T) {
+		// Each handler waits for the other to be called, which would time out if handlers were called sequentially
+		var arrivals [2]chan struct{}
+		var calls [2]atomic.Int32
+		handlers := make([]ChangeHandler, len(arrivals))
+		for i := range handlers {
+			handlers[i] = ChangeHandlerFunc(func(context.Context, net.IP, net.IP, time.Time) error {
+				arrivals[i] <- struct{}{}
+				calls[i].Add(1)
+				select {
+				case <-arrivals[1-i]:
+					return nil
+				case <-time.After(50 * time.Millisecond):
+					return fmt.Errorf("change handler %d was not called concurrently", i+1)
+				}
+			})
+			arrivals[i] = make(chan struct{}, 1)
+		}
+		assert.Empty(t, run(t, newClient(), handlers...))
+		assert.EqualValues(t, 2, calls[0].Load())
+		assert.EqualValues(t, 2, calls[1].Load())
+	})
+
+	t.Run("errors and panics are logged", func(t *testing.T) {
+		var changes []string
+		failing := ChangeHandlerFunc(func(context.Context, net.IP, net.IP, time.Time) error {
+			return fmt.Errorf("handler error")
+		})
+		panicking := ChangeHandlerFunc(func(context.Context, net.IP, net.IP, time.Time) error {
+			panic("boom")
+		})
+		warnings := run(t, newClient(), failing, panicking, recorder(&changes))
+		assert.Equal(t, expectedChanges, changes, "other handlers should be unaffected")
+
+		var warned []string
+		for _, w := range warnings {
+			warned = append(warned, w["change_handler"]+": "+w["error"])
+		}
+		assert.ElementsMatch(t, []string{
+			"1: handler error", "1: handler error",
+			"2: change handler panicked: boom", "2: change handler panicked: boom",
+		}, warned)
+	})
+}
+
+func TestAgentRunWithMaxConsecutiveErrors(t *testing.T) {
+	pollErr := fmt.Errorf("poll error")
+	updateErr := fmt.Errorf("alias update error")
+	run := func(t *testing.T, client *sdktest.MockClient, maxErrors int) (time.Duration, error) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := RunWithOptions(ctx, log.NewNopLogger(), client, RunOptions{
+			PollInterval:         5 * time.Millisecond,
+			MaxConsecutiveErrors: maxErrors,
+		})
+		return time.Since(start), err
+	}
+
+	t.Run("below threshold", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(nil, pollErr).Twice()
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil)
+
+		_, err := run(t, client, 3)
+		assert.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("at threshold", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(nil, pollErr)
+
+		elapsed, err := run(t, client, 3)
+		assert.ErrorIs(t, err, ErrMaxConsecutiveErrors)
+		assert.ErrorIs(t, err, pollErr)
+		assert.EqualError(t, err, "too many consecutive errors (3 failed polls in a row): poll error")
+		assert.Less(t, elapsed, 300*time.Millisecond, "agent should stop before its context is done")
+	})
+
+	t.Run("reset on success", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		for i := 0; i < 3; i++ {
+			client.On("MyIPWithContext").Return(nil, pollErr).Twice()
+			client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		}
+		client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil)
+
+		_, err := run(t, client, 3)
+		assert.NoError(t, err, "errors separated by successes should not stop the agent")
+		client.AssertExpectations(t)
+	})
+
+	t.Run("DNS update errors are counted separately", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+		client.On("UpdateAliasWithContext").Return(nil, updateErr)
+
+		_, err := run(t, client, 2)
+		assert.ErrorIs(t, err, ErrMaxConsecutiveErrors)
+		assert.EqualError(t, err, "too many consecutive errors (2 failed DNS updates in a row): alias update error")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("MyIPWithContext").Return(nil, pollErr)
+
+		_, err := run(t, client, 0)
+		assert.NoError(t, err)
+	})
+}
+
+type mockIPSource struct{ mock.Mock }
+
+func (m *mockIPSource) GetIP(context.Context) (net.IP, error) {
+	args := m.Called()
+	ip, _ := args.Get(0).(net.IP)
+	return ip, args.Error(1)
+}
+
+func TestSDKIPSource(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("MyIPWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(nil, fmt.Errorf("my IP error")).Once()
+
+	ip, err := SDKIPSource{Client: client}.GetIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ip.String())
+	_, err = SDKIPSource{Client: client}.GetIP(context.Background())
+	assert.EqualError(t, err, "my IP error")
+	client.AssertExpectations(t)
+}
+
+func TestAgentRunWithIPSource(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	source := &mockIPSource{}
+	source.On("GetIP").Return(nil, fmt.Errorf("source error")).Once()
+	source.On("GetIP").Return(net.ParseIP("9.8.7.6"), nil)
+
+	logWriter := new(bytes.Buffer)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := Run(ctx, log.NewJSONLogger(logWriter), client, 10*time.Millisecond, RetryPolicy{},
+		WithIPSource(source))
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	source.AssertExpectations(t)
+	client.AssertNotCalled(t, "MyIPWithContext")
+	assert.Contains(t, logWriter.String(), `"error":"source error"`, "IP source errors should be logged")
+}
+
+func TestAgentRunWithIPSubscriber(t *testing.T) {
+	t.Run("pushed IP addresses", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+		client.PushIPs(net.ParseIP("1.2.3.4"), net.ParseIP("9.8.7.6"), net.ParseIP("9.8.7.6")).Once()
+
+		tracker := &StateTracker{}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := Run(ctx, log.NewNopLogger(), client, 10*time.Millisecond, RetryPolicy{},
+			WithIPSubscriber(client), WithStateTracker(tracker), func(o *RunOptions) { o.HistorySize = 3 })
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		client.AssertNotCalled(t, "MyIPWithContext")
+		state := tracker.StateSnapshot()
+		assert.Equal(t, "9.8.7.6", state.CurrentIP.String())
+		assert.Equal(t, []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("9.8.7.6"), net.ParseIP("9.8.7.6")},
+			state.RecentIPs, "pushed IP addresses should be observed as polls")
+	})
+
+	t.Run("falls back to polling", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+		client.ReturnError("SubscribeToIPChangesWithContext", fmt.Errorf("subscription error")).Once()
+		client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+
+		logWriter := new(bytes.Buffer)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := Run(ctx, log.NewJSONLogger(logWriter), client, 10*time.Millisecond, RetryPolicy{},
+			WithIPSubscriber(client))
+		require.NoError(t, err)
+		client.AssertExpectations(t)
+		assert.Contains(t, logWriter.String(), "falling back to polling")
+		assert.Contains(t, logWriter.String(), `"error":"subscription error"`)
+	})
+}
+
+func TestAgentRunWithExtraClients(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	client.On("MyIPWithContext").Return(net.ParseIP("9.8.7.6"), nil)
+
+	succeeding := &sdktest.MockClient{}
+	succeeding.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+	succeeding.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+	failing := &sdktest.MockClient{}
+	failing.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("extra alias update error")).Twice()
+
+	logWriter := new(bytes.Buffer)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := RunWithOptions(ctx, log.NewJSONLogger(logWriter), client, RunOptions{
+		PollInterval: 10 * time.Millisecond,
+		ExtraClients: []Client{succeeding, failing},
+	})
+	require.NoError(t, err)
+	client.AssertExpectations(t)
+	succeeding.AssertExpectations(t)
+	failing.AssertExpectations(t)
+	succeeding.AssertNotCalled(t, "MyIPWithContext")
+	failing.AssertNotCalled(t, "MyIPWithContext")
+
+	var primaryUpdates, extraUpdates, extraFailures []string
+	for _, line := range strings.Split(strings.TrimSpace(logWriter.String()), "\n") {
+		logData := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(line), &logData))
+		switch logData["msg"] {
+		case "Updated IP alias":
+			primaryUpdates = append(primaryUpdates, logData["ip"])
+		case "Updated extra IP alias":
+			extraUpdates = append(extraUpdates, logData["extra_target"]+"="+logData["ip"])
+		case "Failed to update extra IP alias":
+			assert.Equal(t, "error", logData["level"])
+			extraFailures = append(extraFailures, logData["extra_target"]+"="+logData["error"])
+		}
+	}
+	assert.Equal(t, []string{"9.8.7.6"}, primaryUpdates, "primary update should succeed despite extra failures")
+	assert.Equal(t, []string{"1=1.2.3.4", "1=9.8.7.6"}, extraUpdates)
+	assert.Equal(t, []string{"2=extra alias update error", "2=extra alias update error"}, extraFailures)
+}
+
+func TestUpdateExtraAliases(t *testing.T) {
+	clients := make([]Client, 3)
+	for i := range clients {
+		c := &sdktest.MockClient{}
+		if i == 1 {
+			c.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("extra alias update error")).Once()
+		} else {
+			c.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+		}
+		clients[i] = c
+	}
+
+	errs := updateExtraAliases(context.Background(), log.NewNopLogger(), clients, RetryPolicy{})
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "extra alias update error")
+	assert.NoError(t, errs[2])
+	for _, c := range clients {
+		c.(*sdktest.MockClient).AssertExpectations(t)
+	}
+
+	assert.Empty(t, updateExtraAliases(context.Background(), log.NewNopLogger(), nil, RetryPolicy{}))
+}
+
+func TestUpdateDNSWithChangeThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		threshold       int
+		polledIPs       []string
+		updates         []string
+		expectedUpdates int
+	}{
+		{
+			"default threshold updates on each change",
+			0,
+			[]string{"9.8.7.6", "1.2.3.4", "9.8.7.6"},
+			[]string{"9.8.7.6", "1.2.3.4", "9.8.7.6"},
+			3,
+		},
+		{
+			"change is confirmed by consecutive observations",
+			3,
+			[]string{"9.8.7.6", "9.8.7.6", "9.8.7.6", "9.8.7.6"},
+			[]string{"9.8.7.6"},
+			1,
+		},
+		{
+			"flapping IP does not cause updates",
+			2,
+			[]string{"9.8.7.6", "1.2.3.4", "9.8.7.6", "1.2.3.4", "2.3.4.5", "1.2.3.4"},
+			nil,
+			0,
+		},
+		{
+			"interrupted run resets the count",
+			3,
+			[]string{"9.8.7.6", "9.8.7.6", "2.3.4.5", "9.8.7.6", "9.8.7.6", "9.8.7.6"},
+			[]string{"9.8.7.6"},
+			1,
+		},
+		{
+			"change after update requires new confirmation",
+			2,
+			[]string{"9.8.7.6", "9.8.7.6", "2.3.4.5", "1.2.3.4", "1.2.3.4"},
+			[]string{"9.8.7.6", "1.2.3.4"},
+			2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &sdktest.MockClient{}
+			for _, ip := range tt.updates {
+				client.On("UpdateAliasWithContext").Return(net.ParseIP(ip), nil).Once()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ips := make(chan net.IP)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				updateDNS(ctx, ctx, log.NewNopLogger(), client, nopMetricsHandler{}, nil, nil, RetryPolicy{},
+					tt.threshold, 0, nil, net.ParseIP("1.2.3.4"), ips)
+			}()
+
+			// Sends on the unbuffered channel block until the previously-sent IP has been processed
+			for _, ip := range tt.polledIPs {
+				ips <- net.ParseIP(ip)
+			}
+			ips <- net.ParseIP(tt.polledIPs[len(tt.polledIPs)-1])
+			cancel()
+			<-done
+
+			client.AssertNumberOfCalls(t, "UpdateAliasWithContext", tt.expectedUpdates)
+			client.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateDNSWithChangeThresholdRetriesFailedUpdates(t *testing.T) {
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Once()
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ips := make(chan net.IP)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		updateDNS(ctx, ctx, log.NewNopLogger(), client, nopMetricsHandler{}, nil, nil, RetryPolicy{},
+			2, 0, nil, net.ParseIP("1.2.3.4"), ips)
+	}()
+
+	// The second observation confirms the change (but the update fails), and the third retries the update
+	for _, ip := range []string{"9.8.7.6", "9.8.7.6", "9.8.7.6", "9.8.7.6"} {
+		ips <- net.ParseIP(ip)
+	}
+	cancel()
+	<-done
+
+	client.AssertExpectations(t)
+}
+
+func TestUpdateDNSWithCooldown(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		cooldown        time.Duration
+		polledIPs       []string
+		updates         []string
+		expectedUpdates int
+	}{
+		{
+			"no cooldown updates on each change",
+			0,
+			[]string{"9.8.7.6", "2.3.4.5"},
+			[]string{"9.8.7.6", "2.3.4.5"},
+			2,
+		},
+		{
+			"changes within the cooldown are not updated",
+			time.Hour,
+			[]string{"9.8.7.6", "2.3.4.5", "9.8.7.6"},
+			nil,
+			0,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &sdktest.MockClient{}
+			for _, ip := range tt.updates {
+				client.On("UpdateAliasWithContext").Return(net.ParseIP(ip), nil).Once()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ips := make(chan net.IP)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				updateDNS(ctx, ctx, log.NewNopLogger(), client, nopMetricsHandler{}, nil, nil, RetryPolicy{},
+					1, tt.cooldown, nil, net.ParseIP("1.2.3.4"), ips)
+			}()
+
+			for _, ip := range tt.polledIPs {
+				ips <- net.ParseIP(ip)
+			}
+			ips <- net.ParseIP(tt.polledIPs[len(tt.polledIPs)-1])
+			cancel()
+			<-done
+
+			client.AssertNumberOfCalls(t, "UpdateAliasWithContext", tt.expectedUpdates)
+			client.AssertExpectations(t)
+		})
+	}
+
+	t.Run("deferred change is updated after the cooldown", func(t *testing.T) {
+		const cooldown = 200 * time.Millisecond
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ips := make(chan net.IP)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			updateDNS(ctx, ctx, log.NewNopLogger(), client, nopMetricsHandler{}, nil, nil, RetryPolicy{},
+				1, cooldown, nil, net.ParseIP("1.2.3.4"), ips)
+		}()
+
+		// The change is deferred at first, then updated once by the first poll after the cooldown, after which
+		// a second change within the (restarted) cooldown is deferred again
+		ips <- net.ParseIP("9.8.7.6")
+		time.Sleep(cooldown)
+		ips <- net.ParseIP("9.8.7.6")
+		ips <- net.ParseIP("2.3.4.5")
+		ips <- net.ParseIP("2.3.4.5")
+		cancel()
+		<-done
+
+		client.AssertNumberOfCalls(t, "UpdateAliasWithContext", 1)
+		client.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCircuitRecoveryTimeout is how long an open CircuitBreaker waits before allowing a trial DNS update,
+// when no other recovery timeout is configured.
+const DefaultCircuitRecoveryTimeout = 5 * time.Minute
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed allows all DNS updates. This is the initial state of a CircuitBreaker.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all DNS updates until the recovery timeout has elapsed.
+	CircuitOpen
+	// CircuitHalfOpen allows a single trial DNS update, whose outcome determines whether the circuit closes or
+	// re-opens.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerOptions configures a CircuitBreaker.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of DNS update cycles in a row that must fail before the circuit opens.
+	// A value of 0 disables the circuit breaker.
+	FailureThreshold int
+	// RecoveryTimeout is how long the circuit stays open before a trial DNS update is allowed.
+	// Defaults to DefaultCircuitRecoveryTimeout.
+	RecoveryTimeout time.Duration
+}
+
+// CircuitBreaker prevents repeated DNS updates while the mydyndns service is known to be down.
+// After FailureThreshold consecutive failures the circuit opens, and DNS updates are rejected until the
+// RecoveryTimeout has elapsed. The circuit then becomes half-open and allows a single trial update, which closes
+// the circuit when it succeeds and re-opens it when it fails.
+// A nil *CircuitBreaker allows all DNS updates. CircuitBreaker methods are safe for concurrent use.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	options  CircuitBreakerOptions
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trialing bool
+	now      func() time.Time
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker configured by options.
+func NewCircuitBreaker(options CircuitBreakerOptions) *CircuitBreaker {
+	if options.RecoveryTimeout <= 0 {
+		options.RecoveryTimeout = DefaultCircuitRecoveryTimeout
+	}
+	return &CircuitBreaker{options: options, now: time.Now}
+}
+
+// State returns the current CircuitState. An open circuit whose recovery timeout has elapsed is reported as
+// open until the next call to Allow.
+func (b *CircuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a DNS update may be attempted. When the recovery timeout of an open circuit has elapsed,
+// the circuit becomes half-open and Allow returns true for a single trial update, whose outcome must be reported
+// with Success or Failure before another update is allowed.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.options.RecoveryTimeout {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		fallthrough
+	case CircuitHalfOpen:
+		if b.trialing {
+			return false
+		}
+		b.trialing = true
+	}
+	return true
+}
+
+// Success reports a successful DNS update, which closes the circuit.
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.trialing = CircuitClosed, 0, false
+}
+
+// Failure reports a failed DNS update, which opens the circuit when it is half-open or when FailureThreshold
+// consecutive failures have been reported.
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.options.FailureThreshold {
+		b.state, b.openedAt, b.trialing = CircuitOpen, b.now(), false
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 2, RecoveryTimeout: time.Minute})
+	breaker.now = func() time.Time { return clock }
+
+	assert.Equal(t, CircuitClosed, breaker.State(), "new circuit breakers should be closed")
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, CircuitClosed, breaker.State(), "should stay closed below the failure threshold")
+	breaker.Success()
+	breaker.Failure()
+	assert.Equal(t, CircuitClosed, breaker.State(), "success should reset the consecutive failure count")
+
+	// closed -> open
+	breaker.Failure()
+	assert.Equal(t, CircuitOpen, breaker.State(), "should open at the failure threshold")
+	assert.False(t, breaker.Allow())
+	clock = clock.Add(time.Minute - time.Nanosecond)
+	assert.False(t, breaker.Allow(), "should stay open until the recovery timeout elapses")
+
+	// open -> half-open -> open
+	clock = clock.Add(time.Nanosecond)
+	assert.True(t, breaker.Allow(), "should allow a trial once the recovery timeout elapses")
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	assert.False(t, breaker.Allow(), "should allow only one trial at a time")
+	breaker.Failure()
+	assert.Equal(t, CircuitOpen, breaker.State(), "a failed trial should re-open the circuit")
+	assert.False(t, breaker.Allow(), "the recovery timeout should restart after a failed trial")
+
+	// open -> half-open -> closed
+	clock = clock.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	breaker.Success()
+	assert.Equal(t, CircuitClosed, breaker.State(), "a successful trial should close the circuit")
+	assert.True(t, breaker.Allow())
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, CircuitClosed, breaker.State(), "closing should reset the consecutive failure count")
+}
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1})
+	assert.Equal(t, DefaultCircuitRecoveryTimeout, breaker.options.RecoveryTimeout)
+
+	var disabled *CircuitBreaker
+	disabled.Failure()
+	disabled.Success()
+	assert.True(t, disabled.Allow(), "nil circuit breakers should allow all updates")
+	assert.Equal(t, CircuitClosed, disabled.State())
+}
+
+func TestCircuitStateString(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "unknown", CircuitState(-1).String())
+}
+
+func TestUpdateDNSWithCircuitBreaker(t *testing.T) {
+	clock := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	breaker := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 2, RecoveryTimeout: time.Minute})
+	breaker.now = func() time.Time { return clock }
+
+	client := &sdktest.MockClient{}
+	client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("service unavailable")).Times(3)
+	client.On("UpdateAliasWithContext").Return(net.ParseIP("9.8.7.6"), nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var logs bytes.Buffer
+	ips := make(chan net.IP)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		updateDNS(ctx, ctx, log.NewLogfmtLogger(&logs), client, nopMetricsHandler{}, nil, nil, RetryPolicy{},
+			1, 0, breaker, net.ParseIP("1.2.3.4"), ips)
+	}()
+
+	// Sends on the unbuffered channel block until the previously-sent IP has been received, so each send after the
+	// first also waits for the preceding update cycle to finish. The starting IP is sent before advancing the
+	// clock for that reason.
+	ips <- net.ParseIP("9.8.7.6") // fails
+	ips <- net.ParseIP("9.8.7.6") // fails and opens the circuit
+	ips <- net.ParseIP("9.8.7.6") // skipped
+	ips <- net.ParseIP("9.8.7.6") // skipped
+	ips <- net.ParseIP("1.2.3.4") // unchanged
+	clock = clock.Add(time.Minute)
+	ips <- net.ParseIP("9.8.7.6") // trial fails and re-opens the circuit
+	ips <- net.ParseIP("9.8.7.6") // skipped
+	ips <- net.ParseIP("1.2.3.4") // unchanged
+	clock = clock.Add(time.Minute)
+	ips <- net.ParseIP("9.8.7.6") // trial succeeds and closes the circuit
+	ips <- net.ParseIP("9.8.7.6") // unchanged
+	cancel()
+	<-done
+
+	client.AssertNumberOfCalls(t, "UpdateAliasWithContext", 4)
+	client.AssertExpectations(t)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	assert.Equal(t, 3, bytes.Count(logs.Bytes(), []byte("IP address change not updated while circuit breaker is open")))
+	assert.Equal(t, 2, bytes.Count(logs.Bytes(), []byte("Circuit breaker opened after failed DNS updates")))
+	assert.Equal(t, 1, bytes.Count(logs.Bytes(), []byte("Circuit breaker closed after successful DNS update")))
+}
@@ -0,0 +1,60 @@
+// Package dryrun provides an agent.Client that makes no API requests, which allows the behavior of an agent to be
+// verified without changing any DNS records.
+package dryrun
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+)
+
+// DefaultIP is the IP address reported by a Client created without one. It belongs to a range reserved for
+// documentation (RFC 5737), so it never refers to a real host.
+var DefaultIP = net.IPv4(192, 0, 2, 1)
+
+var _ agent.Client = (*Client)(nil)
+
+// Client satisfies the agent.Client interface without making any API requests. Instead, each operation is logged
+// (at INFO level, with a dry_run=true field) and reports a fixed IP address.
+type Client struct {
+	logger log.Logger
+	ip     net.IP
+}
+
+// NewClient returns a pointer to a new Client that logs operations to logger and reports ip as the apparent
+// IP address (and DNS alias). When ip is nil, DefaultIP is reported.
+func NewClient(logger log.Logger, ip net.IP) *Client {
+	if ip == nil {
+		ip = DefaultIP
+	}
+	return &Client{logger: logger, ip: ip}
+}
+
+// MyIPWithContext logs that the apparent IP address would be requested, and returns the fixed IP address.
+func (c *Client) MyIPWithContext(ctx context.Context) (net.IP, error) {
+	return c.skip(ctx, "my-ip")
+}
+
+// UpdateAliasWithContext logs that a DNS alias update would be requested, and returns the fixed IP address.
+func (c *Client) UpdateAliasWithContext(ctx context.Context) (net.IP, error) {
+	return c.skip(ctx, "update-alias")
+}
+
+// GetCurrentAliasWithContext logs that the current DNS alias would be requested, and returns the fixed IP address.
+func (c *Client) GetCurrentAliasWithContext(ctx context.Context) (net.IP, error) {
+	return c.skip(ctx, "current-alias")
+}
+
+// skip logs that the API operation op was skipped, and returns a copy of the fixed IP address.
+// Like a real API request, skip fails when ctx is already done.
+func (c *Client) skip(ctx context.Context, op string) (net.IP, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	level.Info(c.logger).Log("msg", "Skipping API operation", "dry_run", "true", "op", op, "ip", c.ip.String())
+	return append(net.IP(nil), c.ip...), nil
+}
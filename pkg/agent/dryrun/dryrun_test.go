@@ -0,0 +1,63 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	for _, tt := range []struct {
+		op   string
+		call func(c *Client, ctx context.Context) (net.IP, error)
+	}{
+		{"my-ip", (*Client).MyIPWithContext},
+		{"update-alias", (*Client).UpdateAliasWithContext},
+		{"current-alias", (*Client).GetCurrentAliasWithContext},
+	} {
+		t.Run(tt.op, func(t *testing.T) {
+			logWriter := new(bytes.Buffer)
+			c := NewClient(log.NewJSONLogger(logWriter), nil)
+
+			ip, err := tt.call(c, context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "192.0.2.1", ip.String())
+
+			logData := map[string]string{}
+			require.NoError(t, json.Unmarshal(logWriter.Bytes(), &logData))
+			assert.Equal(t, map[string]string{
+				"level": "info", "msg": "Skipping API operation", "dry_run": "true", "op": tt.op, "ip": "192.0.2.1",
+			}, logData)
+
+			t.Run("cancelled context", func(t *testing.T) {
+				logWriter.Reset()
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				ip, err := tt.call(c, ctx)
+				assert.Nil(t, ip)
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.Empty(t, strings.TrimSpace(logWriter.String()))
+			})
+		})
+	}
+}
+
+func TestClientWithIP(t *testing.T) {
+	c := NewClient(log.NewNopLogger(), net.ParseIP("2001:db8::1"))
+	ip, err := c.UpdateAliasWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ip.String())
+
+	// Modifying a returned IP address must not affect later results
+	ip[0] = 0
+	ip, err = c.MyIPWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ip.String())
+}
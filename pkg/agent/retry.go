@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// RetryPolicy configures how failed DNS alias update requests are retried before the agent gives up on an
+// update cycle. Delays between attempts grow exponentially from BaseDelay by Multiplier, are capped at MaxDelay,
+// and are randomized by up to Jitter (a fraction of the computed delay) to avoid synchronized retries.
+// The zero value makes exactly one attempt (i.e. no retries).
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made per update cycle. Values less than 1 are treated as 1.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// Multiplier is the factor by which the delay grows after each retry. Values less than 1 are treated as 1.
+	Multiplier float64
+	// MaxDelay caps the delay between attempts. A value of 0 means the delay is not capped.
+	MaxDelay time.Duration
+	// Jitter is the fraction (between 0 and 1) of each delay that may be randomly subtracted from it.
+	Jitter float64
+}
+
+// attempts returns the effective maximum number of attempts for the RetryPolicy.
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Delay returns the amount of time to wait after the given (1-indexed) failed attempt before retrying.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// pollBackoff tracks consecutive poll failures in order to delay subsequent polls exponentially
+// (see RunOptions.BackoffOnPollError).
+type pollBackoff struct {
+	enabled  bool
+	maxDelay time.Duration
+	failures int
+}
+
+// delay returns the amount of time to wait before the next poll, given the regular poll interval.
+// When backoff is disabled or the previous poll succeeded, the delay is the poll interval. Otherwise, it doubles
+// with each consecutive failure (starting from the poll interval) up to maxDelay, but is never less than interval.
+func (b pollBackoff) delay(interval time.Duration) time.Duration {
+	if !b.enabled || b.failures < 1 {
+		return interval
+	}
+	return max(RetryPolicy{BaseDelay: interval, Multiplier: 2, MaxDelay: b.maxDelay}.Delay(b.failures), interval)
+}
+
+// updateAliasWithRetry requests the Client to update DNS records, retrying failed requests according to the given
+// RetryPolicy. Retries stop early when the provided Context is done.
+// It returns the updated IP address or the error from the final attempt.
+func updateAliasWithRetry(ctx context.Context, logger log.Logger, client Client, policy RetryPolicy) (
+	ip net.IP, err error) {
+	maxAttempts := policy.attempts()
+	for attempt := 1; ; attempt++ {
+		if ip, err = client.UpdateAliasWithContext(ctx); err == nil {
+			return
+		}
+		level.Error(logger).Log("msg", "Error updating DNS alias", "error", err,
+			"attempt", fmt.Sprintf("%d/%d", attempt, maxAttempts))
+		if attempt >= maxAttempts {
+			return
+		}
+
+		delay := policy.Delay(attempt)
+		level.Debug(logger).Log("msg", "Retrying DNS alias update after delay", "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
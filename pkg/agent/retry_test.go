@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk/sdktest"
+)
+
+func TestPollBackoffDelay(t *testing.T) {
+	const interval = time.Minute
+	for _, tt := range []struct {
+		name     string
+		backoff  pollBackoff
+		expected []time.Duration // indexed by the number of consecutive failures
+	}{
+		{
+			"disabled",
+			pollBackoff{maxDelay: time.Hour},
+			[]time.Duration{interval, interval, interval, interval},
+		},
+		{
+			"exponential growth",
+			pollBackoff{enabled: true, maxDelay: time.Hour},
+			[]time.Duration{interval, interval, 2 * interval, 4 * interval, 8 * interval},
+		},
+		{
+			"capped by max delay",
+			pollBackoff{enabled: true, maxDelay: 5 * time.Minute},
+			[]time.Duration{interval, interval, 2 * interval, 4 * interval, 5 * time.Minute, 5 * time.Minute},
+		},
+		{
+			"never less than interval",
+			pollBackoff{enabled: true, maxDelay: time.Second},
+			[]time.Duration{interval, interval, interval, interval},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for failures, expected := range tt.expected {
+				tt.backoff.failures = failures
+				assert.Equal(t, expected, tt.backoff.delay(interval), "unexpected delay after %d failures", failures)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		policy   RetryPolicy
+		expected []time.Duration
+	}{
+		{
+			"zero value",
+			RetryPolicy{},
+			[]time.Duration{0, 0, 0},
+		},
+		{
+			"exponential growth",
+			RetryPolicy{BaseDelay: time.Second, Multiplier: 2},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			"capped by max delay",
+			RetryPolicy{BaseDelay: time.Second, Multiplier: 3, MaxDelay: 5 * time.Second},
+			[]time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			"multiplier below 1 is constant",
+			RetryPolicy{BaseDelay: time.Second, Multiplier: 0.5},
+			[]time.Duration{time.Second, time.Second, time.Second},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected, tt.policy.Delay(i+1), "unexpected delay for attempt %d", i+1)
+			}
+		})
+	}
+
+	t.Run("jitter", func(t *testing.T) {
+		policy := RetryPolicy{BaseDelay: time.Second, Multiplier: 2, Jitter: 0.5}
+		for attempt := 1; attempt <= 4; attempt++ {
+			unjittered := RetryPolicy{BaseDelay: policy.BaseDelay, Multiplier: policy.Multiplier}.Delay(attempt)
+			for i := 0; i < 100; i++ {
+				delay := policy.Delay(attempt)
+				assert.LessOrEqual(t, delay, unjittered)
+				assert.GreaterOrEqual(t, delay, unjittered/2)
+			}
+		}
+	})
+}
+
+func TestUpdateAliasWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Multiplier: 2, Jitter: 0.1}
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Times(3)
+
+		ip, err := updateAliasWithRetry(context.Background(), log.NewNopLogger(), client, policy)
+		assert.EqualError(t, err, "alias update error")
+		assert.Nil(t, ip)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("succeeds after two failures", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Twice()
+		client.On("UpdateAliasWithContext").Return(net.ParseIP("1.2.3.4"), nil).Once()
+
+		ip, err := updateAliasWithRetry(context.Background(), log.NewNopLogger(), client, policy)
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		client.AssertExpectations(t)
+	})
+
+	t.Run("zero value policy makes a single attempt", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Once()
+
+		_, err := updateAliasWithRetry(context.Background(), log.NewNopLogger(), client, RetryPolicy{})
+		assert.EqualError(t, err, "alias update error")
+		client.AssertExpectations(t)
+	})
+
+	t.Run("stops retrying when context is done", func(t *testing.T) {
+		client := &sdktest.MockClient{}
+		client.On("UpdateAliasWithContext").Return(nil, fmt.Errorf("alias update error")).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := updateAliasWithRetry(ctx, log.NewNopLogger(), client,
+			RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour})
+		assert.EqualError(t, err, "alias update error")
+		client.AssertExpectations(t)
+	})
+}
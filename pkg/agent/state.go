@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/TylerHendrickson/mydyndns/internal"
+)
+
+// State describes the state of a running agent.
+type State struct {
+	// CurrentIP is the IP address most recently set as the DNS alias.
+	CurrentIP net.IP
+	// LastPollTime is when the apparent IP address was most recently polled (regardless of the outcome).
+	LastPollTime time.Time
+	// LastUpdateTime is when DNS records were most recently updated successfully.
+	LastUpdateTime time.Time
+	// UpdateCount is the number of successful DNS updates, including the initial update.
+	UpdateCount int64
+	// ErrorCount is the number of failed polls and failed DNS update cycles.
+	ErrorCount int64
+	// RecentIPs are the apparent IP addresses most recently retrieved by successful polls, ordered from oldest
+	// to most recent. It is empty unless a history size is configured (see RunOptions.HistorySize).
+	RecentIPs []net.IP
+}
+
+// A StateTracker records the State of a running agent, which can be queried at any time with StateSnapshot.
+// It satisfies the MetricsHandler interface, and is safe for concurrent use. The zero value is ready to use.
+type StateTracker struct {
+	mu    sync.Mutex
+	state State
+	now   func() time.Time
+}
+
+// StateSnapshot returns a copy of the current State.
+func (t *StateTracker) StateSnapshot() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snapshot()
+}
+
+// snapshot returns a copy of the current State. The caller must hold t.mu.
+func (t *StateTracker) snapshot() State {
+	s := t.state
+	if s.CurrentIP != nil {
+		s.CurrentIP = append(net.IP(nil), s.CurrentIP...)
+	}
+	if len(s.RecentIPs) > 0 {
+		s.RecentIPs = make([]net.IP, len(t.state.RecentIPs))
+		for i, ip := range t.state.RecentIPs {
+			s.RecentIPs[i] = append(net.IP(nil), ip...)
+		}
+	}
+	return s
+}
+
+// ObservePoll records the outcome of an apparent IP address poll.
+func (t *StateTracker) ObservePoll(d time.Duration, ip net.IP, err error) {
+	stateRecorder{tracker: t}.ObservePoll(d, ip, err)
+}
+
+// ObserveUpdate records the outcome of a DNS update cycle. When err is nil, ip is recorded as the CurrentIP.
+func (t *StateTracker) ObserveUpdate(ip net.IP, err error) {
+	stateRecorder{tracker: t}.ObserveUpdate(ip, err)
+}
+
+// stateRecorder is a MetricsHandler that records observations to a StateTracker on behalf of a single agent run,
+// so that the history and handlers configured for the run are not registered with the StateTracker itself.
+type stateRecorder struct {
+	tracker *StateTracker
+	// history records recently polled IP addresses as the State.RecentIPs; when nil, no history is recorded
+	history *internal.RingBuffer[net.IP]
+	// handlers are pushed a snapshot of the State after each observation
+	handlers []func(State)
+}
+
+// newStateRecorder returns a stateRecorder for t that records up to historySize recently polled IP addresses
+// (starting from the RecentIPs already recorded by t), and pushes a snapshot of the State to each of the handlers.
+func newStateRecorder(t *StateTracker, historySize int, handlers []func(State)) stateRecorder {
+	r := stateRecorder{tracker: t, handlers: handlers}
+	if historySize > 0 {
+		r.history = internal.NewRingBuffer[net.IP](historySize)
+		for _, ip := range t.StateSnapshot().RecentIPs {
+			r.history.Push(ip)
+		}
+	}
+	return r
+}
+
+// ObservePoll records the outcome of an apparent IP address poll.
+// When err is nil and history is being recorded, ip is added to the RecentIPs.
+func (r stateRecorder) ObservePoll(_ time.Duration, ip net.IP, err error) {
+	r.update(func(s *State, now time.Time) {
+		s.LastPollTime = now
+		if err != nil {
+			s.ErrorCount++
+		} else if r.history != nil {
+			r.history.Push(ip)
+			s.RecentIPs = r.history.Slice()
+		}
+	})
+}
+
+// ObserveUpdate records the outcome of a DNS update cycle. When err is nil, ip is recorded as the CurrentIP.
+func (r stateRecorder) ObserveUpdate(ip net.IP, err error) {
+	r.update(func(s *State, now time.Time) {
+		if err != nil {
+			s.ErrorCount++
+			return
+		}
+		s.CurrentIP = ip
+		s.LastUpdateTime = now
+		s.UpdateCount++
+	})
+}
+
+// update applies fn to the State tracked by r.tracker and pushes a snapshot of the resulting State to each handler.
+// Handlers are called while the StateTracker is locked, so that snapshots are received in the order in which
+// they were recorded.
+func (r stateRecorder) update(fn func(s *State, now time.Time)) {
+	t := r.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+	fn(&t.state, now())
+	for _, h := range r.handlers {
+		h(t.snapshot())
+	}
+}
+
+// multiMetricsHandler is a MetricsHandler that forwards observations to each of its members.
+type multiMetricsHandler []MetricsHandler
+
+func (m multiMetricsHandler) ObservePoll(d time.Duration, ip net.IP, err error) {
+	for _, h := range m {
+		h.ObservePoll(d, ip, err)
+	}
+}
+
+func (m multiMetricsHandler) ObserveUpdate(ip net.IP, err error) {
+	for _, h := range m {
+		h.ObserveUpdate(ip, err)
+	}
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateTracker(t *testing.T) {
+	start := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock := start
+	var pushed []State
+	tracker := &StateTracker{
+		now: func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		},
+	}
+	assert.Equal(t, State{}, tracker.StateSnapshot(), "zero value should have an empty State")
+	recorder := newStateRecorder(tracker, 0, []func(State){func(s State) { pushed = append(pushed, s) }})
+
+	recorder.ObserveUpdate(net.ParseIP("1.2.3.4"), nil)
+	tracker.ObservePoll(time.Millisecond, net.ParseIP("1.2.3.4"), nil)
+	recorder.ObservePoll(time.Millisecond, net.ParseIP("1.2.3.4"), nil)
+	recorder.ObservePoll(time.Millisecond, nil, fmt.Errorf("poll error"))
+	recorder.ObserveUpdate(nil, fmt.Errorf("update error"))
+	recorder.ObservePoll(time.Millisecond, net.ParseIP("9.8.7.6"), nil)
+	recorder.ObserveUpdate(net.ParseIP("9.8.7.6"), nil)
+
+	expected := []State{
+		{CurrentIP: net.ParseIP("1.2.3.4"), LastUpdateTime: start.Add(time.Second * 1), UpdateCount: 1},
+		{
+			CurrentIP:      net.ParseIP("1.2.3.4"),
+			LastPollTime:   start.Add(time.Second * 3),
+			LastUpdateTime: start.Add(time.Second * 1),
+			UpdateCount:    1,
+		},
+		{
+			CurrentIP:      net.ParseIP("1.2.3.4"),
+			LastPollTime:   start.Add(time.Second * 4),
+			LastUpdateTime: start.Add(time.Second * 1),
+			UpdateCount:    1,
+			ErrorCount:     1,
+		},
+		{
+			CurrentIP:      net.ParseIP("1.2.3.4"),
+			LastPollTime:   start.Add(time.Second * 4),
+			LastUpdateTime: start.Add(time.Second * 1),
+			UpdateCount:    1,
+			ErrorCount:     2,
+		},
+		{
+			CurrentIP:      net.ParseIP("1.2.3.4"),
+			LastPollTime:   start.Add(time.Second * 6),
+			LastUpdateTime: start.Add(time.Second * 1),
+			UpdateCount:    1,
+			ErrorCount:     2,
+		},
+		{
+			CurrentIP:      net.ParseIP("9.8.7.6"),
+			LastPollTime:   start.Add(time.Second * 6),
+			LastUpdateTime: start.Add(time.Second * 7),
+			UpdateCount:    2,
+			ErrorCount:     2,
+		},
+	}
+	assert.Equal(t, expected, pushed, "observations made directly to the tracker should not be pushed")
+	assert.Equal(t, expected[len(expected)-1], tracker.StateSnapshot())
+}
+
+func TestStateTrackerSnapshotIsolation(t *testing.T) {
+	tracker := &StateTracker{}
+	tracker.ObserveUpdate(net.ParseIP("1.2.3.4"), nil)
+
+	snapshot := tracker.StateSnapshot()
+	require.NotNil(t, snapshot.CurrentIP)
+	snapshot.CurrentIP[len(snapshot.CurrentIP)-1] = 0
+	snapshot.UpdateCount = 100
+	assert.Equal(t, "1.2.3.4", tracker.StateSnapshot().CurrentIP.String(),
+		"modifying a snapshot should not modify tracked State")
+	assert.Equal(t, int64(1), tracker.StateSnapshot().UpdateCount)
+}
+
+func TestStateTrackerHistory(t *testing.T) {
+	tracker := &StateTracker{}
+	recorder := newStateRecorder(tracker, 2, nil)
+	assert.Empty(t, tracker.StateSnapshot().RecentIPs)
+
+	recorder.ObservePoll(time.Millisecond, net.ParseIP("1.2.3.4"), nil)
+	recorder.ObservePoll(time.Millisecond, nil, fmt.Errorf("poll error"))
+	recorder.ObserveUpdate(net.ParseIP("5.6.7.8"), nil)
+	assert.Equal(t, []net.IP{net.ParseIP("1.2.3.4")}, tracker.StateSnapshot().RecentIPs,
+		"only successfully polled IP addresses should be recorded")
+
+	tracker.ObservePoll(time.Millisecond, net.ParseIP("2.3.4.5"), nil)
+	assert.Equal(t, []net.IP{net.ParseIP("1.2.3.4")}, tracker.StateSnapshot().RecentIPs,
+		"the tracker should not record history by itself")
+
+	recorder.ObservePoll(time.Millisecond, net.ParseIP("9.8.7.6"), nil)
+	recorder.ObservePoll(time.Millisecond, net.ParseIP("9.8.7.6"), nil)
+	snapshot := tracker.StateSnapshot()
+	assert.Equal(t, []net.IP{net.ParseIP("9.8.7.6"), net.ParseIP("9.8.7.6")}, snapshot.RecentIPs,
+		"only the most recent IP addresses should be recorded")
+
+	snapshot.RecentIPs[0][len(snapshot.RecentIPs[0])-1] = 0
+	assert.Equal(t, "9.8.7.6", tracker.StateSnapshot().RecentIPs[0].String(),
+		"modifying a snapshot should not affect the tracked State")
+
+	t.Run("continues from recorded history", func(t *testing.T) {
+		next := newStateRecorder(tracker, 3, nil)
+		next.ObservePoll(time.Millisecond, net.ParseIP("1.1.1.1"), nil)
+		assert.Equal(t, []net.IP{net.ParseIP("9.8.7.6"), net.ParseIP("9.8.7.6"), net.ParseIP("1.1.1.1")},
+			tracker.StateSnapshot().RecentIPs)
+	})
+}
@@ -0,0 +1,118 @@
+// Package health provides HTTP liveness and readiness endpoints for the MyDynDNS agent, which are suitable for use
+// by container orchestrator probes (e.g. Kubernetes). A Checker reports health according to snapshots of the
+// agent.State of a running agent.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+)
+
+const (
+	shutdownTimeout = time.Second * 5
+	statusOK        = "ok"
+	statusStale     = "stale"
+	statusReady     = "ready"
+	statusNotReady  = "not ready"
+)
+
+// Response is the JSON-encoded body of responses from the health endpoints.
+type Response struct {
+	Status     string `json:"status"`
+	LastPollTS string `json:"last_poll_ts,omitempty"`
+	CurrentIP  string `json:"current_ip,omitempty"`
+	// RecentIPs are the most recently polled IP addresses (oldest first), when the agent records them
+	// (see agent.RunOptions.HistorySize).
+	RecentIPs []string `json:"recent_ips,omitempty"`
+}
+
+// Checker serves health endpoints for a running agent, whose State is retrieved with a snapshot function
+// (e.g. agent.StateTracker.StateSnapshot).
+type Checker struct {
+	snapshot   func() agent.State
+	maxPollAge time.Duration
+	started    time.Time
+	now        func() time.Time
+}
+
+// New returns a pointer to a new Checker for an agent that polls for its apparent IP address at the given interval.
+// The agent is considered to be live as long as it has polled within the last two intervals (or, before its first
+// poll, within two intervals of the Checker being created).
+func New(snapshot func() agent.State, interval time.Duration) *Checker {
+	return &Checker{snapshot: snapshot, maxPollAge: 2 * interval, started: time.Now(), now: time.Now}
+}
+
+// Handler returns an http.Handler that serves the liveness endpoint at "/healthz" and the readiness endpoint
+// at "/readyz".
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", c.serveHealthz)
+	mux.HandleFunc("GET /readyz", c.serveReadyz)
+	return mux
+}
+
+// serveHealthz responds with 200 OK when the agent polled recently enough, or 503 Service Unavailable otherwise.
+func (c *Checker) serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	s := c.snapshot()
+	resp := Response{Status: statusOK}
+	if s.CurrentIP != nil {
+		resp.CurrentIP = s.CurrentIP.String()
+	}
+	for _, ip := range s.RecentIPs {
+		resp.RecentIPs = append(resp.RecentIPs, ip.String())
+	}
+
+	lastActive := c.started
+	if !s.LastPollTime.IsZero() {
+		resp.LastPollTS = s.LastPollTime.Format(time.RFC3339Nano)
+		lastActive = s.LastPollTime
+	}
+	if c.now().Sub(lastActive) > c.maxPollAge {
+		resp.Status = statusStale
+		writeResponse(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// serveReadyz responds with 200 OK once the agent completed its initial DNS update, or 503 Service Unavailable
+// until then.
+func (c *Checker) serveReadyz(w http.ResponseWriter, _ *http.Request) {
+	if s := c.snapshot(); s.UpdateCount > 0 {
+		writeResponse(w, http.StatusOK, Response{Status: statusReady, CurrentIP: s.CurrentIP.String()})
+		return
+	}
+	writeResponse(w, http.StatusServiceUnavailable, Response{Status: statusNotReady})
+}
+
+func writeResponse(w http.ResponseWriter, code int, resp Response) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Serve accepts HTTP connections on ln and serves the health endpoints until ctx is done, at which point
+// the server is gracefully shut down. Serve always returns a non-nil error, except when the server was
+// shut down due to ctx being done.
+func (c *Checker) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: c.Handler(), ReadHeaderTimeout: time.Second * 10}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdownErr
+}
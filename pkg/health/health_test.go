@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, Response) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	assert.Equal(t, "application/json", rec.Header().Get("content-type"))
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "invalid response body: %s", rec.Body)
+	return rec.Code, resp
+}
+
+func TestCheckerHealthz(t *testing.T) {
+	now := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name             string
+		started          time.Time
+		state            agent.State
+		expectedCode     int
+		expectedResponse Response
+	}{
+		{
+			"healthy",
+			now.Add(-time.Hour),
+			agent.State{CurrentIP: net.ParseIP("1.2.3.4"), LastPollTime: now.Add(-time.Minute)},
+			http.StatusOK,
+			Response{Status: "ok", LastPollTS: "2022-01-02T15:03:05Z", CurrentIP: "1.2.3.4"},
+		},
+		{
+			"healthy with recent IPs",
+			now.Add(-time.Hour),
+			agent.State{
+				CurrentIP:    net.ParseIP("9.8.7.6"),
+				LastPollTime: now.Add(-time.Minute),
+				RecentIPs:    []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("9.8.7.6")},
+			},
+			http.StatusOK,
+			Response{Status: "ok", LastPollTS: "2022-01-02T15:03:05Z", CurrentIP: "9.8.7.6",
+				RecentIPs: []string{"1.2.3.4", "9.8.7.6"}},
+		},
+		{
+			"stale last poll",
+			now.Add(-time.Hour),
+			agent.State{CurrentIP: net.ParseIP("1.2.3.4"), LastPollTime: now.Add(-3 * time.Minute)},
+			http.StatusServiceUnavailable,
+			Response{Status: "stale", LastPollTS: "2022-01-02T15:01:05Z", CurrentIP: "1.2.3.4"},
+		},
+		{
+			"recently started without polls",
+			now.Add(-time.Minute),
+			agent.State{},
+			http.StatusOK,
+			Response{Status: "ok"},
+		},
+		{
+			"long started without polls",
+			now.Add(-3 * time.Minute),
+			agent.State{CurrentIP: net.ParseIP("1.2.3.4")},
+			http.StatusServiceUnavailable,
+			Response{Status: "stale", CurrentIP: "1.2.3.4"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(func() agent.State { return tt.state }, time.Minute)
+			c.started = tt.started
+			c.now = func() time.Time { return now }
+
+			code, resp := get(t, c.Handler(), "/healthz")
+			assert.Equal(t, tt.expectedCode, code)
+			assert.Equal(t, tt.expectedResponse, resp)
+		})
+	}
+}
+
+func TestCheckerReadyz(t *testing.T) {
+	tracker := &agent.StateTracker{}
+	c := New(tracker.StateSnapshot, time.Minute)
+
+	code, resp := get(t, c.Handler(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, Response{Status: "not ready"}, resp)
+
+	tracker.ObserveUpdate(nil, fmt.Errorf("initial update failed"))
+	code, _ = get(t, c.Handler(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "failed updates should not make the agent ready")
+
+	tracker.ObserveUpdate(net.ParseIP("1.2.3.4"), nil)
+	code, resp = get(t, c.Handler(), "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Response{Status: "ready", CurrentIP: "1.2.3.4"}, resp)
+}
+
+func TestCheckerHandlerMethods(t *testing.T) {
+	c := New(func() agent.State { return agent.State{} }, time.Minute)
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestCheckerServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	c := New(func() agent.State { return agent.State{UpdateCount: 1, CurrentIP: net.ParseIP("1.2.3.4")} }, time.Hour)
+	go func() { served <- c.Serve(ctx, ln) }()
+
+	// The server waits for unused (but open) connections when shutting down, so they are closed by the client first
+	client := &http.Client{Transport: &http.Transport{}}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", ln.Addr(), path))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+	client.CloseIdleConnections()
+
+	cancel()
+	select {
+	case err := <-served:
+		assert.NoError(t, err, "expected clean shutdown after context cancellation")
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "server did not shut down after context cancellation")
+	}
+}
@@ -0,0 +1,63 @@
+// Package ipsource provides alternatives to the MyDynDNS API for detecting the apparent IP address of a host,
+// which satisfy the agent.IPSource interface.
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxResponseSize is the number of response body bytes read by HTTPIPSource, which is plenty for any textual
+// representation of an IP address (plus surrounding whitespace).
+const maxResponseSize = 64
+
+// HTTPIPSource retrieves the apparent IP address from a plain-text HTTP endpoint (such as https://api.ipify.org or
+// https://icanhazip.com) at URL, whose response body consists of nothing but the IP address.
+type HTTPIPSource struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewHTTPIPSource returns a pointer to a new HTTPIPSource that retrieves the apparent IP address from url.
+// Each retrieval fails if it does not complete within timeout.
+func NewHTTPIPSource(url string, timeout time.Duration) *HTTPIPSource {
+	return &HTTPIPSource{
+		URL:        url,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// GetIP returns the IP address in the response body from s.URL, ignoring any surrounding whitespace.
+// Any response with a non-2xx HTTP status code, or whose body is not an IP address, is considered to be a failure.
+func (s *HTTPIPSource) GetIP(ctx context.Context) (net.IP, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "text/plain")
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("IP source %s responded with unexpected status code %d (%s)",
+			s.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("IP source %s responded with an invalid IP address %q", s.URL, body)
+	}
+	return ip, nil
+}
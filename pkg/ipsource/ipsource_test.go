@@ -0,0 +1,115 @@
+package ipsource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+)
+
+// HTTPIPSource must be usable as the agent's IPSource.
+var _ agent.IPSource = (*HTTPIPSource)(nil)
+
+func TestHTTPIPSourceGetIP(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		respStatus  int
+		respBody    string
+		respDelay   time.Duration
+		expectedIP  string
+		expectedErr func(s *httptest.Server) string
+	}{
+		{
+			"IPv4 address",
+			http.StatusOK,
+			"1.2.3.4",
+			0,
+			"1.2.3.4",
+			nil,
+		},
+		{
+			"IPv6 address with trailing newline",
+			http.StatusOK,
+			"2001:db8::1\n",
+			0,
+			"2001:db8::1",
+			nil,
+		},
+		{
+			"failure on unexpected status",
+			http.StatusServiceUnavailable,
+			"1.2.3.4",
+			0,
+			"",
+			func(s *httptest.Server) string {
+				return "IP source " + s.URL + " responded with unexpected status code 503 (Service Unavailable)"
+			},
+		},
+		{
+			"failure on invalid IP address",
+			http.StatusOK,
+			"<html>not an IP</html>",
+			0,
+			"",
+			func(s *httptest.Server) string {
+				return "IP source " + s.URL + ` responded with an invalid IP address "<html>not an IP</html>"`
+			},
+		},
+		{
+			"failure on oversized response",
+			http.StatusOK,
+			strings.Repeat("1", 2*maxResponseSize),
+			0,
+			"",
+			func(s *httptest.Server) string {
+				return "IP source " + s.URL + " responded with an invalid IP address"
+			},
+		},
+		{
+			"failure on timeout",
+			http.StatusOK,
+			"1.2.3.4",
+			time.Millisecond * 200,
+			"",
+			func(*httptest.Server) string { return "Client.Timeout exceeded" },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodGet, req.Method)
+				time.Sleep(tt.respDelay)
+				resp.WriteHeader(tt.respStatus)
+				resp.Write([]byte(tt.respBody))
+			}))
+			defer server.Close()
+
+			ip, err := NewHTTPIPSource(server.URL, 100*time.Millisecond).GetIP(context.Background())
+			if tt.expectedErr != nil {
+				assert.ErrorContains(t, err, tt.expectedErr(server))
+				assert.Nil(t, ip)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedIP, ip.String())
+		})
+	}
+
+	t.Run("failure on cancelled context", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewHTTPIPSource(server.URL, time.Second).GetIP(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,105 @@
+// Package journal provides a local, append-only history of the IP address changes applied to DNS records.
+// Entries are stored as JSON lines, so that the history can be inspected with common tools as well as with Read.
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultPath is the journal file path used when no other path is configured.
+const DefaultPath = "mydyndns-history.jsonl"
+
+// Entry records a single change of IP address.
+type Entry struct {
+	Timestamp time.Time `json:"ts"`
+	FromIP    net.IP    `json:"from_ip"`
+	ToIP      net.IP    `json:"to_ip"`
+}
+
+// Journal appends Entry records to the file at Path, which is created when it does not exist.
+// A Journal is safe for concurrent use.
+type Journal struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// New returns a pointer to a new Journal that records entries to the file at path.
+func New(path string) *Journal {
+	return &Journal{Path: path}
+}
+
+// Append writes e to the end of the journal file.
+func (j *Journal) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	// Each entry is written with a single call, so that concurrent appends by other processes are not interleaved
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Notify records that the IP address changed from previous to current at ts.
+// This allows a Journal to be used as an agent.ChangeNotifier.
+func (j *Journal) Notify(_ context.Context, previous, current net.IP, ts time.Time) error {
+	return j.Append(Entry{Timestamp: ts, FromIP: previous, ToIP: current})
+}
+
+// A Filter selects the entries returned by Read.
+type Filter struct {
+	// Since excludes entries recorded before the given time (unless zero).
+	Since time.Time
+	// Limit is the maximum number of (most recent) entries to return (unless less than 1).
+	Limit int
+}
+
+// Read returns the entries recorded in the journal file at path that match the given Filter,
+// in the order they were recorded.
+func Read(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid journal entry on line %d of %s: %w", lineNo, path, err)
+		}
+		if e.Timestamp.Before(filter.Since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,122 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	j := New(path)
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	require.NoError(t, j.Append(Entry{Timestamp: ts, FromIP: net.ParseIP("1.2.3.4"), ToIP: net.ParseIP("5.6.7.8")}))
+	require.NoError(t, j.Notify(context.Background(), net.ParseIP("5.6.7.8"), net.ParseIP("::1"), ts.Add(time.Hour)))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"ts":"2022-01-02T15:04:05Z","from_ip":"1.2.3.4","to_ip":"5.6.7.8"}`+"\n"+
+			`{"ts":"2022-01-02T16:04:05Z","from_ip":"5.6.7.8","to_ip":"::1"}`+"\n",
+		string(data))
+}
+
+func TestJournalAppendConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	j := New(path)
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	const writers, entriesPerWriter = 10, 20
+	wg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < entriesPerWriter; i++ {
+				assert.NoError(t, j.Append(Entry{
+					Timestamp: ts,
+					FromIP:    net.ParseIP(fmt.Sprintf("10.0.%d.%d", w, i)),
+					ToIP:      net.ParseIP(fmt.Sprintf("10.1.%d.%d", w, i)),
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := Read(path, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, writers*entriesPerWriter)
+	seen := map[string]bool{}
+	for _, e := range entries {
+		seen[e.ToIP.String()] = true
+	}
+	assert.Len(t, seen, writers*entriesPerWriter, "every entry should be recorded exactly once")
+}
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	j := New(path)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, j.Append(Entry{
+			Timestamp: ts.Add(time.Duration(i) * time.Hour),
+			FromIP:    net.ParseIP(fmt.Sprintf("1.1.1.%d", i)),
+			ToIP:      net.ParseIP(fmt.Sprintf("1.1.1.%d", i+1)),
+		}))
+	}
+
+	toIPs := func(entries []Entry) (ips []string) {
+		for _, e := range entries {
+			ips = append(ips, e.ToIP.String())
+		}
+		return
+	}
+
+	for _, tt := range []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"all", Filter{}, []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"}},
+		{"limit", Filter{Limit: 2}, []string{"1.1.1.4", "1.1.1.5"}},
+		{"limit exceeds entries", Filter{Limit: 10}, []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"}},
+		{"since", Filter{Since: ts.Add(3 * time.Hour)}, []string{"1.1.1.4", "1.1.1.5"}},
+		{"since and limit", Filter{Since: ts.Add(time.Hour), Limit: 1}, []string{"1.1.1.5"}},
+		{"since excludes all", Filter{Since: ts.Add(24 * time.Hour)}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Read(path, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, toIPs(entries))
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{})
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid entry", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join([]string{
+			`{"ts":"2022-01-02T15:04:05Z","from_ip":"1.2.3.4","to_ip":"5.6.7.8"}`,
+			"",
+			"not json",
+		}, "\n")), 0o644))
+		_, err := Read(path, Filter{})
+		assert.ErrorContains(t, err, fmt.Sprintf("invalid journal entry on line 3 of %s", path))
+	})
+}
@@ -0,0 +1,127 @@
+// Package metrics provides Prometheus instrumentation for the MyDynDNS agent.
+// A Metrics value records observations reported by a running agent and exposes them for scraping
+// at the "/metrics" path of an HTTP server.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace       = "mydyndns"
+	shutdownTimeout = time.Second * 5
+	statusOK        = "ok"
+	statusError     = "error"
+)
+
+// Metrics collects operational metrics for the MyDynDNS agent.
+// It satisfies the agent.MetricsHandler interface and is safe for concurrent use.
+type Metrics struct {
+	registry     *prometheus.Registry
+	polls        *prometheus.CounterVec
+	updates      *prometheus.CounterVec
+	currentIP    prometheus.Gauge
+	pollDuration prometheus.Histogram
+}
+
+// New returns a pointer to a new Metrics with all collectors registered to an isolated registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		polls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "polls_total",
+			Help:      "Total number of apparent IP address polls, partitioned by status.",
+		}, []string{"status"}),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Total number of DNS alias updates, partitioned by status.",
+		}, []string{"status"}),
+		currentIP: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "current_ip",
+			Help:      "Numeric representation of the IP address most recently set as the DNS alias.",
+		}),
+		pollDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "poll_duration_seconds",
+			Help:      "Duration of apparent IP address polls.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+
+	// Initialize every status label so that series are present before the first observation
+	for _, status := range []string{statusOK, statusError} {
+		m.polls.WithLabelValues(status)
+		m.updates.WithLabelValues(status)
+	}
+	m.registry.MustRegister(m.polls, m.updates, m.currentIP, m.pollDuration)
+	return m
+}
+
+func status(err error) string {
+	if err != nil {
+		return statusError
+	}
+	return statusOK
+}
+
+// ObservePoll records the outcome of an apparent IP address poll that took d to complete.
+func (m *Metrics) ObservePoll(d time.Duration, _ net.IP, err error) {
+	m.polls.WithLabelValues(status(err)).Inc()
+	m.pollDuration.Observe(d.Seconds())
+}
+
+// ObserveUpdate records the outcome of a DNS alias update. When err is nil, ip is recorded as the current IP.
+func (m *Metrics) ObserveUpdate(ip net.IP, err error) {
+	m.updates.WithLabelValues(status(err)).Inc()
+	if err == nil {
+		m.currentIP.Set(ipToFloat(ip))
+	}
+}
+
+// ipToFloat returns the numeric representation of ip. IPv4 addresses are represented exactly;
+// IPv6 addresses exceed the precision of a float64, so their representation is approximate.
+func ipToFloat(ip net.IP) float64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	f, _ := new(big.Float).SetInt(new(big.Int).SetBytes(ip)).Float64()
+	return f
+}
+
+// Handler returns an http.Handler that serves the collected metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve accepts HTTP connections on ln and serves the collected metrics at "/metrics" until ctx is done,
+// at which point the server is gracefully shut down. Serve always returns a non-nil error, except when
+// the server was shut down due to ctx being done.
+func (m *Metrics) Serve(ctx context.Context, ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: time.Second * 10}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdownErr
+}
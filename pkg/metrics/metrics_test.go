@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsObservations(t *testing.T) {
+	m := New()
+	m.ObservePoll(time.Millisecond*250, net.ParseIP("1.2.3.4"), nil)
+	m.ObservePoll(time.Second*2, nil, fmt.Errorf("poll error"))
+	m.ObservePoll(time.Millisecond*500, net.ParseIP("1.2.3.4"), nil)
+	m.ObserveUpdate(net.ParseIP("1.2.3.4"), nil)
+	m.ObserveUpdate(nil, fmt.Errorf("update error"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.polls.WithLabelValues("ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.polls.WithLabelValues("error")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.updates.WithLabelValues("ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.updates.WithLabelValues("error")))
+	assert.Equal(t, float64(0x01020304), testutil.ToFloat64(m.currentIP),
+		"failed update should not change the current IP")
+	assert.Equal(t, 1, testutil.CollectAndCount(m.pollDuration))
+}
+
+func TestIPToFloat(t *testing.T) {
+	for _, tt := range []struct {
+		ip       string
+		expected float64
+	}{
+		{"0.0.0.0", 0},
+		{"1.2.3.4", 16909060},
+		{"255.255.255.255", 4294967295},
+		{"::ffff:1.2.3.4", 16909060},
+		{"::1", 1},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ipToFloat(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := New()
+	m.ObserveUpdate(net.ParseIP("1.2.3.4"), nil)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`mydyndns_polls_total{status="ok"} 0`,
+		`mydyndns_polls_total{status="error"} 0`,
+		`mydyndns_updates_total{status="ok"} 1`,
+		`mydyndns_updates_total{status="error"} 0`,
+		`mydyndns_current_ip 1.690906e+07`,
+		`mydyndns_poll_duration_seconds_count 0`,
+	} {
+		assert.Contains(t, body, expected)
+	}
+}
+
+func TestMetricsServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- New().Serve(ctx, ln) }()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", ln.Addr()))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "mydyndns_polls_total")
+
+	cancel()
+	select {
+	case err := <-served:
+		assert.NoError(t, err, "expected clean shutdown after context cancellation")
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "server did not shut down after context cancellation")
+	}
+}
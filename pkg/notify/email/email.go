@@ -0,0 +1,123 @@
+// Package email provides notifications about the mydyndns agent (e.g. IP address changes) by way of email
+// delivered to an SMTP server.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Notifier delivers notifications about the agent as plain-text emails sent from From to To, by way of the
+// SMTP server at Host:Port. It implements the agent.ChangeHandler interface.
+type Notifier struct {
+	Host string
+	Port int
+	From string
+	To   string
+	// Password authenticates From with the SMTP server (using the PLAIN mechanism, which requires TLS unless the
+	// server is on localhost). When empty, no authentication is attempted.
+	Password string
+	// Timeout limits the amount of time allowed to deliver each email. A value of 0 means deliveries are not
+	// limited by the Notifier.
+	Timeout time.Duration
+}
+
+// NewNotifier returns a pointer to a new Notifier that sends emails from from to to by way of the SMTP server
+// at host:port, authenticating with password (when not empty).
+// Each delivery attempt fails if it does not complete within timeout.
+func NewNotifier(host string, port int, from, password, to string, timeout time.Duration) *Notifier {
+	return &Notifier{Host: host, Port: port, From: from, To: to, Password: password, Timeout: timeout}
+}
+
+// OnChange sends an email reporting that DNS records were updated from the from IP address to the to IP address
+// at ts.
+func (n *Notifier) OnChange(ctx context.Context, from, to net.IP, ts time.Time) error {
+	return n.Send(ctx, fmt.Sprintf("mydyndns: IP address changed to %s", to),
+		fmt.Sprintf("The mydyndns agent updated DNS records from %s to %s at %s.", from, to, ts.Format(time.RFC3339)))
+}
+
+// NotifyStarted sends an email reporting that the agent started with the IP address ip at ts.
+func (n *Notifier) NotifyStarted(ctx context.Context, ip net.IP, ts time.Time) error {
+	return n.Send(ctx, "mydyndns: agent started",
+		fmt.Sprintf("The mydyndns agent started with IP address %s at %s.", ip, ts.Format(time.RFC3339)))
+}
+
+// NotifyStopped sends an email reporting that the agent stopped at ts.
+func (n *Notifier) NotifyStopped(ctx context.Context, ts time.Time) error {
+	return n.Send(ctx, "mydyndns: agent stopped",
+		fmt.Sprintf("The mydyndns agent stopped at %s.", ts.Format(time.RFC3339)))
+}
+
+// Send delivers a plain-text email with the given subject and body. The connection to the SMTP server is upgraded
+// with STARTTLS whenever the server supports it.
+func (n *Notifier) Send(ctx context.Context, subject, body string) error {
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Password != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.From, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(n.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(subject, body, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message returns the RFC 5322 message with the given subject and body, dated ts.
+func (n *Notifier) message(subject, body string, ts time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", ts.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,167 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSession records what a client sent to a bare SMTP server during a single session.
+type smtpSession struct {
+	commands []string
+	auth     string
+	data     string
+}
+
+// newSMTPServer starts a bare SMTP server, which accepts a single session and then sends its record to the
+// returned channel. It returns the host and port on which the server listens.
+func newSMTPServer(t *testing.T) (string, int, <-chan smtpSession) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var s smtpSession
+		defer func() { sessions <- s }()
+
+		r := bufio.NewReader(conn)
+		reply := func(lines ...string) { conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n")) }
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd, arg, _ := strings.Cut(line, " ")
+			s.commands = append(s.commands, strings.ToUpper(cmd))
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				reply("250-localhost", "250 AUTH PLAIN")
+			case "AUTH":
+				s.auth = arg
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL", "RCPT":
+				s.commands[len(s.commands)-1] = line
+				reply("250 2.1.0 OK")
+			case "DATA":
+				reply("354 Start mail input; end with <CRLF>.<CRLF>")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				s.data = data.String()
+				reply("250 2.0.0 OK")
+			case "QUIT":
+				reply("221 2.0.0 Bye")
+				return
+			default:
+				reply("502 5.5.2 Command not recognized")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return host, portNum, sessions
+}
+
+func TestNotifier(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name            string
+		send            func(n *Notifier) error
+		expectedSubject string
+		expectedBody    string
+	}{
+		{
+			"change",
+			func(n *Notifier) error {
+				return n.OnChange(context.Background(), net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8"), ts)
+			},
+			"mydyndns: IP address changed to 5.6.7.8",
+			"The mydyndns agent updated DNS records from 1.2.3.4 to 5.6.7.8 at 2022-01-02T15:04:05Z.",
+		},
+		{
+			"started",
+			func(n *Notifier) error { return n.NotifyStarted(context.Background(), net.ParseIP("1.2.3.4"), ts) },
+			"mydyndns: agent started",
+			"The mydyndns agent started with IP address 1.2.3.4 at 2022-01-02T15:04:05Z.",
+		},
+		{
+			"stopped",
+			func(n *Notifier) error { return n.NotifyStopped(context.Background(), ts) },
+			"mydyndns: agent stopped",
+			"The mydyndns agent stopped at 2022-01-02T15:04:05Z.",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, sessions := newSMTPServer(t)
+			n := NewNotifier(host, port, "agent@example.com", "", "admin@example.com", time.Second)
+			require.NoError(t, tt.send(n))
+
+			s := <-sessions
+			assert.Equal(t, []string{"EHLO", "MAIL FROM:<agent@example.com>", "RCPT TO:<admin@example.com>",
+				"DATA", "QUIT"}, s.commands)
+			assert.Empty(t, s.auth, "no authentication should be attempted without a password")
+
+			headers, body, found := strings.Cut(s.data, "\r\n\r\n")
+			require.True(t, found, "message has no header/body separator: %q", s.data)
+			assert.Contains(t, headers, "From: agent@example.com\r\n")
+			assert.Contains(t, headers, "To: admin@example.com\r\n")
+			assert.Contains(t, headers, "Subject: "+tt.expectedSubject+"\r\n")
+			assert.Contains(t, headers, "Content-Type: text/plain; charset=utf-8")
+			assert.Regexp(t, `(?m)^Date: .+\r$`, headers)
+			assert.Equal(t, tt.expectedBody+"\r\n", body)
+		})
+	}
+
+	t.Run("with password", func(t *testing.T) {
+		host, port, sessions := newSMTPServer(t)
+		n := NewNotifier(host, port, "agent@example.com", "hunter2", "admin@example.com", time.Second)
+		require.NoError(t, n.NotifyStopped(context.Background(), ts))
+
+		s := <-sessions
+		assert.Equal(t, "AUTH", s.commands[1])
+		mechanism, credentials, _ := strings.Cut(s.auth, " ")
+		assert.Equal(t, "PLAIN", mechanism)
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		require.NoError(t, err)
+		assert.Equal(t, "\x00agent@example.com\x00hunter2", string(decoded))
+	})
+
+	t.Run("unreachable server", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		n := NewNotifier("127.0.0.1", port, "agent@example.com", "", "admin@example.com", time.Second)
+		assert.ErrorContains(t, n.NotifyStopped(context.Background(), ts), "connection refused")
+	})
+}
@@ -3,31 +3,345 @@ package sdk
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/TylerHendrickson/mydyndns/internal/ratelimit"
 )
 
-// maxIPStrLen defines the maximum amount of characters in a valid IP (v6) address.
-const maxIPStrLen = 48
+const (
+	// maxIPStrLen defines the maximum amount of characters in a valid IP (v6) address.
+	maxIPStrLen = 48
+	// defaultRequestTimeout is the RequestTimeout used by a Client when not otherwise configured.
+	defaultRequestTimeout = time.Second * 30
+	// DefaultPingPath is the path (relative to BaseURL) requested by PingWithContext when PingPath is empty.
+	DefaultPingPath = "health"
+)
 
 // Client is an SDK for the MyDynDNS API.
 type Client struct {
 	BaseURL    string
 	apiKey     string
 	HTTPClient *http.Client
+	// CheckBaseURL is the base URL used for requests that only detect the apparent IP address (i.e. MyIP),
+	// which allows IP detection to be served by a different (e.g. read-only) endpoint than DNS alias updates.
+	// When empty, BaseURL is used for all requests.
+	CheckBaseURL string
+	// RequestTimeout limits the amount of time allowed for each API request (in addition to any deadline
+	// on the Context provided for the request). A value of 0 means requests are not limited by the Client.
+	RequestTimeout time.Duration
+	// MyIPTimeout limits the amount of time allowed for each MyIP request in place of RequestTimeout
+	// (e.g. so that a slow read does not delay the agent as long as a mutation is allowed to).
+	// A value of 0 means RequestTimeout applies.
+	MyIPTimeout time.Duration
+	// UpdateAliasTimeout limits the amount of time allowed for each UpdateAlias request in place of RequestTimeout.
+	// A value of 0 means RequestTimeout applies.
+	UpdateAliasTimeout time.Duration
+	// PingPath is the path (relative to BaseURL) of the health check endpoint requested by PingWithContext.
+	// When empty, DefaultPingPath is used.
+	PingPath string
+	// IPFamily restricts the IP addresses accepted from the API to a single family (version).
+	// When a response contains an IP address of a different family, an UnexpectedIPFamily error is returned.
+	// The zero value (AnyIPFamily) accepts any IP address.
+	IPFamily IPFamily
+	// MaxResponseBodySize limits the number of bytes read from each API response body; any remaining bytes are
+	// ignored. A value of 0 means the maximum length of an IP address (v6) string is used.
+	MaxResponseBodySize int64
+	// SSEEnabled allows subscribing to IP address change notifications pushed by the mydyndns web service as
+	// server-sent events (see SubscribeToIPChangesWithContext).
+	SSEEnabled bool
+	// SSEReconnectBackoff determines how long SubscribeToIPChangesWithContext waits before reconnecting a
+	// disconnected event stream. When nil, the delay grows exponentially from 1 second up to 1 minute.
+	SSEReconnectBackoff RetryBackoff
+	// customHeaders are set on every API request (see WithCustomHeaders).
+	customHeaders http.Header
+	// acceptEncoding is the accept-encoding header value set on every API request (see WithCompression).
+	// When empty, the header is not set by the Client.
+	acceptEncoding string
+	// tracer creates spans for API operations (see WithTracerProvider).
+	tracer trace.Tracer
+	// rateLimiter delays API requests that exceed the rate limit (see WithRateLimit). When nil, requests are not
+	// rate-limited.
+	rateLimiter *ratelimit.TokenBucket
+	// optionErr is the first error encountered while applying ClientOption values, which is returned by NewClientE.
+	optionErr error
+}
+
+// A ClientOption configures optional Client behavior.
+type ClientOption func(*Client)
+
+// setOptionErr records err as the error encountered while applying a ClientOption, unless an error was already
+// recorded.
+func (c *Client) setOptionErr(err error) {
+	if c.optionErr == nil {
+		c.optionErr = err
+	}
+}
+
+// WithRequestTimeout sets the RequestTimeout of a Client to d.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.RequestTimeout = d
+	}
+}
+
+// WithMyIPTimeout sets the MyIPTimeout of a Client to d, which overrides RequestTimeout for MyIP requests.
+func WithMyIPTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.MyIPTimeout = d
+	}
+}
+
+// WithUpdateAliasTimeout sets the UpdateAliasTimeout of a Client to d, which overrides RequestTimeout for
+// UpdateAlias requests.
+func WithUpdateAliasTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.UpdateAliasTimeout = d
+	}
+}
+
+// WithMaxResponseBodySize sets the MaxResponseBodySize of a Client to n, e.g. to accept API responses containing
+// more than an IP address. Values of n less than 1 are reported by NewClientE (see NewClient).
+func WithMaxResponseBodySize(n int64) ClientOption {
+	return func(c *Client) {
+		if n < 1 {
+			c.setOptionErr(fmt.Errorf("max response body size must be positive (received %d)", n))
+			return
+		}
+		c.MaxResponseBodySize = n
+	}
+}
+
+// WithRateLimit limits the API requests made by a Client to an average of rps requests per second, while allowing
+// bursts of up to burst requests. Requests that exceed the limit are delayed until they are allowed (or until their
+// Context is done). Retried requests are subject to the limit, as are requests made by Clients that share the
+// same ClientOption value. Non-positive values of rps or burst are reported by NewClientE (see NewClient).
+func WithRateLimit(rps float64, burst int) ClientOption {
+	var limiter *ratelimit.TokenBucket
+	if rps > 0 && burst > 0 {
+		limiter = ratelimit.NewTokenBucket(rps, burst)
+	}
+	return func(c *Client) {
+		if limiter == nil {
+			c.setOptionErr(fmt.Errorf("rate limit must be positive, with a burst of at least 1 (received %g/s "+
+				"with a burst of %d)", rps, burst))
+			return
+		}
+		c.rateLimiter = limiter
+	}
+}
+
+// ClientTransport describes settings for the HTTP transport used by a Client to make API requests.
+// Zero values leave the corresponding setting at its default (see http.DefaultTransport).
+type ClientTransport struct {
+	// ProxyURL is the URL of a proxy through which all API requests are made.
+	// When nil, the proxy is determined by the environment (see http.ProxyFromEnvironment).
+	ProxyURL *url.URL
+	// TLSConfig configures TLS connections, e.g. to trust custom CA certificates.
+	TLSConfig *tls.Config
+	// MaxIdleConns limits the number of idle (keep-alive) connections.
+	MaxIdleConns int
+	// IdleConnTimeout is the maximum amount of time an idle (keep-alive) connection remains open.
+	IdleConnTimeout time.Duration
+	// KeepAlive is the interval between keep-alive probes for active network connections.
+	KeepAlive time.Duration
+}
+
+// WithTransport configures the HTTPClient of a Client to make requests using an *http.Transport built from t.
+func WithTransport(t ClientTransport) ClientOption {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if t.ProxyURL != nil {
+			transport.Proxy = http.ProxyURL(t.ProxyURL)
+		}
+		if t.TLSConfig != nil {
+			transport.TLSClientConfig = t.TLSConfig.Clone()
+		}
+		if t.MaxIdleConns > 0 {
+			transport.MaxIdleConns = t.MaxIdleConns
+		}
+		if t.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = t.IdleConnTimeout
+		}
+		if t.KeepAlive != 0 {
+			transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: t.KeepAlive}).DialContext
+		}
+		c.HTTPClient.Transport = transport
+	}
+}
+
+// The RoundTripperFunc type is an adapter to allow the use of ordinary functions as HTTP round-trippers.
+// If f is a function with the appropriate signature, RoundTripperFunc(f) is an http.RoundTripper that calls f.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithRoundTripper configures the HTTPClient of a Client to make requests using the http.RoundTripper returned by
+// wrap, which allows requests to be modified (e.g. signed) before they are sent. wrap is given the transport that the
+// Client would otherwise use (or http.DefaultTransport, when none is set), to which the returned http.RoundTripper
+// typically delegates each modified request, e.g.:
+//
+//	sdk.WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+//		return sdk.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("Authorization", "Bearer "+token)
+//			return next.RoundTrip(req)
+//		})
+//	})
+//
+// Settings made by WithTransport and WithClientCert are preserved when they are applied before WithRoundTripper.
+func WithRoundTripper(wrap func(next http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		next := c.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		c.HTTPClient.Transport = wrap(next)
+	}
+}
+
+// WithClientCert configures the HTTPClient of a Client to present the X.509 certificate (and matching private key)
+// loaded from the PEM-encoded certFile and keyFile to API servers that require mutual TLS.
+// When combined with WithTransport, WithClientCert must be applied after WithTransport (and before WithRoundTripper).
+// Errors loading the certificate are returned by NewClientE (see NewClient).
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return func(c *Client) {
+		if certFile == "" || keyFile == "" {
+			c.setOptionErr(fmt.Errorf("client certificate and key files are both required for mutual TLS "+
+				"(received certificate %q and key %q)", certFile, keyFile))
+			return
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			c.setOptionErr(fmt.Errorf("unable to load client certificate: %w", err))
+			return
+		}
+
+		transport, err := c.cloneTransport("client certificates")
+		if err != nil {
+			c.setOptionErr(err)
+			return
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.Certificates = append(transport.TLSClientConfig.Certificates, cert)
+		c.HTTPClient.Transport = transport
+	}
+}
+
+// cloneTransport returns a clone of the *http.Transport used by the HTTPClient of c (or of http.DefaultTransport,
+// when none is set), so that it can be modified by a ClientOption. An error naming feature is returned when the
+// HTTPClient uses any other kind of http.RoundTripper.
+func (c *Client) cloneTransport(feature string) (*http.Transport, error) {
+	switch t := c.HTTPClient.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	case *http.Transport:
+		return t.Clone(), nil
+	default:
+		return nil, fmt.Errorf("%s require an *http.Transport (Client uses %T)", feature, t)
+	}
+}
+
+// reservedHeaders are the (canonical) names of request headers set by the Client itself,
+// which cannot be set by WithCustomHeaders.
+var reservedHeaders = []string{"Accept", "Accept-Encoding", "X-Api-Key"}
+
+// WithCustomHeaders configures a Client to set each of the given headers (e.g. request IDs or tenant identifiers
+// required by an API gateway) on every API request, in addition to any custom headers configured by preceding
+// options. Headers set by the Client itself (i.e. the accept, accept-encoding, and x-api-key headers) cannot be
+// overridden; attempts to set them (or headers with empty names) are reported by NewClientE (see NewClient).
+func WithCustomHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) {
+		for _, name := range slices.Sorted(maps.Keys(headers)) {
+			if name == "" {
+				c.setOptionErr(fmt.Errorf("custom header names cannot be empty"))
+				return
+			}
+			if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(name)) {
+				c.setOptionErr(fmt.Errorf("custom header %q is reserved and cannot be overridden", name))
+				return
+			}
+		}
+
+		if c.customHeaders == nil {
+			c.customHeaders = make(http.Header, len(headers))
+		}
+		for name, value := range headers {
+			c.customHeaders.Set(name, value)
+		}
+	}
 }
 
 // NewClient returns a pointer to a new Client configured to make requests
 // authenticated with apiKey to a MyDynDNS web service hosted at BaseURL.
-func NewClient(baseURL, apiKey string) *Client {
-	return &Client{
-		BaseURL:    baseURL,
-		apiKey:     apiKey,
-		HTTPClient: &http.Client{Timeout: time.Second * 30},
+// The Client is further configured by applying each of the given ClientOption values in order.
+// NewClient panics when NewClientE would return an error; use NewClientE to handle such errors instead.
+func NewClient(baseURL, apiKey string, opts ...ClientOption) *Client {
+	c, err := NewClientE(baseURL, apiKey, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewClientE is like NewClient, but returns an error when any of the given ClientOption values could not be applied,
+// or an InvalidBaseURLError when baseURL is not usable (see ValidateBaseURL).
+func NewClientE(baseURL, apiKey string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		BaseURL:             baseURL,
+		apiKey:              apiKey,
+		HTTPClient:          &http.Client{},
+		RequestTimeout:      defaultRequestTimeout,
+		MaxResponseBodySize: maxIPStrLen,
+		acceptEncoding:      defaultAcceptEncoding,
+		tracer:              noop.NewTracerProvider().Tracer(TracerName),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.optionErr != nil {
+		return nil, c.optionErr
+	}
+	if err := ValidateBaseURL(baseURL); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
+
+// ValidateBaseURL returns an InvalidBaseURLError when baseURL is not usable as the BaseURL of a Client,
+// i.e. when it is empty, cannot be parsed, does not use the https scheme, or has no host.
+func ValidateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return InvalidBaseURLError{Reason: "URL is empty"}
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return InvalidBaseURLError{URL: baseURL, Reason: "URL cannot be parsed", Err: err}
+	}
+	if !strings.EqualFold(u.Scheme, "https") {
+		return InvalidBaseURLError{URL: baseURL, Reason: "scheme must be https"}
+	}
+	if u.Host == "" {
+		return InvalidBaseURLError{URL: baseURL, Reason: "URL has no host"}
+	}
+	return nil
 }
 
 // MyIP wraps MyIPWithContext using context.Background.
@@ -36,73 +350,239 @@ func (c *Client) MyIP() (net.IP, error) {
 }
 
 // MyIPWithContext retrieves the apparent IP address of the host from which the request originated.
+// The request is limited by MyIPTimeout, when set, rather than RequestTimeout.
 // Calling this function should not result in modification to the DNS alias maintained by the mydyndns web service.
 // It returns the retrieved net.IP address or an error that caused the operation to fail.
 func (c *Client) MyIPWithContext(ctx context.Context) (net.IP, error) {
-	return c.fetchIP(ctx, "GET", "my-ip")
+	return c.fetchIP(ctx, "sdk.MyIP", c.timeout(c.MyIPTimeout), "GET", c.checkBaseURL(), "my-ip")
+}
+
+// UpdateAliasOptions configures a DNS update request (see UpdateAliasWithOptionsAndContext).
+type UpdateAliasOptions struct {
+	// TTL is the time-to-live (in seconds) requested for the updated DNS record.
+	// When 0, the TTL is chosen by the mydyndns web service.
+	TTL int
+	// RecordType is the type of DNS record to update.
+	// When RecordTypeDefault, the record type is chosen by the mydyndns web service.
+	RecordType RecordType
 }
 
-// UpdateAlias wraps UpdateAliasWithContext using context.Background.
+// UpdateAlias wraps UpdateAliasWithOptionsAndContext using context.Background and zero-value UpdateAliasOptions.
 func (c *Client) UpdateAlias() (net.IP, error) {
-	return c.UpdateAliasWithContext(context.Background())
+	return c.UpdateAliasWithOptionsAndContext(context.Background(), UpdateAliasOptions{})
 }
 
-// UpdateAliasWithContext retrieves the apparent IP address of the host from which the request originated
+// UpdateAliasWithContext wraps UpdateAliasWithOptionsAndContext using zero-value UpdateAliasOptions.
+func (c *Client) UpdateAliasWithContext(ctx context.Context) (net.IP, error) {
+	return c.UpdateAliasWithOptionsAndContext(ctx, UpdateAliasOptions{})
+}
+
+// UpdateAliasWithOptionsAndContext retrieves the apparent IP address of the host from which the request originated
 // and requests that the DNS alias maintained by the mydyndns web service be updated to that IP address.
+// When opts.TTL is nonzero, it is sent as the ttl query parameter of the request.
+// When opts.RecordType is set, it is sent as the record_type query parameter of the request; RecordTypeAuto is first
+// resolved to either RecordTypeA or RecordTypeAAAA by retrieving the apparent IP address with MyIPWithContext.
+// The request is limited by UpdateAliasTimeout, when set, rather than RequestTimeout.
 // It returns the apparent net.IP address or an error that caused the operation to fail.
-func (c *Client) UpdateAliasWithContext(ctx context.Context) (net.IP, error) {
-	return c.fetchIP(ctx, "POST", "dns-value")
+func (c *Client) UpdateAliasWithOptionsAndContext(ctx context.Context, opts UpdateAliasOptions) (net.IP, error) {
+	query := url.Values{}
+	if opts.TTL < 0 {
+		return nil, fmt.Errorf("TTL cannot be negative (received %d)", opts.TTL)
+	} else if opts.TTL > 0 {
+		query.Set("ttl", strconv.Itoa(opts.TTL))
+	}
+
+	recordType, err := ParseRecordType(string(opts.RecordType))
+	if err != nil {
+		return nil, err
+	}
+	if recordType == RecordTypeAuto {
+		ip, err := c.MyIPWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect record type: %w", err)
+		}
+		recordType = RecordTypeOf(ip)
+	}
+	if recordType != RecordTypeDefault {
+		query.Set("record_type", string(recordType))
+	}
+
+	path := "dns-value"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.fetchIP(ctx, "sdk.UpdateAlias", c.timeout(c.UpdateAliasTimeout), "POST", c.BaseURL, path)
+}
+
+// GetCurrentAlias wraps GetCurrentAliasWithContext using context.Background.
+func (c *Client) GetCurrentAlias() (net.IP, error) {
+	return c.GetCurrentAliasWithContext(context.Background())
+}
+
+// GetCurrentAliasWithContext retrieves the IP address to which the DNS alias maintained by the mydyndns web service
+// currently points. Unlike UpdateAliasWithOptionsAndContext, calling this function does not modify the DNS alias.
+// It returns the current net.IP address of the DNS alias or an error that caused the operation to fail.
+func (c *Client) GetCurrentAliasWithContext(ctx context.Context) (net.IP, error) {
+	return c.fetchIP(ctx, "sdk.GetCurrentAlias", c.RequestTimeout, "GET", c.BaseURL, "dns-value")
 }
 
-func (c *Client) fetchIP(ctx context.Context, method, path string) (ip net.IP, err error) {
-	req, err := c.newRequest(ctx, method, path)
+// Ping wraps PingWithContext using context.Background.
+func (c *Client) Ping() (time.Duration, error) {
+	return c.PingWithContext(context.Background())
+}
+
+// PingWithContext checks connectivity to the mydyndns web service by requesting its health check endpoint
+// (see PingPath). It returns the round-trip latency of the request, or an error when the request fails or
+// the response has a non-200 HTTP status code.
+func (c *Client) PingWithContext(ctx context.Context) (time.Duration, error) {
+	path := c.PingPath
+	if path == "" {
+		path = DefaultPingPath
+	}
+
+	var latency time.Duration
+	start := time.Now()
+	_, _, err := c.request(ctx, c.RequestTimeout, "GET", c.BaseURL, strings.TrimPrefix(path, "/"),
+		func(*http.Response) error {
+			latency = time.Since(start)
+			return nil
+		})
 	if err != nil {
-		return
+		return 0, err
 	}
+	return latency, nil
+}
 
-	resp, err := c.doRequest(req)
-	if resp != nil {
-		defer resp.Body.Close()
+// CheckAuth wraps CheckAuthWithContext using context.Background.
+func (c *Client) CheckAuth() error {
+	return c.CheckAuthWithContext(context.Background())
+}
+
+// CheckAuthWithContext checks whether the mydyndns web service accepts the Client's API key, without modifying
+// the DNS alias, by requesting the apparent IP address from BaseURL (regardless of CheckBaseURL).
+// When the API key is rejected, the returned error matches ErrUnauthorized (see errors.Is).
+func (c *Client) CheckAuthWithContext(ctx context.Context) error {
+	_, _, err := c.request(ctx, c.RequestTimeout, "GET", c.BaseURL, "my-ip", nil)
+	return err
+}
+
+// checkBaseURL returns the base URL to use for IP detection requests.
+func (c *Client) checkBaseURL() string {
+	if c.CheckBaseURL != "" {
+		return c.CheckBaseURL
 	}
+	return c.BaseURL
+}
+
+// timeout returns the operation-specific timeout override when it is set, or RequestTimeout otherwise.
+func (c *Client) timeout(override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	return c.RequestTimeout
+}
+
+// fetchIP requests path (relative to baseURL) and parses the response body as an IP address.
+// The request is limited by timeout (in addition to any deadline on ctx), unless timeout is 0,
+// and is traced by a span named spanName.
+func (c *Client) fetchIP(ctx context.Context, spanName string, timeout time.Duration, method, baseURL, path string) (
+	ip net.IP, err error) {
+	ctx, span := c.startSpan(ctx, spanName)
+	var req *http.Request
+	var resp *http.Response
+	defer func() { endSpan(span, req, resp, err) }()
+
+	req, resp, err = c.request(ctx, timeout, method, baseURL, path, func(resp *http.Response) (err error) {
+		ip, err = c.parseIP(resp.Body)
+		return
+	})
+	return
+}
+
+// request sends a request for path (relative to baseURL), which is limited by timeout (in addition to any deadline
+// on ctx) unless timeout is 0. When the request succeeds, the response is passed to handle (unless it is nil), whose
+// error is returned, before the response body is closed. The request and response are returned for tracing.
+func (c *Client) request(ctx context.Context, timeout time.Duration, method, baseURL, path string,
+	handle func(*http.Response) error) (req *http.Request, resp *http.Response, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err = c.newRequest(ctx, method, baseURL, path)
 	if err != nil {
 		return
 	}
 
-	return c.parseIP(resp.Body)
+	resp, err = c.doRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err == nil && handle != nil {
+		err = handle(resp)
+	}
+	return
 }
 
-func (c *Client) newRequest(ctx context.Context, method, path string) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", c.BaseURL, path), http.NoBody)
-	if err == nil {
-		req.Header.Set("accept", "text/plain")
-		req.Header.Set("x-api-key", c.apiKey)
+func (c *Client) newRequest(ctx context.Context, method, baseURL, path string) (*http.Request, error) {
+	url := fmt.Sprintf("%s/%s", baseURL, path)
+	req, err := http.NewRequestWithContext(ctx, method, url, http.NoBody)
+	if err != nil {
+		return nil, RequestBuildError{method: method, url: url, cause: err}
+	}
+	for name, values := range c.customHeaders {
+		req.Header[name] = slices.Clone(values)
 	}
+	req.Header.Set("accept", "text/plain")
+	if c.acceptEncoding != "" {
+		req.Header.Set("accept-encoding", c.acceptEncoding)
+	}
+	req.Header.Set("x-api-key", c.apiKey)
 
-	return req, err
+	return req, nil
 }
 
 func (c *Client) doRequest(req *http.Request) (resp *http.Response, err error) {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
 	resp, err = c.HTTPClient.Do(req)
 	if err == nil && resp.StatusCode != 200 {
 		err = NewUnexpectedStatusCode(req, resp)
+	} else if err == nil {
+		err = decompressBody(resp)
 	}
 
 	return
 }
 
-// parseIP reads up to maxIPStrLen bytes from (a response body) io.Reader and parses as an IP address.
+// maxResponseBodySize returns MaxResponseBodySize when it is set, or maxIPStrLen otherwise.
+func (c *Client) maxResponseBodySize() int64 {
+	if c.MaxResponseBodySize > 0 {
+		return c.MaxResponseBodySize
+	}
+	return maxIPStrLen
+}
+
+// parseIP reads up to MaxResponseBodySize bytes from (a response body) io.Reader and parses as an IP address.
+// Unparseable values result in an IPParseError, and parsed IP addresses that do not belong to the Client's
+// IPFamily result in an UnexpectedIPFamily error.
 // When the returned error is not nil, the IP address is considered invalid.
 func (c *Client) parseIP(r io.Reader) (ip net.IP, err error) {
-	lr := io.LimitReader(r, maxIPStrLen)
-	buf := make([]byte, maxIPStrLen)
-	size := 0
-	for {
-		n, err := lr.Read(buf[size:])
-		size += n
-		if err == io.EOF {
-			break
-		}
+	body, err := io.ReadAll(io.LimitReader(r, c.maxResponseBodySize()))
+	if err != nil {
+		return nil, err
+	}
+	if err = ip.UnmarshalText(body); err != nil {
+		var parseErr *net.ParseError
+		errors.As(err, &parseErr)
+		return nil, IPParseError{body: body, cause: parseErr}
+	}
+	if !c.IPFamily.Matches(ip) {
+		return nil, UnexpectedIPFamily{ip: ip, expected: c.IPFamily}
 	}
-	err = ip.UnmarshalText(buf[:size])
 	return
 }
@@ -1,13 +1,30 @@
 package sdk
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClient(t *testing.T) {
@@ -49,13 +66,154 @@ func TestClient(t *testing.T) {
 			func(*httptest.Server) error { return nil },
 			func(c *Client) (net.IP, error) { return c.UpdateAlias() },
 		},
+		{
+			"UpdateAliasWithOptionsAndContext() with TTL",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"/dns-value?ttl=300",
+			net.ParseIP("9.8.7.6"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(), UpdateAliasOptions{TTL: 300})
+			},
+		},
+		{
+			"UpdateAliasWithOptionsAndContext() with zero TTL",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"/dns-value",
+			net.ParseIP("9.8.7.6"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(), UpdateAliasOptions{})
+			},
+		},
+		{
+			"UpdateAliasWithOptionsAndContext() with negative TTL",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"",
+			nil,
+			func(*httptest.Server) error { return fmt.Errorf("TTL cannot be negative (received -1)") },
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(), UpdateAliasOptions{TTL: -1})
+			},
+		},
+		{
+			"UpdateAliasWithOptionsAndContext() with A record type",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"/dns-value?record_type=A",
+			net.ParseIP("9.8.7.6"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(),
+					UpdateAliasOptions{RecordType: RecordTypeA})
+			},
+		},
+		{
+			"UpdateAliasWithOptionsAndContext() with AAAA record type and TTL",
+			http.StatusOK,
+			[]byte("2001:db8::1"),
+			"/dns-value?record_type=AAAA&ttl=300",
+			net.ParseIP("2001:db8::1"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(),
+					UpdateAliasOptions{TTL: 300, RecordType: RecordTypeAAAA})
+			},
+		},
+		{
+			"UpdateAliasWithOptionsAndContext() with invalid record type",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"",
+			nil,
+			func(*httptest.Server) error {
+				return fmt.Errorf(`invalid record type "MX" (must be one of: A, AAAA, auto)`)
+			},
+			func(c *Client) (net.IP, error) {
+				return c.UpdateAliasWithOptionsAndContext(context.Background(), UpdateAliasOptions{RecordType: "MX"})
+			},
+		},
+		{
+			"GetCurrentAlias() 200 response",
+			http.StatusOK,
+			[]byte("5.6.7.8"),
+			"/dns-value",
+			net.ParseIP("5.6.7.8"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) { return c.GetCurrentAlias() },
+		},
+		{
+			"GetCurrentAlias() with unparseable IP",
+			http.StatusOK,
+			[]byte("badip"),
+			"/dns-value",
+			nil,
+			func(*httptest.Server) error {
+				return IPParseError{body: []byte("badip"), cause: &net.ParseError{Type: "IP address", Text: "badip"}}
+			},
+			func(c *Client) (net.IP, error) { return c.GetCurrentAlias() },
+		},
+		{
+			"MyIP() with IPv6 response",
+			http.StatusOK,
+			[]byte("2001:db8::1"),
+			"/my-ip",
+			net.ParseIP("2001:db8::1"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) { return c.MyIP() },
+		},
+		{
+			"MyIP() with IPv6 response when IPv6 is required",
+			http.StatusOK,
+			[]byte("2001:db8::1"),
+			"/my-ip",
+			net.ParseIP("2001:db8::1"),
+			func(*httptest.Server) error { return nil },
+			func(c *Client) (net.IP, error) {
+				c.IPFamily = IPv6Family
+				return c.MyIP()
+			},
+		},
+		{
+			"MyIP() with IPv6 response when IPv4 is required",
+			http.StatusOK,
+			[]byte("2001:db8::1"),
+			"/my-ip",
+			nil,
+			func(*httptest.Server) error {
+				return UnexpectedIPFamily{ip: net.ParseIP("2001:db8::1"), expected: IPv4Family}
+			},
+			func(c *Client) (net.IP, error) {
+				c.IPFamily = IPv4Family
+				return c.MyIP()
+			},
+		},
+		{
+			"UpdateAlias() with IPv4 response when IPv6 is required",
+			http.StatusOK,
+			[]byte("9.8.7.6"),
+			"/dns-value",
+			nil,
+			func(*httptest.Server) error {
+				return UnexpectedIPFamily{ip: net.ParseIP("9.8.7.6"), expected: IPv6Family}
+			},
+			func(c *Client) (net.IP, error) {
+				c.IPFamily = IPv6Family
+				return c.UpdateAlias()
+			},
+		},
 		{
 			"UpdateAlias() with unparseable IP",
 			http.StatusOK,
 			[]byte("badip"),
 			"/dns-value",
 			nil,
-			func(*httptest.Server) error { return &net.ParseError{Type: "IP address", Text: "badip"} },
+			func(*httptest.Server) error {
+				return IPParseError{body: []byte("badip"), cause: &net.ParseError{Type: "IP address", Text: "badip"}}
+			},
 			func(c *Client) (net.IP, error) { return c.UpdateAlias() },
 		},
 		{
@@ -65,14 +223,15 @@ func TestClient(t *testing.T) {
 			"/dns-value",
 			nil,
 			func(*httptest.Server) error {
-				return &net.ParseError{Type: "IP address", Text: strings.Repeat("a", maxIPStrLen)}
+				body := strings.Repeat("a", maxIPStrLen)
+				return IPParseError{body: []byte(body), cause: &net.ParseError{Type: "IP address", Text: body}}
 			},
 			func(c *Client) (net.IP, error) { return c.UpdateAlias() },
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			apiKey := "asdfjkl"
-			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 				assert.Equal(t, apiKey, req.Header.Get("x-api-key"))
 				assert.Equal(t, "text/plain", req.Header.Get("accept"))
 				assert.Equal(t, tt.expectPath, req.RequestURI)
@@ -82,7 +241,7 @@ func TestClient(t *testing.T) {
 				resp.Write(tt.respBody)
 			}))
 			defer server.Close()
-			c := NewClient(server.URL, apiKey)
+			c := NewClient(server.URL, apiKey, trustTestServer(server))
 			ip, err := tt.do(c)
 
 			assert.Equal(t, tt.expectIP.String(), ip.String())
@@ -94,3 +253,761 @@ func TestClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClientUpdateAliasAutoRecordType(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		myIP               string
+		myIPStatus         int
+		expectedRecordType string
+		expectedErr        string
+	}{
+		{"IPv4", "1.2.3.4", http.StatusOK, "A", ""},
+		{"IPv6", "2001:db8::1", http.StatusOK, "AAAA", ""},
+		{"detection failure", "", http.StatusInternalServerError, "", "unable to detect record type: "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var updateRequests []*http.Request
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /my-ip", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.myIPStatus)
+				w.Write([]byte(tt.myIP))
+			})
+			mux.HandleFunc("POST /dns-value", func(w http.ResponseWriter, r *http.Request) {
+				updateRequests = append(updateRequests, r)
+				w.Write([]byte(tt.myIP))
+			})
+			server := httptest.NewTLSServer(mux)
+			defer server.Close()
+
+			c := NewClient(server.URL, "asdfjkl", trustTestServer(server))
+			ip, err := c.UpdateAliasWithOptionsAndContext(context.Background(),
+				UpdateAliasOptions{RecordType: RecordTypeAuto})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				assert.Empty(t, updateRequests, "no update should be requested when detection fails")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.myIP, ip.String())
+			require.Len(t, updateRequests, 1)
+			assert.Equal(t, tt.expectedRecordType, updateRequests[0].URL.Query().Get("record_type"))
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c := NewClient("https://example.com", "asdfjkl")
+		assert.Equal(t, "https://example.com", c.BaseURL)
+		assert.Equal(t, "asdfjkl", c.apiKey)
+		assert.Equal(t, defaultRequestTimeout, c.RequestTimeout)
+		assert.Equal(t, int64(maxIPStrLen), c.MaxResponseBodySize)
+		assert.NotNil(t, c.HTTPClient)
+	})
+
+	t.Run("with request timeout", func(t *testing.T) {
+		c := NewClient("https://example.com", "asdfjkl", WithRequestTimeout(time.Second))
+		assert.Equal(t, time.Second, c.RequestTimeout)
+	})
+}
+
+func TestNewClientE(t *testing.T) {
+	for _, tt := range []struct {
+		name, baseURL string
+		expectedErr   string
+	}{
+		{"empty URL", "", `invalid base URL "": URL is empty`},
+		{"HTTP URL", "http://example.com", `invalid base URL "http://example.com": scheme must be https`},
+		{"unparseable URL", "https://exa mple.com", `invalid base URL "https://exa mple.com": URL cannot be parsed`},
+		{"relative URL", "example.com/api", `invalid base URL "example.com/api": scheme must be https`},
+		{"missing host", "https:///api", `invalid base URL "https:///api": URL has no host`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClientE(tt.baseURL, "asdfjkl")
+			assert.Nil(t, c)
+			assert.EqualError(t, err, tt.expectedErr)
+			var urlErr InvalidBaseURLError
+			require.ErrorAs(t, err, &urlErr)
+			assert.Equal(t, tt.baseURL, urlErr.URL)
+			assert.Equal(t, err, ValidateBaseURL(tt.baseURL))
+		})
+	}
+
+	t.Run("unparseable URL wraps the parse error", func(t *testing.T) {
+		_, err := NewClientE("https://exa mple.com", "asdfjkl")
+		var parseErr *url.Error
+		assert.ErrorAs(t, err, &parseErr)
+	})
+
+	for _, baseURL := range []string{"https://example.com", "HTTPS://example.com/api/", "https://127.0.0.1:8443"} {
+		t.Run(baseURL, func(t *testing.T) {
+			c, err := NewClientE(baseURL, "asdfjkl", WithRequestTimeout(time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, baseURL, c.BaseURL)
+			assert.Equal(t, time.Second, c.RequestTimeout)
+			assert.NoError(t, ValidateBaseURL(baseURL))
+		})
+	}
+
+	t.Run("option errors are reported first", func(t *testing.T) {
+		_, err := NewClientE("", "asdfjkl", WithCustomHeaders(map[string]string{"": "value"}))
+		assert.EqualError(t, err, "custom header names cannot be empty")
+	})
+
+	t.Run("NewClient panics on error", func(t *testing.T) {
+		assert.PanicsWithError(t, `invalid base URL "http://example.com": scheme must be https`, func() {
+			NewClient("http://example.com", "asdfjkl")
+		})
+		assert.PanicsWithError(t, "custom header names cannot be empty", func() {
+			NewClient("https://example.com", "asdfjkl", WithCustomHeaders(map[string]string{"": "value"}))
+		})
+	})
+}
+
+func TestClientCheckBaseURL(t *testing.T) {
+	newServer := func(name, ip string, hits *[]string) *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			*hits = append(*hits, fmt.Sprintf("%s %s %s", name, req.Method, req.URL.Path))
+			resp.Write([]byte(ip))
+		}))
+	}
+
+	for _, tt := range []struct {
+		name         string
+		useCheckURL  bool
+		expectedHits []string
+	}{
+		{
+			"check URL set",
+			true,
+			[]string{"check GET /my-ip", "primary POST /dns-value", "primary GET /dns-value"},
+		},
+		{
+			"check URL unset",
+			false,
+			[]string{"primary GET /my-ip", "primary POST /dns-value", "primary GET /dns-value"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits []string
+			primary := newServer("primary", "1.2.3.4", &hits)
+			defer primary.Close()
+			check := newServer("check", "1.2.3.4", &hits)
+			defer check.Close()
+
+			c := NewClient(primary.URL, "asdfjkl", trustTestServer(primary))
+			if tt.useCheckURL {
+				c.CheckBaseURL = check.URL
+			}
+
+			_, err := c.MyIP()
+			require.NoError(t, err)
+			_, err = c.UpdateAlias()
+			require.NoError(t, err)
+			_, err = c.GetCurrentAlias()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedHits, hits)
+		})
+	}
+}
+
+func TestClientWithTransport(t *testing.T) {
+	t.Run("proxied requests", func(t *testing.T) {
+		var proxiedRequests []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			proxiedRequests = append(proxiedRequests, req.Method+" "+req.Host)
+			resp.WriteHeader(http.StatusForbidden)
+		}))
+		defer proxy.Close()
+		proxyURL, err := url.Parse(proxy.URL)
+		require.NoError(t, err)
+
+		c := NewClient("https://mydyndns.invalid", "asdfjkl", WithTransport(ClientTransport{ProxyURL: proxyURL}))
+		_, err = c.MyIP()
+		assert.Error(t, err, "the proxy should refuse to tunnel the request")
+		assert.Equal(t, []string{"CONNECT mydyndns.invalid:443"}, proxiedRequests)
+	})
+
+	t.Run("custom TLS config", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		defer server.Close()
+
+		_, err := NewClient(server.URL, "asdfjkl").MyIP()
+		assert.Error(t, err, "server certificate should not be trusted by default")
+
+		roots := x509.NewCertPool()
+		roots.AddCert(server.Certificate())
+		tlsConfig := &tls.Config{RootCAs: roots}
+		c := NewClient(server.URL, "asdfjkl", WithTransport(ClientTransport{TLSConfig: tlsConfig}))
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+
+		// The TLS config is modified by the transport (e.g. for HTTP/2), so it must not be shared
+		transport, ok := c.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok, "expected Client to use an *http.Transport")
+		assert.NotSame(t, tlsConfig, transport.TLSClientConfig)
+		assert.Empty(t, tlsConfig.NextProtos, "the provided TLS config should not be modified")
+	})
+
+	t.Run("connection settings", func(t *testing.T) {
+		c := NewClient("https://example.com", "asdfjkl", WithTransport(ClientTransport{
+			MaxIdleConns:    5,
+			IdleConnTimeout: time.Second * 15,
+			KeepAlive:       time.Second * 20,
+		}))
+		transport, ok := c.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok, "expected Client to use an *http.Transport")
+		assert.Equal(t, 5, transport.MaxIdleConns)
+		assert.Equal(t, time.Second*15, transport.IdleConnTimeout)
+		assert.NotNil(t, transport.DialContext)
+		assert.NotNil(t, transport.Proxy, "proxy should default to environment")
+	})
+}
+
+func TestClientWithRoundTripper(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedHeaders = req.Header.Clone()
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	var roundTrips int
+	injectToken := WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			roundTrips++
+			req.Header.Set("Authorization", "Bearer token")
+			return next.RoundTrip(req)
+		})
+	})
+	c := NewClient(server.URL, "asdfjkl", trustTestServer(server), injectToken)
+
+	ip, err := c.MyIP()
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ip.String())
+	assert.Equal(t, 1, roundTrips)
+	assert.Equal(t, "Bearer token", receivedHeaders.Get("Authorization"), "round-tripper should inject headers")
+	assert.Equal(t, "asdfjkl", receivedHeaders.Get("x-api-key"), "API key header should still be sent")
+
+	t.Run("default transport", func(t *testing.T) {
+		var next http.RoundTripper
+		NewClient("https://example.com", "asdfjkl", WithRoundTripper(func(rt http.RoundTripper) http.RoundTripper {
+			next = rt
+			return rt
+		}))
+		assert.Same(t, http.DefaultTransport, next)
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		certFile, keyFile, clientCert := writeClientCert(t, t.TempDir())
+		var presentedCNs []string
+		mtls := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			receivedHeaders = req.Header.Clone()
+			for _, cert := range req.TLS.PeerCertificates {
+				presentedCNs = append(presentedCNs, cert.Subject.CommonName)
+			}
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCert)
+		mtls.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+		mtls.StartTLS()
+		defer mtls.Close()
+
+		receivedHeaders = nil
+		c, err := NewClientE(mtls.URL, "asdfjkl", trustTestServer(mtls), WithClientCert(certFile, keyFile),
+			injectToken)
+		require.NoError(t, err)
+		_, err = c.MyIP()
+		require.NoError(t, err, "the client certificate should be presented by the wrapped transport")
+		assert.Equal(t, []string{"mydyndns-client"}, presentedCNs)
+		assert.Equal(t, "Bearer token", receivedHeaders.Get("Authorization"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		rtErr := fmt.Errorf("signing error")
+		c := NewClient(server.URL, "asdfjkl", WithRoundTripper(func(http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, rtErr })
+		}))
+		_, err := c.UpdateAlias()
+		assert.ErrorIs(t, err, rtErr)
+	})
+}
+
+func TestClientWithCustomHeaders(t *testing.T) {
+	var receivedHeaders http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedHeaders = req.Header.Clone()
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	c, err := NewClientE(server.URL, "asdfjkl", trustTestServer(server),
+		WithCustomHeaders(map[string]string{"X-Request-Id": "abc123", "x-tenant-id": "tenant-1"}),
+		WithCustomHeaders(map[string]string{"X-Gateway-Route": "dyndns"}))
+	require.NoError(t, err)
+	for name, call := range map[string]func() error{
+		"MyIP":        func() error { _, err := c.MyIP(); return err },
+		"UpdateAlias": func() error { _, err := c.UpdateAlias(); return err },
+		"CheckAuth":   c.CheckAuth,
+		"Ping":        func() error { _, err := c.Ping(); return err },
+	} {
+		t.Run(name, func(t *testing.T) {
+			receivedHeaders = nil
+			require.NoError(t, call())
+			assert.Equal(t, "abc123", receivedHeaders.Get("X-Request-Id"))
+			assert.Equal(t, "tenant-1", receivedHeaders.Get("X-Tenant-Id"))
+			assert.Equal(t, "dyndns", receivedHeaders.Get("X-Gateway-Route"),
+				"headers from each option should be sent")
+			assert.Equal(t, "asdfjkl", receivedHeaders.Get("x-api-key"))
+			assert.Equal(t, "text/plain", receivedHeaders.Get("accept"))
+		})
+	}
+
+	t.Run("reserved headers", func(t *testing.T) {
+		for _, name := range []string{"x-api-key", "X-API-KEY", "Accept", "accept", "accept-encoding"} {
+			t.Run(name, func(t *testing.T) {
+				_, err := NewClientE(server.URL, "asdfjkl",
+					WithCustomHeaders(map[string]string{"X-Request-Id": "abc123", name: "override"}))
+				assert.EqualError(t, err, fmt.Sprintf("custom header %q is reserved and cannot be overridden", name))
+			})
+		}
+	})
+
+	t.Run("empty header name", func(t *testing.T) {
+		_, err := NewClientE(server.URL, "asdfjkl", WithCustomHeaders(map[string]string{"": "value"}))
+		assert.EqualError(t, err, "custom header names cannot be empty")
+	})
+}
+
+// trustTestServer returns a ClientOption that configures a Client to trust the certificate of the given TLS test
+// server (which is shared by all TLS test servers).
+func trustTestServer(server *httptest.Server) ClientOption {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return WithTransport(ClientTransport{TLSConfig: &tls.Config{RootCAs: roots}})
+}
+
+// writeClientCert generates a self-signed client certificate and writes it (and its private key) as PEM-encoded
+// files in dir. It returns the paths of the files and the parsed certificate.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mydyndns-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		0o600))
+	return certFile, keyFile, cert
+}
+
+func TestClientWithClientCert(t *testing.T) {
+	certFile, keyFile, clientCert := writeClientCert(t, t.TempDir())
+
+	var presentedCNs []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		for _, cert := range req.TLS.PeerCertificates {
+			presentedCNs = append(presentedCNs, cert.Subject.CommonName)
+		}
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	trustServer := trustTestServer(server)
+
+	t.Run("client certificate is presented", func(t *testing.T) {
+		presentedCNs = nil
+		c, err := NewClientE(server.URL, "asdfjkl", trustServer, WithClientCert(certFile, keyFile))
+		require.NoError(t, err)
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		assert.Equal(t, []string{"mydyndns-client"}, presentedCNs)
+	})
+
+	t.Run("server rejects clients without certificate", func(t *testing.T) {
+		c, err := NewClientE(server.URL, "asdfjkl", trustServer)
+		require.NoError(t, err)
+		_, err = c.MyIP()
+		assert.Error(t, err)
+	})
+
+	t.Run("default transport", func(t *testing.T) {
+		c, err := NewClientE("https://example.com", "asdfjkl", WithClientCert(certFile, keyFile))
+		require.NoError(t, err)
+		transport, ok := c.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok, "expected Client to use an *http.Transport")
+		require.NotNil(t, transport.TLSClientConfig)
+		assert.Len(t, transport.TLSClientConfig.Certificates, 1)
+		assert.NotSame(t, http.DefaultTransport, transport, "default transport should not be modified")
+	})
+
+	for _, tt := range []struct {
+		name, certFile, keyFile string
+		expectedErr             string
+	}{
+		{
+			"missing key",
+			certFile, "",
+			fmt.Sprintf("client certificate and key files are both required for mutual TLS "+
+				"(received certificate %q and key %q)", certFile, ""),
+		},
+		{
+			"missing certificate",
+			"", keyFile,
+			fmt.Sprintf("client certificate and key files are both required for mutual TLS "+
+				"(received certificate %q and key %q)", "", keyFile),
+		},
+		{
+			"unreadable certificate",
+			filepath.Join(t.TempDir(), "missing.crt"), keyFile,
+			"unable to load client certificate: open",
+		},
+		{
+			"mismatched files",
+			keyFile, certFile,
+			"unable to load client certificate: tls:",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClientE(server.URL, "asdfjkl", WithClientCert(tt.certFile, tt.keyFile))
+			assert.Nil(t, c)
+			require.Error(t, err)
+			assert.True(t, strings.HasPrefix(err.Error(), tt.expectedErr), "unexpected error: %s", err)
+
+			assert.PanicsWithError(t, err.Error(), func() {
+				NewClient(server.URL, "asdfjkl", WithClientCert(tt.certFile, tt.keyFile))
+			})
+		})
+	}
+
+	t.Run("unsupported transport", func(t *testing.T) {
+		_, err := NewClientE(server.URL, "asdfjkl", WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(next.RoundTrip)
+		}), WithClientCert(certFile, keyFile))
+		assert.EqualError(t, err, "client certificates require an *http.Transport (Client uses sdk.RoundTripperFunc)")
+	})
+}
+
+func TestClientCheckAuth(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		respStatus         int
+		expectErr          bool
+		expectUnauthorized bool
+	}{
+		{"accepted", http.StatusOK, false, false},
+		{"unauthorized", http.StatusUnauthorized, true, true},
+		{"forbidden", http.StatusForbidden, true, true},
+		{"server error", http.StatusInternalServerError, true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/my-ip", req.URL.Path)
+				assert.Equal(t, http.MethodGet, req.Method)
+				assert.Equal(t, "asdfjkl", req.Header.Get("x-api-key"))
+				resp.WriteHeader(tt.respStatus)
+				// The response body is irrelevant to authentication, so it need not be an IP address
+				resp.Write([]byte("not an IP address"))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "asdfjkl", trustTestServer(server))
+			// Credentials are checked against the base URL, since the check URL may not require authentication
+			c.CheckBaseURL = "https://check.invalid"
+			err := c.CheckAuth()
+			if !tt.expectErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, UnexpectedStatusCode{url: server.URL + "/my-ip", receivedStatus: tt.respStatus}.Error())
+			assert.Equal(t, tt.expectUnauthorized, errors.Is(err, ErrUnauthorized))
+		})
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		pingPath   string
+		respStatus int
+		respDelay  time.Duration
+		expectPath string
+		expectErr  func(s *httptest.Server) error
+	}{
+		{
+			"healthy server",
+			"",
+			http.StatusOK,
+			0,
+			"/health",
+			func(*httptest.Server) error { return nil },
+		},
+		{
+			"healthy server with custom path",
+			"/status",
+			http.StatusOK,
+			0,
+			"/status",
+			func(*httptest.Server) error { return nil },
+		},
+		{
+			"500 response",
+			"",
+			http.StatusInternalServerError,
+			0,
+			"/health",
+			func(s *httptest.Server) error {
+				return UnexpectedStatusCode{url: s.URL + "/health", receivedStatus: http.StatusInternalServerError}
+			},
+		},
+		{
+			"timeout",
+			"",
+			http.StatusOK,
+			time.Millisecond * 200,
+			"/health",
+			func(*httptest.Server) error { return context.DeadlineExceeded },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, tt.expectPath, req.URL.Path)
+				assert.Equal(t, http.MethodGet, req.Method)
+				assert.Equal(t, "asdfjkl", req.Header.Get("x-api-key"))
+				select {
+				case <-time.After(tt.respDelay):
+					resp.WriteHeader(tt.respStatus)
+				case <-req.Context().Done():
+				}
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithRequestTimeout(time.Millisecond*100))
+			c.PingPath = tt.pingPath
+			latency, err := c.Ping()
+			if expectedErr := tt.expectErr(server); expectedErr != nil {
+				assert.ErrorIs(t, err, expectedErr)
+				assert.Zero(t, latency)
+			} else {
+				assert.NoError(t, err)
+				assert.Positive(t, latency)
+			}
+		})
+	}
+
+	t.Run("DNS failure", func(t *testing.T) {
+		_, err := NewClient("https://mydyndns.invalid", "asdfjkl").Ping()
+		var dnsErr *net.DNSError
+		assert.ErrorAs(t, err, &dnsErr)
+	})
+}
+
+func TestClientWithMaxResponseBodySize(t *testing.T) {
+	longBody := strings.Repeat("a", maxIPStrLen*2)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte(req.URL.Query().Get("body")))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name         string
+		opts         []ClientOption
+		body         string
+		expectIP     string
+		expectedBody string
+	}{
+		{"default truncates oversized body", nil, longBody, "", longBody[:maxIPStrLen]},
+		{"raised limit reads entire body", []ClientOption{WithMaxResponseBodySize(maxIPStrLen * 4)},
+			longBody, "", longBody},
+		{"lowered limit truncates IP address", []ClientOption{WithMaxResponseBodySize(3)}, "1.2.3.4", "", "1.2"},
+		{"raised limit accepts IP address", []ClientOption{WithMaxResponseBodySize(1024)},
+			"2001:db8::1", "2001:db8::1", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.URL, "asdfjkl", append([]ClientOption{trustTestServer(server)}, tt.opts...)...)
+			// The server echoes the requested body, which is passed via the query string of the request path
+			ip, err := c.fetchIP(context.Background(), "test", 0, "GET", c.BaseURL,
+				"?"+url.Values{"body": {tt.body}}.Encode())
+			if tt.expectIP != "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectIP, ip.String())
+				return
+			}
+			var parseErr IPParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, tt.expectedBody, string(parseErr.body))
+		})
+	}
+
+	for _, n := range []int64{0, -1} {
+		t.Run(fmt.Sprintf("invalid size %d", n), func(t *testing.T) {
+			_, err := NewClientE("https://example.com", "asdfjkl", WithMaxResponseBodySize(n))
+			assert.EqualError(t, err, fmt.Sprintf("max response body size must be positive (received %d)", n))
+		})
+	}
+}
+
+func TestClientWithRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	t.Run("requests exceeding the limit are delayed", func(t *testing.T) {
+		requests.Store(0)
+		// Clients configured with the same option share its limit
+		opt := WithRateLimit(20, 2)
+		clients := []*Client{
+			NewClient(server.URL, "asdfjkl", trustTestServer(server), opt),
+			NewClient(server.URL, "asdfjkl", trustTestServer(server), opt),
+		}
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			for _, c := range clients {
+				_, err := c.MyIPWithContext(context.Background())
+				require.NoError(t, err)
+			}
+		}
+		// The burst is immediate, and each of the 2 subsequent requests waits 50ms
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+		assert.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("delayed requests are abandoned when cancelled", func(t *testing.T) {
+		requests.Store(0)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithRateLimit(0.1, 1))
+		_, err := c.MyIPWithContext(context.Background())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = c.MyIPWithContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, int32(1), requests.Load(), "the delayed request should not have been made")
+	})
+
+	for _, tt := range []struct {
+		rps   float64
+		burst int
+	}{{0, 1}, {-1, 1}, {1, 0}} {
+		t.Run(fmt.Sprintf("invalid limit %g with burst %d", tt.rps, tt.burst), func(t *testing.T) {
+			_, err := NewClientE("https://example.com", "asdfjkl", WithRateLimit(tt.rps, tt.burst))
+			assert.EqualError(t, err, fmt.Sprintf("rate limit must be positive, with a burst of at least 1 "+
+				"(received %g/s with a burst of %d)", tt.rps, tt.burst))
+		})
+	}
+}
+
+func TestClientRequestTimeout(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(time.Millisecond * 200):
+			resp.Write([]byte("1.2.3.4"))
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name        string
+		timeout     time.Duration
+		ctxTimeout  time.Duration
+		expectedErr error
+	}{
+		{"request timeout exceeded", time.Millisecond * 50, time.Second * 5, context.DeadlineExceeded},
+		{"context deadline exceeded first", time.Second * 5, time.Millisecond * 50, context.DeadlineExceeded},
+		{"request timeout not exceeded", time.Second * 5, time.Second * 5, nil},
+		{"request timeout disabled", 0, time.Second * 5, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithRequestTimeout(tt.timeout))
+			ctx, cancel := context.WithTimeout(context.Background(), tt.ctxTimeout)
+			defer cancel()
+
+			start := time.Now()
+			ip, err := c.MyIPWithContext(ctx)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Less(t, time.Since(start), time.Millisecond*200, "request was not cut short")
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "1.2.3.4", ip.String())
+			}
+		})
+	}
+}
+
+func TestClientOperationTimeouts(t *testing.T) {
+	// The server responds slowly to all requests, so that only operations allowed more time succeed
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		time.Sleep(time.Millisecond * 100)
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	myIP := func(c *Client) (net.IP, error) { return c.MyIP() }
+	updateAlias := func(c *Client) (net.IP, error) { return c.UpdateAlias() }
+	getCurrentAlias := func(c *Client) (net.IP, error) { return c.GetCurrentAlias() }
+	for _, tt := range []struct {
+		name        string
+		opts        []ClientOption
+		do          func(*Client) (net.IP, error)
+		expectedErr error
+	}{
+		{"MyIP timeout exceeded", []ClientOption{WithMyIPTimeout(time.Millisecond * 20)},
+			myIP, context.DeadlineExceeded},
+		{"MyIP timeout overrides request timeout",
+			[]ClientOption{WithRequestTimeout(time.Millisecond * 20), WithMyIPTimeout(time.Second * 5)},
+			myIP, nil},
+		{"MyIP timeout does not apply to UpdateAlias", []ClientOption{WithMyIPTimeout(time.Millisecond * 20)},
+			updateAlias, nil},
+		{"UpdateAlias timeout exceeded", []ClientOption{WithUpdateAliasTimeout(time.Millisecond * 20)},
+			updateAlias, context.DeadlineExceeded},
+		{"UpdateAlias timeout overrides request timeout",
+			[]ClientOption{WithRequestTimeout(time.Millisecond * 20), WithUpdateAliasTimeout(time.Second * 5)},
+			updateAlias, nil},
+		{"UpdateAlias timeout does not apply to MyIP",
+			[]ClientOption{WithUpdateAliasTimeout(time.Millisecond * 20)},
+			myIP, nil},
+		{"request timeout applies to other operations",
+			[]ClientOption{WithRequestTimeout(time.Millisecond * 20), WithMyIPTimeout(time.Second * 5),
+				WithUpdateAliasTimeout(time.Second * 5)},
+			getCurrentAlias, context.DeadlineExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.URL, "asdfjkl", append([]ClientOption{trustTestServer(server)}, tt.opts...)...)
+			ip, err := tt.do(c)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "1.2.3.4", ip.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Content codings of compressed API responses that can be decoded by a Client (see WithCompression).
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// defaultAcceptEncoding is the accept-encoding request header value used by a Client when not otherwise configured.
+const defaultAcceptEncoding = EncodingGzip
+
+// WithCompression configures the content codings (EncodingGzip and/or EncodingDeflate, in order of preference)
+// that a Client accepts for API responses. Compressed responses are decompressed transparently.
+// By default, a Client accepts gzip-compressed responses; calling WithCompression without any codings
+// disables compression. Unsupported codings are reported by NewClientE (see NewClient).
+func WithCompression(encodings ...string) ClientOption {
+	return func(c *Client) {
+		for _, enc := range encodings {
+			if enc != EncodingGzip && enc != EncodingDeflate {
+				c.setOptionErr(fmt.Errorf("unsupported compression %q (must be one of: %s, %s)",
+					enc, EncodingGzip, EncodingDeflate))
+				return
+			}
+		}
+		c.acceptEncoding = "identity"
+		if len(encodings) > 0 {
+			c.acceptEncoding = strings.Join(slices.Compact(slices.Clone(encodings)), ", ")
+		}
+	}
+}
+
+// decompressBody replaces the body of resp with a reader that decompresses it according to the content-encoding
+// response header. Responses without a content-encoding (or with the identity coding) are left unchanged.
+func decompressBody(resp *http.Response) error {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return nil
+	case EncodingGzip:
+		r, err = gzip.NewReader(resp.Body)
+	case EncodingDeflate:
+		r, err = zlib.NewReader(resp.Body)
+	default:
+		return fmt.Errorf("unsupported response content encoding %q", enc)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to decompress response: %w", err)
+	}
+
+	resp.Body = decompressedBody{ReadCloser: r, compressed: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decompressedBody is a response body that decompresses the original (compressed) response body.
+type decompressedBody struct {
+	io.ReadCloser
+	compressed io.ReadCloser
+}
+
+// Close closes both the decompressor and the original response body.
+func (b decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.compressed.Close()
+}
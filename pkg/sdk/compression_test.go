@@ -0,0 +1,103 @@
+package sdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compressingServer returns a TLS test server that responds with the IP address 1.2.3.4, compressed according to
+// the first content coding accepted by the request (if any). Each accept-encoding request header value is
+// sent to the returned channel.
+func compressingServer(t *testing.T) (*httptest.Server, <-chan string) {
+	acceptEncodings := make(chan string, 10)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		acceptEncodings <- req.Header.Get("Accept-Encoding")
+		var body bytes.Buffer
+		var w io.WriteCloser
+		enc, _, _ := strings.Cut(req.Header.Get("Accept-Encoding"), ",")
+		switch enc {
+		case EncodingGzip:
+			w = gzip.NewWriter(&body)
+		case EncodingDeflate:
+			w = zlib.NewWriter(&body)
+		default:
+			resp.Write([]byte("1.2.3.4"))
+			return
+		}
+		resp.Header().Set("Content-Encoding", enc)
+		w.Write([]byte("1.2.3.4"))
+		assert.NoError(t, w.Close())
+		resp.Write(body.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server, acceptEncodings
+}
+
+func TestClientWithCompression(t *testing.T) {
+	server, acceptEncodings := compressingServer(t)
+
+	for _, tt := range []struct {
+		name                   string
+		opts                   []ClientOption
+		expectedAcceptEncoding string
+	}{
+		{"default", nil, "gzip"},
+		{"gzip", []ClientOption{WithCompression(EncodingGzip)}, "gzip"},
+		{"deflate", []ClientOption{WithCompression(EncodingDeflate)}, "deflate"},
+		{"preference order", []ClientOption{WithCompression(EncodingDeflate, EncodingGzip)}, "deflate, gzip"},
+		{"disabled", []ClientOption{WithCompression()}, "identity"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClientE(server.URL, "asdfjkl", append([]ClientOption{trustTestServer(server)}, tt.opts...)...)
+			require.NoError(t, err)
+			ip, err := c.MyIP()
+			require.NoError(t, err)
+			assert.Equal(t, "1.2.3.4", ip.String())
+			assert.Equal(t, tt.expectedAcceptEncoding, <-acceptEncodings)
+		})
+	}
+
+	t.Run("uncompressed response", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		defer server.Close()
+		ip, err := NewClient(server.URL, "asdfjkl", trustTestServer(server)).UpdateAlias()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+	})
+
+	t.Run("invalid compressed response", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Encoding", "gzip")
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		defer server.Close()
+		_, err := NewClient(server.URL, "asdfjkl", trustTestServer(server)).MyIP()
+		assert.ErrorContains(t, err, "unable to decompress response: ")
+	})
+
+	t.Run("unsupported response encoding", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Encoding", "br")
+			resp.Write([]byte("1.2.3.4"))
+		}))
+		defer server.Close()
+		_, err := NewClient(server.URL, "asdfjkl", trustTestServer(server)).MyIP()
+		assert.EqualError(t, err, `unsupported response content encoding "br"`)
+	})
+
+	t.Run("unsupported compression option", func(t *testing.T) {
+		_, err := NewClientE(server.URL, "asdfjkl", WithCompression(EncodingGzip, "zstd"))
+		assert.EqualError(t, err, `unsupported compression "zstd" (must be one of: gzip, deflate)`)
+	})
+}
@@ -0,0 +1,113 @@
+package sdk
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strings"
+)
+
+// RedactedHeaderValue replaces the values of redacted headers in the HTTP traffic logged by a Client configured
+// with WithDebugLogging.
+const RedactedHeaderValue = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers redacted by WithDebugLogging when no others are given.
+var DefaultRedactedHeaders = []string{"x-api-key"}
+
+// A DebugLogger receives the HTTP traffic logged by a Client configured with WithDebugLogging.
+type DebugLogger interface {
+	Log(keyvals ...interface{}) error
+}
+
+// debugTransport is an http.RoundTripper that logs a dump of each request and response (or error) with the
+// values of sensitive headers redacted.
+type debugTransport struct {
+	next            http.RoundTripper
+	logger          DebugLogger
+	redactedHeaders []string
+}
+
+// RoundTrip logs req, sends it with the next http.RoundTripper, and then logs the response or error.
+// The dumps are made from copies of req and the response, so the headers that are sent and received are not
+// redacted; response bodies are read in full to be dumped, and then replaced with an identical body.
+// Event streams (see SubscribeToIPChangesWithContext) do not end, so only the headers of such responses are dumped.
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logged := req.Clone(req.Context())
+	logged.Header = t.redact(req.Header)
+	// Cloning does not copy the body, so a body is only dumped when it can be re-read without consuming req.Body
+	withBody := req.GetBody != nil
+	if withBody {
+		var err error
+		if logged.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	} else {
+		logged.Body = nil
+	}
+	if dump, err := httputil.DumpRequestOut(logged, withBody); err != nil {
+		t.logger.Log("msg", "Unable to dump API request", "error", err)
+	} else {
+		t.logger.Log("msg", "Sending API request", "request", string(dump))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logger.Log("msg", "API request failed", "error", err)
+		return resp, err
+	}
+
+	loggedResp := *resp
+	loggedResp.Header = t.redact(resp.Header)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("content-type"))
+	withRespBody := mediaType != "text/event-stream"
+	dump, dumpErr := httputil.DumpResponse(&loggedResp, withRespBody)
+	if withRespBody {
+		// Dumping consumed the original body and replaced it on the copy
+		resp.Body = loggedResp.Body
+	}
+	if dumpErr != nil {
+		t.logger.Log("msg", "Unable to dump API response", "error", dumpErr)
+	} else {
+		t.logger.Log("msg", "Received API response", "response", string(dump))
+	}
+	return resp, nil
+}
+
+// redact returns a copy of h in which the values of each of the redacted headers are replaced with
+// RedactedHeaderValue.
+func (t *debugTransport) redact(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name, values := range redacted {
+		// Header names are compared case-insensitively, since custom headers are not necessarily canonicalized
+		if slices.ContainsFunc(t.redactedHeaders, func(r string) bool { return strings.EqualFold(r, name) }) {
+			redacted[name] = slices.Repeat([]string{RedactedHeaderValue}, len(values))
+		}
+	}
+	return redacted
+}
+
+// WithDebugLogging configures a Client to log a dump of each HTTP request that it sends and of each response that it
+// receives (or the error that prevented a response) to logger. The values of the given headers
+// (DefaultRedactedHeaders when none are given) are replaced with RedactedHeaderValue in the logged dumps, since
+// they may otherwise expose credentials such as the API key. Header names are case-insensitive.
+//
+// WithDebugLogging wraps the HTTP transport configured by preceding options, so it must be applied after
+// WithTransport, WithRoundTripper, and WithClientCert. When applied before WithFallbackURLs, every attempt made to
+// each of the fallback base URLs is logged.
+func WithDebugLogging(logger DebugLogger, redactedHeaders ...string) ClientOption {
+	return func(c *Client) {
+		if len(redactedHeaders) == 0 {
+			redactedHeaders = DefaultRedactedHeaders
+		}
+		next := c.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		c.HTTPClient.Transport = &debugTransport{
+			next:            next,
+			logger:          logger,
+			redactedHeaders: redactedHeaders,
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger is a DebugLogger that records the keyvals of each call to Log.
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []map[string]interface{}
+}
+
+func (l *recordingLogger) Log(keyvals ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record := make(map[string]interface{})
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		record[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+	l.records = append(l.records, record)
+	return nil
+}
+
+func TestWithDebugLogging(t *testing.T) {
+	const apiKey = "asdfjkl"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Redaction only applies to logged dumps, so the API must receive the original header values
+		assert.Equal(t, apiKey, r.Header.Get("x-api-key"))
+		assert.Equal(t, "Bearer token", r.Header.Get("authorization"))
+		assert.Equal(t, "visible", r.Header.Get("x-custom"))
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	t.Run("redacts given headers", func(t *testing.T) {
+		logger := &recordingLogger{}
+		c := NewClient(server.URL, apiKey, trustTestServer(server),
+			WithCustomHeaders(map[string]string{"authorization": "Bearer token", "x-custom": "visible"}),
+			WithDebugLogging(logger, "X-API-KEY", "Authorization", "set-cookie"))
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String(), "response body should remain readable after it is dumped")
+
+		require.Len(t, logger.records, 2)
+		assert.Equal(t, "Sending API request", logger.records[0]["msg"])
+		request := logger.records[0]["request"].(string)
+		assert.True(t, strings.HasPrefix(request, "GET /my-ip HTTP/1.1\r\n"), request)
+		assert.Contains(t, request, "\r\nX-Api-Key: [REDACTED]\r\n")
+		assert.Contains(t, request, "\r\nAuthorization: [REDACTED]\r\n")
+		assert.Contains(t, request, "\r\nX-Custom: visible\r\n")
+		assert.NotContains(t, request, apiKey)
+		assert.NotContains(t, request, "Bearer token")
+
+		assert.Equal(t, "Received API response", logger.records[1]["msg"])
+		response := logger.records[1]["response"].(string)
+		assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"), response)
+		assert.Contains(t, response, "\r\nSet-Cookie: [REDACTED]\r\n")
+		assert.True(t, strings.HasSuffix(response, "\r\n\r\n1.2.3.4"), response)
+	})
+
+	t.Run("redacts API key by default", func(t *testing.T) {
+		logger := &recordingLogger{}
+		c := NewClient(server.URL, apiKey, trustTestServer(server),
+			WithCustomHeaders(map[string]string{"authorization": "Bearer token", "x-custom": "visible"}),
+			WithDebugLogging(logger))
+		_, err := c.MyIP()
+		require.NoError(t, err)
+
+		require.Len(t, logger.records, 2)
+		request := logger.records[0]["request"].(string)
+		assert.Contains(t, request, "\r\nX-Api-Key: [REDACTED]\r\n")
+		assert.Contains(t, request, "\r\nAuthorization: Bearer token\r\n")
+		assert.Contains(t, logger.records[1]["response"], "\r\nSet-Cookie: session=secret\r\n")
+	})
+
+	t.Run("logs request errors", func(t *testing.T) {
+		logger := &recordingLogger{}
+		c := NewClient("https://127.0.0.1:0", apiKey, WithDebugLogging(logger))
+		_, err := c.MyIP()
+		require.Error(t, err)
+
+		require.Len(t, logger.records, 2)
+		assert.Equal(t, "Sending API request", logger.records[0]["msg"])
+		assert.Equal(t, "API request failed", logger.records[1]["msg"])
+		assert.Error(t, logger.records[1]["error"].(error))
+	})
+}
+
+func TestDebugTransportDoesNotModifyRequest(t *testing.T) {
+	const body = "request body"
+	var sent *http.Request
+	var sentBody []byte
+	transport := &debugTransport{
+		next: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			var err error
+			sentBody, err = io.ReadAll(req.Body)
+			require.NoError(t, err)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				ProtoMajor: 1, ProtoMinor: 1,
+				Header:  http.Header{"X-Api-Key": {"response-secret"}},
+				Body:    io.NopCloser(strings.NewReader("9.8.7.6")),
+				Request: req,
+			}, nil
+		}),
+		logger:          &recordingLogger{},
+		redactedHeaders: DefaultRedactedHeaders,
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "https://example.com/dns-value",
+		bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	req.Header.Set("x-api-key", "secret")
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Same(t, req, sent, "the original request should be sent")
+	assert.Equal(t, http.Header{"X-Api-Key": {"secret"}}, req.Header)
+	assert.Equal(t, body, string(sentBody), "the request body should not be consumed by the dump")
+	assert.Equal(t, http.Header{"X-Api-Key": {"response-secret"}}, resp.Header)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "9.8.7.6", string(respBody))
+
+	records := transport.logger.(*recordingLogger).records
+	require.Len(t, records, 2)
+	assert.Contains(t, records[0]["request"], "\r\nX-Api-Key: [REDACTED]\r\n")
+	assert.True(t, strings.HasSuffix(records[0]["request"].(string), "\r\n\r\n"+body), records[0]["request"])
+	assert.Contains(t, records[1]["response"], "\r\nX-Api-Key: [REDACTED]\r\n")
+}
@@ -0,0 +1,123 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// dohMediaType is the media type of DNS messages exchanged with DNS-over-HTTPS servers (RFC 8484).
+const dohMediaType = "application/dns-message"
+
+// dohHTTPClient sends DNS queries to DNS-over-HTTPS servers.
+var dohHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// WithDoHResolver configures the HTTPClient of a Client to resolve the host names of API servers by sending
+// DNS queries to the DNS-over-HTTPS (RFC 8484) server at dohURL, rather than to the system's DNS servers
+// (e.g. to bypass split-horizon DNS that resolves the API to an internal IP address). The host name of the
+// DoH server itself is resolved by the system, so dohURL typically uses an IP address, e.g.
+// "https://1.1.1.1/dns-query". When combined with WithTransport, WithDoHResolver must be applied after
+// WithTransport. An invalid dohURL is reported by NewClientE (see NewClient).
+func WithDoHResolver(dohURL string) ClientOption {
+	return func(c *Client) {
+		u, err := url.Parse(dohURL)
+		if err != nil || !strings.EqualFold(u.Scheme, "https") || u.Host == "" {
+			c.setOptionErr(fmt.Errorf("invalid DoH resolver URL %q (must be an absolute https URL)", dohURL))
+			return
+		}
+		transport, err := c.cloneTransport("DoH resolvers")
+		if err != nil {
+			c.setOptionErr(err)
+			return
+		}
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: newDoHResolver(dohURL)}
+		transport.DialContext = dialer.DialContext
+		c.HTTPClient.Transport = transport
+	}
+}
+
+// newDoHResolver returns a net.Resolver that sends DNS queries to the DNS-over-HTTPS server at dohURL.
+func newDoHResolver(dohURL string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			// The address of the system's DNS server is ignored in favor of the DoH server
+			return &dohConn{ctx: ctx, url: dohURL}, nil
+		},
+	}
+}
+
+// dohConn is a net.Conn over which a net.Resolver exchanges DNS messages with a DNS-over-HTTPS server.
+// Since it is not a net.PacketConn, the resolver frames each DNS message with a 2-byte length prefix (as over TCP);
+// each query written to the dohConn is sent in its own HTTPS request, and the (framed) response is read back.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	query    bytes.Buffer
+	response bytes.Reader
+}
+
+// Write buffers b until a complete DNS query has been written, and then sends the query to the DoH server.
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.query.Write(b)
+	if c.query.Len() < 2 {
+		return len(b), nil
+	}
+	msgLen := int(binary.BigEndian.Uint16(c.query.Bytes()))
+	if c.query.Len() < 2+msgLen {
+		return len(b), nil
+	}
+	msg := c.query.Next(2 + msgLen)[2:]
+	resp, err := c.exchange(msg)
+	if err != nil {
+		return 0, err
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(resp)), uint16(len(resp)))
+	c.response.Reset(append(framed, resp...))
+	return len(b), nil
+}
+
+// exchange sends the DNS query msg to the DoH server and returns its DNS response.
+func (c *dohConn) exchange(msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", dohMediaType)
+	req.Header.Set("accept", dohMediaType)
+	resp, err := dohHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH resolver responded with status %d", resp.StatusCode)
+	}
+	// DNS messages are limited to 65535 bytes by their length prefix
+	return io.ReadAll(io.LimitReader(resp.Body, 0xffff))
+}
+
+// Read reads from the (framed) response to the most recent query.
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.response.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// dohAddr is the net.Addr of a DNS-over-HTTPS server, identified by its URL.
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,124 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDoHServer returns a DNS-over-HTTPS server that answers every A query with answerIP (and every other query
+// without any answers), along with a function that returns the names queried so far.
+func newDoHServer(t *testing.T, answerIP net.IP) (*httptest.Server, func() []string) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, dohMediaType, r.Header.Get("content-type"))
+		query, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		// Parse the name and type of the (single) question, which follows the 12-byte header
+		var labels []string
+		offset := 12
+		for query[offset] != 0 {
+			labels = append(labels, string(query[offset+1:offset+1+int(query[offset])]))
+			offset += 1 + int(query[offset])
+		}
+		questionEnd := offset + 5
+		qType := binary.BigEndian.Uint16(query[offset+1:])
+		mu.Lock()
+		queries = append(queries, strings.Join(labels, "."))
+		mu.Unlock()
+
+		// Respond with the same ID and question, and (for A queries) a single answer
+		resp := bytes.NewBuffer(nil)
+		resp.Write(query[:2])
+		resp.Write([]byte{0x81, 0x80, 0, 1})
+		if qType == 1 {
+			resp.Write([]byte{0, 1})
+		} else {
+			resp.Write([]byte{0, 0})
+		}
+		resp.Write([]byte{0, 0, 0, 0})
+		resp.Write(query[12:questionEnd])
+		if qType == 1 {
+			// Name (pointer to the question), type A, class IN, TTL 60, and a 4-byte address
+			resp.Write([]byte{0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4})
+			resp.Write(answerIP.To4())
+		}
+		w.Header().Set("content-type", dohMediaType)
+		w.Write(resp.Bytes())
+	}))
+	t.Cleanup(server.Close)
+
+	original := dohHTTPClient
+	dohHTTPClient = server.Client()
+	t.Cleanup(func() { dohHTTPClient = original })
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), queries...)
+	}
+}
+
+func TestNewDoHResolver(t *testing.T) {
+	server, queries := newDoHServer(t, net.ParseIP("203.0.113.7"))
+
+	addrs, err := newDoHResolver(server.URL).LookupIPAddr(context.Background(), "api.mydyndns.test")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	assert.Equal(t, "203.0.113.7", addrs[0].IP.String())
+	assert.Contains(t, queries(), "api.mydyndns.test")
+}
+
+func TestClientWithDoHResolver(t *testing.T) {
+	t.Run("resolves API host", func(t *testing.T) {
+		doh, queries := newDoHServer(t, net.ParseIP("127.0.0.1"))
+		api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("1.2.3.4"))
+		}))
+		defer api.Close()
+		_, port, err := net.SplitHostPort(api.Listener.Addr().String())
+		require.NoError(t, err)
+
+		// The API host name only exists in the DoH server's answers (and not in the test server's certificate)
+		tlsConfig := api.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		tlsConfig.ServerName = "example.com"
+		c := NewClient("https://api.mydyndns.test:"+port, "asdfjkl",
+			WithTransport(ClientTransport{TLSConfig: tlsConfig}), WithDoHResolver(doh.URL))
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		assert.Contains(t, queries(), "api.mydyndns.test")
+	})
+
+	for _, dohURL := range []string{"", "http://1.1.1.1/dns-query", "dns-query", "https:///dns-query"} {
+		t.Run("invalid URL "+dohURL, func(t *testing.T) {
+			_, err := NewClientE("https://example.com", "asdfjkl", WithDoHResolver(dohURL))
+			assert.EqualError(t, err, `invalid DoH resolver URL "`+dohURL+`" (must be an absolute https URL)`)
+		})
+	}
+
+	t.Run("requires an http.Transport", func(t *testing.T) {
+		_, err := NewClientE("https://example.com", "asdfjkl",
+			WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(next.RoundTrip)
+			}),
+			WithDoHResolver("https://1.1.1.1/dns-query"))
+		assert.EqualError(t, err, "DoH resolvers require an *http.Transport (Client uses sdk.RoundTripperFunc)")
+	})
+}
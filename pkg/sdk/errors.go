@@ -1,10 +1,43 @@
 package sdk
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 )
 
+var (
+	// ErrClientError matches (with errors.Is) any UnexpectedStatusCode with a 4xx HTTP status code, which indicates
+	// that the request was rejected and is unlikely to succeed if retried without changes.
+	ErrClientError = errors.New("client error response from API")
+	// ErrServerError matches (with errors.Is) any UnexpectedStatusCode with a 5xx HTTP status code, which indicates
+	// a (possibly transient) failure of the API that may be resolved by retrying the request.
+	ErrServerError = errors.New("server error response from API")
+	// ErrUnauthorized matches (with errors.Is) any UnexpectedStatusCode with a 401 (Unauthorized) or 403 (Forbidden)
+	// HTTP status code, which indicates that the API rejected the Client's API key.
+	ErrUnauthorized = errors.New("unauthorized by API")
+)
+
+// InvalidBaseURLError indicates that a URL is not usable as the BaseURL of a Client (see ValidateBaseURL).
+type InvalidBaseURLError struct {
+	// URL is the invalid base URL.
+	URL string
+	// Reason describes why URL is invalid.
+	Reason string
+	// Err is the error from parsing URL, when it could not be parsed.
+	Err error
+}
+
+func (err InvalidBaseURLError) Error() string {
+	return fmt.Sprintf("invalid base URL %q: %s", err.URL, err.Reason)
+}
+
+// Unwrap returns the error from parsing the URL, if any.
+func (err InvalidBaseURLError) Unwrap() error {
+	return err.Err
+}
+
 // UnexpectedStatusCode indicates that a request to the mydyndns API resulted in a response with an HTTP status code
 // that was unexpected, indicating that the requested operation failed.
 type UnexpectedStatusCode struct {
@@ -23,6 +56,21 @@ func (err UnexpectedStatusCode) Error() string {
 		err.url, err.receivedStatus, err.StatusText())
 }
 
+// Is reports whether the UnexpectedStatusCode belongs to the family of HTTP status codes indicated by target,
+// i.e. ErrClientError for 4xx status codes, ErrServerError for 5xx status codes, or ErrUnauthorized for
+// 401 and 403 status codes.
+func (err UnexpectedStatusCode) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return err.receivedStatus == http.StatusUnauthorized || err.receivedStatus == http.StatusForbidden
+	case ErrClientError:
+		return err.receivedStatus >= 400 && err.receivedStatus <= 499
+	case ErrServerError:
+		return err.receivedStatus >= 500 && err.receivedStatus <= 599
+	}
+	return false
+}
+
 // URL returns the requested URL which responded with an unexpected status code.
 func (err *UnexpectedStatusCode) URL() string {
 	return err.url
@@ -37,3 +85,96 @@ func (err *UnexpectedStatusCode) StatusCode() int {
 func (err *UnexpectedStatusCode) StatusText() string {
 	return http.StatusText(err.receivedStatus)
 }
+
+// UnexpectedIPFamily indicates that the mydyndns API responded with an IP address that does not belong to the
+// IPFamily requested by the Client.
+type UnexpectedIPFamily struct {
+	ip       net.IP
+	expected IPFamily
+}
+
+// Error represents an UnexpectedIPFamily as a formatted string error message that contains the received IP address
+// and the expected IP version.
+func (err UnexpectedIPFamily) Error() string {
+	return fmt.Sprintf("received IPv%s address %s (expected IPv%s)", IPFamilyOf(err.ip), err.ip, err.expected)
+}
+
+// IP returns the received IP address which did not belong to the expected IPFamily.
+func (err *UnexpectedIPFamily) IP() net.IP {
+	return err.ip
+}
+
+// Expected returns the IPFamily that the received IP address was expected to belong to.
+func (err *UnexpectedIPFamily) Expected() IPFamily {
+	return err.expected
+}
+
+// IPParseError indicates that the body of a response from the mydyndns API could not be parsed as an IP address.
+type IPParseError struct {
+	body  []byte
+	cause *net.ParseError
+}
+
+// Error represents an IPParseError as a formatted string error message that contains the reason parsing failed.
+func (err IPParseError) Error() string {
+	return fmt.Sprintf("unable to parse API response as an IP address: %s", err.cause)
+}
+
+// Unwrap returns the underlying *net.ParseError.
+func (err IPParseError) Unwrap() error {
+	return err.cause
+}
+
+// Body returns the (possibly truncated) response body that could not be parsed as an IP address.
+func (err *IPParseError) Body() []byte {
+	return err.body
+}
+
+// RequestBuildError indicates that a request to the mydyndns API could not be constructed, e.g. because the
+// Client is configured with an invalid BaseURL.
+type RequestBuildError struct {
+	method string
+	url    string
+	cause  error
+}
+
+// Error represents a RequestBuildError as a formatted string error message that contains the request method, URL,
+// and the reason the request could not be constructed.
+func (err RequestBuildError) Error() string {
+	return fmt.Sprintf("unable to build %s request to %s: %s", err.method, err.url, err.cause)
+}
+
+// Unwrap returns the underlying error that prevented the request from being constructed.
+func (err RequestBuildError) Unwrap() error {
+	return err.cause
+}
+
+// Method returns the HTTP method of the request that could not be constructed.
+func (err *RequestBuildError) Method() string {
+	return err.method
+}
+
+// URL returns the URL of the request that could not be constructed.
+func (err *RequestBuildError) URL() string {
+	return err.url
+}
+
+// IsUnexpectedStatusCode reports whether any error in err's tree is an UnexpectedStatusCode.
+func IsUnexpectedStatusCode(err error) bool {
+	return errors.As(err, new(UnexpectedStatusCode))
+}
+
+// IsUnexpectedIPFamily reports whether any error in err's tree is an UnexpectedIPFamily.
+func IsUnexpectedIPFamily(err error) bool {
+	return errors.As(err, new(UnexpectedIPFamily))
+}
+
+// IsIPParseError reports whether any error in err's tree is an IPParseError.
+func IsIPParseError(err error) bool {
+	return errors.As(err, new(IPParseError))
+}
+
+// IsRequestBuildError reports whether any error in err's tree is a RequestBuildError.
+func IsRequestBuildError(err error) bool {
+	return errors.As(err, new(RequestBuildError))
+}
@@ -1,7 +1,12 @@
 package sdk
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,3 +26,111 @@ func TestUnexpectedStatusCode(t *testing.T) {
 			"request to https://example.com responded with unexpected status code 400 (Bad Request)")
 	})
 }
+
+func TestUnexpectedStatusCodeIs(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.com", http.NoBody)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		status                                     int
+		isClientError, isServerErr, isUnauthorized bool
+	}{
+		{http.StatusOK, false, false, false},
+		{http.StatusBadRequest, true, false, false},
+		{http.StatusUnauthorized, true, false, true},
+		{http.StatusForbidden, true, false, true},
+		{http.StatusNotFound, true, false, false},
+		{http.StatusUnprocessableEntity, true, false, false},
+		{http.StatusInternalServerError, false, true, false},
+		{http.StatusBadGateway, false, true, false},
+		{http.StatusServiceUnavailable, false, true, false},
+	} {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", NewUnexpectedStatusCode(req, &http.Response{StatusCode: tt.status}))
+			assert.Equal(t, tt.isClientError, errors.Is(err, ErrClientError))
+			assert.Equal(t, tt.isServerErr, errors.Is(err, ErrServerError))
+			assert.Equal(t, tt.isUnauthorized, errors.Is(err, ErrUnauthorized))
+			assert.False(t, errors.Is(err, errors.New("other error")))
+			assert.True(t, IsUnexpectedStatusCode(err))
+		})
+	}
+
+	t.Run("other errors", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", IPParseError{cause: &net.ParseError{Type: "IP address", Text: "badip"}})
+		assert.False(t, errors.Is(err, ErrClientError))
+		assert.False(t, errors.Is(err, ErrServerError))
+		assert.False(t, errors.Is(err, ErrUnauthorized))
+	})
+}
+
+func TestUnexpectedIPFamily(t *testing.T) {
+	err := UnexpectedIPFamily{ip: net.ParseIP("2001:db8::1"), expected: IPv4Family}
+
+	assert.Equal(t, "2001:db8::1", err.IP().String())
+	assert.Equal(t, IPv4Family, err.Expected())
+	assert.EqualError(t, err, "received IPv6 address 2001:db8::1 (expected IPv4)")
+}
+
+func TestIPParseError(t *testing.T) {
+	cause := &net.ParseError{Type: "IP address", Text: "badip"}
+	err := fmt.Errorf("wrapped: %w", IPParseError{body: []byte("badip"), cause: cause})
+
+	var target IPParseError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, []byte("badip"), target.Body())
+	assert.EqualError(t, target, "unable to parse API response as an IP address: invalid IP address: badip")
+
+	var parseErr *net.ParseError
+	require.True(t, errors.As(err, &parseErr), "underlying *net.ParseError should be unwrapped")
+	assert.Equal(t, "badip", parseErr.Text)
+	assert.ErrorIs(t, err, cause)
+
+	assert.True(t, IsIPParseError(err))
+	assert.False(t, IsRequestBuildError(err))
+	assert.False(t, IsUnexpectedStatusCode(err))
+}
+
+func TestRequestBuildError(t *testing.T) {
+	// NewClient rejects unparseable base URLs, but BaseURL may be modified afterward
+	c := NewClient("https://example.com", "asdfjkl")
+	c.BaseURL = "https://exa mple.com"
+	_, err := c.MyIPWithContext(context.Background())
+	require.Error(t, err)
+
+	var target RequestBuildError
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, "GET", target.Method())
+	assert.Equal(t, "https://exa mple.com/my-ip", target.URL())
+	assert.ErrorContains(t, err, "unable to build GET request to https://exa mple.com/my-ip: ")
+
+	_, err = c.UpdateAliasWithContext(context.Background())
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, "POST", target.Method())
+	var urlErr *url.Error
+	assert.True(t, errors.As(err, &urlErr), "underlying *url.Error should be unwrapped")
+
+	assert.True(t, IsRequestBuildError(err))
+	assert.False(t, IsIPParseError(err))
+	assert.False(t, IsUnexpectedStatusCode(err))
+}
+
+func TestIsUnexpectedStatusCode(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.com", http.NoBody)
+	require.NoError(t, err)
+
+	wrapped := fmt.Errorf("wrapped: %w",
+		NewUnexpectedStatusCode(req, &http.Response{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, IsUnexpectedStatusCode(wrapped))
+	assert.False(t, IsIPParseError(wrapped))
+	assert.False(t, IsUnexpectedIPFamily(wrapped))
+
+	var target UnexpectedStatusCode
+	require.True(t, errors.As(wrapped, &target))
+	assert.Equal(t, http.StatusServiceUnavailable, target.StatusCode())
+}
+
+func TestIsUnexpectedIPFamily(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", UnexpectedIPFamily{ip: net.ParseIP("1.2.3.4"), expected: IPv6Family})
+	assert.True(t, IsUnexpectedIPFamily(err))
+	assert.False(t, IsUnexpectedIPFamily(fmt.Errorf("some other error")))
+}
@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BaseURLHeader is the name of the header that a Client configured with WithFallbackURLs adds to each API response,
+// whose value is the base URL (i.e. BaseURL or one of the fallback URLs) of the endpoint that served the request.
+const BaseURLHeader = "X-Mydyndns-Base-Url"
+
+// failoverTransport is an http.RoundTripper that retries requests to a primary base URL against each of a list
+// of fallback base URLs (in order) when the primary endpoint responds with a 5xx status code or cannot be reached.
+type failoverTransport struct {
+	next         http.RoundTripper
+	baseURL      string
+	fallbackURLs []string
+}
+
+// RoundTrip sends req to the primary base URL and then, as needed, to each fallback base URL. It stops trying
+// when an endpoint responds with a non-5xx status code, when all endpoints have been tried, or when the request
+// context is done. Requests that are not made to the primary base URL, or whose body cannot be replayed,
+// are sent without failover.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqURL := req.URL.String()
+	if !strings.HasPrefix(reqURL, t.baseURL) || !replayable(req) {
+		return t.next.RoundTrip(req)
+	}
+	rest := strings.TrimPrefix(reqURL, t.baseURL)
+
+	var resp *http.Response
+	var err error
+	for i, baseURL := range append([]string{t.baseURL}, t.fallbackURLs...) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		attempt := req
+		if i > 0 {
+			if attempt, err = t.rewrite(req, baseURL+rest); err != nil {
+				return nil, err
+			}
+		}
+		resp, err = t.next.RoundTrip(attempt)
+		if err == nil {
+			resp.Header.Set(BaseURLHeader, baseURL)
+			if resp.StatusCode < 500 {
+				return resp, nil
+			}
+		}
+	}
+	return resp, err
+}
+
+// rewrite returns a copy of req that is sent to rawURL instead.
+func (t *failoverTransport) rewrite(req *http.Request, rawURL string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = ""
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// replayable reports whether req can be sent more than once, i.e. whether its body (if any) can be re-read.
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// WithFallbackURLs configures a Client to retry each request made to BaseURL against each of the given base URLs
+// (in order) when the preceding endpoint responds with a 5xx status code or cannot be reached (e.g. due to a
+// network error). Retries stop as soon as the request context is done. The base URL of the endpoint that served
+// each request is recorded in the BaseURLHeader header of its response.
+//
+// WithFallbackURLs wraps the HTTP transport configured by preceding options, so it must be applied after
+// WithTransport, WithRoundTripper, and WithClientCert. Failover only applies to BaseURL as provided to NewClient;
+// requests made to CheckBaseURL are not retried. Invalid URLs are reported by NewClientE (see NewClient).
+func WithFallbackURLs(urls ...string) ClientOption {
+	return func(c *Client) {
+		for _, u := range urls {
+			if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				c.setOptionErr(fmt.Errorf("invalid fallback URL %q (must be an absolute URL)", u))
+				return
+			}
+		}
+
+		next := c.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		c.HTTPClient.Transport = &failoverTransport{
+			next:         next,
+			baseURL:      c.BaseURL,
+			fallbackURLs: urls,
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIPServer returns a running TLS test server that responds to every request with status and body,
+// and counts the requests it receives.
+func newIPServer(t *testing.T, status int, body string, requests *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		*requests++
+		resp.WriteHeader(status)
+		resp.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientWithFallbackURLs(t *testing.T) {
+	t.Run("primary OK", func(t *testing.T) {
+		var primaryRequests, fallbackRequests int
+		primary := newIPServer(t, http.StatusOK, "1.2.3.4", &primaryRequests)
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		c, err := NewClientE(primary.URL, "asdfjkl", trustTestServer(primary), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		ip, err := c.UpdateAlias()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		assert.Equal(t, 1, primaryRequests)
+		assert.Equal(t, 0, fallbackRequests, "fallback should not be used when the primary succeeds")
+	})
+
+	t.Run("primary 5xx falls through to fallback", func(t *testing.T) {
+		var primaryRequests, badFallbackRequests, fallbackRequests int
+		primary := newIPServer(t, http.StatusServiceUnavailable, "unavailable", &primaryRequests)
+		badFallback := newIPServer(t, http.StatusBadGateway, "bad gateway", &badFallbackRequests)
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		var usedURL string
+		c, err := NewClientE(primary.URL, "asdfjkl",
+			trustTestServer(primary),
+			WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, "asdfjkl", req.Header.Get("x-api-key"), "API key header should be sent to each URL")
+					return next.RoundTrip(req)
+				})
+			}),
+			WithFallbackURLs(badFallback.URL, fallback.URL))
+		require.NoError(t, err)
+		failover := c.HTTPClient.Transport
+		c.HTTPClient.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := failover.RoundTrip(req)
+			if resp != nil {
+				usedURL = resp.Header.Get(BaseURLHeader)
+			}
+			return resp, err
+		})
+
+		ip, err := c.UpdateAlias()
+		require.NoError(t, err)
+		assert.Equal(t, "5.6.7.8", ip.String())
+		assert.Equal(t, []int{1, 1, 1}, []int{primaryRequests, badFallbackRequests, fallbackRequests})
+		assert.Equal(t, fallback.URL, usedURL)
+	})
+
+	t.Run("primary network error falls through to fallback", func(t *testing.T) {
+		var fallbackRequests int
+		unreachable := httptest.NewTLSServer(http.NotFoundHandler())
+		unreachable.Close()
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		c, err := NewClientE(unreachable.URL, "asdfjkl", trustTestServer(fallback), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "5.6.7.8", ip.String())
+		assert.Equal(t, 1, fallbackRequests)
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		var primaryRequests, fallbackRequests int
+		primary := newIPServer(t, http.StatusInternalServerError, "error", &primaryRequests)
+		fallback := newIPServer(t, http.StatusServiceUnavailable, "unavailable", &fallbackRequests)
+
+		c, err := NewClientE(primary.URL, "asdfjkl", trustTestServer(primary), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		_, err = c.UpdateAlias()
+		assert.ErrorIs(t, err, ErrServerError)
+		var statusErr UnexpectedStatusCode
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.receivedStatus,
+			"error should describe the response from the last URL tried")
+		assert.Equal(t, []int{1, 1}, []int{primaryRequests, fallbackRequests})
+	})
+
+	t.Run("4xx does not fall through", func(t *testing.T) {
+		var primaryRequests, fallbackRequests int
+		primary := newIPServer(t, http.StatusUnauthorized, "unauthorized", &primaryRequests)
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		c, err := NewClientE(primary.URL, "asdfjkl", trustTestServer(primary), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		_, err = c.UpdateAlias()
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.Equal(t, []int{1, 0}, []int{primaryRequests, fallbackRequests})
+	})
+
+	t.Run("context cancelled mid-failover", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var primaryRequests, fallbackRequests int
+		primary := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			primaryRequests++
+			cancel()
+			resp.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer primary.Close()
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		c, err := NewClientE(primary.URL, "asdfjkl", trustTestServer(primary), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		_, err = c.UpdateAliasWithContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, primaryRequests)
+		assert.Equal(t, 0, fallbackRequests, "fallback should not be tried after the context is cancelled")
+	})
+
+	t.Run("check base URL requests are not retried", func(t *testing.T) {
+		var checkRequests, fallbackRequests int
+		check := newIPServer(t, http.StatusServiceUnavailable, "unavailable", &checkRequests)
+		fallback := newIPServer(t, http.StatusOK, "5.6.7.8", &fallbackRequests)
+
+		c, err := NewClientE("https://primary.invalid", "asdfjkl", trustTestServer(check), WithFallbackURLs(fallback.URL))
+		require.NoError(t, err)
+		c.CheckBaseURL = check.URL
+		_, err = c.MyIP()
+		assert.ErrorIs(t, err, ErrServerError)
+		assert.Equal(t, []int{1, 0}, []int{checkRequests, fallbackRequests})
+	})
+
+	t.Run("invalid fallback URL", func(t *testing.T) {
+		_, err := NewClientE("https://example.com", "asdfjkl", WithFallbackURLs("https://ok.example.com", "/relative"))
+		assert.EqualError(t, err, `invalid fallback URL "/relative" (must be an absolute URL)`)
+	})
+}
@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"fmt"
+	"net"
+)
+
+// IPFamily identifies a family (version) of IP addresses that a Client accepts from the MyDynDNS API.
+type IPFamily int
+
+const (
+	// AnyIPFamily accepts both IPv4 and IPv6 addresses.
+	AnyIPFamily IPFamily = iota
+	// IPv4Family accepts only IPv4 addresses.
+	IPv4Family
+	// IPv6Family accepts only IPv6 addresses.
+	IPv6Family
+)
+
+// ParseIPFamily converts s to an IPFamily. Accepted values are "4", "6", and "any" (or an empty string,
+// which is equivalent to "any").
+func ParseIPFamily(s string) (IPFamily, error) {
+	switch s {
+	case "", "any":
+		return AnyIPFamily, nil
+	case "4":
+		return IPv4Family, nil
+	case "6":
+		return IPv6Family, nil
+	}
+	return AnyIPFamily, fmt.Errorf("invalid IP version %q (must be one of: 4, 6, any)", s)
+}
+
+// IPFamilyOf classifies ip as either IPv4Family or IPv6Family.
+func IPFamilyOf(ip net.IP) IPFamily {
+	if ip.To4() != nil {
+		return IPv4Family
+	}
+	return IPv6Family
+}
+
+// Matches checks whether ip belongs to the IPFamily. AnyIPFamily matches every IP address.
+func (f IPFamily) Matches(ip net.IP) bool {
+	return f == AnyIPFamily || f == IPFamilyOf(ip)
+}
+
+// String returns the IPFamily as it would be accepted by ParseIPFamily.
+func (f IPFamily) String() string {
+	switch f {
+	case IPv4Family:
+		return "4"
+	case IPv6Family:
+		return "6"
+	}
+	return "any"
+}
@@ -0,0 +1,56 @@
+package sdk
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPFamily(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		expected IPFamily
+		err      string
+	}{
+		{"", AnyIPFamily, ""},
+		{"any", AnyIPFamily, ""},
+		{"4", IPv4Family, ""},
+		{"6", IPv6Family, ""},
+		{"5", AnyIPFamily, `invalid IP version "5" (must be one of: 4, 6, any)`},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			family, err := ParseIPFamily(tt.input)
+			assert.Equal(t, tt.expected, family)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+				roundTripped, err := ParseIPFamily(family.String())
+				assert.NoError(t, err)
+				assert.Equal(t, family, roundTripped, "String() does not round-trip through ParseIPFamily")
+			}
+		})
+	}
+}
+
+func TestIPFamilyMatches(t *testing.T) {
+	for _, tt := range []struct {
+		ip                   string
+		expectedFamily       IPFamily
+		matchesV4, matchesV6 bool
+	}{
+		{"1.2.3.4", IPv4Family, true, false},
+		{"::ffff:1.2.3.4", IPv4Family, true, false},
+		{"2001:db8::1", IPv6Family, false, true},
+		{"::1", IPv6Family, false, true},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			assert.Equal(t, tt.expectedFamily, IPFamilyOf(ip))
+			assert.True(t, AnyIPFamily.Matches(ip))
+			assert.Equal(t, tt.matchesV4, IPv4Family.Matches(ip))
+			assert.Equal(t, tt.matchesV6, IPv6Family.Matches(ip))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RecordType identifies the type of DNS record that an update request asks the MyDynDNS API to modify.
+type RecordType string
+
+const (
+	// RecordTypeDefault leaves the record type to the mydyndns web service (which implies an A record).
+	RecordTypeDefault RecordType = ""
+	// RecordTypeA updates the A (IPv4) record.
+	RecordTypeA RecordType = "A"
+	// RecordTypeAAAA updates the AAAA (IPv6) record.
+	RecordTypeAAAA RecordType = "AAAA"
+	// RecordTypeAuto updates either the A or AAAA record, according to the family of the apparent IP address
+	// of the host (as retrieved by MyIPWithContext).
+	RecordTypeAuto RecordType = "auto"
+)
+
+// ParseRecordType converts s (case-insensitively) to a RecordType. Accepted values are "A", "AAAA", and "auto"
+// (or an empty string, which is equivalent to RecordTypeDefault).
+func ParseRecordType(s string) (RecordType, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return RecordTypeDefault, nil
+	case "a":
+		return RecordTypeA, nil
+	case "aaaa":
+		return RecordTypeAAAA, nil
+	case "auto":
+		return RecordTypeAuto, nil
+	}
+	return RecordTypeDefault, fmt.Errorf("invalid record type %q (must be one of: A, AAAA, auto)", s)
+}
+
+// RecordTypeOf returns the RecordType (either RecordTypeA or RecordTypeAAAA) of a DNS record for ip.
+func RecordTypeOf(ip net.IP) RecordType {
+	if IPFamilyOf(ip) == IPv4Family {
+		return RecordTypeA
+	}
+	return RecordTypeAAAA
+}
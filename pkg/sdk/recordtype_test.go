@@ -0,0 +1,50 @@
+package sdk
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRecordType(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		expected RecordType
+		err      string
+	}{
+		{"", RecordTypeDefault, ""},
+		{"A", RecordTypeA, ""},
+		{"a", RecordTypeA, ""},
+		{"AAAA", RecordTypeAAAA, ""},
+		{"aaaa", RecordTypeAAAA, ""},
+		{"auto", RecordTypeAuto, ""},
+		{"AUTO", RecordTypeAuto, ""},
+		{"CNAME", RecordTypeDefault, `invalid record type "CNAME" (must be one of: A, AAAA, auto)`},
+	} {
+		t.Run(tt.input, func(t *testing.T) {
+			recordType, err := ParseRecordType(tt.input)
+			assert.Equal(t, tt.expected, recordType)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRecordTypeOf(t *testing.T) {
+	for _, tt := range []struct {
+		ip       string
+		expected RecordType
+	}{
+		{"1.2.3.4", RecordTypeA},
+		{"::ffff:1.2.3.4", RecordTypeA},
+		{"2001:db8::1", RecordTypeAAAA},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RecordTypeOf(net.ParseIP(tt.ip)))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package sdk
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// DefaultRetryStatusCodes are the HTTP status codes of API responses retried by WithAutoRetry when no others
+// are given, which indicate transient failures of a proxy or gateway in front of the API.
+var DefaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// A RetryBackoff determines how long a Client configured with WithAutoRetry waits before retrying a request.
+type RetryBackoff interface {
+	// Wait returns the delay before the retry that follows the given (1-based) failed attempt.
+	Wait(attempt int) time.Duration
+}
+
+// ConstantBackoff is a RetryBackoff that waits Delay before every retry.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// Wait returns Delay.
+func (b ConstantBackoff) Wait(int) time.Duration {
+	return b.Delay
+}
+
+// LinearBackoff is a RetryBackoff whose delay increases by Step after each failed attempt
+// (i.e. Step, 2*Step, 3*Step, ...), up to Max.
+type LinearBackoff struct {
+	Step time.Duration
+	// Max caps the delay. A value of 0 means the delay is not capped.
+	Max time.Duration
+}
+
+// Wait returns attempt*Step, capped at Max.
+func (b LinearBackoff) Wait(attempt int) time.Duration {
+	return capDelay(b.Step*time.Duration(max(attempt, 1)), b.Max)
+}
+
+// ExponentialBackoff is a RetryBackoff whose delay is multiplied by Multiplier after each failed attempt
+// (i.e. Base, Base*Multiplier, Base*Multiplier^2, ...), up to Max.
+type ExponentialBackoff struct {
+	Base time.Duration
+	// Multiplier is the factor by which the delay increases. Values less than 1 are treated as 2.
+	Multiplier float64
+	// Max caps the delay. A value of 0 means the delay is not capped.
+	Max time.Duration
+}
+
+// Wait returns Base*Multiplier^(attempt-1), capped at Max.
+func (b ExponentialBackoff) Wait(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(b.Base) * math.Pow(multiplier, float64(max(attempt, 1)-1))
+	if delay >= math.MaxInt64 {
+		return capDelay(math.MaxInt64, b.Max)
+	}
+	return capDelay(time.Duration(delay), b.Max)
+}
+
+// capDelay returns d, or limit when limit is nonzero and d exceeds it.
+func capDelay(d, limit time.Duration) time.Duration {
+	if limit > 0 && d > limit {
+		return limit
+	}
+	return d
+}
+
+// retryTransport is an http.RoundTripper that retries requests whose responses have one of a set of HTTP status
+// codes, waiting between attempts according to a RetryBackoff.
+type retryTransport struct {
+	next        http.RoundTripper
+	retryOn     []int
+	maxAttempts int
+	backoff     RetryBackoff
+}
+
+// RoundTrip sends req up to maxAttempts times, until a response has a status code that is not retried. The
+// response to the final attempt is returned regardless of its status code. Retries stop as soon as the request
+// context is done, and requests whose body cannot be replayed (or that fail without a response) are not retried.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !replayable(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		resp, err := t.next.RoundTrip(r)
+		if err != nil || attempt >= t.maxAttempts || !slices.Contains(t.retryOn, resp.StatusCode) {
+			return resp, err
+		}
+		resp.Body.Close()
+
+		timer := time.NewTimer(t.backoff.Wait(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// WithAutoRetry configures a Client to retry API requests (up to a total of maxAttempts attempts) whose responses
+// have any of the HTTP status codes in retryOn, or DefaultRetryStatusCodes when retryOn is empty. The delay before
+// each retry is determined by backoff. Retries stop as soon as the request context is done (including when
+// RequestTimeout elapses), in which case the Context error is returned.
+//
+// Like WithFallbackURLs, WithAutoRetry wraps the HTTP transport configured by preceding options, so it must be
+// applied after WithTransport, WithRoundTripper, and WithClientCert. When applied before WithFallbackURLs, each
+// endpoint is retried before falling through to the next. Invalid arguments are reported by NewClientE
+// (see NewClient).
+func WithAutoRetry(retryOn []int, maxAttempts int, backoff RetryBackoff) ClientOption {
+	return func(c *Client) {
+		if maxAttempts < 1 {
+			c.setOptionErr(fmt.Errorf("max retry attempts must be at least 1 (received %d)", maxAttempts))
+			return
+		}
+		if backoff == nil {
+			c.setOptionErr(fmt.Errorf("retry backoff is required"))
+			return
+		}
+		for _, code := range retryOn {
+			if code < 100 || code > 599 {
+				c.setOptionErr(fmt.Errorf("invalid retry status code %d", code))
+				return
+			}
+		}
+		if len(retryOn) == 0 {
+			retryOn = DefaultRetryStatusCodes
+		}
+
+		next := c.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		c.HTTPClient.Transport = &retryTransport{
+			next:        next,
+			retryOn:     slices.Clone(retryOn),
+			maxAttempts: maxAttempts,
+			backoff:     backoff,
+		}
+	}
+}
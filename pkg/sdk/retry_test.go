@@ -0,0 +1,134 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyServer returns a running test server that responds to the first failures requests with status,
+// and to every other request with 200 and body. It counts the requests it receives.
+func newFlakyServer(t *testing.T, failures, status int, body string, requests *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		*requests++
+		if *requests <= failures {
+			resp.WriteHeader(status)
+			return
+		}
+		resp.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientWithAutoRetry(t *testing.T) {
+	t.Run("retries until OK", func(t *testing.T) {
+		var requests int
+		server := newFlakyServer(t, 2, http.StatusServiceUnavailable, "1.2.3.4", &requests)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server),
+			WithAutoRetry(nil, 3, ConstantBackoff{Delay: time.Millisecond}))
+
+		ip, err := c.UpdateAlias()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var requests int
+		server := newFlakyServer(t, 2, http.StatusServiceUnavailable, "1.2.3.4", &requests)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithAutoRetry(nil, 2, ConstantBackoff{}))
+
+		_, err := c.MyIP()
+		var statusErr UnexpectedStatusCode
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.receivedStatus)
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("does not retry other status codes", func(t *testing.T) {
+		var requests int
+		server := newFlakyServer(t, 2, http.StatusInternalServerError, "1.2.3.4", &requests)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithAutoRetry(nil, 3, ConstantBackoff{}))
+
+		_, err := c.MyIP()
+		assert.Error(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("custom status codes", func(t *testing.T) {
+		var requests int
+		server := newFlakyServer(t, 1, http.StatusTooManyRequests, "1.2.3.4", &requests)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server),
+			WithAutoRetry([]int{http.StatusTooManyRequests}, 3, LinearBackoff{Step: time.Millisecond}))
+
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+		assert.Equal(t, 2, requests)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		var requests int
+		server := newFlakyServer(t, 2, http.StatusServiceUnavailable, "1.2.3.4", &requests)
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server),
+			WithAutoRetry(nil, 3, ConstantBackoff{Delay: time.Hour}))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := c.MyIPWithContext(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, requests)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		opt         ClientOption
+		expectedErr string
+	}{
+		{"zero attempts", WithAutoRetry(nil, 0, ConstantBackoff{}),
+			"max retry attempts must be at least 1 (received 0)"},
+		{"missing backoff", WithAutoRetry(nil, 3, nil), "retry backoff is required"},
+		{"invalid status code", WithAutoRetry([]int{5030}, 3, ConstantBackoff{}), "invalid retry status code 5030"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClientE("https://example.com", "asdfjkl", tt.opt)
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		backoff  RetryBackoff
+		expected []time.Duration
+	}{
+		{"constant", ConstantBackoff{Delay: time.Second},
+			[]time.Duration{time.Second, time.Second, time.Second, time.Second}},
+		{"linear", LinearBackoff{Step: time.Second},
+			[]time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}},
+		{"linear with max", LinearBackoff{Step: time.Second, Max: 3 * time.Second},
+			[]time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+		{"exponential", ExponentialBackoff{Base: time.Second},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{"exponential with multiplier and max", ExponentialBackoff{Base: time.Second, Multiplier: 3, Max: 10 * time.Second},
+			[]time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 10 * time.Second}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected, tt.backoff.Wait(i+1), "attempt %d", i+1)
+			}
+		})
+	}
+
+	t.Run("exponential overflow", func(t *testing.T) {
+		assert.Equal(t, time.Hour, ExponentialBackoff{Base: time.Second, Max: time.Hour}.Wait(1000))
+	})
+}
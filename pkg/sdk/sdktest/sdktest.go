@@ -0,0 +1,122 @@
+// Package sdktest provides a mock of the MyDynDNS API client for use in the tests of packages that depend on the sdk
+// package.
+package sdktest
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+)
+
+// MockClient is a testify mock with the same API request methods as *sdk.Client.
+// Context arguments are not recorded, so expectations are set on method names alone, except for
+// UpdateAliasWithOptionsAndContext, whose expectations also match its sdk.UpdateAliasOptions argument.
+// Expectations for SubscribeToIPChangesWithContext return the IP addresses to send (see PushIPs) and an error.
+type MockClient struct{ mock.Mock }
+
+func (m *MockClient) MyIP() (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) MyIPWithContext(context.Context) (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) UpdateAlias() (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) UpdateAliasWithContext(context.Context) (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) UpdateAliasWithOptionsAndContext(_ context.Context, opts sdk.UpdateAliasOptions) (net.IP, error) {
+	return m.ipResult(m.Called(opts))
+}
+
+func (m *MockClient) GetCurrentAlias() (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) GetCurrentAliasWithContext(context.Context) (net.IP, error) {
+	return m.ipResult(m.Called())
+}
+
+func (m *MockClient) Ping() (time.Duration, error) {
+	return m.durationResult(m.Called())
+}
+
+func (m *MockClient) PingWithContext(context.Context) (time.Duration, error) {
+	return m.durationResult(m.Called())
+}
+
+func (m *MockClient) CheckAuth() error {
+	return m.Called().Error(0)
+}
+
+func (m *MockClient) CheckAuthWithContext(context.Context) error {
+	return m.Called().Error(0)
+}
+
+// SubscribeToIPChangesWithContext sends each of the mocked IP addresses to ch (until ctx is done), and then returns
+// the mocked error. When the mocked error is nil, it instead blocks until ctx is done, like the subscription of
+// *sdk.Client.
+func (m *MockClient) SubscribeToIPChangesWithContext(ctx context.Context, ch chan<- net.IP) error {
+	args := m.Called()
+	var ips []net.IP
+	if rvIPs := args.Get(0); rvIPs != nil {
+		ips = rvIPs.([]net.IP)
+	}
+	for _, ip := range ips {
+		select {
+		case ch <- ip:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if err := args.Error(1); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// PushIPs sets up SubscribeToIPChangesWithContext to send ips and then remain subscribed until cancelled.
+// The returned *mock.Call can be used for further setup, e.g. Once.
+func (m *MockClient) PushIPs(ips ...net.IP) *mock.Call {
+	return m.On("SubscribeToIPChangesWithContext").Return(ips, nil)
+}
+
+// ReturnIP sets up method (called with arguments) to return ip without an error.
+// The returned *mock.Call can be used for further setup, e.g. Once.
+func (m *MockClient) ReturnIP(method string, ip net.IP, arguments ...interface{}) *mock.Call {
+	return m.On(method, arguments...).Return(ip, nil)
+}
+
+// ReturnError sets up method (called with arguments) to return err, along with the zero value of any other
+// return value. The returned *mock.Call can be used for further setup, e.g. Once.
+func (m *MockClient) ReturnError(method string, err error, arguments ...interface{}) *mock.Call {
+	switch method {
+	case "Ping", "PingWithContext":
+		return m.On(method, arguments...).Return(time.Duration(0), err)
+	case "CheckAuth", "CheckAuthWithContext":
+		return m.On(method, arguments...).Return(err)
+	}
+	return m.On(method, arguments...).Return(nil, err)
+}
+
+// ipResult converts the return values of a mocked method that returns an IP address, either of which may be nil.
+func (m *MockClient) ipResult(args mock.Arguments) (ip net.IP, err error) {
+	if rvIP := args.Get(0); rvIP != nil {
+		ip = rvIP.(net.IP)
+	}
+	return ip, args.Error(1)
+}
+
+func (m *MockClient) durationResult(args mock.Arguments) (time.Duration, error) {
+	return args.Get(0).(time.Duration), args.Error(1)
+}
@@ -0,0 +1,116 @@
+package sdktest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TylerHendrickson/mydyndns/pkg/agent"
+	"github.com/TylerHendrickson/mydyndns/pkg/sdk"
+)
+
+// apiClient declares the API request methods of *sdk.Client.
+type apiClient interface {
+	MyIP() (net.IP, error)
+	MyIPWithContext(context.Context) (net.IP, error)
+	UpdateAlias() (net.IP, error)
+	UpdateAliasWithContext(context.Context) (net.IP, error)
+	UpdateAliasWithOptionsAndContext(context.Context, sdk.UpdateAliasOptions) (net.IP, error)
+	GetCurrentAlias() (net.IP, error)
+	GetCurrentAliasWithContext(context.Context) (net.IP, error)
+	Ping() (time.Duration, error)
+	PingWithContext(context.Context) (time.Duration, error)
+	CheckAuth() error
+	CheckAuthWithContext(context.Context) error
+	SubscribeToIPChangesWithContext(context.Context, chan<- net.IP) error
+}
+
+var (
+	_ apiClient    = (*sdk.Client)(nil)
+	_ apiClient    = (*MockClient)(nil)
+	_ agent.Client = (*MockClient)(nil)
+)
+
+func TestMockClientMatchesSDKClient(t *testing.T) {
+	sdkClient, mockClient := reflect.TypeOf(&sdk.Client{}), reflect.TypeOf(&MockClient{})
+	for i := 0; i < sdkClient.NumMethod(); i++ {
+		method := sdkClient.Method(i)
+		t.Run(method.Name, func(t *testing.T) {
+			mocked, ok := mockClient.MethodByName(method.Name)
+			require.True(t, ok, "MockClient does not implement %s", method.Name)
+			// The receiver (the first input of each method type) necessarily differs
+			assert.Equal(t, method.Type.NumIn(), mocked.Type.NumIn())
+			for j := 1; j < method.Type.NumIn() && j < mocked.Type.NumIn(); j++ {
+				assert.Equal(t, method.Type.In(j), mocked.Type.In(j))
+			}
+			assert.Equal(t, method.Type.NumOut(), mocked.Type.NumOut())
+			for j := 0; j < method.Type.NumOut() && j < mocked.Type.NumOut(); j++ {
+				assert.Equal(t, method.Type.Out(j), mocked.Type.Out(j))
+			}
+		})
+	}
+}
+
+func TestMockClientReturnIP(t *testing.T) {
+	ctx := context.Background()
+	m := new(MockClient)
+	m.ReturnIP("MyIPWithContext", net.ParseIP("1.2.3.4")).Once()
+	m.ReturnIP("UpdateAliasWithOptionsAndContext", net.ParseIP("2001:db8::1"),
+		sdk.UpdateAliasOptions{RecordType: sdk.RecordTypeAAAA}).Once()
+
+	ip, err := m.MyIPWithContext(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, net.ParseIP("1.2.3.4"), ip)
+	ip, err = m.UpdateAliasWithOptionsAndContext(ctx, sdk.UpdateAliasOptions{RecordType: sdk.RecordTypeAAAA})
+	assert.NoError(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), ip)
+	m.AssertExpectations(t)
+}
+
+func TestMockClientReturnError(t *testing.T) {
+	ctx := context.Background()
+	expectedErr := errors.New("API unavailable")
+	m := new(MockClient)
+	for _, method := range []string{
+		"UpdateAlias", "PingWithContext", "CheckAuthWithContext", "SubscribeToIPChangesWithContext",
+	} {
+		m.ReturnError(method, expectedErr).Once()
+	}
+
+	ip, err := m.UpdateAlias()
+	assert.ErrorIs(t, err, expectedErr)
+	assert.Nil(t, ip)
+	latency, err := m.PingWithContext(ctx)
+	assert.ErrorIs(t, err, expectedErr)
+	assert.Zero(t, latency)
+	assert.ErrorIs(t, m.CheckAuthWithContext(ctx), expectedErr)
+	assert.ErrorIs(t, m.SubscribeToIPChangesWithContext(ctx, make(chan net.IP)), expectedErr)
+	m.AssertExpectations(t)
+}
+
+func TestMockClientPushIPs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := new(MockClient)
+	m.PushIPs(net.ParseIP("1.2.3.4"), net.ParseIP("2001:db8::1")).Once()
+
+	ch := make(chan net.IP)
+	done := make(chan error, 1)
+	go func() { done <- m.SubscribeToIPChangesWithContext(ctx, ch) }()
+	assert.Equal(t, net.ParseIP("1.2.3.4"), <-ch)
+	assert.Equal(t, net.ParseIP("2001:db8::1"), <-ch)
+	select {
+	case err := <-done:
+		t.Fatalf("subscription ended before being cancelled: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	m.AssertExpectations(t)
+}
@@ -0,0 +1,160 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IPChangeEvent is the type of the server-sent events whose data is the new apparent IP address of the host.
+// Events without a type (i.e. of the default "message" type) are treated the same way.
+const IPChangeEvent = "ip-change"
+
+// ErrSSEDisabled is returned by SubscribeToIPChangesWithContext when the Client was not configured
+// WithSSEEnabled.
+var ErrSSEDisabled = errors.New("server-sent events are not enabled for this Client")
+
+// defaultSSEReconnectBackoff is the SSEReconnectBackoff used by a Client when not otherwise configured.
+var defaultSSEReconnectBackoff = ExponentialBackoff{Base: time.Second, Multiplier: 2, Max: time.Minute}
+
+// WithSSEEnabled sets the SSEEnabled field of a Client to enabled, which allows subscribing to push-based
+// IP address change notifications with SubscribeToIPChangesWithContext (when supported by the API).
+func WithSSEEnabled(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SSEEnabled = enabled
+	}
+}
+
+// SubscribeToIPChangesWithContext subscribes to the server-sent event (SSE) stream at the events endpoint of the
+// mydyndns web service, and sends the IP address of each IPChangeEvent to ch. Events whose data is not an IP address
+// (of the Client's IPFamily) are ignored. Whenever the stream is disconnected (or cannot be established), the Client
+// reconnects after waiting according to SSEReconnectBackoff, which is reset once a stream is established.
+//
+// The subscription continues until ctx is done, at which point nil is returned. Errors that reconnecting cannot
+// resolve are returned instead: ErrSSEDisabled when the Client was not configured WithSSEEnabled, and errors for
+// responses with a 4xx HTTP status code (e.g. when the API does not support SSE, or rejects the API key), except
+// for 408 (Request Timeout) and 429 (Too Many Requests).
+func (c *Client) SubscribeToIPChangesWithContext(ctx context.Context, ch chan<- net.IP) error {
+	if !c.SSEEnabled {
+		return ErrSSEDisabled
+	}
+
+	var lastEventID string
+	for attempt := 1; ; attempt++ {
+		connected, err := c.streamIPChanges(ctx, ch, &lastEventID)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !retryableSSEError(err) {
+			return err
+		}
+		if connected {
+			attempt = 1
+		}
+
+		timer := time.NewTimer(c.sseReconnectBackoff().Wait(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// sseReconnectBackoff returns SSEReconnectBackoff when it is set, or defaultSSEReconnectBackoff otherwise.
+func (c *Client) sseReconnectBackoff() RetryBackoff {
+	if c.SSEReconnectBackoff != nil {
+		return c.SSEReconnectBackoff
+	}
+	return defaultSSEReconnectBackoff
+}
+
+// streamIPChanges establishes a single event stream and sends the IP address of each IPChangeEvent to ch until the
+// stream ends, reporting whether the stream was established. The ID of the last received event is tracked in
+// lastEventID, which is sent when establishing the stream so that missed events can be replayed by the API.
+func (c *Client) streamIPChanges(ctx context.Context, ch chan<- net.IP, lastEventID *string) (bool, error) {
+	req, err := c.newRequest(ctx, "GET", c.BaseURL, "events")
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("accept", "text/event-stream")
+	req.Header.Set("cache-control", "no-cache")
+	if *lastEventID != "" {
+		req.Header.Set("last-event-id", *lastEventID)
+	}
+
+	resp, err := c.doRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return false, err
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("content-type")); mediaType != "text/event-stream" {
+		return false, fmt.Errorf("unexpected content type %q for event stream %s", mediaType, req.URL)
+	}
+
+	var eventType, eventID string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event
+			if eventID != "" {
+				*lastEventID = eventID
+			}
+			if (eventType == "" || eventType == IPChangeEvent) && len(data) > 0 {
+				if ip, err := c.parseIP(strings.NewReader(strings.Join(data, "\n"))); err == nil {
+					select {
+					case ch <- ip:
+					case <-ctx.Done():
+						return true, ctx.Err()
+					}
+				}
+			}
+			eventType, eventID, data = "", "", nil
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// Lines beginning with a colon are comments (e.g. keep-alives)
+		case "event":
+			eventType = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			eventID = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, fmt.Errorf("event stream %s failed: %w", req.URL, err)
+	}
+	return true, fmt.Errorf("event stream %s ended", req.URL)
+}
+
+// retryableSSEError reports whether an event stream that failed with err should be reconnected.
+func retryableSSEError(err error) bool {
+	if IsRequestBuildError(err) {
+		return false
+	}
+	var statusErr UnexpectedStatusCode
+	if errors.As(err, &statusErr) && errors.Is(err, ErrClientError) {
+		switch statusErr.StatusCode() {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return false
+	}
+	return true
+}
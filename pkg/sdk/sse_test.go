@@ -0,0 +1,196 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSSEServer returns a running test server that streams events to each connection (counted by connections) by
+// calling stream with the (1-based) number of the connection. The connection is closed once stream returns.
+func newSSEServer(t *testing.T, connections *atomic.Int32,
+	stream func(n int32, resp http.ResponseWriter, req *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/events", req.URL.Path)
+		assert.Equal(t, "text/event-stream", req.Header.Get("accept"))
+		assert.Equal(t, "asdfjkl", req.Header.Get("x-api-key"))
+		stream(connections.Add(1), resp, req)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeEvents writes the given (raw) events to resp as an event stream, and flushes them to the client.
+func writeEvents(resp http.ResponseWriter, events ...string) {
+	if resp.Header().Get("content-type") == "" {
+		resp.Header().Set("content-type", "text/event-stream; charset=utf-8")
+		resp.WriteHeader(http.StatusOK)
+	}
+	for _, event := range events {
+		fmt.Fprint(resp, event)
+	}
+	resp.(http.Flusher).Flush()
+}
+
+// receiveIPs subscribes c to IP changes until n IP addresses are received, and returns them along with the
+// error returned by the subscription (which is stopped once the IP addresses are received).
+func receiveIPs(t *testing.T, c *Client, n int) ([]string, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan net.IP)
+	done := make(chan error, 1)
+	go func() { done <- c.SubscribeToIPChangesWithContext(ctx, ch) }()
+
+	var ips []string
+	for len(ips) < n {
+		select {
+		case ip := <-ch:
+			ips = append(ips, ip.String())
+		case err := <-done:
+			return ips, err
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d IP addresses before timing out", len(ips), n)
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		return ips, err
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not stop after its context was cancelled")
+	}
+	return nil, nil
+}
+
+func TestClientSubscribeToIPChanges(t *testing.T) {
+	t.Run("parses events", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(_ int32, resp http.ResponseWriter, req *http.Request) {
+			writeEvents(resp,
+				": keep-alive comment\n\n",
+				"data: 1.2.3.4\n\n",
+				"event: other\ndata: 5.6.7.8\n\n",
+				"event: ip-change\nid: 1\ndata: 9.8.7.6\n\n",
+				"data: not an IP\n\n",
+				"retry: 1000\n\n",
+				"data:2001:db8::1\r\n\r\n",
+			)
+			<-req.Context().Done()
+		})
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithSSEEnabled(true))
+
+		ips, err := receiveIPs(t, c, 3)
+		assert.NoError(t, err, "cancelling the subscription is not an error")
+		assert.Equal(t, []string{"1.2.3.4", "9.8.7.6", "2001:db8::1"}, ips)
+		assert.Equal(t, int32(1), connections.Load())
+	})
+
+	t.Run("reconnects", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(n int32, resp http.ResponseWriter, req *http.Request) {
+			switch n {
+			case 1:
+				resp.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				assert.Empty(t, req.Header.Get("last-event-id"))
+				writeEvents(resp, "id: 41\ndata: 1.2.3.4\n\n")
+			default:
+				assert.Equal(t, "41", req.Header.Get("last-event-id"), "the last event ID should be resent")
+				writeEvents(resp, "id: 42\ndata: 9.8.7.6\n\n")
+				<-req.Context().Done()
+			}
+		})
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithSSEEnabled(true))
+		c.SSEReconnectBackoff = ConstantBackoff{Delay: time.Millisecond}
+
+		ips, err := receiveIPs(t, c, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4", "9.8.7.6"}, ips)
+		assert.Equal(t, int32(3), connections.Load())
+	})
+
+	t.Run("cancelled while waiting to reconnect", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(_ int32, resp http.ResponseWriter, _ *http.Request) {
+			resp.WriteHeader(http.StatusBadGateway)
+		})
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithSSEEnabled(true))
+		c.SSEReconnectBackoff = ConstantBackoff{Delay: time.Hour}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.NoError(t, c.SubscribeToIPChangesWithContext(ctx, make(chan net.IP)))
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(1), connections.Load())
+	})
+
+	t.Run("with debug logging", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(_ int32, resp http.ResponseWriter, req *http.Request) {
+			writeEvents(resp, "data: 1.2.3.4\n\n")
+			// The stream does not end until the subscription is cancelled, so its body must not be dumped
+			<-req.Context().Done()
+		})
+		logger := &recordingLogger{}
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithDebugLogging(logger), WithSSEEnabled(true))
+
+		ips, err := receiveIPs(t, c, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4"}, ips)
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		require.Len(t, logger.records, 2)
+		assert.Equal(t, "Received API response", logger.records[1]["msg"])
+		response := logger.records[1]["response"].(string)
+		assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"), response)
+		assert.Contains(t, response, "\r\nContent-Type: text/event-stream; charset=utf-8\r\n")
+		assert.NotContains(t, response, "1.2.3.4")
+	})
+
+	t.Run("not supported by the API", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(_ int32, resp http.ResponseWriter, _ *http.Request) {
+			resp.WriteHeader(http.StatusNotFound)
+		})
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithSSEEnabled(true))
+
+		err := c.SubscribeToIPChangesWithContext(context.Background(), make(chan net.IP))
+		var statusErr UnexpectedStatusCode
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode())
+		assert.Equal(t, int32(1), connections.Load(), "client errors should not be retried")
+	})
+
+	t.Run("unexpected content type", func(t *testing.T) {
+		var connections atomic.Int32
+		server := newSSEServer(t, &connections, func(_ int32, resp http.ResponseWriter, _ *http.Request) {
+			resp.Write([]byte("1.2.3.4"))
+		})
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithSSEEnabled(true))
+		c.SSEReconnectBackoff = ConstantBackoff{Delay: time.Millisecond}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, c.SubscribeToIPChangesWithContext(ctx, make(chan net.IP)))
+		assert.Greater(t, connections.Load(), int32(1), "non-stream responses should be retried")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		c := NewClient("https://example.com", "asdfjkl")
+		assert.ErrorIs(t, c.SubscribeToIPChangesWithContext(context.Background(), make(chan net.IP)), ErrSSEDisabled)
+		c = NewClient("https://example.com", "asdfjkl", WithSSEEnabled(false))
+		assert.ErrorIs(t, c.SubscribeToIPChangesWithContext(context.Background(), make(chan net.IP)), ErrSSEDisabled)
+	})
+}
@@ -0,0 +1,63 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracerName is the instrumentation name with which a Client requests a Tracer from its TracerProvider.
+const TracerName = "github.com/TylerHendrickson/mydyndns/pkg/sdk"
+
+// Attribute keys set on spans created by a Client.
+const (
+	AttributeHTTPMethod     = "http.method"
+	AttributeHTTPURL        = "http.url"
+	AttributeHTTPStatusCode = "http.status_code"
+)
+
+// WithTracerProvider configures a Client to create a span for each MyIP, UpdateAlias, and GetCurrentAlias request
+// using a Tracer obtained from tp. Spans are named after the operation (e.g. "sdk.MyIP"), describe the request
+// with the http.method, http.url, and http.status_code attributes, and have their status set from the result
+// of the operation. When tp is nil, the no-op TracerProvider (the default) is used.
+func WithTracerProvider(tp trace.TracerProvider) ClientOption {
+	return func(c *Client) {
+		if tp == nil {
+			tp = noop.NewTracerProvider()
+		}
+		c.tracer = tp.Tracer(TracerName)
+	}
+}
+
+// startSpan starts a span named spanName using the Client's Tracer.
+func (c *Client) startSpan(ctx context.Context, spanName string) (context.Context, trace.Span) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(TracerName)
+	}
+	return tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+// endSpan records the outcome of the request described by req and resp (either of which may be nil) on span,
+// sets its status from err, and ends it.
+func endSpan(span trace.Span, req *http.Request, resp *http.Response, err error) {
+	if req != nil {
+		span.SetAttributes(
+			attribute.String(AttributeHTTPMethod, req.Method),
+			attribute.String(AttributeHTTPURL, req.URL.String()),
+		)
+	}
+	if resp != nil {
+		span.SetAttributes(attribute.Int(AttributeHTTPStatusCode, resp.StatusCode))
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
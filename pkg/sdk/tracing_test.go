@@ -0,0 +1,125 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newRecordingTracerProvider returns a TracerProvider that synchronously exports each ended span to the returned
+// exporter.
+func newRecordingTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+// spanAttributes returns the attributes of span as a map.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestClientWithTracerProvider(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("x-api-key") != "asdfjkl" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp.Write([]byte("1.2.3.4"))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name           string
+		apiKey         string
+		call           func(*Client) error
+		expectedName   string
+		expectedMethod string
+		expectedURL    string
+		expectedStatus int
+		expectedCode   codes.Code
+	}{
+		{
+			"MyIP", "asdfjkl",
+			func(c *Client) (err error) { _, err = c.MyIP(); return },
+			"sdk.MyIP", "GET", server.URL + "/my-ip", http.StatusOK, codes.Ok,
+		},
+		{
+			"UpdateAlias", "asdfjkl",
+			func(c *Client) (err error) { _, err = c.UpdateAlias(); return },
+			"sdk.UpdateAlias", "POST", server.URL + "/dns-value", http.StatusOK, codes.Ok,
+		},
+		{
+			"GetCurrentAlias", "asdfjkl",
+			func(c *Client) (err error) { _, err = c.GetCurrentAlias(); return },
+			"sdk.GetCurrentAlias", "GET", server.URL + "/dns-value", http.StatusOK, codes.Ok,
+		},
+		{
+			"error response", "wrong",
+			func(c *Client) (err error) { _, err = c.UpdateAlias(); return },
+			"sdk.UpdateAlias", "POST", server.URL + "/dns-value", http.StatusUnauthorized, codes.Error,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, exporter := newRecordingTracerProvider(t)
+			c, err := NewClientE(server.URL, tt.apiKey, trustTestServer(server), WithTracerProvider(tp))
+			require.NoError(t, err)
+			callErr := tt.call(c)
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1, "the span should be ended")
+			span := spans[0]
+			assert.Equal(t, tt.expectedName, span.Name)
+			assert.Equal(t, TracerName, span.InstrumentationScope.Name)
+			assert.Equal(t, map[attribute.Key]attribute.Value{
+				AttributeHTTPMethod:     attribute.StringValue(tt.expectedMethod),
+				AttributeHTTPURL:        attribute.StringValue(tt.expectedURL),
+				AttributeHTTPStatusCode: attribute.IntValue(tt.expectedStatus),
+			}, spanAttributes(span))
+			assert.Equal(t, tt.expectedCode, span.Status.Code)
+			if tt.expectedCode == codes.Error {
+				require.Error(t, callErr)
+				assert.Equal(t, callErr.Error(), span.Status.Description)
+			} else {
+				assert.NoError(t, callErr)
+			}
+		})
+	}
+
+	t.Run("network error", func(t *testing.T) {
+		unreachable := httptest.NewTLSServer(http.NotFoundHandler())
+		unreachable.Close()
+		tp, exporter := newRecordingTracerProvider(t)
+		c := NewClient(unreachable.URL, "asdfjkl", trustTestServer(unreachable), WithTracerProvider(tp))
+		_, err := c.MyIP()
+		require.Error(t, err)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		attrs := spanAttributes(spans[0])
+		assert.NotContains(t, attrs, attribute.Key(AttributeHTTPStatusCode), "no response should be recorded")
+		assert.Equal(t, "GET", attrs[AttributeHTTPMethod].AsString())
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("nil provider", func(t *testing.T) {
+		c := NewClient(server.URL, "asdfjkl", trustTestServer(server), WithTracerProvider(nil))
+		ip, err := c.MyIP()
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3.4", ip.String())
+	})
+}
@@ -0,0 +1,190 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const awsSecretsManagerService = "secretsmanager"
+
+// AWSCredentials are the credentials used to sign requests to AWS APIs.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only required for temporary credentials.
+	SessionToken string
+}
+
+// AWSSecretsManagerBackend retrieves secrets from AWS Secrets Manager. Secret IDs are the names or ARNs
+// of secrets, and the value of each secret is its SecretString.
+type AWSSecretsManagerBackend struct {
+	Region      string
+	Credentials AWSCredentials
+	// Endpoint overrides the base URL of the AWS Secrets Manager API, which is otherwise determined by Region.
+	Endpoint   string
+	HTTPClient *http.Client
+	now        func() time.Time
+}
+
+// NewAWSSecretsManagerBackendFromEnv returns a pointer to a new AWSSecretsManagerBackend configured by the
+// standard AWS_REGION (or AWS_DEFAULT_REGION), AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and (optionally)
+// AWS_SESSION_TOKEN environment variables.
+func NewAWSSecretsManagerBackendFromEnv() (*AWSSecretsManagerBackend, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("AWS_REGION environment variable is not set")
+	}
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set")
+	}
+	return &AWSSecretsManagerBackend{Region: region, Credentials: creds, HTTPClient: &http.Client{}}, nil
+}
+
+// GetSecret returns the SecretString value of the AWS Secrets Manager secret identified by id.
+func (b *AWSSecretsManagerBackend) GetSecret(ctx context.Context, id string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", awsSecretsManagerService, b.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/",
+		bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	signAWSRequestV4(req, body, b.Credentials, b.Region, awsSecretsManagerService, now())
+
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		// Error types may be qualified by a namespace, e.g. "com.amazonaws...#ResourceNotFoundException"
+		errType := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+		switch errType {
+		case "ResourceNotFoundException":
+			return "", fmt.Errorf("aws secret %s: %w", id, ErrNotFound)
+		case "AccessDeniedException", "UnrecognizedClientException":
+			return "", fmt.Errorf("aws secret %s: %w (%s)", id, ErrPermissionDenied, apiErr.Message)
+		default:
+			return "", fmt.Errorf("aws secrets manager responded with unexpected status code %d (%s): %s",
+				resp.StatusCode, errType, apiErr.Message)
+		}
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("unable to decode aws secrets manager response: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("aws secret %s has no string value", id)
+	}
+	return *out.SecretString, nil
+}
+
+// signAWSRequestV4 adds an AWS Signature Version 4 authorization to req (whose body is body) for the
+// given service and region at time t. The host, content-type, and all x-amz-* headers are signed.
+// Query strings are not supported.
+func signAWSRequestV4(req *http.Request, body []byte, creds AWSCredentials, region, service string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	headerNames := make([]string, 0, len(headers))
+	for k := range headers {
+		headerNames = append(headerNames, k)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, k := range headerNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, "", canonicalHeaders.String(), signedHeaders, sha256Hex(body),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", amzDate[:8], region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
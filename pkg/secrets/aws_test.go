@@ -0,0 +1,146 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAWSRequestV4(t *testing.T) {
+	// "get-vanilla" case from the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", http.NoBody)
+	require.NoError(t, err)
+	signAWSRequestV4(req, nil, AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestAWSSecretsManagerBackend(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		respStatus  int
+		respBody    string
+		expected    string
+		expectedErr error
+		errContains string
+	}{
+		{
+			"successful retrieval",
+			http.StatusOK,
+			`{"Name":"mydyndns","SecretString":"asdfjkl"}`,
+			"asdfjkl",
+			nil,
+			"",
+		},
+		{
+			"missing secret",
+			http.StatusBadRequest,
+			`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`,
+			"",
+			ErrNotFound,
+			"aws secret mydyndns: secret not found",
+		},
+		{
+			"wrong permissions",
+			http.StatusBadRequest,
+			`{"__type":"com.amazonaws.secretsmanager#AccessDeniedException","message":"not authorized"}`,
+			"",
+			ErrPermissionDenied,
+			"aws secret mydyndns: permission denied (not authorized)",
+		},
+		{
+			"binary secret",
+			http.StatusOK,
+			`{"Name":"mydyndns","SecretBinary":"YXNkZmprbA=="}`,
+			"",
+			nil,
+			"aws secret mydyndns has no string value",
+		},
+		{
+			"unexpected error",
+			http.StatusInternalServerError,
+			`{"__type":"InternalServiceError","message":"oops"}`,
+			"",
+			nil,
+			"aws secrets manager responded with unexpected status code 500 (InternalServiceError): oops",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "secretsmanager.GetSecretValue", req.Header.Get("X-Amz-Target"))
+				assert.Equal(t, "application/x-amz-json-1.1", req.Header.Get("Content-Type"))
+				assert.Equal(t, "session-token", req.Header.Get("X-Amz-Security-Token"))
+				assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"),
+					"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220102/us-west-2/secretsmanager/aws4_request, "+
+						"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, "),
+					"unexpected Authorization header: %s", req.Header.Get("Authorization"))
+
+				var body map[string]string
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				assert.Equal(t, map[string]string{"SecretId": "mydyndns"}, body)
+
+				resp.WriteHeader(tt.respStatus)
+				resp.Write([]byte(tt.respBody))
+			}))
+			defer server.Close()
+
+			b := &AWSSecretsManagerBackend{
+				Region: "us-west-2",
+				Credentials: AWSCredentials{
+					AccessKeyID:     "AKIDEXAMPLE",
+					SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+					SessionToken:    "session-token",
+				},
+				Endpoint: server.URL,
+				now:      func() time.Time { return time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC) },
+			}
+			secret, err := b.GetSecret(context.Background(), "mydyndns")
+			assert.Equal(t, tt.expected, secret)
+			if tt.errContains != "" {
+				assert.EqualError(t, err, tt.errContains)
+				if tt.expectedErr != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewAWSSecretsManagerBackendFromEnv(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	_, err := NewAWSSecretsManagerBackendFromEnv()
+	assert.EqualError(t, err, "AWS_REGION environment variable is not set")
+
+	t.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	_, err = NewAWSSecretsManagerBackendFromEnv()
+	assert.EqualError(t, err, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set")
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	b, err := NewAWSSecretsManagerBackendFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-2", b.Region)
+	assert.Equal(t, AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, b.Credentials)
+}
@@ -0,0 +1,36 @@
+// Package secrets provides retrieval of sensitive configuration values (e.g. API keys) from external secret stores.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound indicates that a requested secret does not exist.
+	ErrNotFound = errors.New("secret not found")
+	// ErrPermissionDenied indicates that the caller is not permitted to retrieve a requested secret.
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// A Backend retrieves secret values from a secret store.
+type Backend interface {
+	// GetSecret returns the value of the secret identified by id. Implementations should return errors
+	// that wrap ErrNotFound or ErrPermissionDenied when applicable.
+	GetSecret(ctx context.Context, id string) (string, error)
+}
+
+// Resolve retrieves the value of the secret identified by id from b.
+// Surrounding whitespace is trimmed from the value, and empty values result in an error.
+func Resolve(ctx context.Context, b Backend, id string) (string, error) {
+	secret, err := b.GetSecret(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve secret %q: %w", id, err)
+	}
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return "", fmt.Errorf("unable to resolve secret %q: secret is empty", id)
+	}
+	return secret, nil
+}
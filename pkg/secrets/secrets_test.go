@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockBackend struct{ mock.Mock }
+
+func (m *mockBackend) GetSecret(_ context.Context, id string) (string, error) {
+	args := m.Called(id)
+	return args.String(0), args.Error(1)
+}
+
+func TestResolve(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		value       string
+		err         error
+		expected    string
+		expectedErr string
+	}{
+		{"successful retrieval", "asdfjkl", nil, "asdfjkl", ""},
+		{"surrounding whitespace is trimmed", " asdfjkl\n", nil, "asdfjkl", ""},
+		{"missing secret", "", fmt.Errorf("wrapped: %w", ErrNotFound), "",
+			`unable to resolve secret "my-secret": wrapped: secret not found`},
+		{"wrong permissions", "", fmt.Errorf("wrapped: %w", ErrPermissionDenied), "",
+			`unable to resolve secret "my-secret": wrapped: permission denied`},
+		{"empty secret", " ", nil, "", `unable to resolve secret "my-secret": secret is empty`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &mockBackend{}
+			b.On("GetSecret", "my-secret").Return(tt.value, tt.err).Once()
+
+			secret, err := Resolve(context.Background(), b, "my-secret")
+			assert.Equal(t, tt.expected, secret)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			b.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultVaultField is the field of a Vault secret whose value is retrieved when VaultBackend.Field is empty.
+const DefaultVaultField = "api-key"
+
+// VaultBackend retrieves secrets from a HashiCorp Vault server using its HTTP API.
+// Secret IDs are the API paths of secrets (e.g. "secret/data/mydyndns"), and both KV version 1 and
+// version 2 secrets engines are supported.
+type VaultBackend struct {
+	// Address is the base URL of the Vault server, e.g. "https://vault.example.com:8200".
+	Address string
+	// Token authenticates requests to the Vault server.
+	Token string
+	// Field is the field of the secret whose value is retrieved. When empty, DefaultVaultField is used.
+	Field      string
+	HTTPClient *http.Client
+}
+
+// NewVaultBackendFromEnv returns a pointer to a new VaultBackend configured by the standard VAULT_ADDR
+// and VAULT_TOKEN environment variables.
+func NewVaultBackendFromEnv() (*VaultBackend, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR environment variable is not set")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN environment variable is not set")
+	}
+	return &VaultBackend{Address: addr, Token: token, HTTPClient: &http.Client{}}, nil
+}
+
+// GetSecret returns the value of the configured Field of the Vault secret at path.
+func (b *VaultBackend) GetSecret(ctx context.Context, path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(b.Address, "/"), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", b.Token)
+
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("vault path %s: %w", path, ErrNotFound)
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return "", fmt.Errorf("vault path %s: %w", path, ErrPermissionDenied)
+	default:
+		return "", fmt.Errorf("vault responded with unexpected status code %d (%s)",
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("unable to decode vault response: %w", err)
+	}
+
+	data := body.Data
+	// KV version 2 secrets nest the secret data (alongside metadata) in another "data" object
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	field := b.Field
+	if field == "" {
+		field = DefaultVaultField
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault path %s has no %q field: %w", path, field, ErrNotFound)
+	}
+	return value, nil
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultBackend(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		field       string
+		respStatus  int
+		respBody    string
+		expected    string
+		expectedErr error
+		errContains string
+	}{
+		{
+			"successful retrieval from KV v2",
+			"",
+			http.StatusOK,
+			`{"data":{"data":{"api-key":"asdfjkl"},"metadata":{"version":1}}}`,
+			"asdfjkl",
+			nil,
+			"",
+		},
+		{
+			"successful retrieval from KV v1",
+			"",
+			http.StatusOK,
+			`{"data":{"api-key":"asdfjkl"}}`,
+			"asdfjkl",
+			nil,
+			"",
+		},
+		{
+			"successful retrieval of custom field",
+			"token",
+			http.StatusOK,
+			`{"data":{"data":{"api-key":"wrong","token":"asdfjkl"}}}`,
+			"asdfjkl",
+			nil,
+			"",
+		},
+		{
+			"missing secret",
+			"",
+			http.StatusNotFound,
+			`{"errors":[]}`,
+			"",
+			ErrNotFound,
+			"vault path secret/data/mydyndns: secret not found",
+		},
+		{
+			"missing field",
+			"",
+			http.StatusOK,
+			`{"data":{"data":{"token":"asdfjkl"}}}`,
+			"",
+			ErrNotFound,
+			`vault path secret/data/mydyndns has no "api-key" field: secret not found`,
+		},
+		{
+			"wrong permissions",
+			"",
+			http.StatusForbidden,
+			`{"errors":["permission denied"]}`,
+			"",
+			ErrPermissionDenied,
+			"vault path secret/data/mydyndns: permission denied",
+		},
+		{
+			"unexpected status",
+			"",
+			http.StatusServiceUnavailable,
+			`{"errors":["Vault is sealed"]}`,
+			"",
+			nil,
+			"vault responded with unexpected status code 503 (Service Unavailable)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodGet, req.Method)
+				assert.Equal(t, "/v1/secret/data/mydyndns", req.URL.Path)
+				assert.Equal(t, "vault-token", req.Header.Get("X-Vault-Token"))
+				resp.WriteHeader(tt.respStatus)
+				resp.Write([]byte(tt.respBody))
+			}))
+			defer server.Close()
+
+			b := &VaultBackend{Address: server.URL + "/", Token: "vault-token", Field: tt.field}
+			secret, err := b.GetSecret(context.Background(), "/secret/data/mydyndns")
+			assert.Equal(t, tt.expected, secret)
+			if tt.errContains != "" {
+				assert.EqualError(t, err, tt.errContains)
+				if tt.expectedErr != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewVaultBackendFromEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	_, err := NewVaultBackendFromEnv()
+	assert.EqualError(t, err, "VAULT_ADDR environment variable is not set")
+
+	t.Setenv("VAULT_ADDR", "https://vault.example.com:8200")
+	_, err = NewVaultBackendFromEnv()
+	assert.EqualError(t, err, "VAULT_TOKEN environment variable is not set")
+
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	b, err := NewVaultBackendFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "https://vault.example.com:8200", b.Address)
+	assert.Equal(t, "vault-token", b.Token)
+}
@@ -0,0 +1,61 @@
+// Package webhook provides notifications to external systems about IP address changes by way of HTTP webhooks.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Payload is the JSON-encoded body of a webhook request.
+type Payload struct {
+	PreviousIP string    `json:"previous_ip"`
+	NewIP      string    `json:"new_ip"`
+	Timestamp  time.Time `json:"ts"`
+}
+
+// Notifier delivers IP address change notifications by POSTing a JSON-encoded Payload to URL.
+type Notifier struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewNotifier returns a pointer to a new Notifier that delivers notifications to url.
+// Each delivery attempt fails if it does not complete within timeout.
+func NewNotifier(url string, timeout time.Duration) *Notifier {
+	return &Notifier{
+		URL:        url,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify delivers a notification that the IP address changed from previous to current at ts.
+// Any response with a non-2xx HTTP status code is considered to be a failed delivery.
+func (n *Notifier) Notify(ctx context.Context, previous, current net.IP, ts time.Time) error {
+	body, err := json.Marshal(Payload{PreviousIP: previous.String(), NewIP: current.String(), Timestamp: ts})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded with unexpected status code %d (%s)",
+			n.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierNotify(t *testing.T) {
+	ts := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name        string
+		respStatus  int
+		respDelay   time.Duration
+		expectedErr func(s *httptest.Server) string
+	}{
+		{
+			"success",
+			http.StatusOK,
+			0,
+			func(*httptest.Server) string { return "" },
+		},
+		{
+			"success with no content",
+			http.StatusNoContent,
+			0,
+			func(*httptest.Server) string { return "" },
+		},
+		{
+			"failure on unexpected status",
+			http.StatusInternalServerError,
+			0,
+			func(s *httptest.Server) string {
+				return "webhook " + s.URL + " responded with unexpected status code 500 (Internal Server Error)"
+			},
+		},
+		{
+			"failure on timeout",
+			http.StatusOK,
+			time.Millisecond * 200,
+			func(*httptest.Server) string { return "Client.Timeout exceeded" },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "application/json", req.Header.Get("content-type"))
+
+				var payload Payload
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, Payload{PreviousIP: "1.2.3.4", NewIP: "9.8.7.6", Timestamp: ts}, payload)
+
+				time.Sleep(tt.respDelay)
+				resp.WriteHeader(tt.respStatus)
+			}))
+			defer server.Close()
+
+			n := NewNotifier(server.URL, time.Millisecond*100)
+			err := n.Notify(context.Background(), net.ParseIP("1.2.3.4"), net.ParseIP("9.8.7.6"), ts)
+			if expectedErr := tt.expectedErr(server); expectedErr != "" {
+				assert.ErrorContains(t, err, expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("failure on unreachable URL", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		n := NewNotifier(server.URL, time.Second)
+		err := n.Notify(context.Background(), net.ParseIP("1.2.3.4"), net.ParseIP("9.8.7.6"), ts)
+		assert.Error(t, err)
+	})
+}